@@ -1,19 +1,83 @@
 #!/bin/bash
 set -e
 
-git clone /upstream /workspace/repo
-cd /workspace/repo
-if [ -n "$GIT_AUTHOR_NAME" ]; then
-  git config user.name "$GIT_AUTHOR_NAME"
+# Task lock directory, substituted into the system prompt.
+export TASK_LOCK_DIR="${TASK_LOCK_DIR:-current_tasks}"
+
+if [ -n "$CLONE_DEPTH" ]; then
+  # Shallow clones need a file:// URL, and --no-single-branch keeps agent branches visible.
+  git clone --depth "$CLONE_DEPTH" --no-single-branch file:///upstream /workspace/repo
 else
-  git config user.name "$(git log -1 --format='%an' 2>/dev/null || echo "agent-${AGENT_ID}")"
+  git clone /upstream /workspace/repo
 fi
-if [ -n "$GIT_AUTHOR_EMAIL" ]; then
-  git config user.email "$GIT_AUTHOR_EMAIL"
-else
-  git config user.email "$(git log -1 --format='%ae' 2>/dev/null || echo "agent-${AGENT_ID}@metamorph.local")"
+cd /workspace/repo
+# Commit as agent-N. With git.use_author_identity the daemon sets
+# GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL, which git uses for the author while
+# the committer stays agent-N.
+git config user.name "agent-${AGENT_ID}"
+git config user.email "agent-${AGENT_ID}@metamorph.local"
+
+# Sign commits with a private copy of the host's GnuPG home (mounted
+# read-only), since gpg needs to write lock files and agent sockets.
+if [ "$GIT_SIGN_COMMITS" = "true" ]; then
+  if [ -d "$HOME/.gnupg-host" ]; then
+    mkdir -p "$HOME/.gnupg"
+    cp -r "$HOME/.gnupg-host/." "$HOME/.gnupg/"
+    chmod 700 "$HOME/.gnupg"
+  fi
+  git config commit.gpgsign true
+  # Without a key, git would look for one matching the agent-N committer,
+  # so fall back to the first secret key instead.
+  if [ -z "$GIT_SIGNING_KEY" ]; then
+    GIT_SIGNING_KEY="$(gpg --list-secret-keys --with-colons 2>/dev/null | awk -F: '$1 == "sec" { print $5; exit }')"
+  fi
+  if [ -n "$GIT_SIGNING_KEY" ]; then
+    git config user.signingkey "$GIT_SIGNING_KEY"
+  fi
 fi
 
+# In branch-per-agent mode, work on our own branch (continuing it if it was
+# already pushed). We still rebase onto the default branch each session, so
+# pushes to our branch must be forced; the daemon merges it into main.
+PUSH_FLAGS=""
+if [ -n "$AGENT_BRANCH" ]; then
+  if git rev-parse --verify -q "origin/${AGENT_BRANCH}" >/dev/null; then
+    git checkout -B "$AGENT_BRANCH" "origin/${AGENT_BRANCH}"
+  else
+    git checkout -b "$AGENT_BRANCH"
+  fi
+  PUSH_FLAGS="--force"
+fi
+
+# A [docker] command override runs in place of the session loop below, in
+# the prepared clone.
+if [ "$#" -gt 0 ]; then
+  exec "$@"
+fi
+
+# On shutdown the daemon writes DRAIN_FILE and waits for DRAINED_FILE. We
+# finish the current session, push, then idle until the container is stopped
+# (exiting would just get us restarted by Docker's restart policy).
+DRAIN_FILE=/workspace/logs/.drain
+DRAINED_FILE=/workspace/logs/.drained
+rm -f "$DRAIN_FILE" "$DRAINED_FILE"
+
+check_drain() {
+  if [ -f "$DRAIN_FILE" ]; then
+    echo "[$(date)] Drain requested, idling until stopped" | tee -a "$LOG_FILE"
+    touch "$DRAINED_FILE"
+    exec sleep infinity
+  fi
+}
+
+# pause sleeps for $1 seconds, draining if asked to in the meantime.
+pause() {
+  for _ in $(seq "$1"); do
+    check_drain
+    sleep 1
+  done
+}
+
 SESSION=0
 while true; do
   SESSION=$((SESSION + 1))
@@ -46,17 +110,19 @@ while true; do
   fi
 
   # Push any commits the agent made during this session.
-  if ! git push origin HEAD 2>&1 | tee -a "$LOG_FILE"; then
+  if ! git push $PUSH_FLAGS origin HEAD 2>&1 | tee -a "$LOG_FILE"; then
     echo "[$(date)] Push failed, pulling and retrying..." | tee -a "$LOG_FILE"
     git pull --rebase origin HEAD 2>&1 | tee -a "$LOG_FILE" || true
-    git push origin HEAD 2>&1 | tee -a "$LOG_FILE" || true
+    git push $PUSH_FLAGS origin HEAD 2>&1 | tee -a "$LOG_FILE" || true
   fi
 
+  check_drain
+
   if [ "$SESSION_DURATION" -lt 30 ]; then
     echo "[$(date)] Session lasted ${SESSION_DURATION}s (possible rate limit), backing off 300s..." | tee -a "$LOG_FILE"
-    sleep 300
+    pause 300
   else
     echo "[$(date)] Session $SESSION ended, restarting in 5s..." | tee -a "$LOG_FILE"
-    sleep 5
+    pause 5
   fi
 done
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var agentsCmd = &cobra.Command{
+	Use:   "agents",
+	Short: "List agent containers as Docker reports them",
+	Long: `List this project's agent containers straight from Docker, without
+reading the daemon's state file. Use it to check what is really running when
+'metamorph status' looks stale or the daemon is unresponsive.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+		if err != nil {
+			return fmt.Errorf("failed to create Docker client: %w", err)
+		}
+
+		return printLiveAgents(context.Background(), dockerClient, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentsCmd)
+}
+
+// printLiveAgents writes a table of the project's agent containers, as
+// listed by Docker, to out.
+func printLiveAgents(ctx context.Context, client docker.DockerClient, out io.Writer) error {
+	agents, err := client.ListAgents(ctx)
+	if err != nil {
+		return err
+	}
+	if len(agents) == 0 {
+		_, _ = fmt.Fprintln(out, "No agent containers found.")
+		return nil
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "AGENT\tCONTAINER\tROLE\tSTATUS\tSTARTED")
+	for _, a := range agents {
+		containerID := a.ContainerID
+		if len(containerID) > 12 {
+			containerID = containerID[:12]
+		}
+		role := a.Role
+		if role == "" {
+			role = "-"
+		}
+		started := "-"
+		if !a.StartedAt.IsZero() {
+			started = a.StartedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		_, _ = fmt.Fprintf(w, "agent-%d\t%s\t%s\t%s\t%s\n", a.ID, containerID, role, a.Status, started)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <agent-id>",
+	Short: "Stream an agent container's live output",
+	Long: `Stream the live stdout and stderr of an agent's container, formatted like
+'metamorph logs'. Unlike 'logs', which reads session log files from disk,
+this shows exactly what the container is printing, including stderr.
+Press Ctrl-C to detach; the agent keeps running.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid agent ID %q: must be a number", args[0])
+		}
+		tail, _ := cmd.Flags().GetInt("tail")
+
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+		if err != nil {
+			return fmt.Errorf("failed to create Docker client: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		return attachLogs(ctx, dockerClient, agentID, tail, os.Stdout)
+	},
+}
+
+func init() {
+	attachCmd.Flags().Int("tail", 50, "Number of recent lines to show before streaming (0 for all)")
+	rootCmd.AddCommand(attachCmd)
+}
+
+// attachLogs follows the container output of agentID, writing each line
+// through formatLogLine to out until the stream ends or ctx is cancelled.
+// Cancellation is a clean detach, not an error.
+func attachLogs(ctx context.Context, client docker.DockerClient, agentID, tail int, out io.Writer) error {
+	stream, err := client.GetLogs(ctx, agentID, tail, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+
+	// Closing the stream unblocks the scanner when the user detaches.
+	go func() {
+		<-ctx.Done()
+		_ = stream.Close()
+	}()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if line, ok := formatLogLine(scanner.Text()); ok {
+			_, _ = fmt.Fprintln(out, line)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("log stream for agent-%d failed: %w", agentID, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/daemon"
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove all metamorph state, agent containers and logs",
+	Long: `Reset the project by removing agent containers, the .metamorph/ directory
+(upstream repo, state, build context) and agent_logs/. metamorph.toml,
+AGENT_PROMPT.md and your own files are kept.
+
+Agent commits that have not been synced to the project are lost; run
+'metamorph sync' first if you want to keep them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		if daemon.IsRunning(projectDir) {
+			force, _ := cmd.Flags().GetBool("force")
+			if !force {
+				return fmt.Errorf("daemon is running; stop it with 'metamorph stop' or re-run with --force")
+			}
+			fmt.Println("Stopping metamorph daemon...")
+			if err := daemon.Stop(projectDir); err != nil {
+				return fmt.Errorf("failed to stop daemon: %w", err)
+			}
+		}
+
+		dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+		if err != nil {
+			fmt.Printf("Warning: agent containers were not removed: %v\n", err)
+		} else {
+			if err := dockerClient.StopAllAgents(context.Background()); err != nil {
+				return fmt.Errorf("failed to remove agent containers: %w", err)
+			}
+			fmt.Println("Removed agent containers")
+		}
+
+		removed, err := removeProjectState(projectDir)
+		for _, path := range removed {
+			fmt.Printf("Removed %s/\n", path)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("\nProject cleaned. Run 'metamorph start' to begin again.")
+		return nil
+	},
+}
+
+func init() {
+	cleanCmd.Flags().Bool("force", false, "Stop a running daemon before cleaning")
+	rootCmd.AddCommand(cleanCmd)
+}
+
+// removeProjectState deletes the directories metamorph generates inside a
+// project and returns the ones that existed and were removed.
+func removeProjectState(projectDir string) ([]string, error) {
+	var removed []string
+	for _, dir := range []string{constants.MetamorphDir, constants.AgentLogDir} {
+		path := filepath.Join(projectDir, dir)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
@@ -2,14 +2,24 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/robmorgan/metamorph/internal/config"
 	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/daemon"
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/robmorgan/metamorph/internal/tasks"
 )
 
 // testProject creates a temp dir with a valid metamorph.toml, AGENT_PROMPT.md,
@@ -212,6 +222,72 @@ func TestInitCreatesAllFiles(t *testing.T) {
 	}
 }
 
+func TestInitAgentsAndRoles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "flags-project")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitExec(t, dir, "init")
+
+	defer func() {
+		_ = initCmd.Flags().Set("agents", "0")
+		_ = initCmd.Flags().Set("roles", "")
+	}()
+
+	rootCmd.SetArgs([]string{"init", dir, "--agents", "3", "--roles", "developer, tester"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	cfg, err := config.Load(filepath.Join(dir, "metamorph.toml"))
+	if err != nil {
+		t.Fatalf("generated config does not load: %v", err)
+	}
+	if cfg.Agents.Count != 3 {
+		t.Errorf("Count = %d, want 3", cfg.Agents.Count)
+	}
+	if want := []string{"developer", "tester"}; !reflect.DeepEqual(cfg.Agents.Roles, want) {
+		t.Errorf("Roles = %v, want %v", cfg.Agents.Roles, want)
+	}
+}
+
+func TestInitAgents(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		roles     string
+		wantCount int
+		wantRoles []string
+		wantErr   string
+	}{
+		{name: "defaults", wantCount: 4, wantRoles: []string{"developer", "developer", "tester", "refactorer"}},
+		{name: "count trims default roles", count: 2, wantCount: 2, wantRoles: []string{"developer", "developer"}},
+		{name: "count repeats default roles", count: 5, wantCount: 5, wantRoles: []string{"developer", "developer", "tester", "refactorer", "developer"}},
+		{name: "one agent per role", roles: "tester,reviewer", wantCount: 2, wantRoles: []string{"tester", "reviewer"}},
+		{name: "unknown role", roles: "developer,tseter", wantErr: `invalid agent role: "tseter"`},
+		{name: "more roles than agents", count: 1, roles: "developer,tester", wantErr: "--roles lists 2 roles but --agents is 1"},
+		{name: "negative count", count: -1, wantErr: "--agents must be greater than 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, roles, err := initAgents(tt.count, tt.roles)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("initAgents: %v", err)
+			}
+			if count != tt.wantCount || !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("initAgents = %d %v, want %d %v", count, roles, tt.wantCount, tt.wantRoles)
+			}
+		})
+	}
+}
+
 func TestInitPreservesExistingPrompt(t *testing.T) {
 	dir := filepath.Join(t.TempDir(), "existing-project")
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -263,6 +339,195 @@ func TestInitRejectsExistingProject(t *testing.T) {
 	}
 }
 
+func TestInitMinimal(t *testing.T) {
+	dir := t.TempDir()
+	gitExec(t, dir, "init")
+	gitExec(t, dir, "config", "user.name", "test")
+	gitExec(t, dir, "config", "user.email", "test@test")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitExec(t, dir, "add", ".")
+	gitExec(t, dir, "commit", "-m", "initial commit")
+
+	defer func() { _ = initCmd.Flags().Set("minimal", "false") }()
+	rootCmd.SetArgs([]string{"init", dir, "--minimal"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("init --minimal: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "metamorph.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "[docker]") {
+		t.Errorf("minimal metamorph.toml has a [docker] section:\n%s", data)
+	}
+	if _, err := loadConfig(dir); err != nil {
+		t.Fatalf("minimal config does not load: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, constants.AgentPromptFile)); err != nil {
+		t.Errorf("expected AGENT_PROMPT.md: %v", err)
+	}
+
+	// 'run' works against it: a stand-in claude commits a file, and the
+	// session's commit is pushed to the upstream init created.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho done > done.txt\n"
+	if err := os.WriteFile(filepath.Join(bin, "claude"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("ANTHROPIC_API_KEY", "sk-test-dummy")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@test")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@test")
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() { _ = runCmd.Flags().Set("once", "false") }()
+
+	rootCmd.SetArgs([]string{"run", "--once"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("run --once: %v", err)
+	}
+	upstream := filepath.Join(dir, constants.UpstreamDir)
+	if got := gitOutput(t, upstream, "log", "-1", "--format=%s"); got != "metamorph: auto-commit uncommitted changes" {
+		t.Errorf("upstream tip = %q, want the run session's commit", got)
+	}
+
+	t.Run("rejects --agents", func(t *testing.T) {
+		defer func() {
+			_ = initCmd.Flags().Set("minimal", "false")
+			_ = initCmd.Flags().Set("agents", "0")
+		}()
+		rootCmd.SetArgs([]string{"init", t.TempDir(), "--minimal", "--agents", "2"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--minimal cannot be combined") {
+			t.Errorf("expected --minimal/--agents error, got %v", err)
+		}
+	})
+}
+
+func TestInitForce(t *testing.T) {
+	runInit := func(t *testing.T, args ...string) error {
+		t.Helper()
+		defer func() {
+			_ = initCmd.Flags().Set("force", "false")
+			_ = initCmd.Flags().Set("reset-upstream", "false")
+		}()
+		rootCmd.SetArgs(append([]string{"init"}, args...))
+		return rootCmd.Execute()
+	}
+
+	t.Run("reinitializes an existing project", func(t *testing.T) {
+		dir := testProject(t)
+		gitExec(t, dir, "init")
+		gitExec(t, dir, "config", "user.name", "test")
+		gitExec(t, dir, "config", "user.email", "test@test")
+		gitExec(t, dir, "add", ".")
+		gitExec(t, dir, "commit", "-m", "initial commit")
+		prompt, _ := os.ReadFile(filepath.Join(dir, constants.AgentPromptFile))
+		progress, _ := os.ReadFile(filepath.Join(dir, constants.ProgressFile))
+
+		if err := runInit(t, dir, "--force"); err != nil {
+			t.Fatalf("init --force: %v", err)
+		}
+
+		if got, _ := os.ReadFile(filepath.Join(dir, constants.AgentPromptFile)); string(got) != string(prompt) {
+			t.Errorf("AGENT_PROMPT.md was overwritten, got %q", got)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, constants.ProgressFile)); string(got) != string(progress) {
+			t.Errorf("PROGRESS.md was overwritten, got %q", got)
+		}
+		backups, _ := filepath.Glob(filepath.Join(dir, "metamorph.toml.*.bak"))
+		if len(backups) != 1 {
+			t.Fatalf("backups = %q, want one", backups)
+		}
+		if backup, err := os.ReadFile(backups[0]); err != nil || !strings.Contains(string(backup), "test-proj") {
+			t.Errorf("%s = %q, %v; want the previous config", backups[0], backup, err)
+		}
+		for _, d := range []string{constants.TaskLockDir, constants.AgentLogDir} {
+			if _, err := os.Stat(filepath.Join(dir, d)); err != nil {
+				t.Errorf("expected %s to be recreated: %v", d, err)
+			}
+		}
+		gitExec(t, filepath.Join(dir, constants.UpstreamDir), "rev-parse", "HEAD")
+	})
+
+	t.Run("invalid flags leave the config alone", func(t *testing.T) {
+		dir := testProjectWithUpstream(t)
+		before, _ := os.ReadFile(filepath.Join(dir, "metamorph.toml"))
+		defer func() { _ = initCmd.Flags().Set("roles", "") }()
+
+		if err := runInit(t, dir, "--force", "--roles", "wizard"); err == nil || !strings.Contains(err.Error(), "invalid agent role") {
+			t.Fatalf("expected an invalid role error, got %v", err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, "metamorph.toml")); string(got) != string(before) {
+			t.Errorf("metamorph.toml changed after a failed init: %q", got)
+		}
+		if backups, _ := filepath.Glob(filepath.Join(dir, "metamorph.toml.*.bak")); len(backups) != 0 {
+			t.Errorf("backups = %q, want none after a failed init", backups)
+		}
+	})
+
+	t.Run("repeated re-inits keep every backup", func(t *testing.T) {
+		dir := testProjectWithUpstream(t)
+		for range 2 {
+			if err := runInit(t, dir, "--force"); err != nil {
+				t.Fatalf("init --force: %v", err)
+			}
+		}
+		backups, _ := filepath.Glob(filepath.Join(dir, "metamorph.toml.*.bak"))
+		if len(backups) != 2 {
+			t.Fatalf("backups = %q, want two", backups)
+		}
+		var original bool
+		for _, b := range backups {
+			data, _ := os.ReadFile(b)
+			original = original || strings.Contains(string(data), "test-proj")
+		}
+		if !original {
+			t.Error("the original config was overwritten by a later backup")
+		}
+	})
+
+	t.Run("keeps a non-empty upstream without --reset-upstream", func(t *testing.T) {
+		dir := testProjectWithUpstream(t)
+		upstreamPath := filepath.Join(dir, constants.UpstreamDir)
+		marker := filepath.Join(upstreamPath, "marker")
+		if err := os.WriteFile(marker, []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := runInit(t, dir, "--force"); err != nil {
+			t.Fatalf("init --force: %v", err)
+		}
+		if _, err := os.Stat(marker); err != nil {
+			t.Errorf("upstream was recreated without --reset-upstream: %v", err)
+		}
+
+		if err := runInit(t, dir, "--force", "--reset-upstream"); err != nil {
+			t.Fatalf("init --force --reset-upstream: %v", err)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("upstream was not recreated with --reset-upstream: %v", err)
+		}
+		gitExec(t, upstreamPath, "rev-parse", "HEAD")
+	})
+
+	t.Run("reset-upstream requires force", func(t *testing.T) {
+		dir := testProject(t)
+		err := runInit(t, dir, "--reset-upstream")
+		if err == nil || !strings.Contains(err.Error(), "requires --force") {
+			t.Errorf("err = %v, want a --force requirement", err)
+		}
+	})
+}
+
 func TestStatusWithoutDaemon(t *testing.T) {
 	dir := testProject(t)
 
@@ -296,6 +561,144 @@ func TestStatusWithoutDaemon(t *testing.T) {
 	}
 }
 
+func TestPrintStatus(t *testing.T) {
+	task := "fix-login"
+	state := &daemon.State{
+		Status:      "running",
+		ProjectName: "test-proj",
+		Agents: []daemon.AgentState{
+			{ID: 1, Role: "developer", Status: "running", CurrentTask: &task, CPUPercent: 87.25, MemoryBytes: 512 << 20,
+				StartedAt: time.Now().Add(-90 * time.Minute), RestartCount: 3},
+			{ID: 2, Role: "tester", Status: "exited"},
+		},
+		Stats: daemon.Stats{TotalCommits: 7, TotalSessions: 3, TasksCompleted: 2},
+	}
+
+	var buf bytes.Buffer
+	printStatus(&buf, state)
+	output := buf.String()
+
+	for _, want := range []string{
+		"Project:  test-proj",
+		"AGENT",
+		"fix-login",
+		"87.2%",
+		"512.0MiB",
+		"UPTIME",
+		"RESTARTS",
+		"1h 30m",
+		"  3  ",
+		"agent-2",
+		"Commits: 7  Sessions: 3  Tasks completed: 2",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Warning:") {
+		t.Errorf("unexpected stale warning for a running daemon:\n%s", output)
+	}
+	if strings.Contains(output, "Notify:") {
+		t.Errorf("unexpected notify line before any notification was sent:\n%s", output)
+	}
+
+	state.NotifyStatus = &daemon.NotifyStatus{LastAttempt: time.Now(), Event: "agent_crashed", Error: "webhook returned 404"}
+	buf.Reset()
+	printStatus(&buf, state)
+	if want := "Notify:   FAILED 0s ago (agent_crashed): webhook returned 404"; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+	}
+}
+
+func TestRenderTop(t *testing.T) {
+	task := "fix-login"
+	state := &daemon.State{
+		Status:      "running",
+		ProjectName: "test-proj",
+		Agents: []daemon.AgentState{
+			{ID: 1, Role: "developer", Status: "running", CurrentTask: &task, TaskDescription: "session expiry",
+				SessionsCompleted: 4, CPUPercent: 10, MemoryBytes: 64 << 20},
+			{ID: 2, Role: "tester", Status: "running", CPUPercent: 33.3, MemoryBytes: 256 << 20},
+			{ID: 3, Role: "developer", Status: "exited"},
+		},
+		Stats: daemon.Stats{TotalCommits: 7, TotalSessions: 3, TasksCompleted: 2},
+	}
+
+	t.Run("live stats", func(t *testing.T) {
+		var buf bytes.Buffer
+		renderTop(&buf, topFrame{
+			State:         state,
+			Stats:         map[int]docker.AgentStats{1: {CPUPercent: 150, MemoryBytes: 512 << 20, MemoryLimit: 2048 << 20}},
+			RecentCommits: 5,
+			Interval:      2 * time.Second,
+			Now:           time.Now(),
+		})
+		output := buf.String()
+
+		for _, want := range []string{
+			"metamorph top - test-proj",
+			"Commits: 7 (5 in the last hour)",
+			"150.0%",
+			"512.0MiB",
+			"25.0%",
+			"fix-login (session expiry)",
+			// Agent 2 has no live sample, so the daemon's last one is shown.
+			"33.3%",
+			"256.0MiB",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, output)
+			}
+		}
+		if strings.Contains(output, "Live stats unavailable") {
+			t.Errorf("unexpected fallback notice with live stats:\n%s", output)
+		}
+	})
+
+	t.Run("stats unavailable", func(t *testing.T) {
+		var buf bytes.Buffer
+		renderTop(&buf, topFrame{
+			State:         state,
+			StatsErr:      errors.New("cannot connect"),
+			RecentCommits: -1,
+			Interval:      2 * time.Second,
+			Now:           time.Now(),
+		})
+		output := buf.String()
+
+		for _, want := range []string{
+			"Live stats unavailable (cannot connect)",
+			"Commits: 7 (- in the last hour)",
+			"10.0%",
+			"64.0MiB",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, output)
+			}
+		}
+	})
+}
+
+func TestStatusWatchRejectsJSON(t *testing.T) {
+	dir := testProject(t)
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() {
+		_ = statusCmd.Flags().Set("watch", "false")
+		_ = statusCmd.Flags().Set("json", "false")
+	}()
+
+	rootCmd.SetArgs([]string{"status", "--watch", "--json"})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--watch cannot be combined with --json") {
+		t.Errorf("expected --watch/--json error, got %v", err)
+	}
+}
+
 func TestTasksWithNoLocks(t *testing.T) {
 	dir := testProjectWithUpstream(t)
 
@@ -362,6 +765,52 @@ func TestPromptShow(t *testing.T) {
 	}
 }
 
+func TestPromptValidate(t *testing.T) {
+	dir := testProject(t)
+	t.Setenv("METAMORPH_TEST_TOKEN", "x")
+
+	prompt := "# Agent ${AGENT_ID}\nRole: ${AGENT_ROLE}\nName: ${AGENT_NAME}, token ${METAMORPH_TEST_TOKEN}\n"
+	if err := os.WriteFile(filepath.Join(dir, constants.AgentPromptFile), []byte(prompt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rolePrompt := "Model: ${AGENT_MODEL}\n\nBranch: ${AGENT_BRANCHH}\n"
+	if err := os.WriteFile(filepath.Join(dir, "AGENT_PROMPT.tester.md"), []byte(rolePrompt), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := validatePrompts(dir, &buf)
+	if err == nil || !strings.Contains(err.Error(), "found 2 unknown placeholder(s)") {
+		t.Fatalf("expected 2 unknown placeholders, got %v", err)
+	}
+	for _, want := range []string{
+		"AGENT_PROMPT.md:3: unknown placeholder ${AGENT_NAME}",
+		"AGENT_PROMPT.tester.md:3: unknown placeholder ${AGENT_BRANCHH}",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "unknown placeholder ${METAMORPH_TEST_TOKEN}") {
+		t.Errorf("environment variables should be known:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "AGENT_PROMPT.md:3: note: ${METAMORPH_TEST_TOKEN} is only set on this host") {
+		t.Errorf("output should note that host variables are empty in Docker agents:\n%s", buf.String())
+	}
+
+	// Fixing the typos makes validation pass.
+	if err := os.WriteFile(filepath.Join(dir, constants.AgentPromptFile), []byte("# Agent ${AGENT_ID}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "AGENT_PROMPT.tester.md")); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := validatePrompts(dir, &buf); err != nil {
+		t.Fatalf("validatePrompts: %v\n%s", err, buf.String())
+	}
+}
+
 func TestStartDryRun(t *testing.T) {
 	dir := testProjectWithUpstream(t)
 
@@ -401,6 +850,84 @@ func TestStartDryRun(t *testing.T) {
 	}
 }
 
+func TestStartDryRun_DotEnvInConfig(t *testing.T) {
+	dir := testProjectWithUpstream(t)
+	data, _ := os.ReadFile(filepath.Join(dir, "metamorph.toml"))
+	data = []byte(strings.Replace(string(data), `model = "claude-sonnet"`, `model = "${METAMORPH_TEST_MODEL}"`, 1))
+	if err := os.WriteFile(filepath.Join(dir, "metamorph.toml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, dotEnvFile), []byte("METAMORPH_TEST_MODEL=claude-from-dotenv\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	gitExec(t, dir, "add", "-f", ".")
+	gitExec(t, dir, "commit", "-m", "use .env")
+
+	// t.Setenv restores the original value; unset it for the test.
+	t.Setenv("METAMORPH_TEST_MODEL", "")
+	_ = os.Unsetenv("METAMORPH_TEST_MODEL")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-test-dummy")
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"start", "--dry-run"})
+	err := rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	if err != nil {
+		t.Fatalf("start --dry-run: %v", err)
+	}
+	if !strings.Contains(buf.String(), "claude-from-dotenv") {
+		t.Errorf("expected the model from .env in output, got: %q", buf.String())
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	dir := testProjectWithUpstream(t)
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() { _ = syncCmd.Flags().Set("dry-run", "false") }()
+
+	headBefore := gitOutput(t, dir, "rev-parse", "HEAD")
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"sync", "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("sync --dry-run: %v", err)
+	}
+
+	if output := buf.String(); !strings.Contains(output, "Commits that would be synced") || !strings.Contains(output, "seed scaffold files") {
+		t.Errorf("expected the pending upstream commit in output, got: %q", output)
+	}
+	if head := gitOutput(t, dir, "rev-parse", "HEAD"); head != headBefore {
+		t.Errorf("HEAD moved from %s to %s on a dry run", headBefore, head)
+	}
+	if _, err := os.Stat(filepath.Join(dir, constants.TaskLockDir, ".gitkeep")); !os.IsNotExist(err) {
+		t.Errorf("dry run changed the working tree: .gitkeep stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".metamorph", "work")); !os.IsNotExist(err) {
+		t.Errorf("dry run created the working copy: stat err = %v", err)
+	}
+}
+
 func TestStartRejectsDirtyTree(t *testing.T) {
 	dir := testProjectWithUpstream(t)
 
@@ -506,3 +1033,1073 @@ func TestFormatRelativeTime(t *testing.T) {
 		}
 	}
 }
+
+func TestDoctorChecks(t *testing.T) {
+	t.Run("docker", func(t *testing.T) {
+		if r := checkDocker(func() error { return nil }); !r.OK {
+			t.Error("expected docker check to pass")
+		}
+		r := checkDocker(func() error { return fmt.Errorf("connection refused") })
+		if r.OK || !r.Critical || !strings.Contains(r.Hint, "connection refused") {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	})
+
+	t.Run("git", func(t *testing.T) {
+		if r := checkGit(func(string) (string, error) { return "/usr/bin/git", nil }); !r.OK {
+			t.Error("expected git check to pass")
+		}
+		if r := checkGit(func(string) (string, error) { return "", exec.ErrNotFound }); r.OK {
+			t.Error("expected git check to fail")
+		}
+	})
+
+	t.Run("project files", func(t *testing.T) {
+		dir := testProject(t)
+		if r := checkConfigFile(dir); !r.OK {
+			t.Errorf("checkConfigFile: %+v", r)
+		}
+		if r := checkAgentPrompt(dir); !r.OK {
+			t.Errorf("checkAgentPrompt: %+v", r)
+		}
+
+		empty := t.TempDir()
+		if r := checkConfigFile(empty); r.OK || !strings.Contains(r.Hint, "metamorph init") {
+			t.Errorf("checkConfigFile on empty dir: %+v", r)
+		}
+		if r := checkAgentPrompt(empty); r.OK {
+			t.Errorf("checkAgentPrompt on empty dir: %+v", r)
+		}
+
+		_ = os.WriteFile(filepath.Join(empty, "metamorph.toml"), []byte("[project]\n"), 0644)
+		if r := checkConfigFile(empty); r.OK || !strings.Contains(r.Hint, "project.name is required") {
+			t.Errorf("checkConfigFile on invalid config: %+v", r)
+		}
+	})
+
+	t.Run("upstream is not critical", func(t *testing.T) {
+		r := checkUpstream(t.TempDir())
+		if r.OK || r.Critical {
+			t.Errorf("unexpected result: %+v", r)
+		}
+		if r := checkUpstream(testProjectWithUpstream(t)); !r.OK {
+			t.Errorf("checkUpstream: %+v", r)
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		env := map[string]string{}
+		getenv := func(k string) string { return env[k] }
+
+		dir := t.TempDir()
+		if r := checkCredentials(getenv, dir); r.OK {
+			t.Error("expected credentials check to fail with no env vars")
+		}
+		env["ANTHROPIC_API_KEY"] = "sk-test"
+		if r := checkCredentials(getenv, dir); !r.OK {
+			t.Error("expected credentials check to pass with ANTHROPIC_API_KEY")
+		}
+	})
+
+	t.Run("credential files", func(t *testing.T) {
+		env := map[string]string{}
+		getenv := func(k string) string { return env[k] }
+
+		dir := testProject(t)
+		if err := os.WriteFile(filepath.Join(dir, "oauth_token"), []byte("token-from-file\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, "metamorph.toml"), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.WriteString("\n[credentials]\noauth_token_file = \"oauth_token\"\n")
+		_ = f.Close()
+
+		if r := checkCredentials(getenv, dir); !r.OK {
+			t.Errorf("expected credentials check to pass with oauth_token_file: %+v", r)
+		}
+
+		cfg, err := loadConfig(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, token, err := resolveCredentials(getenv, cfg, dir)
+		if err != nil || token != "token-from-file" {
+			t.Errorf("resolveCredentials = %q, %v; want token from file", token, err)
+		}
+		env["CLAUDE_CODE_OAUTH_TOKEN"] = "token-from-env"
+		if _, token, _ := resolveCredentials(getenv, cfg, dir); token != "token-from-env" {
+			t.Errorf("token = %q, want the environment to take precedence", token)
+		}
+	})
+}
+
+func TestLoadDotEnv(t *testing.T) {
+	dir := testProject(t)
+	env := "# credentials for local runs\n\nexport ANTHROPIC_API_KEY=\"key-from-dotenv\"\nMETAMORPH_TEST_DOTENV=from-file\n"
+	if err := os.WriteFile(filepath.Join(dir, dotEnvFile), []byte(env), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// t.Setenv restores the original values; unset them for the test.
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	_ = os.Unsetenv("ANTHROPIC_API_KEY")
+	t.Setenv("CLAUDE_CODE_OAUTH_TOKEN", "")
+	_ = os.Unsetenv("CLAUDE_CODE_OAUTH_TOKEN")
+	t.Setenv("METAMORPH_TEST_DOTENV", "already-set")
+
+	if err := loadDotEnv(dir); err != nil {
+		t.Fatalf("loadDotEnv: %v", err)
+	}
+
+	cfg, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, _, err := resolveCredentials(os.Getenv, cfg, dir)
+	if err != nil || apiKey != "key-from-dotenv" {
+		t.Errorf("resolveCredentials = %q, %v; want the key from .env", apiKey, err)
+	}
+	if got := os.Getenv("METAMORPH_TEST_DOTENV"); got != "already-set" {
+		t.Errorf("METAMORPH_TEST_DOTENV = %q, want the existing value kept", got)
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if err := loadDotEnv(t.TempDir()); err != nil {
+			t.Errorf("loadDotEnv without a .env file: %v", err)
+		}
+	})
+
+	t.Run("malformed line", func(t *testing.T) {
+		bad := t.TempDir()
+		if err := os.WriteFile(filepath.Join(bad, dotEnvFile), []byte("# ok\nNOT_A_PAIR\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadDotEnv(bad); err == nil || !strings.Contains(err.Error(), ".env:2") {
+			t.Errorf("expected an error naming line 2, got %v", err)
+		}
+	})
+}
+
+func TestLogsAll(t *testing.T) {
+	dir := testProject(t)
+	for id, content := range map[int]string{
+		1: "old session\n",
+		2: "agent two line\n",
+	} {
+		logDir := filepath.Join(dir, constants.AgentLogDir, fmt.Sprintf("agent-%d", id))
+		if err := os.MkdirAll(logDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte(content), 0644)
+	}
+	_ = os.WriteFile(filepath.Join(dir, constants.AgentLogDir, "agent-1", "session-2.log"), []byte("agent one line\n"), 0644)
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+
+	// Capture stdout.
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"logs", "--all"})
+	err := rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("logs --all: %v", err)
+	}
+
+	want := "[agent-1] agent one line\n[agent-2] agent two line\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+}
+
+func TestReadNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session-1.log")
+	_ = os.WriteFile(path, []byte("first\n"), 0644)
+
+	lines, offset := readNewLines(path, 0)
+	if len(lines) != 2 || lines[0] != "first" || offset != 6 {
+		t.Errorf("readNewLines = %q, %d", lines, offset)
+	}
+
+	lines, offset = readNewLines(path, offset)
+	if lines != nil || offset != 6 {
+		t.Errorf("expected no new lines, got %q, %d", lines, offset)
+	}
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString("second\n")
+	_ = f.Close()
+
+	lines, offset = readNewLines(path, offset)
+	if len(lines) != 2 || lines[0] != "second" || offset != 13 {
+		t.Errorf("readNewLines after append = %q, %d", lines, offset)
+	}
+
+	// Rotation truncates the file; reading starts over rather than waiting
+	// for it to grow past the old offset.
+	_ = os.WriteFile(path, []byte("third\n"), 0644)
+	lines, offset = readNewLines(path, offset)
+	if len(lines) != 2 || lines[0] != "third" || offset != 6 {
+		t.Errorf("readNewLines after truncation = %q, %d", lines, offset)
+	}
+}
+
+func TestJSONLogLine(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		line   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "stream event keeps fields",
+			line:   `{"type":"stream_event", "event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}}`,
+			want:   `{"agent_id":2,"event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}},"timestamp":"2025-06-15T10:00:00Z","type":"stream_event"}`,
+			wantOK: true,
+		},
+		{
+			name:   "raw line is wrapped",
+			line:   "=== Session 3 starting ===",
+			want:   `{"agent_id":2,"text":"=== Session 3 starting ===","timestamp":"2025-06-15T10:00:00Z","type":"raw"}`,
+			wantOK: true,
+		},
+		{
+			name:   "invalid JSON is wrapped",
+			line:   "{not json",
+			want:   `{"agent_id":2,"text":"{not json","timestamp":"2025-06-15T10:00:00Z","type":"raw"}`,
+			wantOK: true,
+		},
+		{
+			name: "blank line is skipped",
+			line: "   ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := jsonLogLine(2, tt.line, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("jsonLogLine =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecentLines(t *testing.T) {
+	cutoff := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+	event := func(ts, text string) string {
+		return fmt.Sprintf(`{"type":"stream_event","timestamp":%q,"event":{"type":"content_block_delta","delta":{"type":"text_delta","text":%q}}}`, ts, text)
+	}
+	lines := []string{
+		"=== Session 3 starting ===",
+		event("2025-06-15T09:50:00Z", "old"),
+		"raw after old",
+		event("2025-06-15T10:05:00Z", "new"),
+		"raw after new",
+		event("2025-06-15T10:06:00.5Z", "newer"),
+	}
+
+	tests := []struct {
+		name   string
+		tail   int
+		cutoff time.Time
+		want   []string
+	}{
+		{
+			name: "no cutoff keeps everything",
+			want: lines,
+		},
+		{
+			name:   "cutoff drops older events and their raw lines",
+			cutoff: cutoff,
+			want:   lines[3:],
+		},
+		{
+			name:   "tail applies after the cutoff",
+			tail:   2,
+			cutoff: cutoff,
+			want:   lines[4:],
+		},
+		{
+			name:   "nothing newer than the cutoff",
+			cutoff: cutoff.Add(time.Hour),
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recentLines(lines, tt.tail, tt.cutoff)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recentLines =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogClock(t *testing.T) {
+	event := func(ts, text string) string {
+		return fmt.Sprintf(`{"type":"stream_event","timestamp":%q,"event":{"type":"content_block_delta","delta":{"type":"text_delta","text":%q}}}`, ts, text)
+	}
+	local := func(s string) string {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts.Local().Format("15:04:05")
+	}
+	anchor := time.Date(2025, 6, 15, 11, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		mode   string
+		anchor time.Time
+		lines  []string
+		want   []string
+	}{
+		{
+			name:   "raw lines before the first event take its time",
+			mode:   timestampsAbsolute,
+			anchor: anchor,
+			lines: []string{
+				"=== Session 3 starting ===",
+				event("2025-06-15T10:05:00Z", "first"),
+				"raw after first",
+				event("2025-06-15T10:06:30.5Z", "second"),
+			},
+			want: []string{
+				local("2025-06-15T10:05:00Z"),
+				local("2025-06-15T10:05:00Z"),
+				local("2025-06-15T10:05:00Z"),
+				local("2025-06-15T10:06:30Z"),
+			},
+		},
+		{
+			name:   "raw-only log uses the anchor",
+			mode:   timestampsAbsolute,
+			anchor: anchor,
+			lines:  []string{"one", "two"},
+			want:   []string{local("2025-06-15T11:00:00Z"), local("2025-06-15T11:00:00Z")},
+		},
+		{
+			name:  "no anchor falls back to now",
+			mode:  timestampsAbsolute,
+			lines: []string{"one"},
+			want:  []string{local("2025-06-15T12:00:00Z")},
+		},
+		{
+			name: "relative is measured from the first line",
+			mode: timestampsRelative,
+			lines: []string{
+				"=== Session 3 starting ===",
+				event("2025-06-15T10:05:00Z", "first"),
+				event("2025-06-15T11:07:09Z", "second"),
+				"raw after second",
+			},
+			want: []string{"+00:00:00", "+00:00:00", "+01:02:09", "+01:02:09"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &logClock{mode: tt.mode, anchor: tt.anchor}
+			c.prime(tt.lines)
+			var got []string
+			for _, line := range tt.lines {
+				got = append(got, c.stamp(line, now))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stamps = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClearStaleTasksMaxAge(t *testing.T) {
+	// writeLocks creates a working copy with locks claimed 30m and 3h ago.
+	writeLocks := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		lockDir := filepath.Join(dir, constants.TaskLockDir)
+		if err := os.MkdirAll(lockDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, age := range map[string]time.Duration{"recent": 30 * time.Minute, "old": 3 * time.Hour} {
+			content := fmt.Sprintf("agent-1 %s", time.Now().UTC().Add(-age).Format(time.RFC3339))
+			if err := os.WriteFile(filepath.Join(lockDir, name+".lock"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	remaining := func(t *testing.T, dir string) int {
+		t.Helper()
+		matches, _ := filepath.Glob(filepath.Join(dir, constants.TaskLockDir, "*.lock"))
+		return len(matches)
+	}
+
+	tests := []struct {
+		maxAge        time.Duration
+		wantRemaining int
+		wantPrompt    string
+	}{
+		{2 * time.Hour, 1, "older than 2h)"},
+		{10 * time.Minute, 0, "older than 10m)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.maxAge.String(), func(t *testing.T) {
+			dir := writeLocks(t)
+
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			err := clearStaleTasks(strings.NewReader("y\n"), dir, constants.TaskLockDir, tt.maxAge)
+
+			_ = w.Close()
+			os.Stdout = old
+
+			var buf bytes.Buffer
+			_, _ = buf.ReadFrom(r)
+
+			if err != nil {
+				t.Fatalf("clearStaleTasks: %v", err)
+			}
+			if got := remaining(t, dir); got != tt.wantRemaining {
+				t.Errorf("remaining locks = %d, want %d", got, tt.wantRemaining)
+			}
+			if !strings.Contains(buf.String(), tt.wantPrompt) {
+				t.Errorf("expected prompt to contain %q, got: %q", tt.wantPrompt, buf.String())
+			}
+		})
+	}
+}
+
+func TestTasksReleaseForce(t *testing.T) {
+	dir := testProjectWithUpstream(t)
+	upstreamPath := filepath.Join(dir, constants.UpstreamDir)
+
+	// The working copy commits the removal; give it an identity.
+	t.Setenv("GIT_AUTHOR_NAME", "operator")
+	t.Setenv("GIT_AUTHOR_EMAIL", "operator@test")
+	t.Setenv("GIT_COMMITTER_NAME", "operator")
+	t.Setenv("GIT_COMMITTER_EMAIL", "operator@test")
+
+	// Agent 2 holds a lock upstream.
+	agentDir := filepath.Join(t.TempDir(), "agent-2")
+	gitExec(t, filepath.Dir(agentDir), "clone", upstreamPath, agentDir)
+	lock := fmt.Sprintf("agent-2 %s", time.Now().UTC().Format(time.RFC3339))
+	if err := os.WriteFile(filepath.Join(agentDir, constants.TaskLockDir, "stuck.lock"), []byte(lock), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitExec(t, agentDir, "add", ".")
+	gitExec(t, agentDir, "commit", "-m", "claim stuck")
+	gitExec(t, agentDir, "push")
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() { _ = tasksReleaseCmd.Flags().Set("force", "false") }()
+
+	rootCmd.SetArgs([]string{"tasks", "release", "stuck"})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "held by agent-2") || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected --force error naming agent-2, got %v", err)
+	}
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"tasks", "release", "stuck", "--force"})
+	err = rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("tasks release --force: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Released stuck (held by agent-2") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	verifyDir := filepath.Join(t.TempDir(), "verify")
+	gitExec(t, filepath.Dir(verifyDir), "clone", upstreamPath, verifyDir)
+	if _, err := os.Stat(filepath.Join(verifyDir, constants.TaskLockDir, "stuck.lock")); !os.IsNotExist(err) {
+		t.Error("lock should be removed upstream after forced release")
+	}
+}
+
+func TestTasksClaim(t *testing.T) {
+	dir := testProjectWithUpstream(t)
+	upstreamPath := filepath.Join(dir, constants.UpstreamDir)
+
+	t.Setenv("GIT_AUTHOR_NAME", "operator")
+	t.Setenv("GIT_AUTHOR_EMAIL", "operator@test")
+	t.Setenv("GIT_COMMITTER_NAME", "operator")
+	t.Setenv("GIT_COMMITTER_EMAIL", "operator@test")
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() { _ = tasksClaimCmd.Flags().Set("agent", "0") }()
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"tasks", "claim", "seeded", "--agent", "3"})
+	err := rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("tasks claim: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Claimed seeded for agent-3") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	verifyDir := filepath.Join(t.TempDir(), "verify")
+	gitExec(t, filepath.Dir(verifyDir), "clone", upstreamPath, verifyDir)
+	data, err := os.ReadFile(filepath.Join(verifyDir, constants.TaskLockDir, "seeded.lock"))
+	if err != nil {
+		t.Fatalf("lock should be pushed upstream: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "agent-3 ") {
+		t.Errorf("lock content = %q, want agent-3 prefix", data)
+	}
+
+	// A second claim for the same task is refused.
+	rootCmd.SetArgs([]string{"tasks", "claim", "seeded", "--agent", "4"})
+	err = rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "held by agent-3") {
+		t.Fatalf("expected already-held error naming agent-3, got %v", err)
+	}
+
+	// Names that would escape the lock dir are rejected.
+	rootCmd.SetArgs([]string{"tasks", "claim", "../escape", "--agent", "4"})
+	err = rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "path separators") {
+		t.Fatalf("expected a path separator error, got %v", err)
+	}
+}
+
+func TestTasksHistory(t *testing.T) {
+	dir := testProject(t)
+	if err := os.MkdirAll(filepath.Join(dir, ".metamorph"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	history := `{"task":"add-login","agent_id":1,"event":"completed","timestamp":"2025-06-15T10:30:00Z"}
+{"task":"fix-bug","agent_id":2,"event":"cleared","timestamp":"2025-06-15T11:00:00Z"}
+`
+	if err := os.WriteFile(filepath.Join(dir, constants.TaskHistoryFile), []byte(history), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+	defer func() { _ = tasksCmd.Flags().Set("history", "false") }()
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"tasks", "--history"})
+	err := rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("tasks --history: %v", err)
+	}
+	for _, want := range []string{"add-login", "agent-1", "completed", "fix-bug", "cleared"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got: %q", want, output)
+		}
+	}
+	if strings.Index(output, "add-login") > strings.Index(output, "fix-bug") {
+		t.Errorf("expected oldest entry first, got: %q", output)
+	}
+}
+
+func TestTaskLocksJSON(t *testing.T) {
+	claimed := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+	locks := []tasks.TaskLock{{Name: "add-login", AgentID: 2, ClaimedAt: claimed, Priority: 1, Description: "login form"}}
+
+	data, err := json.Marshal(taskLocksJSON(locks, claimed.Add(90*time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d locks, want 1: %s", len(got), data)
+	}
+	want := map[string]interface{}{
+		"Name":        "add-login",
+		"AgentID":     float64(2),
+		"ClaimedAt":   "2025-06-15T10:00:00Z",
+		"Priority":    float64(1),
+		"Description": "login form",
+		"age_seconds": float64(5400),
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("lock JSON = %v, want %v", got[0], want)
+	}
+}
+
+func TestCleanRemovesStatePreservesConfig(t *testing.T) {
+	dir := testProject(t)
+
+	for _, f := range []string{constants.StateFile, constants.HeartbeatFile, filepath.Join(constants.UpstreamDir, "HEAD")} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logDir := filepath.Join(dir, constants.AgentLogDir, "agent-1")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(oldWd) }()
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	rootCmd.SetArgs([]string{"clean"})
+	err := rootCmd.Execute()
+
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+
+	for _, gone := range []string{constants.MetamorphDir, constants.AgentLogDir} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", gone)
+		}
+		if !strings.Contains(output, "Removed "+gone+"/") {
+			t.Errorf("expected output to list %s, got: %q", gone, output)
+		}
+	}
+	for _, kept := range []string{"metamorph.toml", constants.AgentPromptFile, constants.ProgressFile} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("expected %s to be preserved: %v", kept, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	oldWd, _ := os.Getwd()
+	defer func() { _ = os.Chdir(oldWd) }()
+
+	t.Run("valid config prints resolved values", func(t *testing.T) {
+		dir := testProject(t)
+		cfgPath := filepath.Join(dir, "metamorph.toml")
+		data, _ := os.ReadFile(cfgPath)
+		data = append(data, []byte("signing_secret = \"s3cret\"\n\n[notifications.email]\nsmtp_host = \"smtp.example.com\"\nfrom = \"m@example.com\"\nto = [\"dev@example.com\"]\nusername = \"m\"\npassword = \"smtp-pass\"\n\n[docker.registry_auth]\nusername = \"bot\"\npassword = \"hunter2\"\n")...)
+		if err := os.WriteFile(cfgPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		rootCmd.SetOut(&buf)
+		defer rootCmd.SetOut(nil)
+		rootCmd.SetArgs([]string{"config", "validate"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("config validate: %v", err)
+		}
+
+		out := buf.String()
+		for _, want := range []string{
+			"metamorph.toml is valid",
+			`name = "test-proj"`,
+			`stale_task_max_age = "2h0m0s"`, // default applied
+			`gc_interval = "1h0m0s"`,
+			`signing_secret = "<redacted>"`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, "s3cret") {
+			t.Error("signing secret should be redacted")
+		}
+		if strings.Contains(out, "hunter2") {
+			t.Error("registry password should be redacted")
+		}
+		if strings.Contains(out, "smtp-pass") {
+			t.Error("SMTP password should be redacted")
+		}
+	})
+
+	t.Run("invalid config fails with field path", func(t *testing.T) {
+		dir := t.TempDir()
+		content := "[project]\nname = \"bad\"\n\n[agents]\ncount = 0\nmodel = \"claude-sonnet\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "metamorph.toml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		rootCmd.SetArgs([]string{"config", "validate"})
+		err := rootCmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "agents.count") {
+			t.Fatalf("expected agents.count error, got %v", err)
+		}
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.5KiB"},
+		{512 << 20, "512.0MiB"},
+		{3 << 30, "3.0GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// logsDockerClient is a docker.DockerClient that only implements GetLogs.
+type logsDockerClient struct {
+	docker.DockerClient
+	body   io.ReadCloser
+	follow bool
+	tail   int
+}
+
+func (c *logsDockerClient) GetLogs(ctx context.Context, agentID int, tail int, follow bool) (io.ReadCloser, error) {
+	if agentID != 1 {
+		return nil, fmt.Errorf("docker: no container found for agent-%d", agentID)
+	}
+	c.tail, c.follow = tail, follow
+	return c.body, nil
+}
+
+// listDockerClient is a docker.DockerClient that only implements ListAgents.
+type listDockerClient struct {
+	docker.DockerClient
+	agents []docker.AgentInfo
+	err    error
+}
+
+func (c *listDockerClient) ListAgents(ctx context.Context) ([]docker.AgentInfo, error) {
+	return c.agents, c.err
+}
+
+func TestPrintLiveAgents(t *testing.T) {
+	t.Run("renders containers sorted by agent", func(t *testing.T) {
+		started := time.Date(2025, 6, 15, 10, 30, 0, 0, time.UTC)
+		client := &listDockerClient{agents: []docker.AgentInfo{
+			{ID: 2, ContainerID: "bbbbbbbbbbbbbbbbbbbb", Role: "tester", Status: "Up 5 minutes (unhealthy)", StartedAt: started},
+			{ID: 1, ContainerID: "aaaaaaaaaaaaaaaaaaaa", Role: "developer", Status: "Exited (1) 2 minutes ago"},
+		}}
+
+		var buf bytes.Buffer
+		if err := printLiveAgents(context.Background(), client, &buf); err != nil {
+			t.Fatalf("printLiveAgents: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected a header and 2 rows, got:\n%s", buf.String())
+		}
+		if fields := strings.Fields(lines[0]); !reflect.DeepEqual(fields, []string{"AGENT", "CONTAINER", "ROLE", "STATUS", "STARTED"}) {
+			t.Errorf("header = %q", lines[0])
+		}
+		for _, want := range []string{"agent-1", "aaaaaaaaaaaa", "developer", "Exited (1) 2 minutes ago", "-"} {
+			if !strings.Contains(lines[1], want) {
+				t.Errorf("row 1 missing %q: %q", want, lines[1])
+			}
+		}
+		for _, want := range []string{"agent-2", "bbbbbbbbbbbb", "tester", "Up 5 minutes (unhealthy)", started.Local().Format("2006-01-02 15:04:05")} {
+			if !strings.Contains(lines[2], want) {
+				t.Errorf("row 2 missing %q: %q", want, lines[2])
+			}
+		}
+		if strings.Contains(buf.String(), "aaaaaaaaaaaaa") {
+			t.Error("expected container IDs to be shortened to 12 characters")
+		}
+	})
+
+	t.Run("no containers", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printLiveAgents(context.Background(), &listDockerClient{}, &buf); err != nil {
+			t.Fatalf("printLiveAgents: %v", err)
+		}
+		if buf.String() != "No agent containers found.\n" {
+			t.Errorf("output = %q", buf.String())
+		}
+	})
+
+	t.Run("docker error", func(t *testing.T) {
+		client := &listDockerClient{err: errors.New("docker: failed to list containers")}
+		if err := printLiveAgents(context.Background(), client, io.Discard); err == nil {
+			t.Error("expected the ListAgents error")
+		}
+	})
+}
+
+func TestAttachLogs(t *testing.T) {
+	t.Run("formats streamed lines", func(t *testing.T) {
+		body := strings.Join([]string{
+			"[Mon Jan 1] Starting session 3 as developer",
+			`{"type":"stream_event","event":{"type":"content_block_start","content_block":{"type":"tool_use","name":"Bash"}}}`,
+			`{"type":"stream_event","event":{"type":"ping"}}`,
+			"fatal: unable to access upstream",
+		}, "\n") + "\n"
+		client := &logsDockerClient{body: io.NopCloser(strings.NewReader(body))}
+
+		var buf bytes.Buffer
+		if err := attachLogs(context.Background(), client, 1, 20, &buf); err != nil {
+			t.Fatalf("attachLogs: %v", err)
+		}
+
+		want := "[Mon Jan 1] Starting session 3 as developer\n[tool] Bash\nfatal: unable to access upstream\n"
+		if buf.String() != want {
+			t.Errorf("output = %q, want %q", buf.String(), want)
+		}
+		if !client.follow || client.tail != 20 {
+			t.Errorf("GetLogs called with follow=%v tail=%d, want follow=true tail=20", client.follow, client.tail)
+		}
+	})
+
+	t.Run("detaches cleanly when cancelled", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer func() { _ = pw.Close() }()
+		client := &logsDockerClient{body: pr}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- attachLogs(ctx, client, 1, 0, io.Discard) }()
+
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("attachLogs after cancel: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("attachLogs did not return after cancel")
+		}
+	})
+
+	t.Run("unknown agent", func(t *testing.T) {
+		client := &logsDockerClient{}
+		if err := attachLogs(context.Background(), client, 9, 0, io.Discard); err == nil || !strings.Contains(err.Error(), "agent-9") {
+			t.Errorf("expected error for agent-9, got %v", err)
+		}
+	})
+}
+
+func TestNextSessionDelay(t *testing.T) {
+	rc := config.RunConfig{
+		MinSessionDuration: 30 * time.Second,
+		RateLimitBackoff:   5 * time.Minute,
+		RestartDelay:       5 * time.Second,
+	}
+	tests := []struct {
+		name        string
+		session     time.Duration
+		rc          config.RunConfig
+		want        time.Duration
+		rateLimited bool
+	}{
+		{name: "short session backs off", session: 3 * time.Second, rc: rc, want: 5 * time.Minute, rateLimited: true},
+		{name: "at threshold restarts normally", session: 30 * time.Second, rc: rc, want: 5 * time.Second},
+		{name: "long session restarts normally", session: 20 * time.Minute, rc: rc, want: 5 * time.Second},
+		{name: "zero threshold never backs off", session: 0, rc: config.RunConfig{RateLimitBackoff: time.Hour, RestartDelay: time.Second}, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rateLimited := nextSessionDelay(tt.session, tt.rc)
+			if got != tt.want || rateLimited != tt.rateLimited {
+				t.Errorf("nextSessionDelay(%v) = %v, %v; want %v, %v", tt.session, got, rateLimited, tt.want, tt.rateLimited)
+			}
+		})
+	}
+}
+
+func TestPushWithRetry(t *testing.T) {
+	// setup returns two clones of a fresh upstream that share one commit.
+	setup := func(t *testing.T) (upstream, a, b string) {
+		root := t.TempDir()
+		upstream = filepath.Join(root, "upstream.git")
+		gitExec(t, root, "init", "--bare", upstream)
+
+		seed := filepath.Join(root, "seed")
+		gitExec(t, root, "clone", upstream, seed)
+		gitExec(t, seed, "config", "user.name", "test")
+		gitExec(t, seed, "config", "user.email", "test@test")
+		if err := os.WriteFile(filepath.Join(seed, "shared.txt"), []byte("base\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitExec(t, seed, "add", ".")
+		gitExec(t, seed, "commit", "-m", "base")
+		gitExec(t, seed, "push", "origin", "HEAD")
+
+		a, b = filepath.Join(root, "a"), filepath.Join(root, "b")
+		for _, dir := range []string{a, b} {
+			gitExec(t, root, "clone", upstream, dir)
+			gitExec(t, dir, "config", "user.name", "test")
+			gitExec(t, dir, "config", "user.email", "test@test")
+		}
+		return upstream, a, b
+	}
+	commit := func(t *testing.T, dir, file, content, msg string) {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitExec(t, dir, "add", ".")
+		gitExec(t, dir, "commit", "-m", msg)
+	}
+
+	t.Run("rebases and pushes when upstream moved", func(t *testing.T) {
+		upstream, a, b := setup(t)
+		commit(t, b, "b.txt", "b\n", "from b")
+		gitExec(t, b, "push", "origin", "HEAD")
+		commit(t, a, "a.txt", "a\n", "from a")
+
+		if err := pushWithRetry(a); err != nil {
+			t.Fatalf("pushWithRetry: %v", err)
+		}
+		if got := gitOutput(t, upstream, "log", "-1", "--format=%s"); got != "from a" {
+			t.Errorf("upstream tip = %q, want %q", got, "from a")
+		}
+	})
+
+	t.Run("aborts a conflicting rebase", func(t *testing.T) {
+		upstream, a, b := setup(t)
+		commit(t, b, "shared.txt", "from b\n", "b edits shared")
+		gitExec(t, b, "push", "origin", "HEAD")
+		commit(t, a, "shared.txt", "from a\n", "a edits shared")
+
+		err := pushWithRetry(a)
+		if !errors.Is(err, errRebaseConflict) {
+			t.Fatalf("pushWithRetry error = %v, want errRebaseConflict", err)
+		}
+		if rebaseInProgress(a) {
+			t.Error("rebase should have been aborted")
+		}
+		if got := gitOutput(t, a, "log", "-1", "--format=%s"); got != "a edits shared" {
+			t.Errorf("local tip = %q, want the agent's commit kept", got)
+		}
+		if status := gitOutput(t, a, "status", "--porcelain"); status != "" {
+			t.Errorf("working tree not clean: %q", status)
+		}
+		if got := gitOutput(t, upstream, "log", "-1", "--format=%s"); got != "b edits shared" {
+			t.Errorf("upstream tip = %q, want it unchanged", got)
+		}
+	})
+}
+
+func TestApplyNoRestart(t *testing.T) {
+	defer func() { _ = startCmd.Flags().Set("no-restart", "false") }()
+
+	cfg := &config.Config{}
+	applyNoRestart(startCmd, cfg)
+	if !cfg.Daemon.AutoRestartEnabled() {
+		t.Fatal("auto-restart disabled without --no-restart, want the config value")
+	}
+
+	_ = startCmd.Flags().Set("no-restart", "true")
+	applyNoRestart(startCmd, cfg)
+	if cfg.Daemon.AutoRestartEnabled() {
+		t.Error("AutoRestart = true with --no-restart")
+	}
+}
+
+func TestApplyLogFormat(t *testing.T) {
+	defer func() { _ = startCmd.Flags().Set("log-format", "") }()
+
+	cfg := &config.Config{Daemon: config.DaemonConfig{LogFormat: "text"}}
+	if err := applyLogFormat(startCmd, cfg); err != nil || cfg.Daemon.LogFormat != "text" {
+		t.Fatalf("without flag: LogFormat = %q, err = %v; want the config value", cfg.Daemon.LogFormat, err)
+	}
+
+	_ = startCmd.Flags().Set("log-format", "json")
+	if err := applyLogFormat(startCmd, cfg); err != nil || cfg.Daemon.LogFormat != "json" {
+		t.Fatalf("--log-format json: LogFormat = %q, err = %v", cfg.Daemon.LogFormat, err)
+	}
+
+	_ = startCmd.Flags().Set("log-format", "xml")
+	if err := applyLogFormat(startCmd, cfg); err == nil || !strings.Contains(err.Error(), "invalid --log-format") {
+		t.Errorf("--log-format xml: err = %v, want an invalid format error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/BurntSushi/toml"
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// redacted replaces secret values when printing the resolved config.
+const redacted = "<redacted>"
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the project configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate metamorph.toml and print the resolved configuration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return fmt.Errorf("invalid metamorph.toml: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintln(out, "metamorph.toml is valid. Resolved configuration (including defaults):")
+		fmt.Fprintln(out)
+		return printConfig(out, cfg)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// printConfig writes cfg as TOML with secrets redacted.
+func printConfig(out io.Writer, cfg *config.Config) error {
+	c := *cfg
+	if c.Notifications.SigningSecret != "" {
+		c.Notifications.SigningSecret = redacted
+	}
+	if c.Notifications.Email.Password != "" {
+		c.Notifications.Email.Password = redacted
+	}
+	if c.Docker.RegistryAuth.Password != "" {
+		c.Docker.RegistryAuth.Password = redacted
+	}
+	if len(c.Notifications.Headers) > 0 {
+		c.Notifications.Headers = maps.Clone(c.Notifications.Headers)
+		for k := range c.Notifications.Headers {
+			c.Notifications.Headers[k] = redacted
+		}
+	}
+	return toml.NewEncoder(out).Encode(c)
+}
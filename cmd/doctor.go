@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+// checkResult is the outcome of a single doctor check.
+type checkResult struct {
+	Name     string
+	OK       bool
+	Critical bool   // a failed critical check makes doctor exit non-zero
+	Hint     string // how to fix a failed check
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that everything needed to run metamorph is in place",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		results := []checkResult{
+			checkDocker(func() error {
+				host := ""
+				if cfg, err := loadConfig(projectDir); err == nil {
+					host = cfg.Docker.Host
+				}
+				_, err := docker.NewClient("", host)
+				return err
+			}),
+			checkGit(exec.LookPath),
+			checkConfigFile(projectDir),
+			checkAgentPrompt(projectDir),
+			checkUpstream(projectDir),
+			checkCredentials(os.Getenv, projectDir),
+		}
+
+		failed := 0
+		for _, r := range results {
+			mark := "✓"
+			if !r.OK {
+				mark = "✗"
+				if !r.Critical {
+					mark = "!"
+				}
+			}
+			fmt.Printf("%s %s\n", mark, r.Name)
+			if !r.OK && r.Hint != "" {
+				fmt.Printf("    → %s\n", r.Hint)
+			}
+			if !r.OK && r.Critical {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d critical check(s) failed", failed)
+		}
+		fmt.Println("\nAll critical checks passed.")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// checkDocker verifies the Docker daemon is reachable using ping.
+func checkDocker(ping func() error) checkResult {
+	r := checkResult{Name: "Docker daemon is reachable", Critical: true}
+	if err := ping(); err != nil {
+		r.Hint = fmt.Sprintf("Start Docker (or check DOCKER_HOST): %v", err)
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+// checkGit verifies git is installed on the host.
+func checkGit(lookPath func(string) (string, error)) checkResult {
+	r := checkResult{Name: "git is installed", Critical: true}
+	if _, err := lookPath("git"); err != nil {
+		r.Hint = "Install git and make sure it is on your PATH"
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+// checkConfigFile verifies metamorph.toml exists and is valid.
+func checkConfigFile(projectDir string) checkResult {
+	r := checkResult{Name: "metamorph.toml is present and valid", Critical: true}
+	if _, err := os.Stat(filepath.Join(projectDir, "metamorph.toml")); err != nil {
+		r.Hint = "Run 'metamorph init' to create a project"
+		return r
+	}
+	if _, err := loadConfig(projectDir); err != nil {
+		r.Hint = fmt.Sprintf("Fix metamorph.toml: %v", err)
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+// checkAgentPrompt verifies the agent prompt template exists.
+func checkAgentPrompt(projectDir string) checkResult {
+	r := checkResult{Name: constants.AgentPromptFile + " is present", Critical: true}
+	if _, err := os.Stat(filepath.Join(projectDir, constants.AgentPromptFile)); err != nil {
+		r.Hint = "Run 'metamorph init' to generate the default prompt"
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+// checkUpstream reports whether the upstream bare repo exists. It is not
+// critical because 'metamorph start' creates it on first run.
+func checkUpstream(projectDir string) checkResult {
+	r := checkResult{Name: "upstream repository exists"}
+	if _, err := os.Stat(filepath.Join(projectDir, constants.UpstreamDir)); err != nil {
+		r.Hint = "It will be created by 'metamorph start' (requires the project to be a git repository)"
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+// checkCredentials verifies a Claude credential is available, either from
+// the environment or from a [credentials] file in metamorph.toml.
+func checkCredentials(getenv func(string) string, projectDir string) checkResult {
+	r := checkResult{Name: "Claude credentials are set", Critical: true}
+	apiKey, oauthToken := getenv("ANTHROPIC_API_KEY"), getenv("CLAUDE_CODE_OAUTH_TOKEN")
+	if cfg, err := loadConfig(projectDir); err == nil {
+		var readErr error
+		if apiKey, oauthToken, readErr = resolveCredentials(getenv, cfg, projectDir); readErr != nil {
+			r.Hint = fmt.Sprintf("Fix metamorph.toml: %v", readErr)
+			return r
+		}
+	}
+	if oauthToken == "" && apiKey == "" {
+		r.Hint = "Set CLAUDE_CODE_OAUTH_TOKEN (Claude Pro/Max) or ANTHROPIC_API_KEY, or configure [credentials] in metamorph.toml"
+		return r
+	}
+	r.OK = true
+	return r
+}
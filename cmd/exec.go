@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/moby/term"
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <agent-id> [-- command...]",
+	Short: "Run a command (default: a shell) inside an agent container",
+	Long: `Run a command inside an agent's container with your terminal attached.
+With no command, an interactive /bin/bash shell is started in /workspace.
+
+Examples:
+  metamorph exec 1
+  metamorph exec 2 -- git -C repo log --oneline -5`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid agent ID %q: must be a number", args[0])
+		}
+
+		command := args[1:]
+		if len(command) == 0 {
+			command = []string{"/bin/bash"}
+		}
+
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+		if err != nil {
+			return fmt.Errorf("failed to create Docker client: %w", err)
+		}
+
+		// Put the terminal in raw mode so keystrokes (Ctrl-C, arrows, tab)
+		// are passed through to the container's shell.
+		fd, isTerminal := term.GetFdInfo(os.Stdin)
+		if isTerminal {
+			state, err := term.SetRawTerminal(fd)
+			if err != nil {
+				return fmt.Errorf("failed to set raw terminal mode: %w", err)
+			}
+			defer func() { _ = term.RestoreTerminal(fd, state) }()
+		}
+
+		exitCode, err := dockerClient.ExecInteractive(context.Background(), agentID, docker.ExecOpts{
+			Cmd:    command,
+			Tty:    isTerminal,
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("command exited with status %d", exitCode)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+}
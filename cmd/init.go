@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/daemon"
+	"github.com/robmorgan/metamorph/internal/gitops"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +21,18 @@ var initCmd = &cobra.Command{
 	Short: "Initialize a new metamorph project",
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		resetUpstream, _ := cmd.Flags().GetBool("reset-upstream")
+		if resetUpstream && !force {
+			return fmt.Errorf("--reset-upstream requires --force")
+		}
+		agentsFlag, _ := cmd.Flags().GetInt("agents")
+		rolesFlag, _ := cmd.Flags().GetString("roles")
+		minimal, _ := cmd.Flags().GetBool("minimal")
+		if minimal && (agentsFlag != 0 || rolesFlag != "") {
+			return fmt.Errorf("--minimal cannot be combined with --agents or --roles")
+		}
+
 		dir := "."
 		if len(args) > 0 {
 			dir = args[0]
@@ -33,19 +51,32 @@ var initCmd = &cobra.Command{
 
 		// Check if already initialized.
 		configPath := filepath.Join(absDir, "metamorph.toml")
-		if _, err := os.Stat(configPath); err == nil {
-			return fmt.Errorf("metamorph.toml already exists in %s", absDir)
+		_, err = os.Stat(configPath)
+		reinit := err == nil
+		if reinit {
+			if !force {
+				return fmt.Errorf("metamorph.toml already exists in %s (use --force to reinitialize)", absDir)
+			}
+			if daemon.IsRunning(absDir) {
+				return fmt.Errorf("daemon is running: run 'metamorph stop' before reinitializing")
+			}
 		}
 
-		// Write metamorph.toml.
+		count, roles, err := initAgents(agentsFlag, rolesFlag)
+		if err != nil {
+			return err
+		}
+
+		// Write metamorph.toml. The minimal profile is for 'metamorph run'
+		// on the host, so it leaves out the Docker and daemon settings.
 		configContent := fmt.Sprintf(`[project]
 name = %q
 description = ""
 
 [agents]
-count = 4
+count = %d
 model = "claude-opus-4-6"
-roles = ["developer", "developer", "tester", "refactorer"]
+roles = [%s]
 
 [docker]
 image = "metamorph-agent:latest"
@@ -57,8 +88,33 @@ fast_command = ""
 
 [notifications]
 webhook_url = ""
+`, projectName, count, quoteList(roles))
+		if minimal {
+			configContent = fmt.Sprintf(`# Minimal profile for 'metamorph run'. To run agents in Docker with
+# 'metamorph start', reinitialize with 'metamorph init --force'.
+
+[project]
+name = %q
+description = ""
+
+[agents]
+count = 1
+model = "claude-opus-4-6"
+
+[testing]
+command = ""
+fast_command = ""
 `, projectName)
+		}
 
+		// Back up the old config only once the new one is ready to write.
+		if reinit {
+			backup, err := backupConfig(configPath, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed to back up metamorph.toml: %w", err)
+			}
+			fmt.Printf("  Backed up metamorph.toml to %s\n", filepath.Base(backup))
+		}
 		if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 			return fmt.Errorf("failed to write metamorph.toml: %w", err)
 		}
@@ -119,7 +175,7 @@ Add project-specific instructions for your agents here.
 
 		// Append entries to .gitignore (create if missing, never overwrite).
 		gitignorePath := filepath.Join(absDir, ".gitignore")
-		requiredEntries := []string{".metamorph/", "agent_logs/"}
+		requiredEntries := []string{".metamorph/", "agent_logs/", "metamorph.local.toml"}
 		existing, _ := os.ReadFile(gitignorePath)
 		existingStr := string(existing)
 		var toAdd []string
@@ -149,7 +205,26 @@ Add project-specific instructions for your agents here.
 			fmt.Println("  .gitignore already up to date")
 		}
 
+		// A forced re-init also repairs the upstream repo. 'metamorph run'
+		// clones the upstream but, unlike start, doesn't create it, so the
+		// minimal profile creates it up front.
+		if force || minimal {
+			if err := reinitUpstream(absDir, resetUpstream); err != nil {
+				return err
+			}
+		}
+
 		fmt.Printf("\nProject %q initialized successfully!\n\n", projectName)
+		if minimal {
+			fmt.Println("Next steps:")
+			fmt.Println("  1. Edit AGENT_PROMPT.md with project-specific instructions")
+			fmt.Println("  2. Set credentials (pick one):")
+			fmt.Println("       export CLAUDE_CODE_OAUTH_TOKEN=...   # Claude Pro/Max subscription")
+			fmt.Println("       export ANTHROPIC_API_KEY=sk-...       # Anthropic API key")
+			fmt.Println("  3. Run an agent on this machine: metamorph run --once")
+			fmt.Println("\nTo run agents in Docker with 'metamorph start', reinitialize with 'metamorph init --force'.")
+			return nil
+		}
 		fmt.Println("Next steps:")
 		fmt.Println("  1. Review and customize metamorph.toml")
 		fmt.Println("  2. Edit AGENT_PROMPT.md with project-specific instructions")
@@ -165,6 +240,123 @@ Add project-specific instructions for your agents here.
 }
 
 func init() {
+	initCmd.Flags().Int("agents", 0, "Number of agents (default 4, or one per --roles entry)")
+	initCmd.Flags().String("roles", "", "Comma-separated agent roles, e.g. developer,tester")
+	initCmd.Flags().Bool("force", false, "Reinitialize a project that already has a metamorph.toml")
+	initCmd.Flags().Bool("reset-upstream", false, "With --force, recreate a non-empty upstream repo (discards agent work not yet synced)")
+	initCmd.Flags().Bool("minimal", false, "Set up for 'metamorph run' only, without Docker settings")
 	rootCmd.AddCommand(initCmd)
 }
 
+// reinitUpstream creates the upstream repo during 'init --force' or
+// 'init --minimal' when it is missing or empty. An upstream that already
+// holds a repository may contain agent work not yet synced, so it is only
+// recreated when reset is set.
+func reinitUpstream(projectDir string, reset bool) error {
+	upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+	entries, err := os.ReadDir(upstreamPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read upstream repo: %w", err)
+	}
+	if len(entries) > 0 && !reset {
+		fmt.Println("  Keeping existing upstream repository (pass --reset-upstream to recreate it)")
+		return nil
+	}
+
+	cfg, err := loadConfig(projectDir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(upstreamPath); err != nil {
+		return fmt.Errorf("failed to remove upstream repo: %w", err)
+	}
+	if err := gitops.InitUpstream(context.Background(), projectDir, cfg.Git.DefaultBranch, cfg.Tasks.LockDir); err != nil {
+		return fmt.Errorf("failed to initialize upstream repo: %w", err)
+	}
+	fmt.Println("  Created upstream repository")
+	return nil
+}
+
+// defaultInitRoles are the roles written by init when --roles is not given.
+var defaultInitRoles = []string{"developer", "developer", "tester", "refactorer"}
+
+// backupConfig copies the config at path to a timestamped backup next to it,
+// e.g. metamorph.toml.20260102-150405.bak, and returns the backup's path.
+// It never overwrites an earlier backup, so repeated re-inits keep them all.
+func backupConfig(path string, now time.Time) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	base := path + "." + now.Format("20060102-150405")
+	for i := 0; ; i++ {
+		backup := base + ".bak"
+		if i > 0 {
+			backup = fmt.Sprintf("%s-%d.bak", base, i)
+		}
+		f, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			_ = f.Close()
+			return "", err
+		}
+		return backup, f.Close()
+	}
+}
+
+// initAgents resolves the agent count and roles for a new metamorph.toml from
+// the --agents and --roles flags. Without --roles, the default roles are
+// repeated or trimmed to match the count; without --agents, there is one
+// agent per role.
+func initAgents(count int, rolesFlag string) (int, []string, error) {
+	if count < 0 {
+		return 0, nil, fmt.Errorf("--agents must be greater than 0")
+	}
+
+	var roles []string
+	for _, r := range strings.Split(rolesFlag, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	for _, r := range roles {
+		if _, ok := constants.AgentRoles[r]; !ok {
+			valid := make([]string, 0, len(constants.AgentRoles))
+			for name := range constants.AgentRoles {
+				valid = append(valid, name)
+			}
+			sort.Strings(valid)
+			return 0, nil, fmt.Errorf("invalid agent role: %q (must be one of %s)", r, strings.Join(valid, ", "))
+		}
+	}
+
+	switch {
+	case len(roles) == 0:
+		if count == 0 {
+			count = len(defaultInitRoles)
+		}
+		for i := 0; i < count; i++ {
+			roles = append(roles, defaultInitRoles[i%len(defaultInitRoles)])
+		}
+	case count == 0:
+		count = len(roles)
+	case len(roles) > count:
+		return 0, nil, fmt.Errorf("--roles lists %d roles but --agents is %d", len(roles), count)
+	}
+	return count, roles, nil
+}
+
+// quoteList formats items as the body of a TOML string array.
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return strings.Join(quoted, ", ")
+}
+
@@ -13,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/robmorgan/metamorph/internal/config"
 	"github.com/robmorgan/metamorph/internal/constants"
 	"github.com/spf13/cobra"
 )
@@ -99,15 +100,12 @@ func formatLogLine(line string) (string, bool) {
 }
 
 var logsCmd = &cobra.Command{
-	Use:   "logs <agent-id>",
+	Use:   "logs [agent-id]",
 	Short: "View agent logs",
-	Args:  cobra.ExactArgs(1),
+	Long: `View the latest session log for an agent. With no agent ID (or --all),
+show the latest session log of every agent, each line prefixed with [agent-N].`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		agentID, err := strconv.Atoi(args[0])
-		if err != nil {
-			return fmt.Errorf("invalid agent ID %q: must be a number", args[0])
-		}
-
 		projectDir, err := resolveProjectDir()
 		if err != nil {
 			return err
@@ -115,6 +113,41 @@ var logsCmd = &cobra.Command{
 
 		follow, _ := cmd.Flags().GetBool("follow")
 		tail, _ := cmd.Flags().GetInt("tail")
+		if !cmd.Flags().Changed("tail") {
+			// Default to the window the daemon scans for errors.
+			if cfg, err := loadConfig(projectDir); err == nil {
+				tail = cfg.Notifications.LogScanLines
+			}
+		}
+		all, _ := cmd.Flags().GetBool("all")
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		since, _ := cmd.Flags().GetDuration("since")
+		if since < 0 {
+			return fmt.Errorf("--since must not be negative")
+		}
+		timestamps, _ := cmd.Flags().GetString("timestamps")
+		switch timestamps {
+		case "", timestampsAbsolute, timestampsRelative:
+		default:
+			return fmt.Errorf("invalid --timestamps: %q (must be %s or %s)", timestamps, timestampsAbsolute, timestampsRelative)
+		}
+		if timestamps != "" && jsonOutput {
+			return fmt.Errorf("--timestamps cannot be combined with --json")
+		}
+		var cutoff time.Time
+		if since > 0 {
+			cutoff = time.Now().Add(-since)
+		}
+
+		if all || len(args) == 0 {
+			return showAllLogs(projectDir, tail, cutoff, follow, newLogPrinter(jsonOutput, true, timestamps))
+		}
+		printer := newLogPrinter(jsonOutput, false, timestamps)
+
+		agentID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid agent ID %q: must be a number", args[0])
+		}
 
 		logDir := filepath.Join(projectDir, constants.AgentLogDir, fmt.Sprintf("agent-%d", agentID))
 
@@ -131,16 +164,9 @@ var logsCmd = &cobra.Command{
 		}
 
 		// Print last N lines.
+		printer.anchor(agentID, fileModTime(logFile))
 		lines := strings.Split(string(data), "\n")
-		start := 0
-		if tail > 0 && tail < len(lines) {
-			start = len(lines) - tail
-		}
-		for _, line := range lines[start:] {
-			if formatted, ok := formatLogLine(line); ok {
-				fmt.Println(formatted)
-			}
-		}
+		printer.print(agentID, recentLines(lines, tail, cutoff))
 
 		if !follow {
 			return nil
@@ -159,51 +185,391 @@ var logsCmd = &cobra.Command{
 			case <-sigCh:
 				return nil
 			case <-ticker.C:
-				f, err := os.Open(logFile)
-				if err != nil {
-					continue
-				}
+				newLines, newOffset := readNewLines(logFile, offset)
+				offset = newOffset
+				printer.anchor(agentID, fileModTime(logFile))
+				printer.print(agentID, newLines)
+			}
+		}
+	},
+}
 
-				info, err := f.Stat()
-				if err != nil {
-					_ = f.Close()
-					continue
-				}
+func init() {
+	logsCmd.Flags().BoolP("follow", "f", false, "Follow log output")
+	logsCmd.Flags().Int("tail", config.DefaultLogScanLines, "Number of lines to show from the end (notifications.log_scan_lines when unset)")
+	logsCmd.Flags().Bool("all", false, "Show logs from all agents")
+	logsCmd.Flags().Bool("json", false, "Emit one JSON object per event instead of formatted text")
+	logsCmd.Flags().Duration("since", 0, "Only show lines newer than this, e.g. 10m")
+	logsCmd.Flags().String("timestamps", "", "Prefix each line with its time: absolute (the default when given) or relative to the first line")
+	logsCmd.Flags().Lookup("timestamps").NoOptDefVal = timestampsAbsolute
+	rootCmd.AddCommand(logsCmd)
+}
 
-				if info.Size() <= offset {
-					_ = f.Close()
-					continue
-				}
+// recentLines returns the last tail lines (all when tail is 0) of those
+// logged at or after cutoff. A zero cutoff keeps every line.
+func recentLines(lines []string, tail int, cutoff time.Time) []string {
+	if !cutoff.IsZero() {
+		lines = filterSince(lines, cutoff)
+	}
+	if tail > 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	return lines
+}
 
-				if _, err := f.Seek(offset, io.SeekStart); err != nil {
-					_ = f.Close()
-					continue
+// filterSince keeps the lines logged at or after cutoff. Stream-json events
+// with a timestamp are judged on their own; lines without one (e.g.
+// entrypoint output) follow the most recent timestamped event before them,
+// so lines preceding any timestamped event are dropped.
+func filterSince(lines []string, cutoff time.Time) []string {
+	var kept []string
+	inWindow := false
+	for _, line := range lines {
+		if ts, ok := lineTimestamp(line); ok {
+			inWindow = !ts.Before(cutoff)
+		}
+		if inWindow {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// lineTimestamp returns the top-level RFC 3339 timestamp of a stream-json
+// event, if it has one.
+func lineTimestamp(line string) (time.Time, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || trimmed[0] != '{' {
+		return time.Time{}, false
+	}
+	var ev struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &ev); err != nil || ev.Timestamp == "" {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, ev.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// readNewLines returns the lines appended to path since offset and the new
+// offset. It returns no lines if the file is unreadable or has not grown. A
+// file smaller than offset was truncated by log rotation, so it is read
+// again from the start.
+func readNewLines(path string, offset int64) ([]string, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, offset
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() <= offset {
+		return nil, offset
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset
+	}
+
+	newData, err := io.ReadAll(f)
+	if err != nil || len(newData) == 0 {
+		return nil, offset
+	}
+
+	return strings.Split(string(newData), "\n"), offset + int64(len(newData))
+}
+
+// agentLog tracks the follow position in one agent's latest session log.
+type agentLog struct {
+	dir    string
+	path   string
+	offset int64
+}
+
+// showAllLogs prints the last tail lines of every agent's latest session log
+// (limited to lines newer than cutoff, if set), each prefixed with [agent-N].
+// In follow mode it polls all agent log
+// directories, switching to newer sessions as they appear, and prints new
+// lines as they arrive.
+func showAllLogs(projectDir string, tail int, cutoff time.Time, follow bool, printer logPrinter) error {
+	logRoot := filepath.Join(projectDir, constants.AgentLogDir)
+	ids, err := listAgentLogDirs(logRoot)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 && !follow {
+		return fmt.Errorf("no agent logs found in %s", logRoot)
+	}
+
+	logs := make(map[int]*agentLog)
+	for _, id := range ids {
+		al := &agentLog{dir: filepath.Join(logRoot, fmt.Sprintf("agent-%d", id))}
+		logs[id] = al
+
+		path, err := findLatestLog(al.dir)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		al.path = path
+		al.offset = int64(len(data))
+
+		printer.anchor(id, fileModTime(path))
+		lines := strings.Split(string(data), "\n")
+		printer.print(id, recentLines(lines, tail, cutoff))
+	}
+
+	if !follow {
+		return nil
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sigCh:
+			return nil
+		case <-ticker.C:
+			// Pick up agents that started logging after we began.
+			ids, _ := listAgentLogDirs(logRoot)
+			for _, id := range ids {
+				if _, ok := logs[id]; !ok {
+					logs[id] = &agentLog{dir: filepath.Join(logRoot, fmt.Sprintf("agent-%d", id))}
 				}
+			}
 
-				newData, err := io.ReadAll(f)
-				_ = f.Close()
-				if err != nil {
+			for _, id := range ids {
+				al := logs[id]
+				// A new session starts a new log file; read it from the start.
+				if path, err := findLatestLog(al.dir); err == nil && path != al.path {
+					al.path = path
+					al.offset = 0
+					printer.reset(id)
+				}
+				if al.path == "" {
 					continue
 				}
 
-				if len(newData) > 0 {
-					offset += int64(len(newData))
-					newLines := strings.Split(string(newData), "\n")
-					for _, line := range newLines {
-						if formatted, ok := formatLogLine(line); ok {
-							fmt.Println(formatted)
-						}
-					}
-				}
+				var lines []string
+				lines, al.offset = readNewLines(al.path, al.offset)
+				printer.anchor(id, fileModTime(al.path))
+				printer.print(id, lines)
 			}
 		}
-	},
+	}
 }
 
-func init() {
-	logsCmd.Flags().BoolP("follow", "f", false, "Follow log output")
-	logsCmd.Flags().Int("tail", 50, "Number of lines to show from the end")
-	rootCmd.AddCommand(logsCmd)
+// logPrinter prints an agent's log lines, either formatted for humans
+// (optionally prefixed with [agent-N] and a timestamp) or as JSON objects.
+type logPrinter struct {
+	json       bool
+	prefix     bool
+	timestamps string            // "", timestampsAbsolute or timestampsRelative
+	clocks     map[int]*logClock // per-agent clocks when timestamps is set
+}
+
+func newLogPrinter(jsonOutput, prefix bool, timestamps string) logPrinter {
+	p := logPrinter{json: jsonOutput, prefix: prefix, timestamps: timestamps}
+	if timestamps != "" {
+		p.clocks = make(map[int]*logClock)
+	}
+	return p
+}
+
+// clock returns agentID's log clock, or nil without --timestamps.
+func (p logPrinter) clock(agentID int) *logClock {
+	if p.clocks == nil {
+		return nil
+	}
+	c, ok := p.clocks[agentID]
+	if !ok {
+		c = &logClock{mode: p.timestamps}
+		p.clocks[agentID] = c
+	}
+	return c
+}
+
+// anchor sets the time given to agentID's lines when no stream-json event
+// says otherwise, normally the log file's modification time.
+func (p logPrinter) anchor(agentID int, t time.Time) {
+	if c := p.clock(agentID); c != nil {
+		c.anchor = t
+	}
+}
+
+// reset discards agentID's clock when it moves on to a new session log.
+func (p logPrinter) reset(agentID int) {
+	delete(p.clocks, agentID)
+}
+
+func (p logPrinter) print(agentID int, lines []string) {
+	clock := p.clock(agentID)
+	if clock != nil {
+		clock.prime(lines)
+	}
+	now := time.Now()
+	for _, line := range lines {
+		var stamp string
+		if clock != nil {
+			stamp = clock.stamp(line, now)
+		}
+		var out string
+		var ok bool
+		if p.json {
+			out, ok = jsonLogLine(agentID, line, now.UTC())
+		} else if out, ok = formatLogLine(line); ok {
+			if p.prefix {
+				out = fmt.Sprintf("[agent-%d] %s", agentID, out)
+			}
+			if stamp != "" {
+				out = stamp + " " + out
+			}
+		}
+		if ok {
+			fmt.Println(out)
+		}
+	}
+}
+
+// Values of logs --timestamps.
+const (
+	timestampsAbsolute = "absolute"
+	timestampsRelative = "relative"
+)
+
+// logClock assigns a time to each of an agent's log lines for --timestamps.
+// Stream-json events carry their own timestamp; lines without one (e.g.
+// entrypoint output) take the time of the most recent event before them,
+// matching --since. With no event to go on, the anchor is used instead.
+type logClock struct {
+	mode   string
+	anchor time.Time // fallback time, normally the log file's mod time
+	last   time.Time // time of the most recent timestamped event
+	start  time.Time // time of the first stamped line, for relative output
+}
+
+// prime gives lines that precede the first timestamped event in a batch that
+// event's time, so a session's opening output isn't stamped with the anchor
+// when better information follows.
+func (c *logClock) prime(lines []string) {
+	if !c.last.IsZero() {
+		return
+	}
+	for _, line := range lines {
+		if ts, ok := lineTimestamp(line); ok {
+			c.last = ts
+			return
+		}
+	}
+}
+
+// stamp returns the time prefix for line and advances the clock past it. now
+// stands in when there is neither an earlier event nor an anchor.
+func (c *logClock) stamp(line string, now time.Time) string {
+	if ts, ok := lineTimestamp(line); ok {
+		c.last = ts
+	}
+	t := c.last
+	if t.IsZero() {
+		t = c.anchor
+	}
+	if t.IsZero() {
+		t = now
+	}
+	if c.start.IsZero() {
+		c.start = t
+	}
+
+	if c.mode == timestampsRelative {
+		d := t.Sub(c.start)
+		if d < 0 {
+			d = 0
+		}
+		secs := int(d / time.Second)
+		return fmt.Sprintf("+%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return t.Local().Format("15:04:05")
+}
+
+// fileModTime returns path's modification time, or the zero time if it
+// can't be read.
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// jsonLogLine converts a log line into a compact JSON object with agent_id
+// and timestamp fields added. Stream-json events keep their original fields;
+// other lines (e.g. entrypoint output) become {"type":"raw","text":...}.
+// Log lines carry no time of their own, so timestamp is when it was read.
+func jsonLogLine(agentID int, line string, now time.Time) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return "", false
+	}
+
+	fields := make(map[string]interface{})
+	var raw map[string]json.RawMessage
+	if trimmed[0] == '{' && json.Unmarshal([]byte(trimmed), &raw) == nil {
+		for k, v := range raw {
+			fields[k] = v
+		}
+	} else {
+		fields["type"] = "raw"
+		fields["text"] = line
+	}
+	fields["agent_id"] = agentID
+	fields["timestamp"] = now.Format(time.RFC3339Nano)
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// listAgentLogDirs returns the sorted IDs of agents with an agent-N
+// directory under logRoot.
+func listAgentLogDirs(logRoot string) ([]int, error) {
+	entries, err := os.ReadDir(logRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	var ids []int
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "agent-") {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimPrefix(e.Name(), "agent-")); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
 }
 
 // findLatestLog finds the most recent session-*.log file in the given directory.
@@ -2,15 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/robmorgan/metamorph/internal/daemon"
 	"github.com/robmorgan/metamorph/internal/notify"
 	"github.com/spf13/cobra"
 )
 
 var notifyCmd = &cobra.Command{
 	Use:   "notify",
-	Short: "Manage webhook notifications",
+	Short: "Manage webhook and email notifications",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		testFlag, _ := cmd.Flags().GetBool("test")
 		if !testFlag {
@@ -27,8 +29,9 @@ var notifyCmd = &cobra.Command{
 			return err
 		}
 
-		if cfg.Notifications.WebhookURL == "" {
-			return fmt.Errorf("no webhook URL configured in metamorph.toml ([notifications] webhook_url)")
+		notifier := daemon.NewNotifier(cfg.Notifications)
+		if notifier == nil {
+			return fmt.Errorf("no notifications configured in metamorph.toml ([notifications] webhook_url or [notifications.email])")
 		}
 
 		event := notify.Event{
@@ -38,9 +41,16 @@ var notifyCmd = &cobra.Command{
 			Timestamp: time.Now().UTC(),
 		}
 
-		fmt.Printf("Sending test notification to %s...\n", cfg.Notifications.WebhookURL)
+		var targets []string
+		if cfg.Notifications.WebhookURL != "" {
+			targets = append(targets, cfg.Notifications.WebhookURL)
+		}
+		if cfg.Notifications.Email.Enabled() {
+			targets = append(targets, strings.Join(cfg.Notifications.Email.To, ", "))
+		}
+		fmt.Printf("Sending test notification to %s...\n", strings.Join(targets, " and "))
 
-		if err := notify.Send(cfg.Notifications.WebhookURL, event); err != nil {
+		if err := notifier.Send(event); err != nil {
 			return fmt.Errorf("notification failed: %w", err)
 		}
 
@@ -50,6 +60,6 @@ var notifyCmd = &cobra.Command{
 }
 
 func init() {
-	notifyCmd.Flags().Bool("test", false, "Send a test notification to the webhook")
+	notifyCmd.Flags().Bool("test", false, "Send a test notification to the configured webhook and email")
 	rootCmd.AddCommand(notifyCmd)
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause [agent-id...]",
+	Short: "Pause agents without stopping their containers",
+	Long: `Freeze agent containers so they stop working and committing until resumed.
+With no agent IDs, all agents are paused. The daemon leaves paused agents
+alone and does not treat them as crashed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setAgentsPaused(args, true)
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [agent-id...]",
+	Short: "Resume paused agents",
+	Long:  `Resume agent containers paused with 'metamorph pause'. With no agent IDs, all agents are resumed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setAgentsPaused(args, false)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+}
+
+// setAgentsPaused pauses or unpauses the given agents, or every agent in the
+// project when no IDs are given.
+func setAgentsPaused(args []string, pause bool) error {
+	var ids []int
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid agent ID %q: must be a number", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	projectDir, err := resolveProjectDir()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(projectDir)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+	if err != nil {
+		return fmt.Errorf("failed to create Docker client: %w", err)
+	}
+
+	ctx := context.Background()
+	if len(ids) == 0 {
+		agents, err := dockerClient.ListAgents(ctx)
+		if err != nil {
+			return err
+		}
+		if len(agents) == 0 {
+			return fmt.Errorf("no agent containers found (is the daemon running?)")
+		}
+		for _, a := range agents {
+			ids = append(ids, a.ID)
+		}
+	}
+
+	verb := "Resumed"
+	if pause {
+		verb = "Paused"
+	}
+	for _, id := range ids {
+		if pause {
+			err = dockerClient.PauseAgent(ctx, id)
+		} else {
+			err = dockerClient.UnpauseAgent(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s agent-%d\n", verb, id)
+	}
+
+	return nil
+}
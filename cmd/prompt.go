@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/robmorgan/metamorph/assets"
 	"github.com/robmorgan/metamorph/internal/constants"
@@ -17,18 +20,28 @@ var promptCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		showSystem, _ := cmd.Flags().GetBool("show-system")
 
+		projectDir, err := resolveProjectDir()
 		if showSystem {
-			fmt.Print(assets.SystemPrompt)
+			// Outside a project there is no override, so show the built-in prompt.
+			systemPrompt := assets.SystemPrompt
+			if err == nil {
+				if cfg, err := loadConfig(projectDir); err == nil {
+					systemPrompt = cfg.Agents.SystemPrompt(projectDir)
+				}
+			}
+			fmt.Print(systemPrompt)
 			return nil
 		}
-
-		projectDir, err := resolveProjectDir()
 		if err != nil {
 			return err
 		}
 
 		promptPath := filepath.Join(projectDir, constants.AgentPromptFile)
 
+		if validate, _ := cmd.Flags().GetBool("validate"); validate {
+			return validatePrompts(projectDir, cmd.OutOrStdout())
+		}
+
 		editFlag, _ := cmd.Flags().GetBool("edit")
 
 		if editFlag {
@@ -59,7 +72,79 @@ var promptCmd = &cobra.Command{
 
 func init() {
 	promptCmd.Flags().Bool("show", false, "Show the agent prompt (default)")
-	promptCmd.Flags().Bool("show-system", false, "Show the built-in system prompt")
+	promptCmd.Flags().Bool("show-system", false, "Show the system prompt (agents.system_prompt_file or the built-in one)")
 	promptCmd.Flags().Bool("edit", false, "Open the agent prompt in $EDITOR")
+	promptCmd.Flags().Bool("validate", false, "Check the agent prompts for unknown ${...} placeholders")
 	rootCmd.AddCommand(promptCmd)
 }
+
+// agentPlaceholders are the variables set for every agent, on top of the
+// environment.
+var agentPlaceholders = map[string]bool{
+	"AGENT_ID":      true,
+	"AGENT_ROLE":    true,
+	"AGENT_MODEL":   true,
+	"TASK_LOCK_DIR": true,
+}
+
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// placeholder is a ${NAME} reference found in a prompt.
+type placeholder struct {
+	Line     int
+	Name     string
+	HostOnly bool // set in this host's environment but not in agent containers
+}
+
+// unknownPlaceholders returns the ${...} placeholders in content that are
+// not agent variables. Those set in the host environment are marked
+// HostOnly: 'metamorph run' expands them, but Docker agents expand the
+// prompt inside the container, where they are empty. The rest expand to an
+// empty string everywhere.
+func unknownPlaceholders(content string) []placeholder {
+	var unknown []placeholder
+	for i, line := range strings.Split(content, "\n") {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(line, -1) {
+			name := m[1]
+			if agentPlaceholders[name] {
+				continue
+			}
+			_, hostOnly := os.LookupEnv(name)
+			unknown = append(unknown, placeholder{Line: i + 1, Name: name, HostOnly: hostOnly})
+		}
+	}
+	return unknown
+}
+
+// validatePrompts checks AGENT_PROMPT.md and any per-role prompts for
+// unknown placeholders, reporting each with its line number.
+func validatePrompts(projectDir string, out io.Writer) error {
+	roleGlob := strings.Replace(constants.RolePromptFile, "%s", "*", 1)
+	rolePrompts, _ := filepath.Glob(filepath.Join(projectDir, roleGlob))
+	paths := append([]string{filepath.Join(projectDir, constants.AgentPromptFile)}, rolePrompts...)
+
+	found := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) && path == paths[0] {
+				return fmt.Errorf("AGENT_PROMPT.md not found (run 'metamorph init' first)")
+			}
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		for _, p := range unknownPlaceholders(string(data)) {
+			if p.HostOnly {
+				_, _ = fmt.Fprintf(out, "%s:%d: note: ${%s} is only set on this host (expanded by 'metamorph run', empty in Docker agents)\n", filepath.Base(path), p.Line, p.Name)
+				continue
+			}
+			_, _ = fmt.Fprintf(out, "%s:%d: unknown placeholder ${%s} (expands to an empty string)\n", filepath.Base(path), p.Line, p.Name)
+			found++
+		}
+	}
+
+	if found > 0 {
+		return fmt.Errorf("found %d unknown placeholder(s); known placeholders are ${AGENT_ID}, ${AGENT_ROLE}, ${AGENT_MODEL}, ${TASK_LOCK_DIR} and, for 'metamorph run' only, environment variables", found)
+	}
+	_, _ = fmt.Fprintf(out, "No unknown placeholders in %d prompt file(s).\n", len(paths))
+	return nil
+}
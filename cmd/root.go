@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/gitops"
 	"github.com/spf13/cobra"
 )
 
@@ -20,16 +23,25 @@ var rootCmd = &cobra.Command{
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		level := slog.LevelInfo
-		if verbose {
-			level = slog.LevelDebug
-		}
-		handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
-		slog.SetDefault(slog.New(handler))
+		slog.SetDefault(slog.New(newLogHandler(os.Stderr, "text")))
 		return nil
 	},
 }
 
+// newLogHandler returns a slog handler writing to w in the given format,
+// "text" or "json", at debug level with --verbose.
+func newLogHandler(w io.Writer, format string) slog.Handler {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose (debug) logging")
 }
@@ -60,6 +72,77 @@ func loadConfig(dir string) (*config.Config, error) {
 	return config.Load(filepath.Join(dir, "metamorph.toml"))
 }
 
+// projectSyncStrategy returns git.project_sync_strategy for the project,
+// falling back to the default merge if the config can't be loaded.
+func projectSyncStrategy(projectDir string) string {
+	cfg, err := loadConfig(projectDir)
+	if err != nil {
+		return gitops.SyncMerge
+	}
+	return cfg.Git.ProjectSyncStrategy
+}
+
+// dotEnvFile is the optional project-local environment file loaded by start
+// and run.
+const dotEnvFile = ".env"
+
+// loadDotEnv sets variables from the project's .env file, if there is one,
+// without overwriting any that are already set. Lines are KEY=VALUE, with an
+// optional "export " prefix and quotes around the value; blank lines and
+// lines starting with # are ignored.
+func loadDotEnv(projectDir string) error {
+	path := filepath.Join(projectDir, dotEnvFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dotEnvFile, err)
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", dotEnvFile, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", dotEnvFile, i+1, err)
+		}
+	}
+	return nil
+}
+
+// resolveCredentials returns the API key and OAuth token to hand to agents.
+// Environment variables take precedence over the files named in
+// [credentials].
+func resolveCredentials(getenv func(string) string, cfg *config.Config, projectDir string) (apiKey, oauthToken string, err error) {
+	fileKey, fileToken, err := cfg.Credentials.Read(projectDir)
+	if err != nil {
+		return "", "", err
+	}
+	apiKey = getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		apiKey = fileKey
+	}
+	oauthToken = getenv("CLAUDE_CODE_OAUTH_TOKEN")
+	if oauthToken == "" {
+		oauthToken = fileToken
+	}
+	return apiKey, oauthToken, nil
+}
+
 // formatDuration formats seconds into a human-readable string like "2h 15m 30s".
 func formatDuration(secs int) string {
 	d := time.Duration(secs) * time.Second
@@ -90,3 +173,17 @@ func formatRelativeTime(t time.Time) string {
 		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
 	}
 }
+
+// formatBytes formats a byte count using binary units, e.g. "512MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,8 +13,9 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/robmorgan/metamorph/assets"
+	"github.com/robmorgan/metamorph/internal/config"
 	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/docker"
 	"github.com/robmorgan/metamorph/internal/gitops"
 	"github.com/spf13/cobra"
 )
@@ -26,15 +29,21 @@ var runCmd = &cobra.Command{
 			return err
 		}
 
+		// Load .env first so ${VAR} references in metamorph.toml can use it.
+		if err := loadDotEnv(projectDir); err != nil {
+			return err
+		}
 		cfg, err := loadConfig(projectDir)
 		if err != nil {
 			return err
 		}
 
-		oauthToken := os.Getenv("CLAUDE_CODE_OAUTH_TOKEN")
-		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		apiKey, oauthToken, err := resolveCredentials(os.Getenv, cfg, projectDir)
+		if err != nil {
+			return err
+		}
 		if oauthToken == "" && apiKey == "" {
-			return fmt.Errorf("no credentials found: set CLAUDE_CODE_OAUTH_TOKEN (Claude Pro/Max) or ANTHROPIC_API_KEY")
+			return fmt.Errorf("no credentials found: set CLAUDE_CODE_OAUTH_TOKEN (Claude Pro/Max) or ANTHROPIC_API_KEY, or configure [credentials] in metamorph.toml")
 		}
 
 		if _, err := exec.LookPath("claude"); err != nil {
@@ -43,6 +52,16 @@ var runCmd = &cobra.Command{
 
 		once, _ := cmd.Flags().GetBool("once")
 		role, _ := cmd.Flags().GetString("role")
+		maxIterations := cfg.Run.MaxIterations
+		if cmd.Flags().Changed("iterations") {
+			maxIterations, _ = cmd.Flags().GetInt("iterations")
+			if maxIterations < 0 {
+				return fmt.Errorf("--iterations must not be negative")
+			}
+		}
+		if once {
+			maxIterations = 1
+		}
 
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 
@@ -54,7 +73,17 @@ var runCmd = &cobra.Command{
 		defer func() { _ = os.RemoveAll(tmpDir) }()
 
 		agentDir := filepath.Join(tmpDir, "agent-work")
-		if err := gitops.CloneForAgent(upstreamPath, 0, agentDir); err != nil {
+		// No daemon merges agent branches here, so always work on the default branch.
+		cloneOpts := gitops.CloneOpts{
+			SignCommits: cfg.Git.SignCommits,
+			SigningKey:  cfg.Git.SigningKey,
+			Depth:       cfg.Git.CloneDepth,
+		}
+		if cfg.Git.UseAuthorIdentity {
+			cloneOpts.AuthorName = cfg.Git.AuthorName
+			cloneOpts.AuthorEmail = cfg.Git.AuthorEmail
+		}
+		if err := gitops.CloneForAgent(context.Background(), upstreamPath, 0, agentDir, cloneOpts); err != nil {
 			return fmt.Errorf("failed to clone upstream: %w", err)
 		}
 
@@ -67,22 +96,22 @@ var runCmd = &cobra.Command{
 		done := make(chan struct{})
 		go func() {
 			defer close(done)
-			for {
-				// Pull latest changes.
-				pullCmd := exec.Command("git", "pull", "--rebase", "origin", "HEAD")
-				pullCmd.Dir = agentDir
-				_ = pullCmd.Run() // best effort
+			for iteration := 1; ; iteration++ {
+				// Pull latest changes (best effort).
+				if err := pullRebase(agentDir); err != nil {
+					slog.Warn("failed to pull latest changes", "error", err)
+				}
 
-				// Read the system prompt (embedded) and user prompt (project dir),
+				// Read the system prompt (built-in or system_prompt_file) and user prompt (project dir),
 				// then concatenate and expand ${VAR} placeholders.
-				userPromptPath := filepath.Join(projectDir, constants.AgentPromptFile)
+				userPromptPath := docker.AgentPromptPath(projectDir, role)
 				userPromptData, err := os.ReadFile(userPromptPath)
 				if err != nil {
 					slog.Error("failed to read user agent prompt", "error", err)
 					return
 				}
 
-				combined := assets.SystemPrompt + "\n" + string(userPromptData)
+				combined := cfg.Agents.SystemPrompt(projectDir) + "\n" + string(userPromptData)
 				prompt := os.Expand(combined, func(key string) string {
 					switch key {
 					case "AGENT_ID":
@@ -91,6 +120,8 @@ var runCmd = &cobra.Command{
 						return role
 					case "AGENT_MODEL":
 						return cfg.Agents.Model
+					case "TASK_LOCK_DIR":
+						return cfg.Tasks.LockDir
 					default:
 						return os.Getenv(key)
 					}
@@ -137,29 +168,22 @@ var runCmd = &cobra.Command{
 				}
 
 				// Push any commits the agent made during this session.
-				pushCmd := exec.Command("git", "push", "origin", "HEAD")
-				pushCmd.Dir = agentDir
-				if err := pushCmd.Run(); err != nil {
-					slog.Warn("push failed, pulling and retrying", "error", err)
-					retryPull := exec.Command("git", "pull", "--rebase", "origin", "HEAD")
-					retryPull.Dir = agentDir
-					_ = retryPull.Run()
-					retryPush := exec.Command("git", "push", "origin", "HEAD")
-					retryPush.Dir = agentDir
-					_ = retryPush.Run()
+				if err := pushWithRetry(agentDir); err != nil {
+					slog.Warn("push failed; commits stay local until the next iteration", "error", err)
 				}
 
-				if once {
+				if maxIterations > 0 && iteration >= maxIterations {
 					return
 				}
 
-				if sessionDuration < 30*time.Second {
-					slog.Warn("session lasted under 30s (possible rate limit), backing off 5m", "duration", sessionDuration)
-					time.Sleep(5 * time.Minute)
+				delay, rateLimited := nextSessionDelay(sessionDuration, cfg.Run)
+				if rateLimited {
+					slog.Warn("session was shorter than min_session_duration (possible rate limit), backing off",
+						"duration", sessionDuration, "backoff", delay)
 				} else {
-					slog.Info("sleeping before next iteration", "duration", sessionDuration)
-					time.Sleep(5 * time.Second)
+					slog.Info("sleeping before next iteration", "duration", sessionDuration, "delay", delay)
 				}
+				time.Sleep(delay)
 			}
 		}()
 
@@ -173,8 +197,79 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// errRebaseConflict is returned when rebasing onto upstream hits a conflict.
+// The rebase has been aborted, leaving the agent's commits unpushed.
+var errRebaseConflict = errors.New("rebase onto upstream conflicted and was aborted")
+
+// pushWithRetry pushes HEAD to origin. If the push is rejected it rebases
+// onto origin and pushes once more; a conflicting rebase is aborted and the
+// push skipped, so the clone is never left mid-rebase.
+func pushWithRetry(dir string) error {
+	if _, err := runGit(dir, "push", "origin", "HEAD"); err == nil {
+		return nil
+	}
+	if err := pullRebase(dir); err != nil {
+		return err
+	}
+	if out, err := runGit(dir, "push", "origin", "HEAD"); err != nil {
+		return fmt.Errorf("push failed after rebase: %w: %s", err, out)
+	}
+	return nil
+}
+
+// pullRebase rebases the current branch onto origin. If the rebase stops on
+// a conflict it is aborted and errRebaseConflict returned.
+func pullRebase(dir string) error {
+	out, err := runGit(dir, "pull", "--rebase", "origin", "HEAD")
+	if err == nil {
+		return nil
+	}
+	if rebaseInProgress(dir) {
+		if abortOut, abortErr := runGit(dir, "rebase", "--abort"); abortErr != nil {
+			return fmt.Errorf("failed to abort conflicting rebase: %w: %s", abortErr, abortOut)
+		}
+		return errRebaseConflict
+	}
+	return fmt.Errorf("git pull --rebase failed: %w: %s", err, out)
+}
+
+// rebaseInProgress reports whether dir has a stopped rebase.
+func rebaseInProgress(dir string) bool {
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := runGit(dir, "rev-parse", "--git-path", name)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// runGit runs git in dir and returns its trimmed combined output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// nextSessionDelay returns how long to wait before the next session, and
+// whether the last one was short enough to be treated as rate-limited.
+func nextSessionDelay(sessionDuration time.Duration, rc config.RunConfig) (time.Duration, bool) {
+	if sessionDuration < rc.MinSessionDuration {
+		return rc.RateLimitBackoff, true
+	}
+	return rc.RestartDelay, false
+}
+
 func init() {
-	runCmd.Flags().Bool("once", false, "Run a single agent iteration and exit")
+	runCmd.Flags().Bool("once", false, "Run a single agent iteration and exit (same as --iterations 1)")
+	runCmd.Flags().Int("iterations", 0, "Stop after this many iterations (0 = forever; overrides run.max_iterations)")
 	runCmd.Flags().String("role", "developer", "Agent role to use")
 	rootCmd.AddCommand(runCmd)
 }
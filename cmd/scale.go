@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/robmorgan/metamorph/internal/daemon"
+	"github.com/spf13/cobra"
+)
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale <count>",
+	Short: "Change the number of running agents",
+	Long: `Scale the running daemon to the given number of agents without a restart.
+New agents get the next sequential IDs and round-robin roles; scaling down
+stops the highest-numbered agents first. The change is applied on the
+daemon's next monitor tick (within 30 seconds).
+
+This does not modify metamorph.toml; the configured count is used again on
+the next 'metamorph start'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid agent count %q: must be a positive number", args[0])
+		}
+
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		if !daemon.IsRunning(projectDir) {
+			return fmt.Errorf("daemon is not running")
+		}
+
+		if err := daemon.RequestScale(projectDir, n); err != nil {
+			return err
+		}
+
+		fmt.Printf("Requested scale to %d agents. The daemon will apply it within 30 seconds.\n", n)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scaleCmd)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"text/tabwriter"
 
+	"github.com/robmorgan/metamorph/internal/config"
 	"github.com/robmorgan/metamorph/internal/constants"
 	"github.com/robmorgan/metamorph/internal/daemon"
 	"github.com/robmorgan/metamorph/internal/docker"
@@ -32,12 +34,16 @@ func init() {
 	startCmd.Flags().IntP("agents", "n", 0, "Number of agents to start (overrides config)")
 	startCmd.Flags().String("model", "", "Model to use (overrides config)")
 	startCmd.Flags().Bool("dry-run", false, "Print what would happen without starting")
+	startCmd.Flags().Bool("reset-stats", false, "Reset commit/task counters carried over from previous runs")
+	startCmd.Flags().Bool("rebuild", false, "Rebuild the agent image even if it is up to date")
+	startCmd.Flags().Bool("no-restart", false, "Leave crashed agents stopped for inspection instead of restarting them (overrides daemon.auto_restart)")
+	startCmd.Flags().String("log-format", "", `Daemon log format, "text" or "json" (overrides daemon.log_format)`)
 
 	// Hidden flags for daemon re-exec.
 	startCmd.Flags().Bool("daemon-mode", false, "Run as daemon (internal)")
 	startCmd.Flags().String("project-dir", "", "Project directory (internal)")
-	startCmd.Flags().String("api-key", "", "API key (internal)")
-	startCmd.Flags().String("oauth-token", "", "OAuth token (internal)")
+	startCmd.Flags().String("api-key", "", "API key (internal, deprecated: passed via environment)")
+	startCmd.Flags().String("oauth-token", "", "OAuth token (internal, deprecated: passed via environment)")
 	_ = startCmd.Flags().MarkHidden("daemon-mode")
 	_ = startCmd.Flags().MarkHidden("project-dir")
 	_ = startCmd.Flags().MarkHidden("api-key")
@@ -54,14 +60,32 @@ func runDaemonMode(cmd *cobra.Command) error {
 	if projectDir == "" {
 		return fmt.Errorf("--project-dir is required in daemon mode")
 	}
-	if apiKey == "" && oauthToken == "" {
-		return fmt.Errorf("--api-key or --oauth-token is required in daemon mode")
-	}
 
 	cfg, err := loadConfig(projectDir)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := applyLogFormat(cmd, cfg); err != nil {
+		return err
+	}
+	applyNoRestart(cmd, cfg)
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, cfg.Daemon.LogFormat)))
+
+	// The parent passes credentials through the environment; the flags are
+	// still accepted for daemons started by older binaries.
+	envKey, envToken, err := resolveCredentials(os.Getenv, cfg, projectDir)
+	if err != nil {
+		return err
+	}
+	if envKey != "" {
+		apiKey = envKey
+	}
+	if envToken != "" {
+		oauthToken = envToken
+	}
+	if apiKey == "" && oauthToken == "" {
+		return fmt.Errorf("no credentials passed to daemon: set ANTHROPIC_API_KEY or CLAUDE_CODE_OAUTH_TOKEN")
+	}
 
 	// Override git author from env vars if set.
 	if name := os.Getenv("GIT_AUTHOR_NAME"); name != "" {
@@ -71,7 +95,7 @@ func runDaemonMode(cmd *cobra.Command) error {
 		cfg.Git.AuthorEmail = email
 	}
 
-	dockerClient, err := docker.NewClient(cfg.Project.Name)
+	dockerClient, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
 	if err != nil {
 		return fmt.Errorf("failed to create Docker client: %w", err)
 	}
@@ -79,6 +103,29 @@ func runDaemonMode(cmd *cobra.Command) error {
 	return daemon.Run(projectDir, cfg, apiKey, oauthToken, dockerClient)
 }
 
+// applyLogFormat overrides daemon.log_format with --log-format, which is
+// forwarded to the daemon when it is re-executed.
+func applyLogFormat(cmd *cobra.Command, cfg *config.Config) error {
+	format, _ := cmd.Flags().GetString("log-format")
+	switch format {
+	case "":
+	case "text", "json":
+		cfg.Daemon.LogFormat = format
+	default:
+		return fmt.Errorf("invalid --log-format: %q (must be \"text\" or \"json\")", format)
+	}
+	return nil
+}
+
+// applyNoRestart turns daemon.auto_restart off when --no-restart is given.
+// It is forwarded to the daemon when it is re-executed.
+func applyNoRestart(cmd *cobra.Command, cfg *config.Config) {
+	if noRestart, _ := cmd.Flags().GetBool("no-restart"); noRestart {
+		autoRestart := false
+		cfg.Daemon.AutoRestart = &autoRestart
+	}
+}
+
 func runForegroundStart(cmd *cobra.Command) error {
 	projectDir, err := resolveProjectDir()
 	if err != nil {
@@ -90,10 +137,18 @@ func runForegroundStart(cmd *cobra.Command) error {
 		return fmt.Errorf("project directory is not a git repository\n\nRun 'metamorph init' to configure the project properly")
 	}
 
+	// Load .env first so ${VAR} references in metamorph.toml can use it.
+	if err := loadDotEnv(projectDir); err != nil {
+		return err
+	}
 	cfg, err := loadConfig(projectDir)
 	if err != nil {
 		return err
 	}
+	if err := applyLogFormat(cmd, cfg); err != nil {
+		return err
+	}
+	applyNoRestart(cmd, cfg)
 
 	// Override git author from env vars if set.
 	if name := os.Getenv("GIT_AUTHOR_NAME"); name != "" {
@@ -118,7 +173,7 @@ func runForegroundStart(cmd *cobra.Command) error {
 	upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 	if _, err := os.Stat(upstreamPath); os.IsNotExist(err) {
 		fmt.Println("Creating upstream repository...")
-		if err := gitops.InitUpstream(projectDir); err != nil {
+		if err := gitops.InitUpstream(context.Background(), projectDir, cfg.Git.DefaultBranch, cfg.Tasks.LockDir); err != nil {
 			return fmt.Errorf("failed to initialize upstream repo: %w", err)
 		}
 	}
@@ -138,10 +193,12 @@ func runForegroundStart(cmd *cobra.Command) error {
 		slog.Info("overriding model from flag", "model", model)
 	}
 
-	oauthToken := os.Getenv("CLAUDE_CODE_OAUTH_TOKEN")
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	apiKey, oauthToken, err := resolveCredentials(os.Getenv, cfg, projectDir)
+	if err != nil {
+		return err
+	}
 	if oauthToken == "" && apiKey == "" {
-		return fmt.Errorf("no credentials found: set CLAUDE_CODE_OAUTH_TOKEN (Claude Pro/Max) or ANTHROPIC_API_KEY")
+		return fmt.Errorf("no credentials found: set CLAUDE_CODE_OAUTH_TOKEN (Claude Pro/Max) or ANTHROPIC_API_KEY, or configure [credentials] in metamorph.toml")
 	}
 
 	if daemon.IsRunning(projectDir) {
@@ -162,6 +219,18 @@ func runForegroundStart(cmd *cobra.Command) error {
 	// Actually, per design: config file is authoritative for the daemon.
 	// Overrides only affect this display. The user should edit metamorph.toml.
 
+	if resetStats, _ := cmd.Flags().GetBool("reset-stats"); resetStats {
+		if err := daemon.ResetStats(projectDir); err != nil {
+			return err
+		}
+	}
+
+	if rebuild, _ := cmd.Flags().GetBool("rebuild"); rebuild {
+		if err := docker.InvalidateBuildCache(projectDir); err != nil {
+			return err
+		}
+	}
+
 	fmt.Printf("Starting metamorph daemon for %q...\n", cfg.Project.Name)
 
 	if err := daemon.Start(projectDir, cfg, apiKey, oauthToken); err != nil {
@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/robmorgan/metamorph/internal/daemon"
 	"github.com/spf13/cobra"
 )
 
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the status of running agents",
@@ -20,6 +28,18 @@ var statusCmd = &cobra.Command{
 		}
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetInt("interval")
+
+		if watch {
+			if jsonOutput {
+				return fmt.Errorf("--watch cannot be combined with --json")
+			}
+			if interval <= 0 {
+				return fmt.Errorf("--interval must be at least 1 second")
+			}
+			return watchStatus(projectDir, time.Duration(interval)*time.Second)
+		}
 
 		state, err := daemon.GetStatus(projectDir)
 		if err != nil {
@@ -39,39 +59,112 @@ var statusCmd = &cobra.Command{
 			return nil
 		}
 
-		// Table mode.
-		fmt.Printf("Project:  %s\n", state.ProjectName)
-		fmt.Printf("Status:   %s\n", state.Status)
-		fmt.Printf("Uptime:   %s\n", formatDuration(state.Stats.UptimeSeconds))
-		fmt.Printf("Started:  %s\n", state.StartedAt.Local().Format("2006-01-02 15:04:05"))
-		fmt.Println()
-
-		if len(state.Agents) > 0 {
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			_, _ = fmt.Fprintln(w, "AGENT\tROLE\tSTATUS\tTASK\tLAST ACTIVITY")
-			for _, a := range state.Agents {
-				task := "-"
-				if a.CurrentTask != nil {
-					task = *a.CurrentTask
-				}
-				lastAct := "-"
-				if !a.LastActivity.IsZero() {
-					lastAct = formatRelativeTime(a.LastActivity)
-				}
-				_, _ = fmt.Fprintf(w, "agent-%d\t%s\t%s\t%s\t%s\n", a.ID, a.Role, a.Status, task, lastAct)
+		printStatus(os.Stdout, state)
+		return nil
+	},
+}
+
+// printStatus renders the daemon state as the status table.
+func printStatus(out io.Writer, state *daemon.State) {
+	_, _ = fmt.Fprintf(out, "Project:  %s\n", state.ProjectName)
+	_, _ = fmt.Fprintf(out, "Status:   %s\n", state.Status)
+	if state.Status == "stale" {
+		_, _ = fmt.Fprintln(out, "Warning:  the daemon process is alive but its monitor loop has not run recently.")
+		_, _ = fmt.Fprintln(out, "          Agents are not being supervised; see .metamorph/daemon.log, or restart with 'metamorph stop' and 'metamorph start'.")
+	}
+	_, _ = fmt.Fprintf(out, "Uptime:   %s\n", formatDuration(state.Stats.UptimeSeconds))
+	_, _ = fmt.Fprintf(out, "Started:  %s\n", state.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	if n := state.NotifyStatus; n != nil {
+		if n.Error != "" {
+			_, _ = fmt.Fprintf(out, "Notify:   FAILED %s (%s): %s\n", formatRelativeTime(n.LastAttempt), n.Event, n.Error)
+		} else {
+			_, _ = fmt.Fprintf(out, "Notify:   ok %s (%s)\n", formatRelativeTime(n.LastAttempt), n.Event)
+		}
+	}
+	_, _ = fmt.Fprintln(out)
+
+	if len(state.Agents) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "AGENT\tROLE\tSTATUS\tUPTIME\tRESTARTS\tCPU\tMEM\tTASK\tLAST ACTIVITY")
+		for _, a := range state.Agents {
+			task := "-"
+			if a.CurrentTask != nil {
+				task = formatTask(*a.CurrentTask, a.TaskDescription)
+			}
+			lastAct := "-"
+			if !a.LastActivity.IsZero() {
+				lastAct = formatRelativeTime(a.LastActivity)
+			}
+			uptime := "-"
+			if (a.Status == "running" || a.Status == "unhealthy") && !a.StartedAt.IsZero() {
+				uptime = formatDuration(int(time.Since(a.StartedAt).Seconds()))
+			}
+			cpu, mem := "-", "-"
+			if a.MemoryBytes > 0 {
+				cpu = fmt.Sprintf("%.1f%%", a.CPUPercent)
+				mem = formatBytes(a.MemoryBytes)
 			}
-			_ = w.Flush()
-			fmt.Println()
+			_, _ = fmt.Fprintf(w, "agent-%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+				a.ID, a.Role, a.Status, uptime, a.RestartCount, cpu, mem, task, lastAct)
 		}
+		_ = w.Flush()
+		_, _ = fmt.Fprintln(out)
+	}
 
-		fmt.Printf("Commits: %d  Sessions: %d  Tasks completed: %d\n",
-			state.Stats.TotalCommits, state.Stats.TotalSessions, state.Stats.TasksCompleted)
+	_, _ = fmt.Fprintf(out, "Commits: %d  Sessions: %d  Tasks completed: %d\n",
+		state.Stats.TotalCommits, state.Stats.TotalSessions, state.Stats.TasksCompleted)
+}
 
-		return nil
-	},
+// watchStatus redraws the status table every interval until interrupted.
+func watchStatus(projectDir string, interval time.Duration) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Render into a buffer first so the screen is cleared and redrawn in
+		// one write instead of flickering.
+		var buf bytes.Buffer
+		_, _ = fmt.Fprintf(&buf, "Every %s: metamorph status    %s\n\n", interval, time.Now().Format("15:04:05"))
+		state, err := daemon.GetStatus(projectDir)
+		switch {
+		case err == nil:
+			printStatus(&buf, state)
+		case !daemon.IsRunning(projectDir):
+			buf.WriteString("Daemon is not running.\n")
+		default:
+			_, _ = fmt.Fprintf(&buf, "Failed to read status: %v\n", err)
+		}
+		fmt.Print(clearScreen + buf.String())
+
+		select {
+		case <-sigCh:
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
 
 func init() {
 	statusCmd.Flags().Bool("json", false, "Output status as JSON")
+	statusCmd.Flags().BoolP("watch", "w", false, "Redraw the status table until interrupted")
+	statusCmd.Flags().Int("interval", 2, "Seconds between redraws with --watch")
 	rootCmd.AddCommand(statusCmd)
 }
+
+// maxTaskDescription is how much of a task description the status table shows.
+const maxTaskDescription = 40
+
+// formatTask renders a task for the status table, with its description
+// shortened to fit.
+func formatTask(name, description string) string {
+	if description == "" {
+		return name
+	}
+	if r := []rune(description); len(r) > maxTaskDescription {
+		description = string(r[:maxTaskDescription-3]) + "..."
+	}
+	return fmt.Sprintf("%s (%s)", name, description)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -29,6 +30,12 @@ var stopCmd = &cobra.Command{
 			fmt.Println("Warning: could not read daemon state")
 		}
 
+		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return previewStop(upstreamPath, projectDir, state)
+		}
+
 		fmt.Println("Stopping metamorph daemon...")
 
 		if err := daemon.Stop(projectDir); err != nil {
@@ -36,14 +43,13 @@ var stopCmd = &cobra.Command{
 		}
 
 		// Sync upstream to working copy (still needed for task file reading).
-		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 		workingCopyPath := filepath.Join(projectDir, ".metamorph", "work")
-		if _, err := gitops.SyncToWorkingCopy(upstreamPath, workingCopyPath); err != nil {
+		if _, err := gitops.SyncToWorkingCopy(context.Background(), upstreamPath, workingCopyPath); err != nil {
 			fmt.Printf("Warning: failed to sync working copy: %v\n", err)
 		}
 
 		// Sync agent commits to user's project.
-		summary, err := gitops.SyncToProjectDir(upstreamPath, projectDir)
+		summary, err := gitops.SyncToProjectDirWithStrategy(context.Background(), upstreamPath, projectDir, projectSyncStrategy(projectDir))
 		if err != nil {
 			fmt.Printf("Warning: failed to sync to project: %v\n", err)
 		} else if summary != "" {
@@ -65,5 +71,33 @@ var stopCmd = &cobra.Command{
 }
 
 func init() {
+	stopCmd.Flags().Bool("dry-run", false, "Show what stopping would sync to the project without stopping anything")
 	rootCmd.AddCommand(stopCmd)
 }
+
+// previewStop prints the agents that would be stopped and the upstream
+// commits that would be synced into the project dir.
+func previewStop(upstreamPath, projectDir string, state *daemon.State) error {
+	fmt.Println("Dry run: the daemon is still running and nothing was synced.")
+
+	if state != nil {
+		running := 0
+		for _, a := range state.Agents {
+			if a.Status == "running" || a.Status == "unhealthy" {
+				running++
+			}
+		}
+		fmt.Printf("\nAgents that would be stopped: %d\n", running)
+	}
+
+	pending, err := gitops.PendingCommits(context.Background(), upstreamPath, projectDir)
+	if err != nil {
+		return fmt.Errorf("failed to compute pending commits: %w", err)
+	}
+	if pending == "" {
+		fmt.Println("\nNo new commits to sync.")
+		return nil
+	}
+	fmt.Printf("\nCommits that would be synced:\n%s\n", pending)
+	return nil
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 
 	"github.com/robmorgan/metamorph/internal/constants"
@@ -21,13 +23,17 @@ var syncCmd = &cobra.Command{
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 		workingCopyPath := filepath.Join(projectDir, ".metamorph", "work")
 
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return syncDryRun(cmd.OutOrStdout(), upstreamPath, projectDir)
+		}
+
 		// Sync upstream to working copy (for task file reading).
-		if _, err := gitops.SyncToWorkingCopy(upstreamPath, workingCopyPath); err != nil {
+		if _, err := gitops.SyncToWorkingCopy(context.Background(), upstreamPath, workingCopyPath); err != nil {
 			fmt.Printf("Warning: failed to sync working copy: %v\n", err)
 		}
 
 		// Sync agent commits to user's project.
-		summary, err := gitops.SyncToProjectDir(upstreamPath, projectDir)
+		summary, err := gitops.SyncToProjectDirWithStrategy(context.Background(), upstreamPath, projectDir, projectSyncStrategy(projectDir))
 		if err != nil {
 			return fmt.Errorf("sync failed: %w", err)
 		}
@@ -42,6 +48,22 @@ var syncCmd = &cobra.Command{
 	},
 }
 
+// syncDryRun prints the upstream commits a sync would bring into the
+// project, leaving its branch and working tree untouched.
+func syncDryRun(out io.Writer, upstreamPath, projectDir string) error {
+	pending, err := gitops.PendingCommits(context.Background(), upstreamPath, projectDir)
+	if err != nil {
+		return fmt.Errorf("failed to compute pending commits: %w", err)
+	}
+	if pending == "" {
+		_, _ = fmt.Fprintln(out, "Already up to date.")
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "Commits that would be synced:\n%s\n", pending)
+	return nil
+}
+
 func init() {
+	syncCmd.Flags().Bool("dry-run", false, "Show the commits that would be synced without changing the project")
 	rootCmd.AddCommand(syncCmd)
 }
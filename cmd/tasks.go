@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/daemon"
 	"github.com/robmorgan/metamorph/internal/gitops"
 	"github.com/robmorgan/metamorph/internal/tasks"
 	"github.com/spf13/cobra"
@@ -25,21 +28,31 @@ var tasksCmd = &cobra.Command{
 			return err
 		}
 
+		if history, _ := cmd.Flags().GetBool("history"); history {
+			jsonOutput, _ := cmd.Flags().GetBool("json")
+			return showTaskHistory(projectDir, jsonOutput)
+		}
+
 		// Sync to working copy first so we can read task files.
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 		workingCopyPath := filepath.Join(projectDir, ".metamorph", "work")
-		if _, err := gitops.SyncToWorkingCopy(upstreamPath, workingCopyPath); err != nil {
+		if _, err := gitops.SyncToWorkingCopy(context.Background(), upstreamPath, workingCopyPath); err != nil {
 			return fmt.Errorf("failed to sync working copy: %w", err)
 		}
 
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
 		clearFlag, _ := cmd.Flags().GetBool("clear")
 		jsonOutput, _ := cmd.Flags().GetBool("json")
 
 		if clearFlag {
-			return clearStaleTasks(workingCopyPath)
+			return clearStaleTasks(os.Stdin, workingCopyPath, cfg.Tasks.LockDir, cfg.Daemon.StaleTaskMaxAge)
 		}
 
-		locks, err := tasks.ListTasks(workingCopyPath)
+		locks, err := tasks.ListTasks(workingCopyPath, cfg.Tasks.LockDir)
 		if err != nil {
 			return fmt.Errorf("failed to list tasks: %w", err)
 		}
@@ -50,7 +63,7 @@ var tasksCmd = &cobra.Command{
 		}
 
 		if jsonOutput {
-			data, err := json.MarshalIndent(locks, "", "  ")
+			data, err := json.MarshalIndent(taskLocksJSON(locks, time.Now()), "", "  ")
 			if err != nil {
 				return fmt.Errorf("failed to marshal tasks: %w", err)
 			}
@@ -59,14 +72,19 @@ var tasksCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		_, _ = fmt.Fprintln(w, "TASK\tAGENT\tCLAIMED AT\tDURATION")
+		_, _ = fmt.Fprintln(w, "TASK\tAGENT\tCLAIMED AT\tDURATION\tDESCRIPTION")
 		for _, lock := range locks {
 			duration := time.Since(lock.ClaimedAt).Truncate(time.Second)
-			_, _ = fmt.Fprintf(w, "%s\tagent-%d\t%s\t%s\n",
+			description := lock.Description
+			if description == "" {
+				description = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s\tagent-%d\t%s\t%s\t%s\n",
 				lock.Name,
 				lock.AgentID,
 				lock.ClaimedAt.Local().Format("2006-01-02 15:04:05"),
 				duration.String(),
+				description,
 			)
 		}
 		_ = w.Flush()
@@ -75,14 +93,200 @@ var tasksCmd = &cobra.Command{
 	},
 }
 
+// taskLockJSON is a task lock as printed by `tasks --json`: the lock's own
+// fields plus its age, so dashboards don't need to compute it.
+type taskLockJSON struct {
+	tasks.TaskLock
+	AgeSeconds int `json:"age_seconds"`
+}
+
+// taskLocksJSON returns locks with their ages as of now.
+func taskLocksJSON(locks []tasks.TaskLock, now time.Time) []taskLockJSON {
+	out := make([]taskLockJSON, len(locks))
+	for i, lock := range locks {
+		out[i] = taskLockJSON{TaskLock: lock, AgeSeconds: int(now.Sub(lock.ClaimedAt).Seconds())}
+	}
+	return out
+}
+
+var tasksReleaseCmd = &cobra.Command{
+	Use:   "release <name>",
+	Short: "Release a task lock held by any agent",
+	Long: `Remove the lock for a single task and push the removal, regardless of
+which agent holds it. Requires --force, since the agent may still be working
+on the task.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		force, _ := cmd.Flags().GetBool("force")
+
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+		workingCopyPath := filepath.Join(projectDir, ".metamorph", "work")
+		if _, err := gitops.SyncToWorkingCopy(context.Background(), upstreamPath, workingCopyPath); err != nil {
+			return fmt.Errorf("failed to sync working copy: %w", err)
+		}
+
+		locks, err := tasks.ListTasks(workingCopyPath, cfg.Tasks.LockDir)
+		if err != nil {
+			return fmt.Errorf("failed to list tasks: %w", err)
+		}
+		var held *tasks.TaskLock
+		for i := range locks {
+			if locks[i].Name == name {
+				held = &locks[i]
+				break
+			}
+		}
+		if held == nil {
+			return fmt.Errorf("no lock found for task %q", name)
+		}
+
+		if !force {
+			return fmt.Errorf("task %q is held by agent-%d (claimed %s); re-run with --force to release it",
+				name, held.AgentID, held.ClaimedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+
+		lock, err := tasks.ForceReleaseTask(workingCopyPath, cfg.Tasks.LockDir, name)
+		if err != nil {
+			return fmt.Errorf("failed to release task: %w", err)
+		}
+
+		fmt.Printf("Released %s (held by agent-%d since %s)\n",
+			name, lock.AgentID, lock.ClaimedAt.Local().Format("2006-01-02 15:04:05"))
+		return nil
+	},
+}
+
+var tasksClaimCmd = &cobra.Command{
+	Use:   "claim <name> --agent <id>",
+	Short: "Claim a task for an agent",
+	Long: `Claim a task on behalf of an agent by pushing a lock file, exactly as the
+agent would. Useful for seeding work to a specific agent or testing the
+locking mechanism. Fails if the task is already locked or another agent wins
+the race.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		agentID, _ := cmd.Flags().GetInt("agent")
+		description, _ := cmd.Flags().GetString("description")
+		if agentID <= 0 {
+			return fmt.Errorf("--agent must be a positive agent ID")
+		}
+		if err := tasks.ValidateTaskName(name); err != nil {
+			return err
+		}
+
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+		workingCopyPath := filepath.Join(projectDir, ".metamorph", "work")
+		if _, err := gitops.SyncToWorkingCopy(context.Background(), upstreamPath, workingCopyPath); err != nil {
+			return fmt.Errorf("failed to sync working copy: %w", err)
+		}
+
+		locks, err := tasks.ListTasks(workingCopyPath, cfg.Tasks.LockDir)
+		if err != nil {
+			return fmt.Errorf("failed to list tasks: %w", err)
+		}
+		for _, lock := range locks {
+			if lock.Name == name {
+				return fmt.Errorf("task %q is already held by agent-%d (claimed %s)",
+					name, lock.AgentID, lock.ClaimedAt.Local().Format("2006-01-02 15:04:05"))
+			}
+		}
+
+		claimed, err := tasks.ClaimTask(workingCopyPath, cfg.Tasks.LockDir, name, agentID, description, cfg.Tasks.ClaimRetries)
+		if err != nil {
+			return fmt.Errorf("failed to claim task: %w", err)
+		}
+		if !claimed {
+			return fmt.Errorf("lost the race: another agent claimed %q first", name)
+		}
+
+		fmt.Printf("Claimed %s for agent-%d\n", name, agentID)
+		return nil
+	},
+}
+
 func init() {
 	tasksCmd.Flags().Bool("clear", false, "Clear stale task locks (interactive)")
 	tasksCmd.Flags().Bool("json", false, "Output tasks as JSON")
+	tasksCmd.Flags().Bool("history", false, "Show recently completed and cleared tasks")
+	tasksReleaseCmd.Flags().Bool("force", false, "Confirm releasing a lock another agent holds")
+	tasksClaimCmd.Flags().Int("agent", 0, "ID of the agent to claim the task for")
+	tasksClaimCmd.Flags().String("description", "", "What the agent is doing, shown by 'tasks' and 'status'")
+	_ = tasksClaimCmd.MarkFlagRequired("agent")
+	tasksCmd.AddCommand(tasksReleaseCmd)
+	tasksCmd.AddCommand(tasksClaimCmd)
 	rootCmd.AddCommand(tasksCmd)
 }
 
-func clearStaleTasks(workingCopyPath string) error {
-	locks, err := tasks.ListTasks(workingCopyPath)
+// taskHistoryLimit is how many entries 'metamorph tasks --history' shows.
+const taskHistoryLimit = 50
+
+// showTaskHistory prints the most recent task history entries, oldest first.
+func showTaskHistory(projectDir string, jsonOutput bool) error {
+	entries, err := daemon.ReadTaskHistory(projectDir, taskHistoryLimit)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		if entries == nil {
+			entries = []daemon.TaskHistoryEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal task history: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No task history yet.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tTASK\tAGENT\tEVENT")
+	for _, e := range entries {
+		agent := "-"
+		if e.AgentID != 0 {
+			agent = fmt.Sprintf("agent-%d", e.AgentID)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			e.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			e.Task,
+			agent,
+			e.Event,
+		)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+// clearStaleTasks lists the task locks in workingCopyPath's lockDir and,
+// after confirmation read from in, removes those older than maxAge.
+func clearStaleTasks(in io.Reader, workingCopyPath, lockDir string, maxAge time.Duration) error {
+	locks, err := tasks.ListTasks(workingCopyPath, lockDir)
 	if err != nil {
 		return fmt.Errorf("failed to list tasks: %w", err)
 	}
@@ -98,8 +302,8 @@ func clearStaleTasks(workingCopyPath string) error {
 		fmt.Printf("  %s (agent-%d, %s)\n", lock.Name, lock.AgentID, duration.String())
 	}
 
-	fmt.Print("\nClear all stale tasks (older than 2h)? [y/N] ")
-	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Printf("\nClear all stale tasks (older than %s)? [y/N] ", formatMaxAge(maxAge))
+	scanner := bufio.NewScanner(in)
 	if scanner.Scan() {
 		answer := strings.TrimSpace(strings.ToLower(scanner.Text()))
 		if answer != "y" && answer != "yes" {
@@ -108,16 +312,29 @@ func clearStaleTasks(workingCopyPath string) error {
 		}
 	}
 
-	cleared, err := tasks.ClearStaleTasks(workingCopyPath, 2*time.Hour)
+	cleared, err := tasks.ClearStaleTasks(workingCopyPath, lockDir, maxAge)
 	if err != nil {
 		return fmt.Errorf("failed to clear stale tasks: %w", err)
 	}
 
 	if len(cleared) == 0 {
-		fmt.Println("No stale tasks found (all locks are less than 2h old).")
+		fmt.Printf("No stale tasks found (all locks are less than %s old).\n", formatMaxAge(maxAge))
 	} else {
 		fmt.Printf("Cleared %d stale task(s): %s\n", len(cleared), strings.Join(cleared, ", "))
 	}
 
 	return nil
 }
+
+// formatMaxAge renders a duration without zero trailing units, e.g. "2h"
+// rather than "2h0m0s".
+func formatMaxAge(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
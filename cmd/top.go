@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/daemon"
+	"github.com/robmorgan/metamorph/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+// recentCommitWindow is how far back top counts commits on the upstream. The
+// dashboard labels it "the last hour".
+const recentCommitWindow = time.Hour
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show a live dashboard of agent status and resource usage",
+	Long: `Show a full-screen view of every agent's status, CPU and memory, and
+current task, refreshed until interrupted. CPU and memory are sampled live
+from Docker; if Docker can't be reached, the daemon's last sample is shown
+instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := resolveProjectDir()
+		if err != nil {
+			return err
+		}
+
+		interval, _ := cmd.Flags().GetInt("interval")
+		if interval <= 0 {
+			return fmt.Errorf("--interval must be at least 1 second")
+		}
+
+		cfg, err := loadConfig(projectDir)
+		if err != nil {
+			return err
+		}
+
+		// Live stats are optional; without Docker, top falls back to the
+		// usage the daemon last recorded in state.json.
+		var client docker.DockerClient
+		var statsErr error
+		if c, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host); err != nil {
+			statsErr = err
+		} else {
+			client = c
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return runTop(ctx, projectDir, client, statsErr, time.Duration(interval)*time.Second)
+	},
+}
+
+// topFrame is everything one redraw of the dashboard shows.
+type topFrame struct {
+	State         *daemon.State
+	Stats         map[int]docker.AgentStats // live samples by agent ID; nil when unavailable
+	StatsErr      error                     // why live stats are unavailable, if they are
+	RecentCommits int                       // commits within recentCommitWindow, -1 if unknown
+	Interval      time.Duration
+	Now           time.Time
+}
+
+// runTop redraws the dashboard every interval until ctx is cancelled.
+func runTop(ctx context.Context, projectDir string, client docker.DockerClient, statsErr error, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+	for {
+		frame := topFrame{Interval: interval, RecentCommits: -1, StatsErr: statsErr}
+		state, err := daemon.GetStatus(projectDir)
+		if err == nil {
+			frame.State = state
+			if client != nil {
+				frame.Stats = sampleStats(ctx, client, state.Agents)
+			}
+			frame.RecentCommits = recentCommits(upstreamPath, recentCommitWindow)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		frame.Now = time.Now()
+
+		// Render into a buffer first so the screen is cleared and redrawn in
+		// one write instead of flickering.
+		var buf bytes.Buffer
+		if frame.State != nil {
+			renderTop(&buf, frame)
+		} else if !daemon.IsRunning(projectDir) {
+			buf.WriteString("Daemon is not running.\n")
+		} else {
+			_, _ = fmt.Fprintf(&buf, "Failed to read status: %v\n", err)
+		}
+		fmt.Print(clearScreen + buf.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleStats collects live usage for every running agent concurrently.
+// Agents whose stats can't be read are left out of the result.
+func sampleStats(ctx context.Context, client docker.DockerClient, agents []daemon.AgentState) map[int]docker.AgentStats {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	stats := make(map[int]docker.AgentStats)
+	for _, a := range agents {
+		if a.Status != "running" && a.Status != "unhealthy" {
+			continue
+		}
+		wg.Add(1)
+		go func(agentID int) {
+			defer wg.Done()
+			s, err := client.Stats(ctx, agentID)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			stats[agentID] = s
+			mu.Unlock()
+		}(a.ID)
+	}
+	wg.Wait()
+	return stats
+}
+
+// recentCommits counts commits on the upstream's default branch made within
+// window, or returns -1 if git can't tell.
+func recentCommits(upstreamPath string, window time.Duration) int {
+	since := fmt.Sprintf("--since=%d.seconds.ago", int(window.Seconds()))
+	out, err := runGit(upstreamPath, "rev-list", "--count", since, "HEAD")
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.Atoi(out)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// renderTop writes one frame of the dashboard to out.
+func renderTop(out io.Writer, f topFrame) {
+	state := f.State
+	_, _ = fmt.Fprintf(out, "metamorph top - %s    every %s    %s\n", state.ProjectName, f.Interval, f.Now.Format("15:04:05"))
+	_, _ = fmt.Fprintf(out, "Status: %s    Uptime: %s    Agents: %d\n", state.Status, formatDuration(state.Stats.UptimeSeconds), len(state.Agents))
+
+	recent := "-"
+	if f.RecentCommits >= 0 {
+		recent = strconv.Itoa(f.RecentCommits)
+	}
+	_, _ = fmt.Fprintf(out, "Commits: %d (%s in the last hour)    Sessions: %d    Tasks completed: %d\n",
+		state.Stats.TotalCommits, recent, state.Stats.TotalSessions, state.Stats.TasksCompleted)
+	switch {
+	case f.StatsErr != nil:
+		_, _ = fmt.Fprintf(out, "Live stats unavailable (%v); showing the daemon's last sample.\n", f.StatsErr)
+	case f.Stats == nil:
+		_, _ = fmt.Fprintln(out, "Live stats unavailable; showing the daemon's last sample.")
+	}
+	_, _ = fmt.Fprintln(out)
+
+	if len(state.Agents) == 0 {
+		_, _ = fmt.Fprintln(out, "No agents.")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "AGENT\tROLE\tSTATUS\tCPU\tMEM\tMEM%\tSESSIONS\tTASK\tLAST ACTIVITY")
+	for _, a := range state.Agents {
+		cpu, mem, memPct := "-", "-", "-"
+		if s, ok := f.Stats[a.ID]; ok {
+			cpu = fmt.Sprintf("%.1f%%", s.CPUPercent)
+			mem = formatBytes(s.MemoryBytes)
+			if s.MemoryLimit > 0 {
+				memPct = fmt.Sprintf("%.1f%%", float64(s.MemoryBytes)/float64(s.MemoryLimit)*100)
+			}
+		} else if a.MemoryBytes > 0 {
+			cpu = fmt.Sprintf("%.1f%%", a.CPUPercent)
+			mem = formatBytes(a.MemoryBytes)
+		}
+		task := "-"
+		if a.CurrentTask != nil {
+			task = formatTask(*a.CurrentTask, a.TaskDescription)
+		}
+		lastAct := "-"
+		if !a.LastActivity.IsZero() {
+			lastAct = formatRelativeTime(a.LastActivity)
+		}
+		_, _ = fmt.Fprintf(w, "agent-%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			a.ID, a.Role, a.Status, cpu, mem, memPct, a.SessionsCompleted, task, lastAct)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	topCmd.Flags().Int("interval", 2, "Seconds between refreshes")
+	rootCmd.AddCommand(topCmd)
+}
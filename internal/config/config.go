@@ -2,12 +2,21 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/robmorgan/metamorph/assets"
 	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/notify"
 )
 
 type Config struct {
@@ -17,6 +26,10 @@ type Config struct {
 	Testing       TestingConfig       `toml:"testing"`
 	Notifications NotificationsConfig `toml:"notifications"`
 	Git           GitConfig           `toml:"git"`
+	Daemon        DaemonConfig        `toml:"daemon"`
+	Credentials   CredentialsConfig   `toml:"credentials"`
+	Run           RunConfig           `toml:"run"`
+	Tasks         TasksConfig         `toml:"tasks"`
 }
 
 type ProjectConfig struct {
@@ -25,31 +38,312 @@ type ProjectConfig struct {
 }
 
 type AgentsConfig struct {
-	Count int      `toml:"count"`
-	Model string   `toml:"model"`
-	Roles []string `toml:"roles"`
+	Count        int      `toml:"count"`
+	Model        string   `toml:"model"`
+	Roles        []string `toml:"roles"`
+	MaxLogFiles  int      `toml:"max_log_files"`   // session logs kept per agent (0 = unlimited)
+	MaxLogSizeMB int      `toml:"max_log_size_mb"` // rotate a session log above this size (0 = unlimited)
+
+	// SystemPromptFile replaces the built-in system prompt that precedes
+	// AGENT_PROMPT.md. Relative paths are resolved against the project dir.
+	SystemPromptFile string `toml:"system_prompt_file"`
+}
+
+// SystemPrompt returns the contents of system_prompt_file, or the built-in
+// system prompt when it is unset or can't be read.
+func (a AgentsConfig) SystemPrompt(projectDir string) string {
+	if a.SystemPromptFile == "" {
+		return assets.SystemPrompt
+	}
+	path := a.SystemPromptFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		slog.Warn("agents.system_prompt_file not readable, using the built-in system prompt", "path", path, "error", err)
+		return assets.SystemPrompt
+	}
+	return string(data)
 }
 
 type DockerConfig struct {
 	Image         string   `toml:"image"`
 	ExtraPackages []string `toml:"extra_packages"`
+	RestartPolicy string   `toml:"restart_policy"` // "no", "on-failure" or "unless-stopped" (default)
+	GPUs          string   `toml:"gpus"`           // "all" or a device count, e.g. "1" (none when empty)
+	Host          string   `toml:"host"`           // Docker daemon address, e.g. "tcp://host:2375" (DOCKER_HOST when empty)
+	CacheVolume   string   `toml:"cache_volume"`   // named volume or host path shared by all agents as a package cache
+
+	// ImagePull pulls Image from its registry instead of building the
+	// agent image locally, for teams that publish a custom image.
+	ImagePull bool `toml:"image_pull"`
+
+	// RegistryAuth authenticates image_pull against a private registry.
+	RegistryAuth RegistryAuthConfig `toml:"registry_auth"`
+
+	// BuildTimeout bounds the agent image build (or pull, with
+	// image_pull), e.g. "15m" when extra_packages pulls large dependencies.
+	BuildTimeout time.Duration `toml:"build_timeout"`
+
+	// Command replaces the built-in session loop, e.g.
+	// ["/workspace/repo/scripts/agent-loop.sh"]. It runs after the
+	// entrypoint has cloned upstream and configured git.
+	Command []string `toml:"command"`
+}
+
+// RegistryAuthConfig holds the credentials for pulling docker.image: either
+// a username and password, or the name of a Docker credential helper.
+type RegistryAuthConfig struct {
+	Username         string `toml:"username"`
+	Password         string `toml:"password"`          // password or access token, e.g. "${GHCR_TOKEN}"
+	CredentialHelper string `toml:"credential_helper"` // runs docker-credential-<name>, e.g. "ecr-login"
 }
 
+// DefaultBuildTimeout is used when docker.build_timeout is not set.
+const DefaultBuildTimeout = 5 * time.Minute
+
+// DefaultImage is the tag of the locally built agent image, used when
+// docker.image is not set.
+const DefaultImage = "metamorph-agent:latest"
+
 type TestingConfig struct {
 	Command     string `toml:"command"`
 	FastCommand string `toml:"fast_command"`
+	RunOnSync   bool   `toml:"run_on_sync"` // run Command in the project dir after the daemon syncs new commits
 }
 
 type NotificationsConfig struct {
-	WebhookURL string `toml:"webhook_url"`
+	WebhookURL     string            `toml:"webhook_url"`
+	Format         string            `toml:"format"`          // payload format: "json" (default), "slack" or "discord"
+	SigningSecret  string            `toml:"signing_secret"`  // HMAC-SHA256 key for X-Metamorph-Signature (optional)
+	Headers        map[string]string `toml:"headers"`         // extra HTTP headers sent with every webhook request
+	ErrorPatterns  []string          `toml:"error_patterns"`  // regexes that flag an agent log line as an error
+	IgnorePatterns []string          `toml:"ignore_patterns"` // regexes that suppress otherwise matching lines
+
+	// CommitBatchInterval is how long commits are collected into a single
+	// commits_pushed event, e.g. "5m". Zero sends one event per monitor tick.
+	CommitBatchInterval time.Duration `toml:"commit_batch_interval"`
+
+	// ErrorCooldown is the minimum time between test_failure events for the
+	// same agent. Zero notifies on every monitor tick that finds an error.
+	ErrorCooldown time.Duration `toml:"error_cooldown"`
+
+	// LogScanLines is how many lines from the end of each agent's latest
+	// session log are scanned for error patterns.
+	LogScanLines int `toml:"log_scan_lines"`
+
+	// EnabledEvents limits webhooks to these event types, e.g.
+	// ["agent_crashed", "test_failure"]. Empty sends every event.
+	EnabledEvents []string `toml:"enabled_events"`
+
+	// Email sends events by email as well as (or instead of) the webhook.
+	Email EmailConfig `toml:"email"`
+}
+
+// EmailConfig configures email notifications, sent when SMTPHost is set.
+type EmailConfig struct {
+	SMTPHost string   `toml:"smtp_host"`
+	Port     int      `toml:"port"`     // SMTP port (default 587)
+	From     string   `toml:"from"`     // sender address
+	To       []string `toml:"to"`       // recipient addresses
+	Username string   `toml:"username"` // SMTP auth user (no auth when empty)
+	Password string   `toml:"password"` // SMTP auth password, e.g. "$SMTP_PASSWORD"
+}
+
+// Enabled reports whether email notifications are configured.
+func (e EmailConfig) Enabled() bool {
+	return e.SMTPHost != ""
 }
 
+// EventEnabled reports whether events of the given type should be sent.
+func (n NotificationsConfig) EventEnabled(eventType string) bool {
+	if len(n.EnabledEvents) == 0 {
+		return true
+	}
+	return slices.Contains(n.EnabledEvents, eventType)
+}
+
+// DefaultCommitBatchInterval is used when notifications.commit_batch_interval
+// is not set.
+const DefaultCommitBatchInterval = 60 * time.Second
+
+// DefaultErrorCooldown is used when notifications.error_cooldown is not set.
+const DefaultErrorCooldown = 5 * time.Minute
+
+// DefaultLogScanLines is used when notifications.log_scan_lines is not set.
+const DefaultLogScanLines = 50
+
+// DefaultErrorPatterns are the log patterns scanned for when
+// notifications.error_patterns is not set.
+var DefaultErrorPatterns = []string{"ERROR:", "FAIL"}
+
 type GitConfig struct {
-	AuthorName  string `toml:"author_name"`
-	AuthorEmail string `toml:"author_email"`
+	AuthorName    string `toml:"author_name"`
+	AuthorEmail   string `toml:"author_email"`
+	DefaultBranch string `toml:"default_branch"` // branch agents work on in the upstream repo (default "main")
+	CloneDepth    int    `toml:"clone_depth"`    // shallow-clone agents with this much history (full clone when 0)
+
+	// BranchPerAgent gives each agent its own agent-N branch upstream; the
+	// daemon merges them into the default branch on each monitor tick.
+	BranchPerAgent bool `toml:"branch_per_agent"`
+
+	// SignCommits makes agents GPG-sign their commits with SigningKey (or
+	// git's default key). Agents get a copy of the host's GnuPG home, so the
+	// key must be usable without a passphrase prompt.
+	SignCommits bool   `toml:"sign_commits"`
+	SigningKey  string `toml:"signing_key"`
+
+	// ProjectSyncStrategy is how agent commits are brought into the project
+	// dir: "merge" (default), "rebase" local commits onto them, or "reset"
+	// the project to upstream, discarding local work.
+	ProjectSyncStrategy string `toml:"project_sync_strategy"`
+
+	// UseAuthorIdentity makes agent commits authored by AuthorName and
+	// AuthorEmail instead of the synthetic agent-N identity. The committer
+	// stays agent-N.
+	UseAuthorIdentity bool `toml:"use_author_identity"`
+}
+
+type DaemonConfig struct {
+	HTTPAddr        string        `toml:"http_addr"`          // serve the status API here (disabled when empty)
+	StaleTaskMaxAge time.Duration `toml:"stale_task_max_age"` // task locks older than this are cleared, e.g. "2h"
+	GCInterval      time.Duration `toml:"gc_interval"`        // how often to run git gc --auto on upstream ("0s" disables)
+	DrainTimeout    time.Duration `toml:"drain_timeout"`      // how long shutdown waits for agents to finish their sessions ("0s" stops them at once)
+
+	// MonitorTimeout is how long a monitor iteration may run before it is
+	// cancelled and reported as stalled ("0s" disables the watchdog).
+	MonitorTimeout time.Duration `toml:"monitor_timeout"`
+
+	// AgentsReadyTimeout is how long `metamorph start` waits, once the image
+	// is built, for every agent to be running.
+	AgentsReadyTimeout time.Duration `toml:"agents_ready_timeout"`
+
+	// LogFormat is the daemon.log format: "text" (default) or "json".
+	LogFormat string `toml:"log_format"`
+
+	// AutoRestart restarts crashed agents. When false a crashed agent's
+	// container is left stopped for inspection. Unset means true; see
+	// AutoRestartEnabled.
+	AutoRestart *bool `toml:"auto_restart"`
+}
+
+// AutoRestartEnabled reports whether crashed agents are restarted, which
+// they are unless auto_restart is explicitly false.
+func (d DaemonConfig) AutoRestartEnabled() bool {
+	return d.AutoRestart == nil || *d.AutoRestart
+}
+
+// DefaultGCInterval is used when daemon.gc_interval is not set.
+const DefaultGCInterval = time.Hour
+
+// DefaultDrainTimeout is used when daemon.drain_timeout is not set.
+const DefaultDrainTimeout = 5 * time.Minute
+
+// DefaultMonitorTimeout is used when daemon.monitor_timeout is not set:
+// three of the daemon's 30s monitor ticks.
+const DefaultMonitorTimeout = 90 * time.Second
+
+// DefaultAgentsReadyTimeout is used when daemon.agents_ready_timeout is not set.
+const DefaultAgentsReadyTimeout = 2 * time.Minute
+
+// RunConfig controls the session loop of `metamorph run`.
+type RunConfig struct {
+	// A session shorter than MinSessionDuration is assumed to have hit a
+	// rate limit, and the next one waits RateLimitBackoff instead of
+	// RestartDelay.
+	MinSessionDuration time.Duration `toml:"min_session_duration"`
+	RateLimitBackoff   time.Duration `toml:"rate_limit_backoff"`
+	RestartDelay       time.Duration `toml:"restart_delay"`
+
+	// MaxIterations stops the loop after this many sessions (0 = run forever).
+	MaxIterations int `toml:"max_iterations"`
+}
+
+// Defaults for [run], used when the keys are not set.
+const (
+	DefaultMinSessionDuration = 30 * time.Second
+	DefaultRateLimitBackoff   = 5 * time.Minute
+	DefaultRestartDelay       = 5 * time.Second
+)
+
+// TasksConfig controls task locking.
+type TasksConfig struct {
+	// LockDir is the repo directory holding task .lock and .task files,
+	// relative to the repo root (default "current_tasks").
+	LockDir string `toml:"lock_dir"`
+
+	// ClaimRetries is how many times `metamorph tasks claim` retries a claim
+	// whose push lost a race while the task itself was still free ("0"
+	// disables retrying).
+	ClaimRetries int `toml:"claim_retries"`
+}
+
+// DefaultClaimRetries is used when tasks.claim_retries is not set.
+const DefaultClaimRetries = 4
+
+// CredentialsConfig names files holding agent credentials, so the secrets
+// never have to appear on the daemon's command line.
+type CredentialsConfig struct {
+	APIKeyFile     string `toml:"api_key_file"`     // file containing an Anthropic API key
+	OAuthTokenFile string `toml:"oauth_token_file"` // file containing a Claude Code OAuth token
+}
+
+// Read returns the contents of the configured credential files with
+// surrounding whitespace trimmed. Relative paths are resolved against
+// projectDir. Credentials without a file reference are returned empty.
+func (c CredentialsConfig) Read(projectDir string) (apiKey, oauthToken string, err error) {
+	if apiKey, err = readCredentialFile(projectDir, c.APIKeyFile); err != nil {
+		return "", "", fmt.Errorf("credentials.api_key_file: %w", err)
+	}
+	if oauthToken, err = readCredentialFile(projectDir, c.OAuthTokenFile); err != nil {
+		return "", "", fmt.Errorf("credentials.oauth_token_file: %w", err)
+	}
+	return apiKey, oauthToken, nil
+}
+
+func readCredentialFile(projectDir, path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
+
+// LocalPath returns the machine-specific override file for the config at
+// path, e.g. metamorph.local.toml for metamorph.toml. It is meant to be
+// gitignored.
+func LocalPath(path string) string {
+	return strings.TrimSuffix(path, ".toml") + ".local.toml"
 }
 
-// Load reads a TOML config file from path and validates it.
+// DefaultBranch is used when git.default_branch is not set.
+const DefaultBranch = "main"
+
+// DefaultStaleTaskMaxAge is used when daemon.stale_task_max_age is not set.
+const DefaultStaleTaskMaxAge = 2 * time.Hour
+
+// aptPackageRe matches a Debian package name with an optional :arch and
+// =version suffix. Names are passed unquoted to apt-get in the Dockerfile, so
+// anything else is rejected.
+var aptPackageRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*(:[a-z0-9-]+)?(=[A-Za-z0-9.+:~-]+)?$`)
+
+// credentialHelperRe matches a Docker credential helper name, the suffix of a
+// docker-credential-<name> binary on PATH.
+var credentialHelperRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Load reads a TOML config file from path, merges the optional local
+// override file next to it (see LocalPath), and validates the result.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -57,23 +351,158 @@ func Load(path string) (*Config, error) {
 	}
 
 	var cfg Config
-	if err := toml.Unmarshal(data, &cfg); err != nil {
+	md, err := toml.Decode(string(data), &cfg)
+	if err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
 
+	// Decoding the local file into the same struct overrides only the keys
+	// it sets; tables merge key by key and arrays are replaced.
+	localPath := LocalPath(path)
+	var localMD toml.MetaData
+	if localData, err := os.ReadFile(localPath); err == nil {
+		localMD, err = toml.Decode(string(localData), &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", filepath.Base(localPath), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(localPath), err)
+	}
+	isDefined := func(key ...string) bool {
+		return md.IsDefined(key...) || localMD.IsDefined(key...)
+	}
+
+	expandEnv(&cfg)
 	applyDefaults(&cfg)
 
+	// An explicit zero disables commit batching, error debouncing, upstream
+	// gc, shutdown draining, the monitor watchdog, the run loop's delays and
+	// task claim retries, so only omitted values get the defaults.
+	if !isDefined("notifications", "commit_batch_interval") {
+		cfg.Notifications.CommitBatchInterval = DefaultCommitBatchInterval
+	}
+	if !isDefined("notifications", "error_cooldown") {
+		cfg.Notifications.ErrorCooldown = DefaultErrorCooldown
+	}
+	if !isDefined("daemon", "gc_interval") {
+		cfg.Daemon.GCInterval = DefaultGCInterval
+	}
+	if !isDefined("daemon", "drain_timeout") {
+		cfg.Daemon.DrainTimeout = DefaultDrainTimeout
+	}
+	if !isDefined("daemon", "monitor_timeout") {
+		cfg.Daemon.MonitorTimeout = DefaultMonitorTimeout
+	}
+	if !isDefined("run", "min_session_duration") {
+		cfg.Run.MinSessionDuration = DefaultMinSessionDuration
+	}
+	if !isDefined("run", "rate_limit_backoff") {
+		cfg.Run.RateLimitBackoff = DefaultRateLimitBackoff
+	}
+	if !isDefined("run", "restart_delay") {
+		cfg.Run.RestartDelay = DefaultRestartDelay
+	}
+	if !isDefined("tasks", "claim_retries") {
+		cfg.Tasks.ClaimRetries = DefaultClaimRetries
+	}
+	// An explicit zero for these would scan nothing, clear every task lock
+	// at once or time out immediately, so it is rejected rather than quietly
+	// replaced with the default.
+	if !isDefined("notifications", "log_scan_lines") {
+		cfg.Notifications.LogScanLines = DefaultLogScanLines
+	}
+	if !isDefined("daemon", "stale_task_max_age") {
+		cfg.Daemon.StaleTaskMaxAge = DefaultStaleTaskMaxAge
+	}
+	if !isDefined("docker", "build_timeout") {
+		cfg.Docker.BuildTimeout = DefaultBuildTimeout
+	}
+	if !isDefined("daemon", "agents_ready_timeout") {
+		cfg.Daemon.AgentsReadyTimeout = DefaultAgentsReadyTimeout
+	}
+	// Auto-restart is on unless explicitly turned off.
+	if cfg.Daemon.AutoRestart == nil {
+		autoRestart := true
+		cfg.Daemon.AutoRestart = &autoRestart
+	}
+
 	if err := validate(&cfg); err != nil {
 		return nil, err
 	}
 
+	if w := roleWarning(&cfg); w != "" {
+		slog.Warn(w)
+	}
+
 	return &cfg, nil
 }
 
+// expandEnv replaces ${VAR} and $VAR references in the string fields that
+// commonly hold secrets or host-specific values. "$$" yields a literal "$".
+// Fields whose values are shell commands or regexes are left untouched.
+func expandEnv(cfg *Config) {
+	for _, f := range []*string{
+		&cfg.Agents.Model,
+		&cfg.Docker.Image,
+		&cfg.Docker.Host,
+		&cfg.Docker.CacheVolume,
+		&cfg.Docker.RegistryAuth.Username,
+		&cfg.Docker.RegistryAuth.Password,
+		&cfg.Notifications.WebhookURL,
+		&cfg.Notifications.SigningSecret,
+		&cfg.Notifications.Email.SMTPHost,
+		&cfg.Notifications.Email.From,
+		&cfg.Notifications.Email.Username,
+		&cfg.Notifications.Email.Password,
+		&cfg.Git.AuthorName,
+		&cfg.Git.AuthorEmail,
+		&cfg.Git.SigningKey,
+		&cfg.Daemon.HTTPAddr,
+		&cfg.Credentials.APIKeyFile,
+		&cfg.Credentials.OAuthTokenFile,
+	} {
+		*f = expand(*f)
+	}
+	for k, v := range cfg.Notifications.Headers {
+		cfg.Notifications.Headers[k] = expand(v)
+	}
+}
+
+// expand is os.ExpandEnv with "$$" as an escape for a literal "$".
+func expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
+
 // applyDefaults fills in default values for optional fields.
 func applyDefaults(cfg *Config) {
+	if cfg.Tasks.LockDir == "" {
+		cfg.Tasks.LockDir = constants.TaskLockDir
+	}
 	if cfg.Docker.Image == "" {
-		cfg.Docker.Image = "metamorph-agent:latest"
+		cfg.Docker.Image = DefaultImage
+	}
+	if cfg.Docker.RestartPolicy == "" {
+		cfg.Docker.RestartPolicy = "unless-stopped"
+	}
+	if cfg.Notifications.Format == "" {
+		cfg.Notifications.Format = "json"
+	}
+	if cfg.Daemon.LogFormat == "" {
+		cfg.Daemon.LogFormat = "text"
+	}
+	if len(cfg.Notifications.ErrorPatterns) == 0 {
+		cfg.Notifications.ErrorPatterns = append([]string(nil), DefaultErrorPatterns...)
+	}
+	if cfg.Git.DefaultBranch == "" {
+		cfg.Git.DefaultBranch = DefaultBranch
+	}
+	if cfg.Git.ProjectSyncStrategy == "" {
+		cfg.Git.ProjectSyncStrategy = "merge"
 	}
 	if cfg.Git.AuthorName == "" {
 		if name, err := exec.Command("git", "config", "user.name").Output(); err == nil {
@@ -87,6 +516,18 @@ func applyDefaults(cfg *Config) {
 	}
 }
 
+// roleWarning returns a warning when there are more agents than configured
+// roles, since the extra agents repeat roles round-robin. It returns "" when
+// there is nothing to warn about.
+func roleWarning(cfg *Config) string {
+	n := len(cfg.Agents.Roles)
+	if n == 0 || cfg.Agents.Count <= n {
+		return ""
+	}
+	return fmt.Sprintf("agents.count (%d) exceeds the %d configured role(s); roles are assigned round-robin, so some agents will share a role",
+		cfg.Agents.Count, n)
+}
+
 func validate(cfg *Config) error {
 	if cfg.Project.Name == "" {
 		return fmt.Errorf("project.name is required")
@@ -96,15 +537,183 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("agents.count must be greater than 0")
 	}
 
+	if cfg.Agents.MaxLogFiles < 0 {
+		return fmt.Errorf("agents.max_log_files must not be negative")
+	}
+
+	if cfg.Agents.MaxLogSizeMB < 0 {
+		return fmt.Errorf("agents.max_log_size_mb must not be negative")
+	}
+
 	if cfg.Agents.Model == "" {
 		return fmt.Errorf("agents.model is required")
 	}
 
+	if cfg.Git.CloneDepth < 0 {
+		return fmt.Errorf("git.clone_depth must not be negative")
+	}
+
+	if strings.ContainsAny(cfg.Git.DefaultBranch, " \t~^:?*[\\") || strings.HasPrefix(cfg.Git.DefaultBranch, "-") {
+		return fmt.Errorf("invalid git.default_branch: %q", cfg.Git.DefaultBranch)
+	}
+
+	switch cfg.Git.ProjectSyncStrategy {
+	case "merge", "rebase", "reset":
+	default:
+		return fmt.Errorf("invalid git.project_sync_strategy: %q (must be \"merge\", \"rebase\" or \"reset\")", cfg.Git.ProjectSyncStrategy)
+	}
+
 	for _, role := range cfg.Agents.Roles {
 		if _, ok := constants.AgentRoles[role]; !ok {
 			return fmt.Errorf("invalid agent role: %q", role)
 		}
 	}
 
+	for _, pkg := range cfg.Docker.ExtraPackages {
+		if !aptPackageRe.MatchString(pkg) {
+			return fmt.Errorf("invalid docker.extra_packages entry: %q", pkg)
+		}
+	}
+
+	switch cfg.Docker.RestartPolicy {
+	case "no", "on-failure", "unless-stopped":
+	default:
+		return fmt.Errorf("invalid docker.restart_policy: %q (must be \"no\", \"on-failure\" or \"unless-stopped\")", cfg.Docker.RestartPolicy)
+	}
+
+	if gpus := cfg.Docker.GPUs; gpus != "" && gpus != "all" {
+		if n, err := strconv.Atoi(gpus); err != nil || n <= 0 {
+			return fmt.Errorf("invalid docker.gpus: %q (must be \"all\" or a positive device count)", gpus)
+		}
+	}
+
+	if cfg.Docker.BuildTimeout <= 0 {
+		return fmt.Errorf("docker.build_timeout must be positive")
+	}
+
+	if auth := cfg.Docker.RegistryAuth; auth.CredentialHelper != "" {
+		if auth.Username != "" || auth.Password != "" {
+			return fmt.Errorf("docker.registry_auth: set username and password or credential_helper, not both")
+		}
+		if !credentialHelperRe.MatchString(auth.CredentialHelper) {
+			return fmt.Errorf("invalid docker.registry_auth.credential_helper: %q (must be a helper name such as \"ecr-login\")", auth.CredentialHelper)
+		}
+	} else if (auth.Username == "") != (auth.Password == "") {
+		return fmt.Errorf("docker.registry_auth needs both username and password")
+	}
+
+	if cfg.Docker.ImagePull && cfg.Docker.Image == DefaultImage {
+		return fmt.Errorf("docker.image_pull requires docker.image to name a registry image, e.g. \"ghcr.io/acme/agent:1.2\"")
+	}
+
+	if cfg.Daemon.StaleTaskMaxAge <= 0 {
+		return fmt.Errorf("daemon.stale_task_max_age must be positive")
+	}
+
+	if cfg.Daemon.AgentsReadyTimeout <= 0 {
+		return fmt.Errorf("daemon.agents_ready_timeout must be positive")
+	}
+
+	switch cfg.Daemon.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid daemon.log_format: %q (must be \"text\" or \"json\")", cfg.Daemon.LogFormat)
+	}
+
+	if cfg.Daemon.GCInterval < 0 {
+		return fmt.Errorf("daemon.gc_interval must not be negative")
+	}
+
+	if cfg.Daemon.DrainTimeout < 0 {
+		return fmt.Errorf("daemon.drain_timeout must not be negative")
+	}
+
+	if cfg.Daemon.MonitorTimeout < 0 {
+		return fmt.Errorf("daemon.monitor_timeout must not be negative")
+	}
+
+	if cfg.Run.MinSessionDuration < 0 {
+		return fmt.Errorf("run.min_session_duration must not be negative")
+	}
+
+	if cfg.Run.RateLimitBackoff < 0 {
+		return fmt.Errorf("run.rate_limit_backoff must not be negative")
+	}
+
+	if cfg.Run.RestartDelay < 0 {
+		return fmt.Errorf("run.restart_delay must not be negative")
+	}
+
+	if cfg.Run.MaxIterations < 0 {
+		return fmt.Errorf("run.max_iterations must not be negative")
+	}
+
+	if !filepath.IsLocal(cfg.Tasks.LockDir) || filepath.Clean(cfg.Tasks.LockDir) == "." {
+		return fmt.Errorf("invalid tasks.lock_dir: %q (must be a directory inside the repo)", cfg.Tasks.LockDir)
+	}
+	if cfg.Tasks.ClaimRetries < 0 {
+		return fmt.Errorf("tasks.claim_retries must not be negative")
+	}
+
+	if cfg.Notifications.WebhookURL != "" && !isHTTPURL(cfg.Notifications.WebhookURL) {
+		return fmt.Errorf("notifications.webhook_url must be an http(s) URL")
+	}
+
+	switch cfg.Notifications.Format {
+	case "json", "slack", "discord":
+	default:
+		return fmt.Errorf("invalid notifications.format: %q (must be \"json\", \"slack\" or \"discord\")", cfg.Notifications.Format)
+	}
+
+	if cfg.Notifications.CommitBatchInterval < 0 {
+		return fmt.Errorf("notifications.commit_batch_interval must not be negative")
+	}
+
+	if cfg.Notifications.ErrorCooldown < 0 {
+		return fmt.Errorf("notifications.error_cooldown must not be negative")
+	}
+
+	if cfg.Notifications.LogScanLines <= 0 {
+		return fmt.Errorf("notifications.log_scan_lines must be positive")
+	}
+
+	for _, e := range cfg.Notifications.EnabledEvents {
+		if !slices.Contains(notify.EventTypes, e) {
+			return fmt.Errorf("invalid notifications.enabled_events entry: %q (must be one of %s)", e, strings.Join(notify.EventTypes, ", "))
+		}
+	}
+
+	if email := cfg.Notifications.Email; email.Enabled() {
+		if email.From == "" {
+			return fmt.Errorf("notifications.email.from is required when smtp_host is set")
+		}
+		if len(email.To) == 0 {
+			return fmt.Errorf("notifications.email.to must list at least one recipient")
+		}
+		if email.Port < 0 || email.Port > 65535 {
+			return fmt.Errorf("invalid notifications.email.port: %d (must be between 1 and 65535)", email.Port)
+		}
+	}
+
+	for _, p := range cfg.Notifications.ErrorPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid notifications.error_patterns entry %q: %v", p, err)
+		}
+	}
+	for _, p := range cfg.Notifications.IgnorePatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid notifications.ignore_patterns entry %q: %v", p, err)
+		}
+	}
+
 	return nil
 }
+
+// isHTTPURL reports whether s is an absolute http or https URL with a host.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
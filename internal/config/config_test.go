@@ -6,6 +6,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/assets"
+	"github.com/robmorgan/metamorph/internal/notify"
 )
 
 func writeConfig(t *testing.T, dir, content string) string {
@@ -189,7 +193,7 @@ foo = "bar"
 `,
 		},
 		{
-			name: "missing sections uses zero values",
+			name: "invalid error pattern",
 			toml: `
 [project]
 name = "my-app"
@@ -197,199 +201,1331 @@ name = "my-app"
 [agents]
 count = 1
 model = "claude-sonnet"
+
+[notifications]
+error_patterns = ["("]
 `,
+			wantErr: "invalid notifications.error_patterns entry \"(\": error parsing regexp: missing closing ): `(`",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dir := t.TempDir()
-			path := writeConfig(t, dir, tt.toml)
-
-			cfg, err := Load(path)
+		{
+			name: "invalid ignore pattern",
+			toml: `
+[project]
+name = "my-app"
 
-			if tt.wantErr != "" {
-				if err == nil {
-					t.Fatalf("expected error containing %q, got nil", tt.wantErr)
-				}
-				if got := err.Error(); got != tt.wantErr {
-					t.Fatalf("expected error %q, got %q", tt.wantErr, got)
-				}
-				return
-			}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if cfg == nil {
-				t.Fatal("expected non-nil config")
-			}
-		})
-	}
-}
+[notifications]
+ignore_patterns = ["[a-"]
+`,
+			wantErr: "invalid notifications.ignore_patterns entry \"[a-\": error parsing regexp: missing closing ]: `[a-`",
+		},
+		{
+			name: "negative max log files",
+			toml: `
+[project]
+name = "my-app"
 
-func TestLoad_FileNotFound(t *testing.T) {
-	_, err := Load("/nonexistent/path/metamorph.toml")
-	if err == nil {
-		t.Fatal("expected error for missing file")
-	}
-}
+[agents]
+count = 1
+model = "claude-sonnet"
+max_log_files = -1
+`,
+			wantErr: "agents.max_log_files must not be negative",
+		},
+		{
+			name: "invalid notification format",
+			toml: `
+[project]
+name = "my-app"
 
-func TestLoad_InvalidTOML(t *testing.T) {
-	dir := t.TempDir()
-	path := writeConfig(t, dir, `[this is not valid toml`)
-	_, err := Load(path)
-	if err == nil {
-		t.Fatal("expected error for invalid TOML")
-	}
-}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-func TestLoad_ValidConfigValues(t *testing.T) {
-	dir := t.TempDir()
-	path := writeConfig(t, dir, `
+[notifications]
+format = "teams"
+`,
+			wantErr: `invalid notifications.format: "teams" (must be "json", "slack" or "discord")`,
+		},
+		{
+			name: "invalid extra package",
+			toml: `
 [project]
-name = "my-project"
-description = "A test project"
+name = "my-app"
 
 [agents]
-count = 3
+count = 1
 model = "claude-sonnet"
-roles = ["developer", "tester", "reviewer"]
 
 [docker]
-image = "custom:latest"
-extra_packages = ["curl", "jq"]
-
-[testing]
-command = "go test ./..."
-fast_command = "go test -short"
+extra_packages = ["vim", "curl; rm -rf /"]
+`,
+			wantErr: `invalid docker.extra_packages entry: "curl; rm -rf /"`,
+		},
+		{
+			name: "versioned extra packages",
+			toml: `
+[project]
+name = "my-app"
 
-[notifications]
-webhook_url = "https://hooks.example.com/test"
-`)
+[agents]
+count = 1
+model = "claude-sonnet"
 
-	cfg, err := Load(path)
-	if err != nil {
-		t.Fatalf("Load: %v", err)
-	}
+[docker]
+extra_packages = ["python3.12", "libssl-dev:amd64", "g++=4:13.2.0-7ubuntu1"]
+`,
+		},
+		{
+			name: "invalid restart policy",
+			toml: `
+[project]
+name = "my-app"
 
-	if cfg.Project.Name != "my-project" {
-		t.Errorf("Project.Name = %q", cfg.Project.Name)
-	}
-	if cfg.Project.Description != "A test project" {
-		t.Errorf("Project.Description = %q", cfg.Project.Description)
-	}
-	if cfg.Agents.Count != 3 {
-		t.Errorf("Agents.Count = %d", cfg.Agents.Count)
-	}
-	if cfg.Agents.Model != "claude-sonnet" {
-		t.Errorf("Agents.Model = %q", cfg.Agents.Model)
-	}
-	if len(cfg.Agents.Roles) != 3 {
-		t.Fatalf("Agents.Roles = %v", cfg.Agents.Roles)
-	}
-	if cfg.Agents.Roles[0] != "developer" || cfg.Agents.Roles[1] != "tester" || cfg.Agents.Roles[2] != "reviewer" {
-		t.Errorf("Agents.Roles = %v", cfg.Agents.Roles)
-	}
-	if cfg.Docker.Image != "custom:latest" {
-		t.Errorf("Docker.Image = %q", cfg.Docker.Image)
-	}
-	if len(cfg.Docker.ExtraPackages) != 2 {
-		t.Errorf("Docker.ExtraPackages = %v", cfg.Docker.ExtraPackages)
-	}
-	if cfg.Testing.Command != "go test ./..." {
-		t.Errorf("Testing.Command = %q", cfg.Testing.Command)
-	}
-	if cfg.Testing.FastCommand != "go test -short" {
-		t.Errorf("Testing.FastCommand = %q", cfg.Testing.FastCommand)
-	}
-	if cfg.Notifications.WebhookURL != "https://hooks.example.com/test" {
-		t.Errorf("Notifications.WebhookURL = %q", cfg.Notifications.WebhookURL)
-	}
-}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-func TestLoad_DefaultValues(t *testing.T) {
-	dir := t.TempDir()
-	path := writeConfig(t, dir, `
+[docker]
+restart_policy = "always"
+`,
+			wantErr: `invalid docker.restart_policy: "always" (must be "no", "on-failure" or "unless-stopped")`,
+		},
+		{
+			name: "invalid default branch",
+			toml: `
 [project]
-name = "defaults-test"
+name = "my-app"
 
 [agents]
 count = 1
 model = "claude-sonnet"
-`)
-
-	cfg, err := Load(path)
-	if err != nil {
-		t.Fatalf("Load: %v", err)
-	}
 
-	// Docker image should get default value.
-	if cfg.Docker.Image != "metamorph-agent:latest" {
-		t.Errorf("Docker.Image default = %q, want %q", cfg.Docker.Image, "metamorph-agent:latest")
-	}
+[git]
+default_branch = "my branch"
+`,
+			wantErr: `invalid git.default_branch: "my branch"`,
+		},
+		{
+			name: "invalid project sync strategy",
+			toml: `
+[project]
+name = "my-app"
 
-	// Optional fields should be zero values.
-	if cfg.Testing.Command != "" {
-		t.Errorf("Testing.Command should be empty, got %q", cfg.Testing.Command)
-	}
-	if cfg.Notifications.WebhookURL != "" {
-		t.Errorf("Notifications.WebhookURL should be empty, got %q", cfg.Notifications.WebhookURL)
-	}
-	if len(cfg.Agents.Roles) != 0 {
-		t.Errorf("Agents.Roles should be empty, got %v", cfg.Agents.Roles)
-	}
-}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-func TestApplyDefaults_GitAuthorFromHostConfig(t *testing.T) {
-	// Get the host's git config values for comparison.
-	wantName := ""
-	if out, err := exec.Command("git", "config", "user.name").Output(); err == nil {
-		wantName = strings.TrimSpace(string(out))
-	}
-	wantEmail := ""
-	if out, err := exec.Command("git", "config", "user.email").Output(); err == nil {
-		wantEmail = strings.TrimSpace(string(out))
-	}
+[git]
+project_sync_strategy = "squash"
+`,
+			wantErr: `invalid git.project_sync_strategy: "squash" (must be "merge", "rebase" or "reset")`,
+		},
+		{
+			name: "invalid gpus",
+			toml: `
+[project]
+name = "my-app"
 
-	if wantName == "" && wantEmail == "" {
-		t.Skip("no git config user.name/user.email set on host")
-	}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-	dir := t.TempDir()
-	path := writeConfig(t, dir, `
+[docker]
+gpus = "some"
+`,
+			wantErr: `invalid docker.gpus: "some" (must be "all" or a positive device count)`,
+		},
+		{
+			name: "negative build timeout",
+			toml: `
 [project]
-name = "git-defaults"
+name = "my-app"
 
 [agents]
 count = 1
 model = "claude-sonnet"
-`)
 
-	cfg, err := Load(path)
-	if err != nil {
-		t.Fatalf("Load: %v", err)
-	}
+[docker]
+build_timeout = "-5m"
+`,
+			wantErr: "docker.build_timeout must be positive",
+		},
+		{
+			name: "zero build timeout",
+			toml: `
+[project]
+name = "my-app"
 
-	if wantName != "" && cfg.Git.AuthorName != wantName {
-		t.Errorf("Git.AuthorName = %q, want %q (from git config)", cfg.Git.AuthorName, wantName)
-	}
-	if wantEmail != "" && cfg.Git.AuthorEmail != wantEmail {
-		t.Errorf("Git.AuthorEmail = %q, want %q (from git config)", cfg.Git.AuthorEmail, wantEmail)
-	}
-}
+[agents]
+count = 1
+model = "claude-sonnet"
 
-func TestApplyDefaults_GitAuthorExplicitNotOverridden(t *testing.T) {
-	dir := t.TempDir()
-	path := writeConfig(t, dir, `
+[docker]
+build_timeout = "0s"
+`,
+			wantErr: "docker.build_timeout must be positive",
+		},
+		{
+			name: "image pull without a registry image",
+			toml: `
 [project]
-name = "git-explicit"
+name = "my-app"
 
 [agents]
 count = 1
 model = "claude-sonnet"
 
-[git]
+[docker]
+image_pull = true
+`,
+			wantErr: `docker.image_pull requires docker.image to name a registry image, e.g. "ghcr.io/acme/agent:1.2"`,
+		},
+		{
+			name: "registry auth without password",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[docker.registry_auth]
+username = "bot"
+`,
+			wantErr: `docker.registry_auth needs both username and password`,
+		},
+		{
+			name: "registry auth with both credential styles",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[docker.registry_auth]
+username = "bot"
+password = "s3cret"
+credential_helper = "ecr-login"
+`,
+			wantErr: `docker.registry_auth: set username and password or credential_helper, not both`,
+		},
+		{
+			name: "invalid credential helper",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[docker.registry_auth]
+credential_helper = "../evil"
+`,
+			wantErr: `invalid docker.registry_auth.credential_helper: "../evil" (must be a helper name such as "ecr-login")`,
+		},
+		{
+			name: "negative stale task max age",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+stale_task_max_age = "-30m"
+`,
+			wantErr: "daemon.stale_task_max_age must be positive",
+		},
+		{
+			name: "zero stale task max age",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+stale_task_max_age = "0s"
+`,
+			wantErr: "daemon.stale_task_max_age must be positive",
+		},
+		{
+			name: "negative commit batch interval",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+commit_batch_interval = "-1m"
+`,
+			wantErr: "notifications.commit_batch_interval must not be negative",
+		},
+		{
+			name: "negative error cooldown",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+error_cooldown = "-5m"
+`,
+			wantErr: "notifications.error_cooldown must not be negative",
+		},
+		{
+			name: "email without sender",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications.email]
+smtp_host = "smtp.example.com"
+to = ["dev@example.com"]
+`,
+			wantErr: "notifications.email.from is required when smtp_host is set",
+		},
+		{
+			name: "email without recipients",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications.email]
+smtp_host = "smtp.example.com"
+from = "metamorph@example.com"
+`,
+			wantErr: "notifications.email.to must list at least one recipient",
+		},
+		{
+			name: "email port out of range",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications.email]
+smtp_host = "smtp.example.com"
+port = 70000
+from = "metamorph@example.com"
+to = ["dev@example.com"]
+`,
+			wantErr: "invalid notifications.email.port: 70000 (must be between 1 and 65535)",
+		},
+		{
+			name: "negative log scan lines",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+log_scan_lines = -10
+`,
+			wantErr: "notifications.log_scan_lines must be positive",
+		},
+		{
+			name: "zero log scan lines",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+log_scan_lines = 0
+`,
+			wantErr: "notifications.log_scan_lines must be positive",
+		},
+		{
+			name: "webhook url without scheme",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+webhook_url = "hooks.example.com/notify"
+`,
+			wantErr: "notifications.webhook_url must be an http(s) URL",
+		},
+		{
+			name: "webhook url with unsupported scheme",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+webhook_url = "ftp://hooks.example.com/notify"
+`,
+			wantErr: "notifications.webhook_url must be an http(s) URL",
+		},
+		{
+			name: "webhook url without host",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+webhook_url = "https:///notify"
+`,
+			wantErr: "notifications.webhook_url must be an http(s) URL",
+		},
+		{
+			name: "negative run max iterations",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[run]
+max_iterations = -1
+`,
+			wantErr: "run.max_iterations must not be negative",
+		},
+		{
+			name: "negative gc interval",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+gc_interval = "-1h"
+`,
+			wantErr: "daemon.gc_interval must not be negative",
+		},
+		{
+			name: "negative drain timeout",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+drain_timeout = "-1m"
+`,
+			wantErr: "daemon.drain_timeout must not be negative",
+		},
+		{
+			name: "negative monitor timeout",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+monitor_timeout = "-1m"
+`,
+			wantErr: "daemon.monitor_timeout must not be negative",
+		},
+		{
+			name: "negative agents ready timeout",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+agents_ready_timeout = "-1m"
+`,
+			wantErr: "daemon.agents_ready_timeout must be positive",
+		},
+		{
+			name: "zero agents ready timeout",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+agents_ready_timeout = "0s"
+`,
+			wantErr: "daemon.agents_ready_timeout must be positive",
+		},
+		{
+			name: "invalid log format",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+log_format = "xml"
+`,
+			wantErr: `invalid daemon.log_format: "xml" (must be "text" or "json")`,
+		},
+		{
+			name: "unknown enabled event",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+enabled_events = ["agent_crashed", "agent_exploded"]
+`,
+			wantErr: `invalid notifications.enabled_events entry: "agent_exploded" (must be one of ` + strings.Join(notify.EventTypes, ", ") + `)`,
+		},
+		{
+			name: "missing sections uses zero values",
+			toml: `
+[project]
+name = "my-app"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeConfig(t, dir, tt.toml)
+
+			cfg, err := Load(path)
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got nil", tt.wantErr)
+				}
+				if got := err.Error(); got != tt.wantErr {
+					t.Fatalf("expected error %q, got %q", tt.wantErr, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg == nil {
+				t.Fatal("expected non-nil config")
+			}
+		})
+	}
+}
+
+func TestLoad_FileNotFound(t *testing.T) {
+	_, err := Load("/nonexistent/path/metamorph.toml")
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestLoad_InvalidTOML(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `[this is not valid toml`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for invalid TOML")
+	}
+}
+
+func TestLoad_ValidConfigValues(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "my-project"
+description = "A test project"
+
+[agents]
+count = 3
+model = "claude-sonnet"
+roles = ["developer", "tester", "reviewer"]
+
+[docker]
+image = "custom:latest"
+extra_packages = ["curl", "jq"]
+
+[testing]
+command = "go test ./..."
+fast_command = "go test -short"
+
+[notifications]
+webhook_url = "https://hooks.example.com/test"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Project.Name != "my-project" {
+		t.Errorf("Project.Name = %q", cfg.Project.Name)
+	}
+	if cfg.Project.Description != "A test project" {
+		t.Errorf("Project.Description = %q", cfg.Project.Description)
+	}
+	if cfg.Agents.Count != 3 {
+		t.Errorf("Agents.Count = %d", cfg.Agents.Count)
+	}
+	if cfg.Agents.Model != "claude-sonnet" {
+		t.Errorf("Agents.Model = %q", cfg.Agents.Model)
+	}
+	if len(cfg.Agents.Roles) != 3 {
+		t.Fatalf("Agents.Roles = %v", cfg.Agents.Roles)
+	}
+	if cfg.Agents.Roles[0] != "developer" || cfg.Agents.Roles[1] != "tester" || cfg.Agents.Roles[2] != "reviewer" {
+		t.Errorf("Agents.Roles = %v", cfg.Agents.Roles)
+	}
+	if cfg.Docker.Image != "custom:latest" {
+		t.Errorf("Docker.Image = %q", cfg.Docker.Image)
+	}
+	if len(cfg.Docker.ExtraPackages) != 2 {
+		t.Errorf("Docker.ExtraPackages = %v", cfg.Docker.ExtraPackages)
+	}
+	if cfg.Testing.Command != "go test ./..." {
+		t.Errorf("Testing.Command = %q", cfg.Testing.Command)
+	}
+	if cfg.Testing.FastCommand != "go test -short" {
+		t.Errorf("Testing.FastCommand = %q", cfg.Testing.FastCommand)
+	}
+	if cfg.Notifications.WebhookURL != "https://hooks.example.com/test" {
+		t.Errorf("Notifications.WebhookURL = %q", cfg.Notifications.WebhookURL)
+	}
+}
+
+func TestLoad_DefaultValues(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "defaults-test"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Docker image should get default value.
+	if cfg.Docker.Image != "metamorph-agent:latest" {
+		t.Errorf("Docker.Image default = %q, want %q", cfg.Docker.Image, "metamorph-agent:latest")
+	}
+
+	// Optional fields should be zero values.
+	if cfg.Testing.Command != "" {
+		t.Errorf("Testing.Command should be empty, got %q", cfg.Testing.Command)
+	}
+	if cfg.Notifications.WebhookURL != "" {
+		t.Errorf("Notifications.WebhookURL should be empty, got %q", cfg.Notifications.WebhookURL)
+	}
+	if len(cfg.Agents.Roles) != 0 {
+		t.Errorf("Agents.Roles should be empty, got %v", cfg.Agents.Roles)
+	}
+
+	if cfg.Notifications.Format != "json" {
+		t.Errorf("Notifications.Format default = %q, want json", cfg.Notifications.Format)
+	}
+
+	if cfg.Docker.RestartPolicy != "unless-stopped" {
+		t.Errorf("Docker.RestartPolicy default = %q, want unless-stopped", cfg.Docker.RestartPolicy)
+	}
+
+	if cfg.Daemon.StaleTaskMaxAge != 2*time.Hour {
+		t.Errorf("Daemon.StaleTaskMaxAge default = %v, want 2h", cfg.Daemon.StaleTaskMaxAge)
+	}
+
+	if cfg.Docker.BuildTimeout != 5*time.Minute {
+		t.Errorf("Docker.BuildTimeout default = %v, want 5m", cfg.Docker.BuildTimeout)
+	}
+
+	if cfg.Git.DefaultBranch != "main" {
+		t.Errorf("Git.DefaultBranch default = %q, want main", cfg.Git.DefaultBranch)
+	}
+	if cfg.Git.ProjectSyncStrategy != "merge" {
+		t.Errorf("Git.ProjectSyncStrategy default = %q, want merge", cfg.Git.ProjectSyncStrategy)
+	}
+
+	if cfg.Notifications.LogScanLines != 50 {
+		t.Errorf("Notifications.LogScanLines default = %d, want 50", cfg.Notifications.LogScanLines)
+	}
+
+	// Error patterns default to the built-in markers.
+	if len(cfg.Notifications.ErrorPatterns) != 2 || cfg.Notifications.ErrorPatterns[0] != "ERROR:" || cfg.Notifications.ErrorPatterns[1] != "FAIL" {
+		t.Errorf("Notifications.ErrorPatterns default = %v, want [ERROR: FAIL]", cfg.Notifications.ErrorPatterns)
+	}
+}
+
+func TestLoad_CustomLogPatterns(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "patterns"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+error_patterns = ["panic:", "^--- FAIL"]
+ignore_patterns = ["FAIL_FAST"]
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if len(cfg.Notifications.ErrorPatterns) != 2 || cfg.Notifications.ErrorPatterns[0] != "panic:" {
+		t.Errorf("Notifications.ErrorPatterns = %v", cfg.Notifications.ErrorPatterns)
+	}
+	if len(cfg.Notifications.IgnorePatterns) != 1 || cfg.Notifications.IgnorePatterns[0] != "FAIL_FAST" {
+		t.Errorf("Notifications.IgnorePatterns = %v", cfg.Notifications.IgnorePatterns)
+	}
+}
+
+func TestLoad_Email(t *testing.T) {
+	t.Setenv("TEST_SMTP_PASSWORD", "s3cret")
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "email"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications.email]
+smtp_host = "smtp.example.com"
+from = "metamorph@example.com"
+to = ["dev@example.com"]
+username = "metamorph"
+password = "$TEST_SMTP_PASSWORD"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	email := cfg.Notifications.Email
+	if !email.Enabled() || email.SMTPHost != "smtp.example.com" || email.From != "metamorph@example.com" {
+		t.Errorf("Notifications.Email = %+v", email)
+	}
+	if len(email.To) != 1 || email.To[0] != "dev@example.com" {
+		t.Errorf("Notifications.Email.To = %v", email.To)
+	}
+	if email.Password != "s3cret" {
+		t.Errorf("Notifications.Email.Password = %q, want it expanded from the environment", email.Password)
+	}
+}
+
+func TestLoad_LocalOverrides(t *testing.T) {
+	t.Setenv("TEST_LOCAL_HOOK", "https://example.com/local-hook")
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "local"
+
+[agents]
+count = 4
+model = "claude-sonnet"
+
+[notifications]
+webhook_url = "https://example.com/team-hook"
+format = "slack"
+error_cooldown = "10m"
+`)
+	local := `
+[agents]
+count = 1
+
+[notifications]
+webhook_url = "$TEST_LOCAL_HOOK"
+error_cooldown = "0s"
+`
+	if err := os.WriteFile(filepath.Join(dir, "metamorph.local.toml"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Local values win and are env-expanded.
+	if cfg.Agents.Count != 1 {
+		t.Errorf("Agents.Count = %d, want the local 1", cfg.Agents.Count)
+	}
+	if cfg.Notifications.WebhookURL != "https://example.com/local-hook" {
+		t.Errorf("Notifications.WebhookURL = %q, want the expanded local hook", cfg.Notifications.WebhookURL)
+	}
+	// An explicit zero in the local file is kept rather than defaulted.
+	if cfg.Notifications.ErrorCooldown != 0 {
+		t.Errorf("Notifications.ErrorCooldown = %v, want the local 0s", cfg.Notifications.ErrorCooldown)
+	}
+	// Keys the local file doesn't set come from the base file.
+	if cfg.Agents.Model != "claude-sonnet" || cfg.Notifications.Format != "slack" || cfg.Project.Name != "local" {
+		t.Errorf("base values lost: model=%q format=%q name=%q", cfg.Agents.Model, cfg.Notifications.Format, cfg.Project.Name)
+	}
+}
+
+func TestLoad_LocalOverridesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "local"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`)
+	if err := os.WriteFile(filepath.Join(dir, "metamorph.local.toml"), []byte("[agents\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "parsing metamorph.local.toml") {
+		t.Errorf("expected a metamorph.local.toml parse error, got %v", err)
+	}
+
+	// Overrides are still validated.
+	if err := os.WriteFile(filepath.Join(dir, "metamorph.local.toml"), []byte("[agents]\ncount = 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an invalid local agent count to fail validation")
+	}
+}
+
+func TestLoad_NotificationHeaders(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "headers"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[notifications]
+webhook_url = "https://example.com/hook"
+
+[notifications.headers]
+Authorization = "Bearer abc"
+X-Team = "platform"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Notifications.Headers["Authorization"] != "Bearer abc" || cfg.Notifications.Headers["X-Team"] != "platform" {
+		t.Errorf("Notifications.Headers = %v", cfg.Notifications.Headers)
+	}
+}
+
+func TestLoad_StaleTaskMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "stale"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[daemon]
+stale_task_max_age = "45m"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Daemon.StaleTaskMaxAge != 45*time.Minute {
+		t.Errorf("Daemon.StaleTaskMaxAge = %v, want 45m", cfg.Daemon.StaleTaskMaxAge)
+	}
+}
+
+func TestLoad_CommitBatchInterval(t *testing.T) {
+	base := `
+[project]
+name = "batch"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  time.Duration
+	}{
+		{name: "default", want: DefaultCommitBatchInterval},
+		{name: "custom", extra: "[notifications]\ncommit_batch_interval = \"5m\"\n", want: 5 * time.Minute},
+		{name: "zero disables batching", extra: "[notifications]\ncommit_batch_interval = \"0s\"\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Notifications.CommitBatchInterval != tt.want {
+				t.Errorf("CommitBatchInterval = %v, want %v", cfg.Notifications.CommitBatchInterval, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_GCInterval(t *testing.T) {
+	base := `
+[project]
+name = "gc"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  time.Duration
+	}{
+		{name: "default", want: DefaultGCInterval},
+		{name: "custom", extra: "[daemon]\ngc_interval = \"6h\"\n", want: 6 * time.Hour},
+		{name: "zero disables gc", extra: "[daemon]\ngc_interval = \"0s\"\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Daemon.GCInterval != tt.want {
+				t.Errorf("GCInterval = %v, want %v", cfg.Daemon.GCInterval, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_AutoRestart(t *testing.T) {
+	base := `
+[project]
+name = "restart"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  bool
+	}{
+		{name: "default", want: true},
+		{name: "enabled", extra: "[daemon]\nauto_restart = true\n", want: true},
+		{name: "disabled", extra: "[daemon]\nauto_restart = false\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := cfg.Daemon.AutoRestartEnabled(); got != tt.want {
+				t.Errorf("AutoRestartEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !(DaemonConfig{}).AutoRestartEnabled() {
+		t.Error("AutoRestartEnabled() = false for an unset auto_restart, want true")
+	}
+}
+
+func TestLoad_DrainTimeout(t *testing.T) {
+	base := `
+[project]
+name = "drain"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  time.Duration
+	}{
+		{name: "default", want: DefaultDrainTimeout},
+		{name: "custom", extra: "[daemon]\ndrain_timeout = \"15m\"\n", want: 15 * time.Minute},
+		{name: "zero disables draining", extra: "[daemon]\ndrain_timeout = \"0s\"\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Daemon.DrainTimeout != tt.want {
+				t.Errorf("DrainTimeout = %v, want %v", cfg.Daemon.DrainTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_MonitorTimeout(t *testing.T) {
+	base := `
+[project]
+name = "watchdog"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  time.Duration
+	}{
+		{name: "default", want: DefaultMonitorTimeout},
+		{name: "custom", extra: "[daemon]\nmonitor_timeout = \"10m\"\n", want: 10 * time.Minute},
+		{name: "zero disables the watchdog", extra: "[daemon]\nmonitor_timeout = \"0s\"\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Daemon.MonitorTimeout != tt.want {
+				t.Errorf("MonitorTimeout = %v, want %v", cfg.Daemon.MonitorTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_AgentsReadyTimeout(t *testing.T) {
+	base := `
+[project]
+name = "ready"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name  string
+		extra string
+		want  time.Duration
+	}{
+		{name: "default", want: DefaultAgentsReadyTimeout},
+		{name: "custom", extra: "[daemon]\nagents_ready_timeout = \"10m\"\n", want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Daemon.AgentsReadyTimeout != tt.want {
+				t.Errorf("AgentsReadyTimeout = %v, want %v", cfg.Daemon.AgentsReadyTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_TasksClaimRetries(t *testing.T) {
+	base := `
+[project]
+name = "retries"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name    string
+		extra   string
+		want    int
+		wantErr string
+	}{
+		{name: "default", want: DefaultClaimRetries},
+		{name: "custom", extra: "[tasks]\nclaim_retries = 10\n", want: 10},
+		{name: "zero disables retrying", extra: "[tasks]\nclaim_retries = 0\n", want: 0},
+		{name: "negative", extra: "[tasks]\nclaim_retries = -1\n", wantErr: "tasks.claim_retries must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Tasks.ClaimRetries != tt.want {
+				t.Errorf("ClaimRetries = %d, want %d", cfg.Tasks.ClaimRetries, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_TasksLockDir(t *testing.T) {
+	base := `
+[project]
+name = "locks"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	tests := []struct {
+		name    string
+		extra   string
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: "current_tasks"},
+		{name: "custom", extra: "[tasks]\nlock_dir = \"work/locks\"\n", want: "work/locks"},
+		{name: "absolute", extra: "[tasks]\nlock_dir = \"/tmp/locks\"\n", wantErr: `invalid tasks.lock_dir: "/tmp/locks"`},
+		{name: "outside the repo", extra: "[tasks]\nlock_dir = \"../locks\"\n", wantErr: `invalid tasks.lock_dir: "../locks"`},
+		{name: "repo root", extra: "[tasks]\nlock_dir = \".\"\n", wantErr: `invalid tasks.lock_dir: "."`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, t.TempDir(), base+tt.extra))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Tasks.LockDir != tt.want {
+				t.Errorf("LockDir = %q, want %q", cfg.Tasks.LockDir, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_RunConfig(t *testing.T) {
+	base := `
+[project]
+name = "run"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, t.TempDir(), base))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		want := RunConfig{
+			MinSessionDuration: DefaultMinSessionDuration,
+			RateLimitBackoff:   DefaultRateLimitBackoff,
+			RestartDelay:       DefaultRestartDelay,
+		}
+		if cfg.Run != want {
+			t.Errorf("Run = %+v, want %+v", cfg.Run, want)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, t.TempDir(), base+`
+[run]
+min_session_duration = "1m"
+rate_limit_backoff = "15m"
+restart_delay = "0s"
+max_iterations = 10
+`))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		want := RunConfig{
+			MinSessionDuration: time.Minute,
+			RateLimitBackoff:   15 * time.Minute,
+			RestartDelay:       0,
+			MaxIterations:      10,
+		}
+		if cfg.Run != want {
+			t.Errorf("Run = %+v, want %+v", cfg.Run, want)
+		}
+	})
+}
+
+func TestLoad_CredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "api_key"), []byte("sk-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, dir, `
+[project]
+name = "creds"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[credentials]
+api_key_file = "api_key"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	apiKey, oauthToken, err := cfg.Credentials.Read(dir)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if apiKey != "sk-from-file" {
+		t.Errorf("apiKey = %q, want %q", apiKey, "sk-from-file")
+	}
+	if oauthToken != "" {
+		t.Errorf("oauthToken = %q, want empty", oauthToken)
+	}
+
+	cfg.Credentials.OAuthTokenFile = filepath.Join(dir, "missing")
+	if _, _, err := cfg.Credentials.Read(dir); err == nil || !strings.Contains(err.Error(), "credentials.oauth_token_file") {
+		t.Errorf("expected credentials.oauth_token_file error, got %v", err)
+	}
+}
+
+func TestApplyDefaults_GitAuthorFromHostConfig(t *testing.T) {
+	// Get the host's git config values for comparison.
+	wantName := ""
+	if out, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		wantName = strings.TrimSpace(string(out))
+	}
+	wantEmail := ""
+	if out, err := exec.Command("git", "config", "user.email").Output(); err == nil {
+		wantEmail = strings.TrimSpace(string(out))
+	}
+
+	if wantName == "" && wantEmail == "" {
+		t.Skip("no git config user.name/user.email set on host")
+	}
+
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "git-defaults"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if wantName != "" && cfg.Git.AuthorName != wantName {
+		t.Errorf("Git.AuthorName = %q, want %q (from git config)", cfg.Git.AuthorName, wantName)
+	}
+	if wantEmail != "" && cfg.Git.AuthorEmail != wantEmail {
+		t.Errorf("Git.AuthorEmail = %q, want %q (from git config)", cfg.Git.AuthorEmail, wantEmail)
+	}
+}
+
+func TestApplyDefaults_GitAuthorExplicitNotOverridden(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+[project]
+name = "git-explicit"
+
+[agents]
+count = 1
+model = "claude-sonnet"
+
+[git]
 author_name = "Explicit Name"
 author_email = "explicit@example.com"
 `)
@@ -406,3 +1542,100 @@ author_email = "explicit@example.com"
 		t.Errorf("Git.AuthorEmail = %q, want %q", cfg.Git.AuthorEmail, "explicit@example.com")
 	}
 }
+
+func TestRoleWarning(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		roles []string
+		warn  bool
+	}{
+		{name: "no roles", count: 4},
+		{name: "one agent per role", count: 2, roles: []string{"developer", "tester"}},
+		{name: "fewer agents than roles", count: 1, roles: []string{"developer", "tester"}},
+		{name: "more agents than roles", count: 4, roles: []string{"developer"}, warn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Agents: AgentsConfig{Count: tt.count, Roles: tt.roles}}
+			got := roleWarning(cfg)
+			if (got != "") != tt.warn {
+				t.Fatalf("roleWarning() = %q, want warning: %v", got, tt.warn)
+			}
+			if tt.warn && !strings.Contains(got, "round-robin") {
+				t.Errorf("warning should explain round-robin assignment: %q", got)
+			}
+		})
+	}
+}
+
+func TestLoad_ExpandsEnv(t *testing.T) {
+	t.Setenv("METAMORPH_TEST_HOOK", "https://hooks.example.com/T000")
+	t.Setenv("METAMORPH_TEST_MODEL", "claude-opus")
+	t.Setenv("METAMORPH_TEST_TOKEN", "abc123")
+
+	cfg, err := Load(writeConfig(t, t.TempDir(), `
+[project]
+name = "expand"
+
+[agents]
+count = 1
+model = "$METAMORPH_TEST_MODEL"
+
+[testing]
+command = "go test ${PKG}"
+
+[notifications]
+webhook_url = "${METAMORPH_TEST_HOOK}"
+signing_secret = "pa$$word"
+
+[notifications.headers]
+Authorization = "Bearer ${METAMORPH_TEST_TOKEN}"
+`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Notifications.WebhookURL != "https://hooks.example.com/T000" {
+		t.Errorf("WebhookURL = %q", cfg.Notifications.WebhookURL)
+	}
+	if cfg.Agents.Model != "claude-opus" {
+		t.Errorf("Model = %q", cfg.Agents.Model)
+	}
+	if got := cfg.Notifications.Headers["Authorization"]; got != "Bearer abc123" {
+		t.Errorf("Authorization header = %q", got)
+	}
+	if cfg.Notifications.SigningSecret != "pa$word" {
+		t.Errorf("SigningSecret = %q, want $$ to become a literal $", cfg.Notifications.SigningSecret)
+	}
+	if cfg.Testing.Command != "go test ${PKG}" {
+		t.Errorf("Testing.Command = %q, should not be expanded", cfg.Testing.Command)
+	}
+}
+
+func TestAgentsConfigSystemPrompt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "MY_SYSTEM_PROMPT.md"), []byte("You are agent ${AGENT_ID}.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{name: "unset uses built-in", want: assets.SystemPrompt},
+		{name: "relative override", file: "MY_SYSTEM_PROMPT.md", want: "You are agent ${AGENT_ID}.\n"},
+		{name: "absolute override", file: filepath.Join(dir, "MY_SYSTEM_PROMPT.md"), want: "You are agent ${AGENT_ID}.\n"},
+		{name: "missing file falls back", file: "missing.md", want: assets.SystemPrompt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := AgentsConfig{SystemPromptFile: tt.file}
+			if got := a.SystemPrompt(dir); got != tt.want {
+				t.Errorf("SystemPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
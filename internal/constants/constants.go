@@ -2,25 +2,37 @@ package constants
 
 // Standard paths used by metamorph.
 const (
-	UpstreamDir     = ".metamorph/upstream.git"
-	StateFile       = ".metamorph/state.json"
-	DockerDir       = ".metamorph/docker"
-	TaskLockDir     = "current_tasks"
-	AgentLogDir     = "agent_logs"
-	ProgressFile    = "PROGRESS.md"
+	MetamorphDir     = ".metamorph"
+	UpstreamDir      = ".metamorph/upstream.git"
+	StateFile        = ".metamorph/state.json"
+	DockerDir        = ".metamorph/docker"
+	TaskLockDir      = "current_tasks"
+	AgentLogDir      = "agent_logs"
+	ProgressFile     = "PROGRESS.md"
 	AgentPromptFile  = "AGENT_PROMPT.md"
+	RolePromptFile   = "AGENT_PROMPT.%s.md" // per-role override of AgentPromptFile
 	SystemPromptFile = "SYSTEM_PROMPT.md"
-	DaemonPIDFile   = ".metamorph/daemon.pid"
-	DaemonLogFile   = ".metamorph/daemon.log"
-	HeartbeatFile   = ".metamorph/heartbeat"
+	DaemonPIDFile    = ".metamorph/daemon.pid"
+	DaemonLogFile    = ".metamorph/daemon.log"
+	HeartbeatFile    = ".metamorph/heartbeat"
+	ScaleFile        = ".metamorph/scale"
+	StatsFile        = ".metamorph/stats.json"
+	TaskHistoryFile  = ".metamorph/task_history.jsonl"
+	StopFile         = ".metamorph/stop"
+
+	// Control files in each agent's log dir (agent_logs/agent-N). The daemon
+	// writes DrainFile to ask the agent to go idle after its current session;
+	// the agent writes DrainedFile once its work is pushed.
+	DrainFile   = ".drain"
+	DrainedFile = ".drained"
 )
 
 // AgentRoles maps built-in role names to their descriptions.
 var AgentRoles = map[string]string{
-	"developer":   "Implements new features and writes production code",
-	"tester":      "Writes and maintains test suites for code quality",
-	"refactorer":  "Improves code structure without changing behavior",
-	"documenter":  "Writes documentation, comments, and READMEs",
-	"optimizer":   "Profiles and optimizes performance bottlenecks",
-	"reviewer":    "Reviews code changes and suggests improvements",
+	"developer":  "Implements new features and writes production code",
+	"tester":     "Writes and maintains test suites for code quality",
+	"refactorer": "Improves code structure without changing behavior",
+	"documenter": "Writes documentation, comments, and READMEs",
+	"optimizer":  "Profiles and optimizes performance bottlenecks",
+	"reviewer":   "Reviews code changes and suggests improvements",
 }
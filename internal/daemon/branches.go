@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/gitops"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// mergeAgentBranches merges every agent's branch into the upstream default
+// branch. A branch that conflicts is left unmerged and a merge_conflict
+// event is sent once per conflicting tip, so the agent can rebase and push
+// again without the user being notified on every tick.
+func (d *Daemon) mergeAgentBranches(ctx context.Context, now time.Time) {
+	if d.conflictNotified == nil {
+		d.conflictNotified = make(map[string]string)
+	}
+
+	branches := make([]string, 0, len(d.state.Agents))
+	for _, a := range d.state.Agents {
+		branches = append(branches, gitops.AgentBranch(a.ID))
+	}
+
+	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
+	result, err := gitops.MergeAgentBranches(ctx, upstreamPath, branches)
+	if err != nil {
+		slog.Warn("failed to merge agent branches", "error", err)
+		return
+	}
+
+	for _, branch := range result.Merged {
+		slog.Info("merged agent branch", "branch", branch)
+		delete(d.conflictNotified, branch)
+	}
+
+	for _, a := range d.state.Agents {
+		branch := gitops.AgentBranch(a.ID)
+		tip, ok := result.Conflicted[branch]
+		if !ok || d.conflictNotified[branch] == tip {
+			continue
+		}
+		d.conflictNotified[branch] = tip
+		slog.Warn("agent branch conflicts with default branch", "branch", branch, "tip", tip)
+		d.sendEvent(notify.Event{
+			Type:      notify.EventMergeConflict,
+			AgentID:   a.ID,
+			Project:   d.cfg.Project.Name,
+			Message:   fmt.Sprintf("%s could not be merged because of conflicts", branch),
+			Timestamp: now,
+			Details: map[string]interface{}{
+				"branch": branch,
+				"commit": tip,
+			},
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/gitops"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+func TestMergeAgentBranches_NotifiesConflictOnce(t *testing.T) {
+	runGit := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	dir := t.TempDir()
+	runGit(dir, "init")
+	runGit(dir, "config", "user.name", "test")
+	runGit(dir, "config", "user.email", "test@test")
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\n"), 0644)
+	runGit(dir, "add", ".")
+	runGit(dir, "commit", "-m", "initial commit")
+	if err := gitops.InitUpstream(t.Context(), dir, "", constants.TaskLockDir); err != nil {
+		t.Fatalf("InitUpstream: %v", err)
+	}
+	upstreamPath := filepath.Join(dir, constants.UpstreamDir)
+
+	// Both agents rewrite README.md, so the second branch conflicts.
+	for id := 1; id <= 2; id++ {
+		agentDir := filepath.Join(t.TempDir(), fmt.Sprintf("agent-%d", id))
+		if err := gitops.CloneForAgent(t.Context(), upstreamPath, id, agentDir, gitops.CloneOpts{BranchPerAgent: true}); err != nil {
+			t.Fatalf("CloneForAgent: %v", err)
+		}
+		_ = os.WriteFile(filepath.Join(agentDir, "README.md"), []byte(fmt.Sprintf("agent %d\n", id)), 0644)
+		runGit(agentDir, "commit", "-am", "rewrite readme")
+		runGit(agentDir, "push", "origin", "HEAD")
+	}
+
+	var received []notify.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	d := &Daemon{
+		projectDir: dir,
+		cfg: &config.Config{
+			Project:       config.ProjectConfig{Name: "test"},
+			Git:           config.GitConfig{BranchPerAgent: true},
+			Notifications: config.NotificationsConfig{WebhookURL: srv.URL},
+		},
+		state: &State{Agents: []AgentState{{ID: 1}, {ID: 2}}},
+	}
+
+	d.mergeAgentBranches(t.Context(), time.Now().UTC())
+	d.mergeAgentBranches(t.Context(), time.Now().UTC())
+
+	if len(received) != 1 {
+		t.Fatalf("expected one %s event, got %d: %+v", notify.EventMergeConflict, len(received), received)
+	}
+	e := received[0]
+	if e.Type != notify.EventMergeConflict || e.AgentID != 2 || e.Details["branch"] != "agent-2" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
+
+func TestSyncRepos_NotifiesConflictOnce(t *testing.T) {
+	runGit := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	dir := t.TempDir()
+	runGit(dir, "init")
+	runGit(dir, "config", "user.name", "test")
+	runGit(dir, "config", "user.email", "test@test")
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\n"), 0644)
+	runGit(dir, "add", ".")
+	runGit(dir, "commit", "-m", "initial commit")
+	if err := gitops.InitUpstream(t.Context(), dir, "", constants.TaskLockDir); err != nil {
+		t.Fatalf("InitUpstream: %v", err)
+	}
+	upstreamPath := filepath.Join(dir, constants.UpstreamDir)
+	if _, err := gitops.SyncToProjectDir(t.Context(), upstreamPath, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user deletes README.md while an agent rewrites it: a modify/delete
+	// conflict that merging in favor of the agent can't resolve.
+	runGit(dir, "rm", "-q", "README.md")
+	runGit(dir, "commit", "-m", "remove readme")
+	agentDir := filepath.Join(t.TempDir(), "agent-1")
+	if err := gitops.CloneForAgent(t.Context(), upstreamPath, 1, agentDir, gitops.CloneOpts{}); err != nil {
+		t.Fatalf("CloneForAgent: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(agentDir, "README.md"), []byte("agent 1\n"), 0644)
+	runGit(agentDir, "commit", "-am", "rewrite readme")
+	runGit(agentDir, "push", "origin", "HEAD")
+
+	var received []notify.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	d := &Daemon{
+		projectDir: dir,
+		cfg: &config.Config{
+			Project:       config.ProjectConfig{Name: "test"},
+			Notifications: config.NotificationsConfig{WebhookURL: srv.URL},
+		},
+		state: &State{},
+	}
+
+	if d.syncRepos(t.Context()) {
+		t.Error("syncRepos reported new commits despite the conflict")
+	}
+	d.syncRepos(t.Context())
+
+	if len(received) != 1 {
+		t.Fatalf("expected one %s event, got %d: %+v", notify.EventSyncConflict, len(received), received)
+	}
+	e := received[0]
+	if e.Type != notify.EventSyncConflict || e.Details["strategy"] != "merge" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	files, _ := e.Details["files"].([]interface{})
+	if len(files) != 1 || files[0] != "README.md" {
+		t.Errorf("files = %v, want [README.md]", e.Details["files"])
+	}
+}
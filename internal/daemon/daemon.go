@@ -5,15 +5,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -27,12 +33,13 @@ import (
 
 const (
 	monitorInterval       = 30 * time.Second
-	staleTaskMaxAge       = 2 * time.Hour
-	startupTimeout        = 5 * time.Minute
+	staleHeartbeatAge     = 3 * monitorInterval // GetStatus reports "stale" past this
 	shutdownTimeout       = 30 * time.Second
-	commitBatchInterval   = 60 * time.Second
-	errorDebounceCooldown = 5 * time.Minute
 	logTailLines          = 50
+	restartBackoffBase    = 30 * time.Second
+	restartBackoffMax     = 10 * time.Minute
+	crashWindow           = 30 * time.Minute
+	maxConsecutiveCrashes = 5
 )
 
 // State represents the daemon's persisted state.
@@ -42,6 +49,21 @@ type State struct {
 	ProjectName string       `json:"project_name"`
 	Agents      []AgentState `json:"agents"`
 	Stats       Stats        `json:"stats"`
+
+	// DrainDeadline is set while shutdown waits for agents to finish their
+	// sessions, so Stop knows how long to wait for the daemon to exit.
+	DrainDeadline *time.Time `json:"drain_deadline,omitempty"`
+
+	// NotifyStatus is the outcome of the last notification sent, so a broken
+	// webhook shows up in status rather than only in daemon.log.
+	NotifyStatus *NotifyStatus `json:"notify_status,omitempty"`
+}
+
+// NotifyStatus records the most recent notification attempt.
+type NotifyStatus struct {
+	LastAttempt time.Time `json:"last_attempt"`
+	Event       string    `json:"event"`
+	Error       string    `json:"error,omitempty"` // empty when the send succeeded
 }
 
 // AgentState tracks a single agent container.
@@ -53,6 +75,11 @@ type AgentState struct {
 	SessionsCompleted int       `json:"sessions_completed"`
 	LastActivity      time.Time `json:"last_activity"`
 	CurrentTask       *string   `json:"current_task"`
+	TaskDescription   string    `json:"task_description,omitempty"` // from the current task's lock, if the agent gave one
+	CPUPercent        float64   `json:"cpu_percent"`                // last sampled CPU usage, 100 = one core
+	MemoryBytes       uint64    `json:"memory_bytes"`               // last sampled memory usage
+	StartedAt         time.Time `json:"started_at"`                 // when the current container started
+	RestartCount      int       `json:"restart_count"`              // restarts by the daemon since it started
 }
 
 // Stats holds aggregate metrics.
@@ -74,23 +101,109 @@ type Daemon struct {
 	startedAt  time.Time
 
 	// Notification state.
-	prevCommitCount   int                  // previous commit count for batching
-	commitBatchStart  time.Time            // when the current commit batch started
-	pendingCommits    []string             // commit messages accumulated during batch window
-	lastErrorNotified map[int]time.Time    // agentID → last time we sent test_failure for this agent
-	hasNewCommits     bool                 // true when new commits detected this tick
+	prevCommitCount   int               // previous commit count for batching
+	commitBatchStart  time.Time         // when the current commit batch started
+	pendingCommits    []string          // commit messages accumulated during batch window
+	lastErrorNotified map[int]time.Time // agentID → last time we sent test_failure for this agent
+	hasNewCommits     bool              // true when new commits detected this tick
+
+	// Crash-loop state.
+	crashes     map[int]*crashRecord // agentID → recent crash history
+	leftStopped map[int]bool         // agents reported crashed or unhealthy and left as they are with auto_restart off
+
+	// Task state.
+	taskLocks map[string]int // task → owning agent, as of the last updateTasks
+
+	// Session state.
+	sessionsSeen map[int]int // agentID → highest session-N.log number seen
+
+	// Branch-per-agent state.
+	conflictNotified map[string]string // branch → tip we last sent merge_conflict for
+
+	// Project sync state.
+	syncConflictNotified string // upstream commit we last sent sync_conflict for
+
+	// Maintenance state.
+	syncTestsRunning atomic.Bool                                          // true while testing.command runs after a sync
+	syncTestsTimeout time.Duration                                        // syncTestsTimeout, shortened in tests
+	gc               func(ctx context.Context, upstreamPath string) error // gitops.GC, replaceable in tests
+	lastGC           time.Time                                            // when the last gc was started
+	gcRunning        atomic.Bool                                          // true while a gc goroutine is running
+
+	// Notification state.
+	notifier     notify.Notifier // delivers events; built from [notifications] when nil
+	notifyMu     sync.Mutex      // guards notifyStatus; events are also sent from the watchdog
+	notifyStatus *NotifyStatus   // outcome of the last send, copied into state on write
+
+	// Watchdog state.
+	shutdownCtx   context.Context           // cancelled when shutdown begins; outlives monitor iterations
+	monitorStep   func(ctx context.Context) // d.monitor, replaceable in tests
+	monitorGen    uint64                    // number of the latest monitor iteration
+	monitorActive atomic.Uint64             // number of the iteration holding the tick loop; 0 when idle
+	monitorDone   chan struct{}             // closed when the latest iteration finishes
+
+	// Disk state.
+	writeFile func(name string, data []byte, perm os.FileMode) error // os.WriteFile, replaceable in tests
+	diskFull  bool                                                   // true while state writes fail with ENOSPC
+
+	// HTTP API state.
+	metrics    *metrics
+	httpServer *http.Server
+	mu         sync.RWMutex // guards published
+	published  *State       // snapshot of state served over HTTP
+	events     eventBroker  // streams events to GET /events subscribers
+}
+
+// crashRecord tracks consecutive crashes of a single agent for backoff.
+type crashRecord struct {
+	count     int       // consecutive crashes within crashWindow
+	lastCrash time.Time // when the most recent crash was detected
+	restartAt time.Time // earliest time the pending restart may happen
+	pending   bool      // true while waiting out the backoff delay
+}
+
+// daemonCommand builds the --daemon-mode re-exec of exe. Credentials go in
+// the child's environment rather than its arguments, which any user can read
+// from the process list.
+func daemonCommand(exe, projectDir string, dcfg config.DaemonConfig, apiKey, oauthToken string) *exec.Cmd {
+	args := []string{"start", "--daemon-mode", "--project-dir", projectDir, "--log-format", dcfg.LogFormat}
+	if !dcfg.AutoRestartEnabled() {
+		args = append(args, "--no-restart")
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = projectDir
+	cmd.Env = os.Environ()
+	if apiKey != "" {
+		cmd.Env = append(cmd.Env, "ANTHROPIC_API_KEY="+apiKey)
+	}
+	if oauthToken != "" {
+		cmd.Env = append(cmd.Env, "CLAUDE_CODE_OAUTH_TOKEN="+oauthToken)
+	}
+	return cmd
 }
 
 // Start launches the daemon as a background subprocess. It re-execs the
-// current binary with --daemon-mode and waits for state.json to appear.
+// current binary with --daemon-mode and waits for every agent to be running,
+// bounding the image build and agent startup phases separately.
 func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) error {
 	pidPath := filepath.Join(projectDir, constants.DaemonPIDFile)
 
 	// Check for orphan containers from a previous crashed daemon.
-	if err := cleanOrphans(projectDir, cfg.Project.Name); err != nil {
+	if err := cleanOrphans(projectDir, cfg.Project.Name, cfg.Docker.Host); err != nil {
 		return fmt.Errorf("daemon: failed to clean orphans: %w", err)
 	}
 
+	// Readiness is checked against the containers themselves; see agentsReady.
+	dc, err := docker.NewClient(cfg.Project.Name, cfg.Docker.Host)
+	if err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+
+	// Carry stats from the previous run forward before the old state is removed.
+	if err := saveLifetimeStats(projectDir); err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+
 	// Remove stale state.json so the polling loop doesn't find an old one.
 	statePath := filepath.Join(projectDir, constants.StateFile)
 	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
@@ -103,15 +216,7 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 		return fmt.Errorf("daemon: failed to find executable: %w", err)
 	}
 
-	args := []string{"start", "--daemon-mode", "--project-dir", projectDir}
-	if apiKey != "" {
-		args = append(args, "--api-key", apiKey)
-	}
-	if oauthToken != "" {
-		args = append(args, "--oauth-token", oauthToken)
-	}
-	cmd := exec.Command(exe, args...)
-	cmd.Dir = projectDir
+	cmd := daemonCommand(exe, projectDir, cfg.Daemon, apiKey, oauthToken)
 
 	// Redirect daemon output to a log file for diagnostics.
 	logPath := filepath.Join(projectDir, constants.DaemonLogFile)
@@ -125,8 +230,8 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 
-	// Detach from parent session.
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// Detach from the parent so the daemon outlives this command.
+	cmd.SysProcAttr = detachedProcAttr()
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("daemon: failed to start subprocess: %w", err)
@@ -136,16 +241,16 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 	if err := os.MkdirAll(filepath.Dir(pidPath), 0755); err != nil {
 		return fmt.Errorf("daemon: failed to create pid dir: %w", err)
 	}
-	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
-		return fmt.Errorf("daemon: failed to write pid file: %w", err)
+	if err := writePIDFile(pidPath, cmd.Process.Pid); err != nil {
+		return fmt.Errorf("daemon: %w", err)
 	}
 
 	// Release the child so it outlives us.
 	childPID := cmd.Process.Pid
 	_ = cmd.Process.Release()
 
-	// Wait for state.json to appear, tailing daemon.log for progress.
-	deadline := time.Now().Add(startupTimeout)
+	// Wait for the agents to come up, tailing daemon.log for progress.
+	tracker := newStartupTracker(time.Now(), cfg.Docker.BuildTimeout, cfg.Daemon.AgentsReadyTimeout)
 
 	// Open the log file for tailing progress messages.
 	tailFile, err := os.Open(logPath)
@@ -158,8 +263,8 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 	}
 	printed := make(map[string]bool) // deduplicate messages
 
-	for time.Now().Before(deadline) {
-		if _, err := os.Stat(statePath); err == nil {
+	for !tracker.expired(time.Now()) {
+		if agentsReady(context.Background(), dc, readStateFile(statePath), cfg.Agents.Count) {
 			if tailFile != nil {
 				tailFile.Close()
 			}
@@ -172,8 +277,9 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 			for {
 				line, err := reader.ReadString('\n')
 				if line != "" {
-					if msg := parseSlogMsg(line); msg != "" && !printed[msg] {
+					if msg := parseLogMsg(line, cfg.Daemon.LogFormat); msg != "" && !printed[msg] {
 						printed[msg] = true
+						tracker.observe(msg, time.Now())
 						fmt.Println(formatProgressMsg(msg))
 					}
 				}
@@ -203,7 +309,7 @@ func Start(projectDir string, cfg *config.Config, apiKey, oauthToken string) err
 	logFile.Close()
 	hint := readDaemonLogHint(logPath)
 
-	return fmt.Errorf("daemon: timed out waiting for state.json after %s%s", startupTimeout, hint)
+	return fmt.Errorf("%w%s", tracker.timeoutError(), hint)
 }
 
 // readDaemonLogHint reads the daemon log file and returns a formatted hint
@@ -231,24 +337,30 @@ func Stop(projectDir string) error {
 		return fmt.Errorf("daemon: process %d not found: %w", pid, err)
 	}
 
-	// Send SIGTERM.
-	if err := proc.Signal(syscall.SIGTERM); err != nil {
+	// Ask the daemon to shut down gracefully.
+	if err := requestShutdown(projectDir, proc); err != nil {
 		_ = os.Remove(pidPath)
-		return fmt.Errorf("daemon: failed to send SIGTERM: %w", err)
+		return fmt.Errorf("daemon: failed to request shutdown: %w", err)
 	}
 
-	// Wait for exit.
+	// Wait for exit, allowing extra time while the daemon drains agents.
 	deadline := time.Now().Add(shutdownTimeout)
-	for time.Now().Before(deadline) {
+	for {
 		if !processAlive(pid) {
 			_ = os.Remove(pidPath)
 			return nil
 		}
+		if drain := drainDeadline(projectDir); drain.Add(shutdownTimeout).After(deadline) {
+			deadline = drain.Add(shutdownTimeout)
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
 	// Force kill.
-	_ = proc.Signal(syscall.SIGKILL)
+	_ = killProcess(proc)
 	time.Sleep(time.Second)
 	_ = os.Remove(pidPath)
 
@@ -270,7 +382,7 @@ func GetStatus(projectDir string) (*State, error) {
 	}
 
 	// Verify the daemon PID is actually alive.
-	if state.Status == "running" && !IsRunning(projectDir) {
+	if (state.Status == "running" || state.Status == "draining") && !IsRunning(projectDir) {
 		state.Status = "stopped"
 		// Also mark all agents as stopped since the daemon is dead.
 		for i := range state.Agents {
@@ -280,22 +392,54 @@ func GetStatus(projectDir string) (*State, error) {
 		}
 	}
 
+	// A live daemon whose monitor loop stopped ticking is hung.
+	if state.Status == "running" && heartbeatStale(projectDir, time.Now().UTC()) {
+		state.Status = "stale"
+	}
+
 	return &state, nil
 }
 
-// IsRunning checks if the daemon process is alive.
+// heartbeatStale reports whether the daemon's last heartbeat is older than
+// staleHeartbeatAge. A missing or unreadable heartbeat is not considered
+// stale, since older daemons didn't write one at startup.
+func heartbeatStale(projectDir string, now time.Time) bool {
+	data, err := os.ReadFile(filepath.Join(projectDir, constants.HeartbeatFile))
+	if err != nil {
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	return now.Sub(last) > staleHeartbeatAge
+}
+
+// IsRunning checks if the daemon process is alive. If the PID file records a
+// start time that doesn't match the live process, the PID has been reused by
+// an unrelated process: the stale PID file is removed and false is returned.
 func IsRunning(projectDir string) bool {
 	pidPath := filepath.Join(projectDir, constants.DaemonPIDFile)
-	pid, err := readPID(pidPath)
+	pid, startTime, err := readPIDFile(pidPath)
 	if err != nil {
 		return false
 	}
-	return processAlive(pid)
+	if !processAlive(pid) {
+		return false
+	}
+	if startTime != "" {
+		if current, err := processStartTime(pid); err == nil && current != startTime {
+			slog.Debug("daemon pid reused by another process", "pid", pid)
+			_ = os.Remove(pidPath)
+			return false
+		}
+	}
+	return true
 }
 
 // Run executes the daemon's main loop (called when --daemon-mode is set).
 // This is exported so the CLI can call it from the start command.
-func Run(projectDir string, cfg *config.Config, apiKey, oauthToken string, dockerClient docker.DockerClient) error {
+func Run(projectDir string, cfg *config.Config, apiKey, oauthToken string, dockerClient docker.DockerClient) (err error) {
 	d := &Daemon{
 		projectDir:        projectDir,
 		cfg:               cfg,
@@ -304,15 +448,46 @@ func Run(projectDir string, cfg *config.Config, apiKey, oauthToken string, docke
 		docker:            dockerClient,
 		startedAt:         time.Now().UTC(),
 		lastErrorNotified: make(map[int]time.Time),
+		crashes:           make(map[int]*crashRecord),
+		metrics:           newMetrics(),
+		gc:                gitops.GC,
+		lastGC:            time.Now().UTC(),
+		notifier:          NewNotifier(cfg.Notifications),
 	}
 
+	// Dead man's switch: report any exit that wasn't requested via stop.
+	// A SIGKILL (e.g. the OOM killer) can't be caught here; status reports
+	// that case as "stale" once the heartbeat stops.
+	stopping := false
+	defer func() {
+		if r := recover(); r != nil {
+			d.sendDaemonDown(fmt.Sprintf("daemon panicked: %v", r))
+			panic(r)
+		}
+		if err != nil && !stopping {
+			d.sendDaemonDown(err.Error())
+		}
+	}()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Build image.
-	slog.Info("building docker image")
-	if err := d.docker.BuildImage(projectDir, cfg.Docker.ExtraPackages); err != nil {
-		return fmt.Errorf("daemon: failed to build image: %w", err)
+	// Build or pull image.
+	if cfg.Docker.ImagePull {
+		slog.Info("pulling docker image", "image", cfg.Docker.Image)
+		auth := docker.RegistryAuth{
+			Username:         cfg.Docker.RegistryAuth.Username,
+			Password:         cfg.Docker.RegistryAuth.Password,
+			CredentialHelper: cfg.Docker.RegistryAuth.CredentialHelper,
+		}
+		if err := d.docker.PullImage(cfg.Docker.Image, auth, cfg.Docker.BuildTimeout); err != nil {
+			return fmt.Errorf("daemon: failed to pull image: %w", err)
+		}
+	} else {
+		slog.Info("building docker image")
+		if err := d.docker.BuildImage(projectDir, cfg.Docker.ExtraPackages, cfg.Agents.SystemPrompt(projectDir), cfg.Docker.BuildTimeout); err != nil {
+			return fmt.Errorf("daemon: failed to build image: %w", err)
+		}
 	}
 
 	// Start agents.
@@ -322,56 +497,92 @@ func Run(projectDir string, cfg *config.Config, apiKey, oauthToken string, docke
 		return fmt.Errorf("daemon: failed to start agents: %w", err)
 	}
 
-	// Write initial state.
+	// Write initial state, continuing the counters from previous runs.
 	d.state = &State{
 		Status:      "running",
 		StartedAt:   d.startedAt,
 		ProjectName: cfg.Project.Name,
 		Agents:      agentStates,
+		Stats:       loadLifetimeStats(projectDir),
 	}
+	d.metrics.setAgentsRunning(len(agentStates))
 	if err := d.writeState(); err != nil {
 		return fmt.Errorf("daemon: failed to write initial state: %w", err)
 	}
+	d.writeHeartbeat(d.startedAt)
+
+	d.sendEvent(notify.Event{
+		Type:      notify.EventDaemonStarted,
+		Project:   cfg.Project.Name,
+		Message:   fmt.Sprintf("daemon started with %d agent(s)", len(agentStates)),
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"agents": len(agentStates),
+		},
+	})
+
+	// Start the optional HTTP status API.
+	if cfg.Daemon.HTTPAddr != "" {
+		if err := d.startHTTPServer(cfg.Daemon.HTTPAddr); err != nil {
+			_ = d.docker.StopAllAgents(ctx)
+			return fmt.Errorf("daemon: failed to start HTTP server: %w", err)
+		}
+	}
 
-	// Set up signal handling.
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	// Set up shutdown handling.
+	sigCh := shutdownRequests(projectDir)
+
+	// A shutdown request cancels the monitor's context, interrupting any
+	// in-flight git or Docker call so a slow tick can't hold up shutdown.
+	monitorCtx, cancelMonitor := context.WithCancel(ctx)
+	defer cancelMonitor()
+	d.shutdownCtx = monitorCtx
+	go func() {
+		select {
+		case <-sigCh:
+			cancelMonitor()
+		case <-ctx.Done():
+		}
+	}()
 
 	ticker := time.NewTicker(monitorInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-sigCh:
+		case <-monitorCtx.Done():
+			stopping = true
+			d.waitForMonitor(shutdownTimeout)
 			return d.shutdown(ctx)
 		case <-ticker.C:
-			d.monitor(ctx)
+			d.runMonitor(monitorCtx)
 		}
 	}
 }
 
+// sendDaemonDown sends a daemon_down event explaining why the daemon is
+// exiting unexpectedly.
+func (d *Daemon) sendDaemonDown(reason string) {
+	d.sendEvent(notify.Event{
+		Type:      notify.EventDaemonDown,
+		Project:   d.cfg.Project.Name,
+		Message:   "daemon exited unexpectedly: " + reason,
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+}
+
 // startAgents creates containers for all configured agents.
 func (d *Daemon) startAgents(ctx context.Context) ([]AgentState, error) {
 	var agents []AgentState
 
-	roles := d.cfg.Agents.Roles
 	for i := 1; i <= d.cfg.Agents.Count; i++ {
-		role := "developer"
-		if len(roles) > 0 {
-			role = roles[(i-1)%len(roles)]
-		}
+		role := d.roleFor(i)
 
 		slog.Info("starting agent", "agent", i, "role", role)
-		containerID, err := d.docker.StartAgent(ctx, docker.AgentOpts{
-			ProjectDir:     d.projectDir,
-			AgentID:        i,
-			Role:           role,
-			Model:          d.cfg.Agents.Model,
-			APIKey:         d.apiKey,
-			OAuthToken:     d.oauthToken,
-			GitAuthorName:  d.cfg.Git.AuthorName,
-			GitAuthorEmail: d.cfg.Git.AuthorEmail,
-		})
+		containerID, err := d.docker.StartAgent(ctx, d.agentOpts(i, role))
 		if err != nil {
 			return nil, fmt.Errorf("failed to start agent-%d: %w", i, err)
 		}
@@ -382,12 +593,79 @@ func (d *Daemon) startAgents(ctx context.Context) ([]AgentState, error) {
 			ContainerID:  containerID,
 			Status:       "running",
 			LastActivity: time.Now().UTC(),
+			StartedAt:    time.Now().UTC(),
 		})
 	}
 
 	return agents, nil
 }
 
+// roleFor returns the role for the given agent ID, assigning configured
+// roles round-robin and defaulting to "developer".
+func (d *Daemon) roleFor(agentID int) string {
+	roles := d.cfg.Agents.Roles
+	if len(roles) == 0 {
+		return "developer"
+	}
+	return roles[(agentID-1)%len(roles)]
+}
+
+// hostGPGHome returns the GnuPG home on the host: $GNUPGHOME, or ~/.gnupg.
+// It returns "" if neither can be determined.
+func hostGPGHome() string {
+	if dir := os.Getenv("GNUPGHOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gnupg")
+}
+
+// agentOpts builds the container options for an agent.
+func (d *Daemon) agentOpts(agentID int, role string) docker.AgentOpts {
+	opts := docker.AgentOpts{
+		ProjectDir:    d.projectDir,
+		AgentID:       agentID,
+		Role:          role,
+		Model:         d.cfg.Agents.Model,
+		APIKey:        d.apiKey,
+		OAuthToken:    d.oauthToken,
+		RestartPolicy: d.cfg.Docker.RestartPolicy,
+		GPUs:          d.cfg.Docker.GPUs,
+		CacheVolume:   d.cfg.Docker.CacheVolume,
+		SignCommits:   d.cfg.Git.SignCommits,
+		SigningKey:    d.cfg.Git.SigningKey,
+		CloneDepth:    d.cfg.Git.CloneDepth,
+		PromptFile:    docker.AgentPromptPath(d.projectDir, role),
+		Command:       d.cfg.Docker.Command,
+		TaskLockDir:   d.taskLockDir(),
+	}
+	// Docker's own restart policy would otherwise revive a crashed container
+	// before it could be inspected.
+	if !d.cfg.Daemon.AutoRestartEnabled() {
+		opts.RestartPolicy = "no"
+	}
+	// Agents commit as agent-N unless git.use_author_identity is set, in
+	// which case the configured identity becomes the commits' author.
+	if d.cfg.Git.UseAuthorIdentity {
+		opts.GitAuthorName = d.cfg.Git.AuthorName
+		opts.GitAuthorEmail = d.cfg.Git.AuthorEmail
+	}
+	// A built image is always tagged with the docker package's default.
+	if d.cfg.Docker.ImagePull {
+		opts.Image = d.cfg.Docker.Image
+	}
+	if d.cfg.Git.SignCommits {
+		opts.GPGHome = hostGPGHome()
+	}
+	if d.cfg.Git.BranchPerAgent {
+		opts.Branch = gitops.AgentBranch(agentID)
+	}
+	return opts
+}
+
 // monitor runs one iteration of the monitoring loop, recovering from panics.
 func (d *Daemon) monitor(ctx context.Context) {
 	defer func() {
@@ -398,41 +676,69 @@ func (d *Daemon) monitor(ctx context.Context) {
 
 	now := time.Now().UTC()
 
+	// Apply any pending scale request before checking agent health.
+	d.reconcileScale(ctx, now)
+
 	// List running containers.
 	agents, err := d.docker.ListAgents(ctx)
 	if err == nil {
 		d.updateAgentStates(agents)
-		d.restartCrashedAgents(ctx, agents)
+		d.restartCrashedAgents(ctx, agents, now)
+		d.collectAgentStats(ctx)
 	}
 
 	// Update task info.
-	d.updateTasks()
+	d.updateTasks(now)
+
+	// Merge agent branches into the default branch before counting commits.
+	if d.cfg.Git.BranchPerAgent {
+		d.mergeAgentBranches(ctx, now)
+	}
 
 	// Count commits and notify if new ones detected.
-	d.countCommitsAndNotify(now)
+	d.countCommitsAndNotify(ctx, now)
 
 	// Sync repos when new commits are detected.
 	if d.hasNewCommits {
-		d.syncRepos()
+		if d.syncRepos(ctx) && d.cfg.Testing.RunOnSync {
+			d.startSyncTests()
+		}
 		d.hasNewCommits = false
 	}
 
 	// Clear stale task locks and notify.
-	d.clearStaleTasksAndNotify(now)
+	d.clearStaleTasksAndNotify(ctx, now)
+
+	// Count sessions that finished since the last tick.
+	d.countSessions()
 
 	// Check agent logs for errors.
 	d.checkAgentLogs(now)
 
+	// Prune and rotate agent session logs.
+	d.rotateAgentLogs()
+
 	// Flush pending commit batch if window has elapsed.
 	d.flushCommitBatch(now)
 
+	// Garbage-collect the upstream repo in the background when due.
+	d.maybeGC(now)
+
 	// Update uptime.
 	d.state.Stats.UptimeSeconds = int(now.Sub(d.startedAt).Seconds())
+	d.metrics.setUptime(d.state.Stats.UptimeSeconds)
 
 	// Write state atomically.
 	_ = d.writeState()
 
-	// Write heartbeat.
+	d.writeHeartbeat(now)
+}
+
+// writeHeartbeat records that the monitor loop is alive. GetStatus uses it
+// to detect a hung daemon. It is written even while the disk is full: the
+// file is a few bytes rewritten in place, and skipping it would make a
+// healthy daemon look hung.
+func (d *Daemon) writeHeartbeat(now time.Time) {
 	heartbeatPath := filepath.Join(d.projectDir, constants.HeartbeatFile)
 	_ = os.WriteFile(heartbeatPath, []byte(now.Format(time.RFC3339)), 0644)
 }
@@ -444,50 +750,118 @@ func (d *Daemon) updateAgentStates(infos []docker.AgentInfo) {
 		infoMap[info.ID] = info
 	}
 
+	running := 0
 	for i := range d.state.Agents {
 		a := &d.state.Agents[i]
+		if a.Status == "failed" {
+			continue // failed agents stay failed until the daemon restarts
+		}
 		if info, ok := infoMap[a.ID]; ok {
 			a.ContainerID = info.ContainerID
-			a.Status = normalizeStatus(info.Status)
+			a.Status = agentStatus(info)
+			if !info.StartedAt.IsZero() {
+				a.StartedAt = info.StartedAt
+			}
 		} else {
 			a.Status = "stopped"
 		}
+		if a.Status == "running" {
+			running++
+		}
 	}
+	d.metrics.setAgentsRunning(running)
 }
 
 // restartCrashedAgents restarts any agents that are no longer running.
-func (d *Daemon) restartCrashedAgents(ctx context.Context, infos []docker.AgentInfo) {
-	running := make(map[int]bool)
+// Repeated crashes are delayed with exponential backoff, and an agent that
+// crashes maxConsecutiveCrashes times within crashWindow is marked "failed"
+// and left stopped until the daemon is restarted. With daemon.auto_restart
+// off, crashed agents are only reported; see reportCrashedAgents.
+func (d *Daemon) restartCrashedAgents(ctx context.Context, infos []docker.AgentInfo, now time.Time) {
+	if !d.cfg.Daemon.AutoRestartEnabled() {
+		d.reportCrashedAgents(infos, now)
+		return
+	}
+	if d.crashes == nil {
+		d.crashes = make(map[int]*crashRecord)
+	}
+
+	// Paused containers are alive and were paused on purpose, so they are
+	// not crashes. Unhealthy containers are running but wedged, so they are
+	// restarted like crashed ones.
+	alive := make(map[int]bool)
 	for _, info := range infos {
-		if strings.Contains(strings.ToLower(info.Status), "up") {
-			running[info.ID] = true
+		switch agentStatus(info) {
+		case "running", "paused":
+			alive[info.ID] = true
 		}
 	}
 
 	for i := range d.state.Agents {
 		a := &d.state.Agents[i]
-		if running[a.ID] {
+		if alive[a.ID] || a.Status == "failed" {
 			continue
 		}
 
-		// Try to stop cleanly first (removes exited container).
+		rec, ok := d.crashes[a.ID]
+		if !ok {
+			rec = &crashRecord{}
+			d.crashes[a.ID] = rec
+		}
+
+		// Record a newly detected crash and schedule the restart.
+		if !rec.pending {
+			if now.Sub(rec.lastCrash) > crashWindow {
+				rec.count = 0
+			}
+			rec.count++
+			rec.lastCrash = now
+			rec.restartAt = now.Add(restartBackoff(rec.count))
+			rec.pending = true
+
+			if rec.count >= maxConsecutiveCrashes {
+				// Remove the container so Docker's restart policy doesn't revive it.
+				_ = d.docker.StopAgent(ctx, a.ID)
+				a.Status = "failed"
+				rec.pending = false
+
+				d.sendEvent(notify.Event{
+					Type:      notify.EventAgentFailed,
+					AgentID:   a.ID,
+					AgentRole: a.Role,
+					Project:   d.cfg.Project.Name,
+					Message:   fmt.Sprintf("agent-%d (%s) crashed %d times in %s and will not be restarted", a.ID, a.Role, rec.count, crashWindow),
+					Timestamp: now,
+					Details: map[string]interface{}{
+						"restart_count": rec.count,
+					},
+				})
+				continue
+			}
+		}
+
+		if now.Before(rec.restartAt) {
+			continue // still backing off
+		}
+		rec.pending = false
+
+		reason := "crashed"
+		if a.Status == "unhealthy" {
+			reason = "became unhealthy"
+		}
+
+		// Try to stop cleanly first (removes exited or wedged container).
 		_ = d.docker.StopAgent(ctx, a.ID)
 
 		// Restart.
-		containerID, err := d.docker.StartAgent(ctx, docker.AgentOpts{
-			ProjectDir:     d.projectDir,
-			AgentID:        a.ID,
-			Role:           a.Role,
-			Model:          d.cfg.Agents.Model,
-			APIKey:         d.apiKey,
-			OAuthToken:     d.oauthToken,
-			GitAuthorName:  d.cfg.Git.AuthorName,
-			GitAuthorEmail: d.cfg.Git.AuthorEmail,
-		})
+		containerID, err := d.docker.StartAgent(ctx, d.agentOpts(a.ID, a.Role))
 		if err == nil {
 			a.ContainerID = containerID
 			a.Status = "running"
-			a.LastActivity = time.Now().UTC()
+			a.LastActivity = now
+			a.StartedAt = now
+			a.RestartCount++
+			d.metrics.incAgentRestarts(a.ID, a.Role)
 
 			// Notify about the crash/restart.
 			d.sendEvent(notify.Event{
@@ -495,40 +869,152 @@ func (d *Daemon) restartCrashedAgents(ctx context.Context, infos []docker.AgentI
 				AgentID:   a.ID,
 				AgentRole: a.Role,
 				Project:   d.cfg.Project.Name,
-				Message:   fmt.Sprintf("agent-%d (%s) crashed and was restarted", a.ID, a.Role),
-				Timestamp: time.Now().UTC(),
+				Message:   fmt.Sprintf("agent-%d (%s) %s and was restarted", a.ID, a.Role, reason),
+				Timestamp: now,
+				Details: map[string]interface{}{
+					"restart_count": rec.count,
+				},
 			})
 		}
 	}
 }
 
-// updateTasks reads current task locks and maps them to agents.
-func (d *Daemon) updateTasks() {
+// reportCrashedAgents sends agent_crashed once for each agent that stopped
+// running or became unhealthy, leaving its container as it is so it can be
+// inspected or exec'd into. An agent that is running again, e.g. after a manual docker start,
+// is reported afresh if it crashes later.
+func (d *Daemon) reportCrashedAgents(infos []docker.AgentInfo, now time.Time) {
+	if d.leftStopped == nil {
+		d.leftStopped = make(map[int]bool)
+	}
+
+	alive := make(map[int]bool)
+	for _, info := range infos {
+		switch agentStatus(info) {
+		case "running", "paused":
+			alive[info.ID] = true
+		}
+	}
+
+	for i := range d.state.Agents {
+		a := &d.state.Agents[i]
+		if alive[a.ID] {
+			delete(d.leftStopped, a.ID)
+			continue
+		}
+		if a.Status == "failed" || d.leftStopped[a.ID] {
+			continue
+		}
+		d.leftStopped[a.ID] = true
+
+		// An unhealthy container is still running; only a crashed one is
+		// actually stopped.
+		reason, left := "crashed", "left stopped"
+		if a.Status == "unhealthy" {
+			reason, left = "became unhealthy", "left running"
+		}
+		slog.Warn("agent "+reason+" and auto_restart is off, leaving it", "agent", a.ID, "status", a.Status)
+		d.sendEvent(notify.Event{
+			Type:      notify.EventAgentCrashed,
+			AgentID:   a.ID,
+			AgentRole: a.Role,
+			Project:   d.cfg.Project.Name,
+			Message:   fmt.Sprintf("agent-%d (%s) %s and was %s (auto_restart is off)", a.ID, a.Role, reason, left),
+			Timestamp: now,
+			Details: map[string]interface{}{
+				"restart_count": 0,
+			},
+		})
+	}
+}
+
+// restartBackoff returns how long to wait before restarting an agent after
+// its nth consecutive crash: immediately the first time, then 30s, 1m, 2m, ...
+// capped at restartBackoffMax.
+func restartBackoff(n int) time.Duration {
+	if n <= 1 {
+		return 0
+	}
+	delay := restartBackoffBase
+	for i := 2; i < n; i++ {
+		delay *= 2
+		if delay >= restartBackoffMax {
+			return restartBackoffMax
+		}
+	}
+	return delay
+}
+
+// taskLockDir returns tasks.lock_dir, falling back to the default.
+func (d *Daemon) taskLockDir() string {
+	if d.cfg.Tasks.LockDir == "" {
+		return constants.TaskLockDir
+	}
+	return d.cfg.Tasks.LockDir
+}
+
+// updateTasks reads the task locks committed to the upstream and maps them
+// to agents.
+func (d *Daemon) updateTasks(now time.Time) {
 	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
-	locks, err := tasks.ListTasks(upstreamPath)
+	locks, err := tasks.ListCommittedTasks(upstreamPath, d.taskLockDir())
 	if err != nil {
 		return
 	}
 
-	taskMap := make(map[int]string)
+	taskMap := make(map[int]tasks.TaskLock)
+	current := make(map[string]int)
 	for _, lock := range locks {
-		taskMap[lock.AgentID] = lock.Name
+		taskMap[lock.AgentID] = lock
+		current[lock.Name] = lock.AgentID
+	}
+
+	// Locks that disappeared since the last tick were released by their agent.
+	if d.taskLocks != nil {
+		var released []TaskHistoryEntry
+		for name, agentID := range d.taskLocks {
+			if _, ok := current[name]; !ok {
+				released = append(released, TaskHistoryEntry{Task: name, AgentID: agentID, Event: TaskCompleted, Timestamp: now})
+			}
+		}
+		sort.Slice(released, func(i, j int) bool { return released[i].Task < released[j].Task })
+		if err := appendTaskHistory(d.projectDir, released...); err != nil {
+			slog.Warn("failed to record task history", "error", err)
+		}
+		d.state.Stats.TasksCompleted += len(released)
+		d.metrics.addTasksCompleted(len(released))
+		for _, entry := range released {
+			d.sendEvent(notify.Event{
+				Type:      notify.EventTaskCompleted,
+				AgentID:   entry.AgentID,
+				AgentRole: d.roleFor(entry.AgentID),
+				Project:   d.cfg.Project.Name,
+				Message:   fmt.Sprintf("agent-%d completed task: %s", entry.AgentID, entry.Task),
+				Timestamp: now,
+				Details: map[string]interface{}{
+					"task": entry.Task,
+				},
+			})
+		}
 	}
+	d.taskLocks = current
 
 	for i := range d.state.Agents {
 		a := &d.state.Agents[i]
-		if name, ok := taskMap[a.ID]; ok {
-			a.CurrentTask = &name
+		if lock, ok := taskMap[a.ID]; ok {
+			a.CurrentTask = &lock.Name
+			a.TaskDescription = lock.Description
 		} else {
 			a.CurrentTask = nil
+			a.TaskDescription = ""
 		}
 	}
 }
 
 // countCommitsAndNotify counts total commits and accumulates new ones for batched notification.
-func (d *Daemon) countCommitsAndNotify(now time.Time) {
+func (d *Daemon) countCommitsAndNotify(ctx context.Context, now time.Time) {
 	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
-	cmd := exec.Command("git", "rev-list", "--count", "HEAD")
+	cmd := exec.CommandContext(ctx, "git", "rev-list", "--count", "HEAD")
 	cmd.Dir = upstreamPath
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -543,9 +1029,10 @@ func (d *Daemon) countCommitsAndNotify(now time.Time) {
 	newCommits := count - d.prevCommitCount
 	if d.prevCommitCount > 0 && newCommits > 0 {
 		d.hasNewCommits = true
+		d.metrics.addCommits(newCommits)
 
 		// Read the latest commit messages.
-		logCmd := exec.Command("git", "log", "--oneline", fmt.Sprintf("-%d", newCommits))
+		logCmd := exec.CommandContext(ctx, "git", "log", "--oneline", fmt.Sprintf("-%d", newCommits))
 		logCmd.Dir = upstreamPath
 		var logOut bytes.Buffer
 		logCmd.Stdout = &logOut
@@ -562,12 +1049,14 @@ func (d *Daemon) countCommitsAndNotify(now time.Time) {
 	d.state.Stats.TotalCommits = count
 }
 
-// flushCommitBatch sends a batched commits_pushed notification if the batch window has elapsed.
+// flushCommitBatch sends a batched commits_pushed notification if the batch
+// window has elapsed. A zero notifications.commit_batch_interval flushes on
+// every tick.
 func (d *Daemon) flushCommitBatch(now time.Time) {
 	if len(d.pendingCommits) == 0 {
 		return
 	}
-	if now.Sub(d.commitBatchStart) < commitBatchInterval {
+	if now.Sub(d.commitBatchStart) < d.cfg.Notifications.CommitBatchInterval {
 		return
 	}
 
@@ -579,6 +1068,7 @@ func (d *Daemon) flushCommitBatch(now time.Time) {
 		Details: map[string]interface{}{
 			"count":   len(d.pendingCommits),
 			"commits": d.pendingCommits,
+			"by_type": commitTypeCounts(d.pendingCommits),
 		},
 	})
 
@@ -586,14 +1076,75 @@ func (d *Daemon) flushCommitBatch(now time.Time) {
 	d.commitBatchStart = time.Time{}
 }
 
+// conventionalCommitRe matches a `git log --oneline` line whose subject has
+// a Conventional Commits prefix, e.g. "1a2b3c4 feat(parser)!: add arrays".
+var conventionalCommitRe = regexp.MustCompile(`^(?:[0-9a-f]{4,40} )?([A-Za-z]+)(?:\([^)]*\))?!?: `)
+
+// conventionalCommitTypes are the commit types counted by commitTypeCounts.
+var conventionalCommitTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// commitTypeCounts counts oneline commit messages by Conventional Commits
+// type. Messages without a recognised type are counted as "other".
+func commitTypeCounts(messages []string) map[string]int {
+	counts := make(map[string]int)
+	for _, msg := range messages {
+		typ := "other"
+		if m := conventionalCommitRe.FindStringSubmatch(msg); m != nil && slices.Contains(conventionalCommitTypes, strings.ToLower(m[1])) {
+			typ = strings.ToLower(m[1])
+		}
+		counts[typ]++
+	}
+	return counts
+}
+
 // clearStaleTasksAndNotify removes stale task locks and sends notifications.
-func (d *Daemon) clearStaleTasksAndNotify(now time.Time) {
+// The upstream is bare, so locks are removed by committing through the
+// daemon's working copy and pushing.
+func (d *Daemon) clearStaleTasksAndNotify(ctx context.Context, now time.Time) {
+	maxAge := d.cfg.Daemon.StaleTaskMaxAge
+	if maxAge <= 0 {
+		maxAge = config.DefaultStaleTaskMaxAge
+	}
 	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
-	cleared, err := tasks.ClearStaleTasks(upstreamPath, staleTaskMaxAge)
+	locks, err := tasks.ListCommittedTasks(upstreamPath, d.taskLockDir())
 	if err != nil {
 		return
 	}
+	var stale []string
+	for _, lock := range locks {
+		if now.Sub(lock.ClaimedAt) > maxAge {
+			stale = append(stale, lock.Name)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	workingCopyPath := filepath.Join(d.projectDir, ".metamorph", "work")
+	if _, err := gitops.SyncToWorkingCopy(ctx, upstreamPath, workingCopyPath); err != nil {
+		slog.Warn("failed to sync working copy to clear stale task locks", "error", err)
+		return
+	}
+	var cleared []string
+	for _, taskName := range stale {
+		if _, err := tasks.ForceReleaseTask(workingCopyPath, d.taskLockDir(), taskName); err != nil {
+			slog.Warn("failed to clear stale task lock", "task", taskName, "error", err)
+			continue
+		}
+		cleared = append(cleared, taskName)
+	}
 	d.state.Stats.TasksCompleted += len(cleared)
+	d.metrics.addTasksCompleted(len(cleared))
+
+	history := make([]TaskHistoryEntry, 0, len(cleared))
+	for _, taskName := range cleared {
+		history = append(history, TaskHistoryEntry{Task: taskName, AgentID: d.taskLocks[taskName], Event: TaskCleared, Timestamp: now})
+		// Already recorded as cleared; don't report it as completed next tick.
+		delete(d.taskLocks, taskName)
+	}
+	if err := appendTaskHistory(d.projectDir, history...); err != nil {
+		slog.Warn("failed to record task history", "error", err)
+	}
 
 	for _, taskName := range cleared {
 		d.sendEvent(notify.Event{
@@ -608,58 +1159,41 @@ func (d *Daemon) clearStaleTasksAndNotify(now time.Time) {
 	}
 }
 
-// checkAgentLogs scans each agent's latest log file for ERROR:/FAIL lines.
+// checkAgentLogs scans the last log_scan_lines lines of each agent's latest
+// log file for lines matching the configured error patterns, skipping lines
+// that match an ignore pattern.
 func (d *Daemon) checkAgentLogs(now time.Time) {
+	errorPatterns := d.cfg.Notifications.ErrorPatterns
+	if len(errorPatterns) == 0 {
+		errorPatterns = config.DefaultErrorPatterns
+	}
+	errorRes := compilePatterns(errorPatterns)
+	ignoreRes := compilePatterns(d.cfg.Notifications.IgnorePatterns)
+	scanLines := d.cfg.Notifications.LogScanLines
+	if scanLines <= 0 {
+		scanLines = logTailLines
+	}
+
 	for _, a := range d.state.Agents {
-		// Debounce: skip if we notified about this agent recently.
+		// Debounce: skip if we notified about this agent within the cooldown.
 		if lastNotified, ok := d.lastErrorNotified[a.ID]; ok {
-			if now.Sub(lastNotified) < errorDebounceCooldown {
-				continue
-			}
-		}
-
-		logDir := filepath.Join(d.projectDir, constants.AgentLogDir, fmt.Sprintf("agent-%d", a.ID))
-		entries, err := os.ReadDir(logDir)
-		if err != nil {
-			continue
-		}
-
-		// Find the latest session log.
-		var latestLog string
-		var latestNum int
-		for _, e := range entries {
-			name := e.Name()
-			if !strings.HasPrefix(name, "session-") || !strings.HasSuffix(name, ".log") {
+			if now.Sub(lastNotified) < d.cfg.Notifications.ErrorCooldown {
 				continue
 			}
-			numStr := strings.TrimSuffix(strings.TrimPrefix(name, "session-"), ".log")
-			num, err := strconv.Atoi(numStr)
-			if err != nil {
-				continue
-			}
-			if num > latestNum {
-				latestNum = num
-				latestLog = filepath.Join(logDir, name)
-			}
 		}
 
+		latestLog := latestSessionLog(d.agentLogDir(a.ID))
 		if latestLog == "" {
 			continue
 		}
 
-		data, err := os.ReadFile(latestLog)
+		lines, err := tailLines(latestLog, scanLines)
 		if err != nil {
 			continue
 		}
 
-		lines := strings.Split(string(data), "\n")
-		start := 0
-		if len(lines) > logTailLines {
-			start = len(lines) - logTailLines
-		}
-
-		for _, line := range lines[start:] {
-			if strings.Contains(line, "ERROR:") || strings.Contains(line, "FAIL") {
+		for _, line := range lines {
+			if matchesAny(errorRes, line) && !matchesAny(ignoreRes, line) {
 				d.lastErrorNotified[a.ID] = now
 				d.sendEvent(notify.Event{
 					Type:      notify.EventTestFailure,
@@ -678,40 +1212,202 @@ func (d *Daemon) checkAgentLogs(now time.Time) {
 	}
 }
 
+// agentLogDir returns the host directory holding an agent's session logs.
+func (d *Daemon) agentLogDir(agentID int) string {
+	return filepath.Join(d.projectDir, constants.AgentLogDir, fmt.Sprintf("agent-%d", agentID))
+}
+
+// latestSessionLog returns the path of the highest-numbered session-N.log in
+// logDir, or "" if there are none.
+func latestSessionLog(logDir string) string {
+	path, _ := latestSession(logDir)
+	return path
+}
+
+// latestSession returns the path and number of the highest-numbered
+// session-N.log in logDir, or "" and 0 if there are none.
+func latestSession(logDir string) (string, int) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return "", 0
+	}
+
+	var latestLog string
+	var latestNum int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "session-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		numStr := strings.TrimSuffix(strings.TrimPrefix(name, "session-"), ".log")
+		num, err := strconv.Atoi(numStr)
+		if err != nil {
+			continue
+		}
+		if num > latestNum {
+			latestNum = num
+			latestLog = filepath.Join(logDir, name)
+		}
+	}
+	return latestLog, latestNum
+}
+
+// tailLines returns the last n lines of the file at path.
+func tailLines(path string, n int) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// compilePatterns compiles each pattern, skipping (and logging) invalid ones.
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			slog.Warn("ignoring invalid log pattern", "pattern", p, "error", err)
+			continue
+		}
+		res = append(res, re)
+	}
+	return res
+}
+
+// matchesAny reports whether line matches any of the given regexes.
+func matchesAny(res []*regexp.Regexp, line string) bool {
+	for _, re := range res {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
 // sendEvent sends a notification event, logging any errors.
 func (d *Daemon) sendEvent(event notify.Event) {
-	webhookURL := d.cfg.Notifications.WebhookURL
-	if webhookURL == "" {
+	d.events.publish(event)
+
+	notifier := d.notifier
+	if notifier == nil {
+		notifier = NewNotifier(d.cfg.Notifications)
+	}
+	if notifier == nil || !d.cfg.Notifications.EventEnabled(event.Type) {
 		return
 	}
-	if err := notify.Send(webhookURL, event); err != nil {
+	err := notifier.Send(event)
+	if err != nil {
 		slog.Error("failed to send notification", "event", event.Type, "error", err)
 	}
+	d.recordNotifyStatus(event.Type, err, time.Now().UTC())
+}
+
+// recordNotifyStatus remembers the outcome of a notification attempt for the
+// next state write.
+func (d *Daemon) recordNotifyStatus(eventType string, err error, now time.Time) {
+	status := &NotifyStatus{LastAttempt: now, Event: eventType}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	d.notifyMu.Lock()
+	d.notifyStatus = status
+	d.notifyMu.Unlock()
+}
+
+// NewNotifier returns the notifiers configured in [notifications]: the
+// webhook and email, either or both. It returns nil when neither is set.
+func NewNotifier(cfg config.NotificationsConfig) notify.Notifier {
+	var notifiers notify.MultiNotifier
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, notify.NewHTTPNotifier(cfg.WebhookURL, notify.Options{
+			Format:        cfg.Format,
+			SigningSecret: cfg.SigningSecret,
+			Headers:       cfg.Headers,
+		}))
+	}
+	if cfg.Email.Enabled() {
+		notifiers = append(notifiers, notify.NewEmailNotifier(notify.EmailOptions{
+			Host:     cfg.Email.SMTPHost,
+			Port:     cfg.Email.Port,
+			From:     cfg.Email.From,
+			To:       cfg.Email.To,
+			Username: cfg.Email.Username,
+			Password: cfg.Email.Password,
+		}))
+	}
+	switch len(notifiers) {
+	case 0:
+		return nil
+	case 1:
+		return notifiers[0]
+	}
+	return notifiers
 }
 
 // syncRepos syncs the upstream bare repo to both the working copy and the
 // user's project directory so changes are visible without running `metamorph sync`.
-func (d *Daemon) syncRepos() {
+// It reports whether new commits were merged into the project directory.
+func (d *Daemon) syncRepos(ctx context.Context) bool {
 	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
 	workingCopyPath := filepath.Join(d.projectDir, ".metamorph", "work")
 
-	if _, err := gitops.SyncToWorkingCopy(upstreamPath, workingCopyPath); err != nil {
+	if _, err := gitops.SyncToWorkingCopy(ctx, upstreamPath, workingCopyPath); err != nil {
 		slog.Warn("periodic sync to working copy failed", "error", err)
 	}
 
-	if _, err := gitops.SyncToProjectDir(upstreamPath, d.projectDir); err != nil {
+	summary, err := gitops.SyncToProjectDirWithStrategy(ctx, upstreamPath, d.projectDir, d.cfg.Git.ProjectSyncStrategy)
+	if err != nil {
 		slog.Warn("periodic sync to project dir failed", "error", err)
+		var conflict *gitops.ConflictError
+		if errors.As(err, &conflict) {
+			d.notifySyncConflict(conflict)
+		}
+		return false
+	}
+	d.syncConflictNotified = ""
+	return summary != ""
+}
+
+// notifySyncConflict sends a sync_conflict event, once per conflicting
+// upstream commit so a conflict that persists across ticks is reported once.
+func (d *Daemon) notifySyncConflict(conflict *gitops.ConflictError) {
+	if d.syncConflictNotified == conflict.Commit {
+		return
 	}
+	d.syncConflictNotified = conflict.Commit
+
+	d.sendEvent(notify.Event{
+		Type:      notify.EventSyncConflict,
+		Project:   d.cfg.Project.Name,
+		Message:   fmt.Sprintf("agent commits could not be synced into the project dir because of conflicts in %d file(s)", len(conflict.Files)),
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"files":    conflict.Files,
+			"commit":   conflict.Commit,
+			"strategy": conflict.Strategy,
+		},
+	})
 }
 
 // shutdown stops all agents and writes final state.
 func (d *Daemon) shutdown(ctx context.Context) error {
+	d.stopHTTPServer()
+
+	// Let agents finish and push their current session before stopping.
+	d.drainAgents(ctx)
 	_ = d.docker.StopAllAgents(ctx)
 
 	// Final sync so the latest agent work is visible in the project dir.
-	d.syncRepos()
+	d.syncRepos(ctx)
 
 	d.state.Status = "stopped"
+	d.state.DrainDeadline = nil
 	d.state.Stats.UptimeSeconds = int(time.Since(d.startedAt).Seconds())
 	_ = d.writeState()
 
@@ -722,13 +1418,63 @@ func (d *Daemon) shutdown(ctx context.Context) error {
 	return nil
 }
 
-// writeState writes state.json atomically via temp file + rename.
+// writeState writes state.json atomically via temp file + rename, and
+// publishes a snapshot for the HTTP API.
 func (d *Daemon) writeState() error {
-	return WriteState(d.projectDir, d.state)
+	d.notifyMu.Lock()
+	if d.notifyStatus != nil {
+		d.state.NotifyStatus = d.notifyStatus
+	}
+	d.notifyMu.Unlock()
+
+	d.publishState()
+	writeFile := d.writeFile
+	if writeFile == nil {
+		writeFile = os.WriteFile
+	}
+	err := writeStateFile(d.projectDir, d.state, writeFile)
+	d.checkDiskFull(err)
+	return err
+}
+
+// checkDiskFull sends a disk_full event the first time a state write fails
+// because the disk is full, and clears the condition once a write succeeds.
+func (d *Daemon) checkDiskFull(err error) {
+	if err == nil {
+		if d.diskFull {
+			slog.Info("disk space available again, state writes resumed")
+			d.diskFull = false
+		}
+		return
+	}
+	if !errors.Is(err, syscall.ENOSPC) {
+		return
+	}
+	if d.diskFull {
+		return
+	}
+	d.diskFull = true
+
+	statePath := filepath.Join(d.projectDir, constants.StateFile)
+	slog.Error("DISK FULL: cannot write daemon state; free up space so metamorph can record progress", "path", statePath, "error", err)
+	d.sendEvent(notify.Event{
+		Type:      notify.EventDiskFull,
+		Project:   d.cfg.Project.Name,
+		Message:   "disk full: daemon cannot write " + constants.StateFile,
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"path": statePath,
+		},
+	})
 }
 
 // WriteState writes a State to state.json atomically.
 func WriteState(projectDir string, state *State) error {
+	return writeStateFile(projectDir, state, os.WriteFile)
+}
+
+// writeStateFile is WriteState with the temp file written by writeFile.
+func writeStateFile(projectDir string, state *State, writeFile func(string, []byte, os.FileMode) error) error {
 	statePath := filepath.Join(projectDir, constants.StateFile)
 
 	data, err := json.MarshalIndent(state, "", "  ")
@@ -741,7 +1487,8 @@ func WriteState(projectDir string, state *State) error {
 	}
 
 	tmpPath := statePath + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+	if err := writeFile(tmpPath, data, 0644); err != nil {
+		_ = os.Remove(tmpPath)
 		return fmt.Errorf("daemon: failed to write temp state: %w", err)
 	}
 
@@ -754,12 +1501,12 @@ func WriteState(projectDir string, state *State) error {
 }
 
 // cleanOrphans stops containers from a previous crashed daemon.
-func cleanOrphans(projectDir string, projectName string) error {
+func cleanOrphans(projectDir, projectName, dockerHost string) error {
 	if IsRunning(projectDir) {
 		return fmt.Errorf("daemon is already running")
 	}
 
-	dc, err := docker.NewClient(projectName)
+	dc, err := docker.NewClient(projectName, dockerHost)
 	if err != nil {
 		// Docker not available — nothing to clean.
 		return nil
@@ -796,33 +1543,93 @@ func CleanOrphansWithClient(projectDir string, dc docker.DockerClient) error {
 	return nil
 }
 
+// writePIDFile writes "<pid> <start-time>" to path. The start time lets
+// IsRunning detect PID reuse; it is omitted if it can't be determined.
+func writePIDFile(path string, pid int) error {
+	content := strconv.Itoa(pid)
+	if startTime, err := processStartTime(pid); err == nil {
+		content += " " + startTime
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+	return nil
+}
+
 // readPID reads and parses the PID from a file.
 func readPID(path string) (int, error) {
+	pid, _, err := readPIDFile(path)
+	return pid, err
+}
+
+// readPIDFile reads the PID and the optional recorded start time from a file.
+// PID files written by older versions contain only the PID.
+func readPIDFile(path string) (int, string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read pid file: %w", err)
+		return 0, "", fmt.Errorf("failed to read pid file: %w", err)
 	}
-	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	pidStr, startTime, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	pid, err := strconv.Atoi(pidStr)
 	if err != nil {
-		return 0, fmt.Errorf("invalid pid in %s: %w", path, err)
+		return 0, "", fmt.Errorf("invalid pid in %s: %w", path, err)
 	}
-	return pid, nil
+	return pid, strings.TrimSpace(startTime), nil
 }
 
-// processAlive checks if a process with the given PID exists.
-func processAlive(pid int) bool {
-	proc, err := os.FindProcess(pid)
+// processStartTime returns an opaque token identifying when the process with
+// the given PID started. Two processes sharing a PID over time will have
+// different tokens. On Linux this is the starttime field of /proc/<pid>/stat;
+// elsewhere it falls back to `ps -o lstart=`.
+func processStartTime(pid int) (string, error) {
+	if runtime.GOOS == "linux" {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return "", err
+		}
+		// The comm field may contain spaces, so parse after the last ')'.
+		stat := string(data)
+		idx := strings.LastIndex(stat, ")")
+		if idx < 0 {
+			return "", fmt.Errorf("malformed /proc/%d/stat", pid)
+		}
+		fields := strings.Fields(stat[idx+1:])
+		// Fields after comm start at field 3 (state); starttime is field 22.
+		if len(fields) < 20 {
+			return "", fmt.Errorf("malformed /proc/%d/stat", pid)
+		}
+		return fields[19], nil
+	}
+
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
 	if err != nil {
-		return false
+		return "", err
 	}
-	// On Unix, FindProcess always succeeds. Signal 0 checks existence.
-	err = proc.Signal(syscall.Signal(0))
-	return err == nil
+	startTime := strings.Join(strings.Fields(string(out)), "_")
+	if startTime == "" {
+		return "", fmt.Errorf("no start time for pid %d", pid)
+	}
+	return startTime, nil
 }
 
 // slogMsgRe matches the msg="..." field in slog text output.
 var slogMsgRe = regexp.MustCompile(`msg="([^"]+)"`)
 
+// parseLogMsg extracts the msg value from a daemon.log line written in the
+// given daemon.log_format.
+func parseLogMsg(line, format string) string {
+	if format == "json" {
+		var record struct {
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return ""
+		}
+		return record.Msg
+	}
+	return parseSlogMsg(line)
+}
+
 // parseSlogMsg extracts the msg value from a slog text-format log line.
 func parseSlogMsg(line string) string {
 	m := slogMsgRe.FindStringSubmatch(line)
@@ -841,15 +1648,32 @@ func formatProgressMsg(msg string) string {
 	return strings.ToUpper(msg[:1]) + msg[1:] + "..."
 }
 
+// agentStatus returns the normalized status of an agent container, reporting
+// a running container whose health check fails as "unhealthy".
+func agentStatus(info docker.AgentInfo) string {
+	status := normalizeStatus(info.Status)
+	if status == "running" && info.Health == "unhealthy" {
+		return "unhealthy"
+	}
+	return status
+}
+
 // normalizeStatus converts Docker status strings to our simpler model.
+// Docker statuses start with the state ("Up 2 hours", "Exited (1) ..."), so
+// match on the prefix to avoid false positives like "backup" containing "up".
+// Paused containers report as "Up 2 hours (Paused)".
 func normalizeStatus(dockerStatus string) string {
-	lower := strings.ToLower(dockerStatus)
+	lower := strings.ToLower(strings.TrimSpace(dockerStatus))
 	switch {
-	case strings.Contains(lower, "up"):
+	case lower == "paused" || strings.HasSuffix(lower, "(paused)"):
+		return "paused"
+	case strings.HasPrefix(lower, "up") && strings.HasSuffix(lower, "(unhealthy)"):
+		return "unhealthy"
+	case strings.HasPrefix(lower, "up"):
 		return "running"
-	case strings.Contains(lower, "exited"):
+	case strings.HasPrefix(lower, "exited"):
 		return "exited"
-	case strings.Contains(lower, "created"):
+	case strings.HasPrefix(lower, "created"):
 		return "created"
 	default:
 		return "unknown"
@@ -3,12 +3,18 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -21,21 +27,35 @@ import (
 // mockDockerClient implements docker.DockerClient for daemon tests.
 type mockDockerClient struct {
 	buildErr    error
+	builds      int
+	pulls       []string // refs passed to PullImage
+	pullAuth    docker.RegistryAuth
+	pullErr     error
 	startAgents map[int]string // agentID -> containerID
 	startErr    error
 	stopCalls   []int
 	stopAllCall bool
+	stopAllAt   time.Time
 	stopErr     error
 	listResult  []docker.AgentInfo
 	listErr     error
 	logsBody    string
 	logsErr     error
+	stats       map[int]docker.AgentStats
+	statsErr    error
 }
 
-func (m *mockDockerClient) BuildImage(projectDir string, extraPackages []string) error {
+func (m *mockDockerClient) BuildImage(projectDir string, extraPackages []string, systemPrompt string, timeout time.Duration) error {
+	m.builds++
 	return m.buildErr
 }
 
+func (m *mockDockerClient) PullImage(ref string, auth docker.RegistryAuth, timeout time.Duration) error {
+	m.pulls = append(m.pulls, ref)
+	m.pullAuth = auth
+	return m.pullErr
+}
+
 func (m *mockDockerClient) StartAgent(ctx context.Context, opts docker.AgentOpts) (string, error) {
 	if m.startErr != nil {
 		return "", m.startErr
@@ -54,6 +74,7 @@ func (m *mockDockerClient) StopAgent(ctx context.Context, agentID int) error {
 
 func (m *mockDockerClient) StopAllAgents(ctx context.Context) error {
 	m.stopAllCall = true
+	m.stopAllAt = time.Now()
 	return m.stopErr
 }
 
@@ -61,6 +82,13 @@ func (m *mockDockerClient) ListAgents(ctx context.Context) ([]docker.AgentInfo,
 	return m.listResult, m.listErr
 }
 
+func (m *mockDockerClient) Stats(ctx context.Context, agentID int) (docker.AgentStats, error) {
+	if m.statsErr != nil {
+		return docker.AgentStats{}, m.statsErr
+	}
+	return m.stats[agentID], nil
+}
+
 func (m *mockDockerClient) GetLogs(ctx context.Context, agentID int, tail int, follow bool) (io.ReadCloser, error) {
 	if m.logsErr != nil {
 		return nil, m.logsErr
@@ -68,6 +96,18 @@ func (m *mockDockerClient) GetLogs(ctx context.Context, agentID int, tail int, f
 	return io.NopCloser(strings.NewReader(m.logsBody)), nil
 }
 
+func (m *mockDockerClient) PauseAgent(ctx context.Context, agentID int) error {
+	return nil
+}
+
+func (m *mockDockerClient) UnpauseAgent(ctx context.Context, agentID int) error {
+	return nil
+}
+
+func (m *mockDockerClient) ExecInteractive(ctx context.Context, agentID int, opts docker.ExecOpts) (int, error) {
+	return 0, nil
+}
+
 // --- State Serialization Tests ---
 
 func TestWriteState(t *testing.T) {
@@ -192,6 +232,79 @@ func TestWriteState(t *testing.T) {
 	})
 }
 
+func TestWriteState_DiskFull(t *testing.T) {
+	n := &recordingNotifier{}
+	full := true
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		cfg:        &config.Config{Project: config.ProjectConfig{Name: "proj"}},
+		state:      &State{Status: "running"},
+		notifier:   n,
+		writeFile: func(name string, data []byte, perm os.FileMode) error {
+			if full {
+				return &os.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+			}
+			return os.WriteFile(name, data, perm)
+		},
+	}
+
+	for range 3 {
+		if err := d.writeState(); !errors.Is(err, syscall.ENOSPC) {
+			t.Fatalf("writeState error = %v, want ENOSPC", err)
+		}
+	}
+	if len(n.events) != 1 || n.events[0].Type != notify.EventDiskFull {
+		t.Fatalf("events = %+v, want a single disk_full event", n.events)
+	}
+	if !d.diskFull {
+		t.Error("diskFull = false after ENOSPC")
+	}
+	if _, err := os.Stat(filepath.Join(d.projectDir, constants.StateFile+".tmp")); err == nil {
+		t.Error("partial temp file left behind")
+	}
+
+	// Heartbeats continue while the disk is full, so status doesn't report
+	// a live daemon as stale.
+	d.writeHeartbeat(time.Now())
+	if _, err := os.Stat(filepath.Join(d.projectDir, constants.HeartbeatFile)); err != nil {
+		t.Errorf("heartbeat not written while the disk is full: %v", err)
+	}
+
+	// Recovery clears the condition, so a later ENOSPC notifies again.
+	full = false
+	if err := d.writeState(); err != nil {
+		t.Fatalf("writeState after recovery: %v", err)
+	}
+	if d.diskFull {
+		t.Error("diskFull still set after a successful write")
+	}
+	full = true
+	_ = d.writeState()
+	if len(n.events) != 2 {
+		t.Errorf("got %d events, want a second disk_full after recovery", len(n.events))
+	}
+}
+
+func TestWriteState_OtherErrorsDoNotNotify(t *testing.T) {
+	n := &recordingNotifier{}
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		cfg:        &config.Config{},
+		state:      &State{Status: "running"},
+		notifier:   n,
+		writeFile: func(string, []byte, os.FileMode) error {
+			return errors.New("permission denied")
+		},
+	}
+
+	if err := d.writeState(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(n.events) != 0 || d.diskFull {
+		t.Errorf("events = %+v, diskFull = %v; want no disk_full for other errors", n.events, d.diskFull)
+	}
+}
+
 func TestStateJSONRoundTrip(t *testing.T) {
 	taskName := "fix-tests"
 	original := &State{
@@ -319,6 +432,47 @@ func TestReadPID(t *testing.T) {
 			t.Fatal("expected error for empty file")
 		}
 	})
+
+	t.Run("reads PID and start time", func(t *testing.T) {
+		dir := t.TempDir()
+		pidPath := filepath.Join(dir, "test.pid")
+		_ = os.WriteFile(pidPath, []byte("12345 987654\n"), 0644)
+
+		pid, startTime, err := readPIDFile(pidPath)
+		if err != nil {
+			t.Fatalf("readPIDFile: %v", err)
+		}
+		if pid != 12345 {
+			t.Errorf("pid = %d, want 12345", pid)
+		}
+		if startTime != "987654" {
+			t.Errorf("startTime = %q, want 987654", startTime)
+		}
+	})
+}
+
+func TestWritePIDFile(t *testing.T) {
+	dir := t.TempDir()
+	pidPath := filepath.Join(dir, "test.pid")
+
+	if err := writePIDFile(pidPath, os.Getpid()); err != nil {
+		t.Fatalf("writePIDFile: %v", err)
+	}
+
+	pid, startTime, err := readPIDFile(pidPath)
+	if err != nil {
+		t.Fatalf("readPIDFile: %v", err)
+	}
+	if pid != os.Getpid() {
+		t.Errorf("pid = %d, want %d", pid, os.Getpid())
+	}
+	want, err := processStartTime(os.Getpid())
+	if err != nil {
+		t.Skipf("process start time unavailable: %v", err)
+	}
+	if startTime != want {
+		t.Errorf("startTime = %q, want %q", startTime, want)
+	}
 }
 
 func TestProcessAlive(t *testing.T) {
@@ -337,6 +491,53 @@ func TestProcessAlive(t *testing.T) {
 	})
 }
 
+func TestParseLogMsg(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		line   string
+		want   string
+	}{
+		{"text", "text", `time=2026-01-02T10:00:00.000Z level=INFO msg="building docker image"` + "\n", "building docker image"},
+		{"text without msg", "text", "Step 1/9 : FROM node:22\n", ""},
+		{"json", "json", `{"time":"2026-01-02T10:00:00Z","level":"INFO","msg":"starting agents"}` + "\n", "starting agents"},
+		{"json with attrs", "json", `{"level":"INFO","msg":"starting agent","agent":1,"role":"developer"}`, "starting agent"},
+		{"json ignores text lines", "json", `time=2026-01-02T10:00:00.000Z level=INFO msg="building docker image"`, ""},
+		{"json ignores non-log output", "json", "panic: boom\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLogMsg(tt.line, tt.format); got != tt.want {
+				t.Errorf("parseLogMsg(%q, %q) = %q, want %q", tt.line, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaemonCommandKeepsSecretsOutOfArgs(t *testing.T) {
+	cmd := daemonCommand("/usr/local/bin/metamorph", "/project", config.DaemonConfig{LogFormat: "json"}, "sk-secret-key", "oauth-secret-token")
+
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "sk-secret-key") || strings.Contains(arg, "oauth-secret-token") {
+			t.Fatalf("secret found in args: %v", cmd.Args)
+		}
+	}
+
+	env := strings.Join(cmd.Env, "\n")
+	if !strings.Contains(env, "ANTHROPIC_API_KEY=sk-secret-key") {
+		t.Error("expected ANTHROPIC_API_KEY in child environment")
+	}
+	if !strings.Contains(env, "CLAUDE_CODE_OAUTH_TOKEN=oauth-secret-token") {
+		t.Error("expected CLAUDE_CODE_OAUTH_TOKEN in child environment")
+	}
+	if cmd.Dir != "/project" {
+		t.Errorf("Dir = %q, want /project", cmd.Dir)
+	}
+	if !strings.Contains(strings.Join(cmd.Args, " "), "--log-format json") {
+		t.Errorf("Args = %v, want --log-format json", cmd.Args)
+	}
+}
+
 func TestIsRunning(t *testing.T) {
 	t.Run("returns true when PID file has live process", func(t *testing.T) {
 		dir := t.TempDir()
@@ -359,6 +560,38 @@ func TestIsRunning(t *testing.T) {
 		}
 	})
 
+	t.Run("returns true when recorded start time matches", func(t *testing.T) {
+		dir := t.TempDir()
+		pidPath := filepath.Join(dir, constants.DaemonPIDFile)
+		_ = os.MkdirAll(filepath.Dir(pidPath), 0755)
+		if err := writePIDFile(pidPath, os.Getpid()); err != nil {
+			t.Fatalf("writePIDFile: %v", err)
+		}
+
+		if !IsRunning(dir) {
+			t.Error("expected IsRunning = true when start time matches")
+		}
+	})
+
+	t.Run("returns false and removes PID file when PID is reused", func(t *testing.T) {
+		if _, err := processStartTime(os.Getpid()); err != nil {
+			t.Skipf("process start time unavailable: %v", err)
+		}
+
+		dir := t.TempDir()
+		pidPath := filepath.Join(dir, constants.DaemonPIDFile)
+		_ = os.MkdirAll(filepath.Dir(pidPath), 0755)
+		// Live PID, but a start time from a different (dead) process.
+		_ = os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())+" 1"), 0644)
+
+		if IsRunning(dir) {
+			t.Error("expected IsRunning = false when start time differs")
+		}
+		if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+			t.Error("expected stale PID file to be removed")
+		}
+	})
+
 	t.Run("returns false when PID is stale", func(t *testing.T) {
 		dir := t.TempDir()
 		pidPath := filepath.Join(dir, constants.DaemonPIDFile)
@@ -444,6 +677,36 @@ func TestGetStatus(t *testing.T) {
 		}
 	})
 
+	t.Run("marks stale when heartbeat is old", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = WriteState(dir, &State{Status: "running", ProjectName: "proj"})
+
+		pidPath := filepath.Join(dir, constants.DaemonPIDFile)
+		_ = os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())), 0644)
+
+		heartbeatPath := filepath.Join(dir, constants.HeartbeatFile)
+		old := time.Now().UTC().Add(-10 * monitorInterval)
+		_ = os.WriteFile(heartbeatPath, []byte(old.Format(time.RFC3339)), 0644)
+
+		got, err := GetStatus(dir)
+		if err != nil {
+			t.Fatalf("GetStatus: %v", err)
+		}
+		if got.Status != "stale" {
+			t.Errorf("Status = %q, want stale (old heartbeat)", got.Status)
+		}
+
+		// A fresh heartbeat means the daemon is healthy.
+		_ = os.WriteFile(heartbeatPath, []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+		got, err = GetStatus(dir)
+		if err != nil {
+			t.Fatalf("GetStatus: %v", err)
+		}
+		if got.Status != "running" {
+			t.Errorf("Status = %q, want running (fresh heartbeat)", got.Status)
+		}
+	})
+
 	t.Run("returns error when state file missing", func(t *testing.T) {
 		dir := t.TempDir()
 
@@ -599,8 +862,16 @@ func TestNormalizeStatus(t *testing.T) {
 		{"Exited (1) 30 seconds ago", "exited"},
 		{"Created", "created"},
 		{"created", "created"},
-		{"Paused", "unknown"},
+		{"Paused", "paused"},
+		{"Up 2 minutes (Paused)", "paused"},
+		{"Up 3 hours (unhealthy)", "unhealthy"},
+		{"Up 3 hours (healthy)", "running"},
+		{"Up 10 seconds (health: starting)", "running"},
 		{"", "unknown"},
+		{"Exited (0) — backup in progress", "exited"},
+		{"Restarting (1) 5 seconds ago", "unknown"},
+		{"Removal In Progress", "unknown"},
+		{"Dead", "unknown"},
 	}
 
 	for _, tt := range tests {
@@ -771,6 +1042,104 @@ func (p *panicDockerClient) ListAgents(ctx context.Context) ([]docker.AgentInfo,
 	panic("simulated panic in ListAgents")
 }
 
+func TestRunSendsLifecycleEvents(t *testing.T) {
+	var received []notify.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		received = append(received, ev)
+	}))
+	defer srv.Close()
+
+	// Occupy the status API port so Run fails right after starting agents.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	cfg := &config.Config{
+		Project:       config.ProjectConfig{Name: "test"},
+		Agents:        config.AgentsConfig{Count: 2, Model: "claude-sonnet"},
+		Notifications: config.NotificationsConfig{WebhookURL: srv.URL, Format: "json"},
+		Daemon:        config.DaemonConfig{HTTPAddr: ln.Addr().String()},
+	}
+	mock := &mockDockerClient{startAgents: map[int]string{}}
+
+	if err := Run(t.TempDir(), cfg, "sk-test", "", mock); err == nil {
+		t.Fatal("expected Run to fail when the HTTP address is in use")
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(received), received)
+	}
+	started := received[0]
+	if started.Type != notify.EventDaemonStarted {
+		t.Errorf("first event = %q, want %q", started.Type, notify.EventDaemonStarted)
+	}
+	if agents, _ := started.Details["agents"].(float64); agents != 2 {
+		t.Errorf("details.agents = %v, want 2", started.Details["agents"])
+	}
+	if received[1].Type != notify.EventDaemonDown {
+		t.Errorf("second event = %q, want %q", received[1].Type, notify.EventDaemonDown)
+	}
+	if !strings.Contains(received[1].Message, "HTTP server") {
+		t.Errorf("daemon_down message = %q, want the failure reason", received[1].Message)
+	}
+}
+
+func TestRunPullsImage(t *testing.T) {
+	// Occupy the status API port so Run fails right after starting agents.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "test"},
+		Agents:  config.AgentsConfig{Count: 1, Model: "claude-sonnet"},
+		Docker: config.DockerConfig{
+			Image:        "ghcr.io/acme/agent:1.2",
+			ImagePull:    true,
+			RegistryAuth: config.RegistryAuthConfig{Username: "bot", Password: "s3cret"},
+		},
+		Daemon: config.DaemonConfig{HTTPAddr: ln.Addr().String()},
+	}
+	mock := &mockDockerClient{startAgents: map[int]string{}}
+
+	_ = Run(t.TempDir(), cfg, "sk-test", "", mock)
+
+	if mock.builds != 0 {
+		t.Errorf("BuildImage called %d times in pull mode, want 0", mock.builds)
+	}
+	if len(mock.pulls) != 1 || mock.pulls[0] != "ghcr.io/acme/agent:1.2" {
+		t.Errorf("pulls = %q, want the configured image", mock.pulls)
+	}
+	if want := (docker.RegistryAuth{Username: "bot", Password: "s3cret"}); mock.pullAuth != want {
+		t.Errorf("pull auth = %+v, want %+v", mock.pullAuth, want)
+	}
+	if len(mock.startAgents) != 1 {
+		t.Errorf("started %d agents, want 1", len(mock.startAgents))
+	}
+
+	d := &Daemon{cfg: cfg}
+	if got := d.agentOpts(1, "developer").Image; got != "ghcr.io/acme/agent:1.2" {
+		t.Errorf("agentOpts Image = %q, want the configured image", got)
+	}
+
+	t.Run("pull failure stops startup", func(t *testing.T) {
+		mock := &mockDockerClient{startAgents: map[int]string{}, pullErr: errors.New("manifest unknown")}
+		err := Run(t.TempDir(), cfg, "sk-test", "", mock)
+		if err == nil || !strings.Contains(err.Error(), "failed to pull image") {
+			t.Fatalf("Run = %v, want a pull error", err)
+		}
+		if len(mock.startAgents) != 0 {
+			t.Errorf("started %d agents after a failed pull", len(mock.startAgents))
+		}
+	})
+}
+
 func TestMonitorRecoversPanic(t *testing.T) {
 	dir := t.TempDir()
 
@@ -828,7 +1197,7 @@ func TestRestartCrashedAgents(t *testing.T) {
 			{ID: 1, Status: "Up 1 hour"},
 		}
 
-		d.restartCrashedAgents(context.Background(), infos)
+		d.restartCrashedAgents(context.Background(), infos, time.Now().UTC())
 
 		// Agent 2 should have been restarted.
 		if len(mock.stopCalls) == 0 {
@@ -837,9 +1206,329 @@ func TestRestartCrashedAgents(t *testing.T) {
 		if _, ok := mock.startAgents[2]; !ok {
 			t.Error("expected StartAgent to be called for agent-2")
 		}
+		if got := d.state.Agents[1].RestartCount; got != 1 {
+			t.Errorf("agent-2 RestartCount = %d, want 1", got)
+		}
+		if got := d.state.Agents[0].RestartCount; got != 0 {
+			t.Errorf("agent-1 RestartCount = %d, want 0", got)
+		}
+	})
+
+	t.Run("counts every restart", func(t *testing.T) {
+		mock := &mockDockerClient{startAgents: make(map[int]string)}
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			docker:     mock,
+			cfg: &config.Config{
+				Project: config.ProjectConfig{Name: "test"},
+				Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+			},
+			state: &State{Agents: []AgentState{{ID: 1, Role: "developer", Status: "running"}}},
+		}
+
+		// Crash twice; the second restart waits out the backoff.
+		now := time.Now().UTC()
+		d.restartCrashedAgents(context.Background(), nil, now)
+		now = now.Add(time.Minute)
+		d.restartCrashedAgents(context.Background(), nil, now)
+		now = now.Add(restartBackoffMax)
+		d.restartCrashedAgents(context.Background(), nil, now)
+
+		a := d.state.Agents[0]
+		if a.RestartCount != 2 {
+			t.Errorf("RestartCount = %d, want 2", a.RestartCount)
+		}
+		if !a.StartedAt.Equal(now) {
+			t.Errorf("StartedAt = %v, want time of the last restart %v", a.StartedAt, now)
+		}
+	})
+
+	t.Run("restarts unhealthy agents", func(t *testing.T) {
+		var received []notify.Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ev notify.Event
+			_ = json.NewDecoder(r.Body).Decode(&ev)
+			received = append(received, ev)
+		}))
+		defer srv.Close()
+
+		mock := &mockDockerClient{startAgents: make(map[int]string)}
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			docker:     mock,
+			cfg: &config.Config{
+				Project:       config.ProjectConfig{Name: "test"},
+				Agents:        config.AgentsConfig{Model: "claude-sonnet"},
+				Notifications: config.NotificationsConfig{WebhookURL: srv.URL, Format: "json"},
+			},
+			state: &State{Agents: []AgentState{{ID: 1, Role: "developer", Status: "running"}}},
+		}
+
+		// The container is up, but its health check is failing.
+		infos := []docker.AgentInfo{{ID: 1, Status: "Up 2 hours", Health: "unhealthy"}}
+		d.updateAgentStates(infos)
+		if d.state.Agents[0].Status != "unhealthy" {
+			t.Fatalf("Status = %q, want unhealthy", d.state.Agents[0].Status)
+		}
+		d.restartCrashedAgents(context.Background(), infos, time.Now().UTC())
+
+		if len(mock.stopCalls) != 1 || mock.stopCalls[0] != 1 {
+			t.Errorf("stopCalls = %v, want the wedged container stopped", mock.stopCalls)
+		}
+		if _, ok := mock.startAgents[1]; !ok {
+			t.Error("expected StartAgent to be called for agent-1")
+		}
+		if len(received) != 1 || !strings.Contains(received[0].Message, "became unhealthy") {
+			t.Errorf("events = %+v, want one agent_crashed event mentioning the health check", received)
+		}
+	})
+
+	t.Run("backs off repeated crashes", func(t *testing.T) {
+		mock := &mockDockerClient{
+			startAgents: make(map[int]string),
+		}
+
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			docker:     mock,
+			cfg: &config.Config{
+				Project: config.ProjectConfig{Name: "test"},
+				Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+			},
+			state: &State{
+				Agents: []AgentState{
+					{ID: 1, Role: "developer", Status: "exited"},
+				},
+			},
+		}
+
+		now := time.Now().UTC()
+
+		// First crash restarts immediately.
+		d.restartCrashedAgents(context.Background(), nil, now)
+		if _, ok := mock.startAgents[1]; !ok {
+			t.Fatal("expected immediate restart after first crash")
+		}
+
+		// Second crash waits for the backoff delay.
+		delete(mock.startAgents, 1)
+		now = now.Add(time.Minute)
+		d.restartCrashedAgents(context.Background(), nil, now)
+		if _, ok := mock.startAgents[1]; ok {
+			t.Error("expected restart to be delayed after second crash")
+		}
+
+		now = now.Add(restartBackoffBase)
+		d.restartCrashedAgents(context.Background(), nil, now)
+		if _, ok := mock.startAgents[1]; !ok {
+			t.Error("expected restart once backoff elapsed")
+		}
+	})
+
+	t.Run("marks agent failed after too many crashes", func(t *testing.T) {
+		mock := &mockDockerClient{
+			startAgents: make(map[int]string),
+		}
+
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			docker:     mock,
+			cfg: &config.Config{
+				Project: config.ProjectConfig{Name: "test"},
+				Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+			},
+			state: &State{
+				Agents: []AgentState{
+					{ID: 1, Role: "developer", Status: "exited"},
+				},
+			},
+		}
+
+		// Each tick either records a new crash or performs the delayed restart,
+		// so the agent keeps crashing until it is marked failed.
+		now := time.Now().UTC()
+		for i := 0; i < 2*maxConsecutiveCrashes && d.state.Agents[0].Status != "failed"; i++ {
+			d.restartCrashedAgents(context.Background(), nil, now)
+			now = now.Add(restartBackoffMax)
+		}
+
+		if d.state.Agents[0].Status != "failed" {
+			t.Fatalf("Status = %q, want failed", d.state.Agents[0].Status)
+		}
+
+		// A failed agent is never restarted again.
+		delete(mock.startAgents, 1)
+		d.restartCrashedAgents(context.Background(), nil, now.Add(time.Hour))
+		if _, ok := mock.startAgents[1]; ok {
+			t.Error("failed agent should not be restarted")
+		}
+
+		// updateAgentStates must not overwrite the failed status.
+		d.updateAgentStates(nil)
+		if d.state.Agents[0].Status != "failed" {
+			t.Errorf("Status = %q after updateAgentStates, want failed", d.state.Agents[0].Status)
+		}
 	})
 }
 
+func TestRestartCrashedAgents_AutoRestartOff(t *testing.T) {
+	mock := &mockDockerClient{startAgents: make(map[int]string)}
+	n := &recordingNotifier{}
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		docker:     mock,
+		notifier:   n,
+		cfg: &config.Config{
+			Project: config.ProjectConfig{Name: "test"},
+			Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+			Daemon:  config.DaemonConfig{AutoRestart: new(bool)},
+			Docker:  config.DockerConfig{RestartPolicy: "unless-stopped"},
+		},
+		state: &State{
+			Agents: []AgentState{
+				{ID: 1, Role: "developer", Status: "running"},
+				{ID: 2, Role: "tester", Status: "running"},
+			},
+		},
+	}
+
+	// Agent 2 has exited; it is reported once and left alone on later ticks.
+	infos := []docker.AgentInfo{
+		{ID: 1, Status: "Up 1 hour"},
+		{ID: 2, Status: "Exited (1) 5 seconds ago"},
+	}
+	now := time.Now().UTC()
+	for i := range 3 {
+		d.updateAgentStates(infos)
+		d.restartCrashedAgents(context.Background(), infos, now.Add(time.Duration(i)*restartBackoffMax))
+	}
+
+	if len(mock.startAgents) != 0 {
+		t.Errorf("StartAgent called for %v, want no restarts", mock.startAgents)
+	}
+	if len(mock.stopCalls) != 0 {
+		t.Errorf("StopAgent called for %v, want the container left for inspection", mock.stopCalls)
+	}
+	if got := d.state.Agents[1].Status; got != "exited" {
+		t.Errorf("agent-2 Status = %q, want exited", got)
+	}
+	if len(n.events) != 1 || n.events[0].Type != notify.EventAgentCrashed || n.events[0].AgentID != 2 {
+		t.Errorf("events = %+v, want one agent_crashed event for agent-2", n.events)
+	}
+
+	if got := d.agentOpts(1, "developer").RestartPolicy; got != "no" {
+		t.Errorf("RestartPolicy = %q, want \"no\" so Docker doesn't revive crashed containers", got)
+	}
+}
+
+func TestAgentOpts_AuthorIdentity(t *testing.T) {
+	cfg := &config.Config{Git: config.GitConfig{AuthorName: "Ada", AuthorEmail: "ada@example.com"}}
+	d := &Daemon{cfg: cfg}
+	if opts := d.agentOpts(1, "developer"); opts.GitAuthorName != "" || opts.GitAuthorEmail != "" {
+		t.Errorf("author = %q <%q>, want none without use_author_identity", opts.GitAuthorName, opts.GitAuthorEmail)
+	}
+
+	cfg.Git.UseAuthorIdentity = true
+	if opts := d.agentOpts(1, "developer"); opts.GitAuthorName != "Ada" || opts.GitAuthorEmail != "ada@example.com" {
+		t.Errorf("author = %q <%q>, want the configured identity", opts.GitAuthorName, opts.GitAuthorEmail)
+	}
+}
+
+func TestRestartCrashedAgents_AutoRestartOffUnhealthy(t *testing.T) {
+	mock := &mockDockerClient{startAgents: make(map[int]string)}
+	n := &recordingNotifier{}
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		docker:     mock,
+		notifier:   n,
+		cfg: &config.Config{
+			Project: config.ProjectConfig{Name: "test"},
+			Daemon:  config.DaemonConfig{AutoRestart: new(bool)},
+		},
+		state: &State{Agents: []AgentState{{ID: 1, Role: "developer", Status: "running"}}},
+	}
+
+	infos := []docker.AgentInfo{{ID: 1, Status: "Up 2 hours (unhealthy)"}}
+	d.updateAgentStates(infos)
+	d.restartCrashedAgents(context.Background(), infos, time.Now().UTC())
+
+	if len(n.events) != 1 {
+		t.Fatalf("events = %+v, want one agent_crashed event", n.events)
+	}
+	if msg := n.events[0].Message; !strings.Contains(msg, "became unhealthy and was left running") {
+		t.Errorf("message = %q, want it to say the container was left running", msg)
+	}
+}
+
+func TestRestartCrashedAgents_StatusDetection(t *testing.T) {
+	tests := []struct {
+		status      string
+		wantRestart bool
+	}{
+		{"Up 1 hour", false},
+		{"Up About a minute", false},
+		{"Up 5 minutes (Paused)", false},
+		{"Up 5 minutes (unhealthy)", true},
+		{"Exited (0) — backup in progress", true},
+		{"Exited (1) 2 minutes ago (cleanup pending)", true},
+		{"Restarting (1) 5 seconds ago", true},
+		{"Created", true},
+		{"Dead", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			mock := &mockDockerClient{
+				startAgents: make(map[int]string),
+			}
+
+			d := &Daemon{
+				projectDir: t.TempDir(),
+				docker:     mock,
+				cfg: &config.Config{
+					Project: config.ProjectConfig{Name: "test"},
+					Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+				},
+				state: &State{
+					Agents: []AgentState{
+						{ID: 1, Role: "developer", Status: "running"},
+					},
+				},
+			}
+
+			infos := []docker.AgentInfo{{ID: 1, Status: tt.status}}
+			d.restartCrashedAgents(context.Background(), infos, time.Now().UTC())
+
+			_, restarted := mock.startAgents[1]
+			if restarted != tt.wantRestart {
+				t.Errorf("status %q: restarted = %v, want %v", tt.status, restarted, tt.wantRestart)
+			}
+		})
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	tests := []struct {
+		crashes int
+		want    time.Duration
+	}{
+		{1, 0},
+		{2, 30 * time.Second},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{20, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := restartBackoff(tt.crashes)
+		if got != tt.want {
+			t.Errorf("restartBackoff(%d) = %v, want %v", tt.crashes, got, tt.want)
+		}
+	}
+}
+
 // --- countCommitsAndNotify Tests ---
 
 func TestCountCommitsAndNotify(t *testing.T) {
@@ -870,7 +1559,7 @@ func TestCountCommitsAndNotify(t *testing.T) {
 		state: &State{},
 	}
 
-	d.countCommitsAndNotify(time.Now().UTC())
+	d.countCommitsAndNotify(t.Context(), time.Now().UTC())
 
 	if d.state.Stats.TotalCommits != 1 {
 		t.Errorf("TotalCommits = %d, want 1", d.state.Stats.TotalCommits)
@@ -918,13 +1607,15 @@ func TestCheckAgentLogsDebounce(t *testing.T) {
 	_ = os.MkdirAll(logDir, 0755)
 	_ = os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte("ERROR: something\n"), 0644)
 
+	notified := time.Now().UTC().Add(-2 * time.Minute)
 	d := &Daemon{
 		projectDir: dir,
 		lastErrorNotified: map[int]time.Time{
-			1: time.Now().UTC(), // Already notified just now.
+			1: notified,
 		},
 		cfg: &config.Config{
-			Project: config.ProjectConfig{Name: "test"},
+			Project:       config.ProjectConfig{Name: "test"},
+			Notifications: config.NotificationsConfig{ErrorCooldown: 5 * time.Minute},
 		},
 		state: &State{
 			Agents: []AgentState{
@@ -933,17 +1624,158 @@ func TestCheckAgentLogsDebounce(t *testing.T) {
 		},
 	}
 
-	before := d.lastErrorNotified[1]
-	d.checkAgentLogs(time.Now().UTC())
+	now := time.Now().UTC()
+	d.checkAgentLogs(now)
 
 	// Should not have updated the notification time (debounced).
-	if !d.lastErrorNotified[1].Equal(before) {
+	if !d.lastErrorNotified[1].Equal(notified) {
 		t.Error("expected lastErrorNotified to remain unchanged (debounced)")
 	}
+
+	// A shorter cooldown has already elapsed, so the error is reported again.
+	d.cfg.Notifications.ErrorCooldown = time.Minute
+	d.checkAgentLogs(now)
+	if !d.lastErrorNotified[1].Equal(now) {
+		t.Errorf("lastErrorNotified = %v, want %v after a 1m cooldown", d.lastErrorNotified[1], now)
+	}
+
+	// Zero notifies on every tick.
+	d.cfg.Notifications.ErrorCooldown = 0
+	later := now.Add(time.Second)
+	d.checkAgentLogs(later)
+	if !d.lastErrorNotified[1].Equal(later) {
+		t.Error("expected a zero cooldown to notify again on the next tick")
+	}
+}
+
+func TestCheckAgentLogsScanLines(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "agent_logs", "agent-1")
+	_ = os.MkdirAll(logDir, 0755)
+
+	// The error is followed by more output than the default window covers.
+	log := "ERROR: test failed\n" + strings.Repeat("ok\n", 60)
+	_ = os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte(log), 0644)
+
+	d := &Daemon{
+		projectDir:        dir,
+		lastErrorNotified: make(map[int]time.Time),
+		cfg: &config.Config{
+			Project:       config.ProjectConfig{Name: "test"},
+			Notifications: config.NotificationsConfig{LogScanLines: config.DefaultLogScanLines},
+		},
+		state: &State{
+			Agents: []AgentState{
+				{ID: 1, Role: "developer"},
+			},
+		},
+	}
+
+	d.checkAgentLogs(time.Now().UTC())
+	if _, ok := d.lastErrorNotified[1]; ok {
+		t.Fatal("expected the default window to miss the error")
+	}
+
+	d.cfg.Notifications.LogScanLines = 100
+	d.checkAgentLogs(time.Now().UTC())
+	if _, ok := d.lastErrorNotified[1]; !ok {
+		t.Error("expected a 100-line window to catch the error")
+	}
+}
+
+func TestCheckAgentLogsPatterns(t *testing.T) {
+	tests := []struct {
+		name       string
+		log        string
+		errorPats  []string
+		ignorePats []string
+		wantNotify bool
+	}{
+		{
+			name:       "default patterns match ERROR:",
+			log:        "ERROR: build broke\n",
+			wantNotify: true,
+		},
+		{
+			name:       "custom pattern matches",
+			log:        "panic: runtime error\n",
+			errorPats:  []string{"^panic:"},
+			wantNotify: true,
+		},
+		{
+			name:       "custom patterns replace defaults",
+			log:        "ERROR: expected output in test fixture\n",
+			errorPats:  []string{"^panic:"},
+			wantNotify: false,
+		},
+		{
+			name:       "ignore pattern suppresses match",
+			log:        "--- FAIL_FAST is a known flag\n",
+			ignorePats: []string{"FAIL_FAST"},
+			wantNotify: false,
+		},
+		{
+			name:       "ignore pattern only suppresses matching lines",
+			log:        "FAIL_FAST noise\nFAIL: TestParser\n",
+			ignorePats: []string{"FAIL_FAST"},
+			wantNotify: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logDir := filepath.Join(dir, "agent_logs", "agent-1")
+			_ = os.MkdirAll(logDir, 0755)
+			_ = os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte(tt.log), 0644)
+
+			d := &Daemon{
+				projectDir:        dir,
+				lastErrorNotified: make(map[int]time.Time),
+				cfg: &config.Config{
+					Project: config.ProjectConfig{Name: "test"},
+					Notifications: config.NotificationsConfig{
+						ErrorPatterns:  tt.errorPats,
+						IgnorePatterns: tt.ignorePats,
+					},
+				},
+				state: &State{
+					Agents: []AgentState{
+						{ID: 1, Role: "developer"},
+					},
+				},
+			}
+
+			d.checkAgentLogs(time.Now().UTC())
+
+			_, notified := d.lastErrorNotified[1]
+			if notified != tt.wantNotify {
+				t.Errorf("notified = %v, want %v", notified, tt.wantNotify)
+			}
+		})
+	}
 }
 
 // --- flushCommitBatch Tests ---
 
+func TestCommitTypeCounts(t *testing.T) {
+	messages := []string{
+		"1a2b3c4 feat(parser): add array support",
+		"2b3c4d5 feat: add object support",
+		"3c4d5e6 fix!: handle empty input",
+		"4d5e6f7 Fix(lexer): trailing commas",
+		"5e6f7a8 docs: document the API",
+		"6f7a8b9 chore(deps): bump toolchain",
+		"7a8b9c0 Update README",
+		"8b9c0d1 wip: half-done refactor",
+		"9c0d1e2 feat:missing space",
+	}
+	want := map[string]int{"feat": 2, "fix": 2, "docs": 1, "chore": 1, "other": 3}
+	if got := commitTypeCounts(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("commitTypeCounts() = %v, want %v", got, want)
+	}
+}
+
 func TestFlushCommitBatch(t *testing.T) {
 	t.Run("no-op when no pending commits", func(t *testing.T) {
 		d := &Daemon{
@@ -962,7 +1794,7 @@ func TestFlushCommitBatch(t *testing.T) {
 			commitBatchStart: time.Now().UTC(),
 			cfg: &config.Config{
 				Project:       config.ProjectConfig{Name: "test"},
-				Notifications: config.NotificationsConfig{WebhookURL: ""},
+				Notifications: config.NotificationsConfig{WebhookURL: "", CommitBatchInterval: time.Minute},
 			},
 		}
 		d.flushCommitBatch(time.Now().UTC())
@@ -971,13 +1803,40 @@ func TestFlushCommitBatch(t *testing.T) {
 		}
 	})
 
+	t.Run("zero interval flushes immediately", func(t *testing.T) {
+		var received []notify.Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ev notify.Event
+			_ = json.NewDecoder(r.Body).Decode(&ev)
+			received = append(received, ev)
+		}))
+		defer srv.Close()
+
+		now := time.Now().UTC()
+		d := &Daemon{
+			pendingCommits:   []string{"commit1"},
+			commitBatchStart: now,
+			cfg: &config.Config{
+				Project:       config.ProjectConfig{Name: "test"},
+				Notifications: config.NotificationsConfig{WebhookURL: srv.URL, Format: "json"},
+			},
+		}
+		d.flushCommitBatch(now)
+		if d.pendingCommits != nil {
+			t.Error("expected pending commits to be flushed on the same tick")
+		}
+		if len(received) != 1 || received[0].Type != notify.EventCommitsPushed {
+			t.Errorf("expected one commits_pushed event, got %+v", received)
+		}
+	})
+
 	t.Run("flushes after window elapses", func(t *testing.T) {
 		d := &Daemon{
 			pendingCommits:   []string{"commit1", "commit2"},
 			commitBatchStart: time.Now().UTC().Add(-2 * time.Minute),
 			cfg: &config.Config{
 				Project:       config.ProjectConfig{Name: "test"},
-				Notifications: config.NotificationsConfig{WebhookURL: ""},
+				Notifications: config.NotificationsConfig{WebhookURL: "", CommitBatchInterval: time.Minute},
 			},
 		}
 		d.flushCommitBatch(time.Now().UTC())
@@ -999,6 +1858,127 @@ func TestSendEvent(t *testing.T) {
 		// Should not panic.
 		d.sendEvent(notify.Event{Type: notify.EventAgentCrashed})
 	})
+
+	t.Run("skips event types not in enabled_events", func(t *testing.T) {
+		var received []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ev notify.Event
+			_ = json.NewDecoder(r.Body).Decode(&ev)
+			received = append(received, ev.Type)
+		}))
+		defer srv.Close()
+
+		d := &Daemon{
+			cfg: &config.Config{
+				Notifications: config.NotificationsConfig{
+					WebhookURL:    srv.URL,
+					Format:        "json",
+					EnabledEvents: []string{notify.EventAgentCrashed},
+				},
+			},
+		}
+		d.sendEvent(notify.Event{Type: notify.EventCommitsPushed})
+		d.sendEvent(notify.Event{Type: notify.EventAgentCrashed})
+
+		if len(received) != 1 || received[0] != notify.EventAgentCrashed {
+			t.Errorf("received = %v, want only %s", received, notify.EventAgentCrashed)
+		}
+	})
+
+	t.Run("delivers through the configured notifier", func(t *testing.T) {
+		n := &recordingNotifier{}
+		d := &Daemon{
+			cfg: &config.Config{
+				Notifications: config.NotificationsConfig{EnabledEvents: []string{notify.EventAgentCrashed}},
+			},
+			notifier: n,
+		}
+		d.sendEvent(notify.Event{Type: notify.EventCommitsPushed})
+		d.sendEvent(notify.Event{Type: notify.EventAgentCrashed, AgentID: 2})
+
+		if len(n.events) != 1 || n.events[0].Type != notify.EventAgentCrashed || n.events[0].AgentID != 2 {
+			t.Errorf("notifier got %+v, want one agent_crashed event for agent 2", n.events)
+		}
+	})
+
+	t.Run("logs notifier errors", func(t *testing.T) {
+		n := &recordingNotifier{err: errors.New("transport down")}
+		d := &Daemon{cfg: &config.Config{}, notifier: n}
+
+		// Should not panic; the error is only logged.
+		d.sendEvent(notify.Event{Type: notify.EventAgentCrashed})
+		if len(n.events) != 1 {
+			t.Errorf("notifier got %d events, want 1", len(n.events))
+		}
+	})
+}
+
+func TestSendEvent_RecordsNotifyStatus(t *testing.T) {
+	n := &recordingNotifier{err: errors.New("webhook returned 404")}
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		cfg:        &config.Config{},
+		state:      &State{Status: "running"},
+		notifier:   n,
+	}
+
+	d.sendEvent(notify.Event{Type: notify.EventAgentCrashed})
+	if err := d.writeState(); err != nil {
+		t.Fatalf("writeState: %v", err)
+	}
+
+	state := readStateFile(filepath.Join(d.projectDir, constants.StateFile))
+	if state == nil || state.NotifyStatus == nil {
+		t.Fatalf("state = %+v, want a notify_status", state)
+	}
+	got := state.NotifyStatus
+	if got.Event != notify.EventAgentCrashed || got.Error != "webhook returned 404" || got.LastAttempt.IsZero() {
+		t.Errorf("notify status = %+v, want the failed agent_crashed send", got)
+	}
+
+	// A later successful send clears the error.
+	n.err = nil
+	d.sendEvent(notify.Event{Type: notify.EventCommitsPushed})
+	if err := d.writeState(); err != nil {
+		t.Fatalf("writeState: %v", err)
+	}
+	state = readStateFile(filepath.Join(d.projectDir, constants.StateFile))
+	if got := state.NotifyStatus; got == nil || got.Event != notify.EventCommitsPushed || got.Error != "" {
+		t.Errorf("notify status = %+v, want a successful commits_pushed send", got)
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	if n := NewNotifier(config.NotificationsConfig{}); n != nil {
+		t.Errorf("NewNotifier() = %#v, want nil without a webhook or email", n)
+	}
+
+	webhook := config.NotificationsConfig{WebhookURL: "https://example.com/hook"}
+	if _, ok := NewNotifier(webhook).(*notify.HTTPNotifier); !ok {
+		t.Errorf("NewNotifier(webhook) = %T, want *notify.HTTPNotifier", NewNotifier(webhook))
+	}
+
+	email := config.EmailConfig{SMTPHost: "smtp.example.com", From: "metamorph@example.com", To: []string{"dev@example.com"}}
+	if _, ok := NewNotifier(config.NotificationsConfig{Email: email}).(*notify.EmailNotifier); !ok {
+		t.Error("expected an email-only config to build a *notify.EmailNotifier")
+	}
+
+	both := webhook
+	both.Email = email
+	if m, ok := NewNotifier(both).(notify.MultiNotifier); !ok || len(m) != 2 {
+		t.Errorf("NewNotifier(webhook+email) = %#v, want a MultiNotifier of both", NewNotifier(both))
+	}
+}
+
+// recordingNotifier is a notify.Notifier that records the events it is sent.
+type recordingNotifier struct {
+	events []notify.Event
+	err    error
+}
+
+func (n *recordingNotifier) Send(event notify.Event) error {
+	n.events = append(n.events, event)
+	return n.err
 }
 
 // --- shutdown Tests ---
@@ -1010,6 +1990,7 @@ func TestShutdown(t *testing.T) {
 
 		d := &Daemon{
 			projectDir: dir,
+			cfg:        &config.Config{},
 			docker:     mock,
 			startedAt:  time.Now().Add(-time.Hour),
 			state: &State{
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// detachedProcAttr starts the daemon in its own session so it is not tied
+// to the terminal that ran 'metamorph start'.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// requestShutdown asks the daemon process to shut down gracefully.
+func requestShutdown(projectDir string, proc *os.Process) error {
+	return proc.Signal(syscall.SIGTERM)
+}
+
+// killProcess forcibly terminates a daemon that did not shut down in time.
+func killProcess(proc *os.Process) error {
+	return proc.Signal(syscall.SIGKILL)
+}
+
+// processGroupAttr starts a child process in its own process group, so
+// killProcessGroup can stop everything it spawned.
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills proc and every process in its group.
+func killProcessGroup(proc *os.Process) error {
+	return syscall.Kill(-proc.Pid, syscall.SIGKILL)
+}
+
+// processAlive checks if a process with the given PID exists.
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Unix, FindProcess always succeeds. Signal 0 checks existence.
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil
+}
+
+// shutdownRequests returns a channel that receives when the daemon should
+// shut down: on SIGTERM (sent by Stop) or SIGINT.
+func shutdownRequests(projectDir string) <-chan os.Signal {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	return sigCh
+}
@@ -0,0 +1,98 @@
+//go:build windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+const (
+	detachedProcess                = 0x00000008 // DETACHED_PROCESS: no console
+	processQueryLimitedInformation = 0x1000     // PROCESS_QUERY_LIMITED_INFORMATION
+	stillActive                    = 259        // STILL_ACTIVE exit code
+	stopPollInterval               = time.Second
+)
+
+// detachedProcAttr starts the daemon without a console and in its own
+// process group, the Windows equivalent of Setsid.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+		HideWindow:    true,
+	}
+}
+
+// requestShutdown asks the daemon to shut down gracefully. Windows has no
+// SIGTERM and a detached process has no console to send Ctrl-Break to, so
+// Stop writes a stop file that the daemon polls for.
+func requestShutdown(projectDir string, proc *os.Process) error {
+	return os.WriteFile(filepath.Join(projectDir, constants.StopFile), nil, 0644)
+}
+
+// killProcess forcibly terminates a daemon that did not shut down in time,
+// including any child processes.
+func killProcess(proc *os.Process) error {
+	if err := exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(proc.Pid)).Run(); err != nil {
+		return proc.Kill()
+	}
+	return nil
+}
+
+// processGroupAttr starts a child process in its own process group, so
+// killProcessGroup can stop everything it spawned.
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// killProcessGroup kills proc and its child processes.
+func killProcessGroup(proc *os.Process) error {
+	return killProcess(proc)
+}
+
+// processAlive checks if a process with the given PID exists and has not exited.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer func() { _ = syscall.CloseHandle(h) }()
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// shutdownRequests returns a channel that receives when the daemon should
+// shut down: when Stop writes the stop file, or on Ctrl-C when the daemon
+// runs attached to a console.
+func shutdownRequests(projectDir string) <-chan os.Signal {
+	stopPath := filepath.Join(projectDir, constants.StopFile)
+	_ = os.Remove(stopPath) // left over from a previous run
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		ticker := time.NewTicker(stopPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := os.Stat(stopPath); err == nil {
+				_ = os.Remove(stopPath)
+				sigCh <- syscall.SIGTERM
+				return
+			}
+		}
+	}()
+
+	return sigCh
+}
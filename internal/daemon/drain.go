@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+const drainPollInterval = 2 * time.Second
+
+// drainAgents asks every agent to finish its current session and push, then
+// waits until each has acknowledged (by writing constants.DrainedFile) or
+// stopped running, for at most daemon.drain_timeout. Agents still busy at
+// the deadline are force-stopped by the caller. A custom docker.command
+// doesn't watch for the drain file, so those agents are stopped at once.
+func (d *Daemon) drainAgents(ctx context.Context) {
+	timeout := d.cfg.Daemon.DrainTimeout
+	if timeout <= 0 || len(d.state.Agents) == 0 {
+		return
+	}
+	if len(d.cfg.Docker.Command) > 0 {
+		slog.Info("skipping drain: agents run a custom docker.command")
+		return
+	}
+
+	pending := make(map[int]bool)
+	for _, a := range d.state.Agents {
+		path := filepath.Join(d.agentLogDir(a.ID), constants.DrainFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			slog.Warn("failed to request agent drain", "agent", a.ID, "error", err)
+			continue
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			slog.Warn("failed to request agent drain", "agent", a.ID, "error", err)
+			continue
+		}
+		pending[a.ID] = true
+	}
+	defer d.clearDrainFiles()
+
+	deadline := time.Now().UTC().Add(timeout)
+	d.state.Status = "draining"
+	d.state.DrainDeadline = &deadline
+	_ = d.writeState()
+	slog.Info("draining agents", "agents", len(pending), "timeout", timeout)
+
+	for {
+		d.updateDrained(ctx, pending)
+		if len(pending) == 0 {
+			slog.Info("all agents drained")
+			return
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			ids := make([]int, 0, len(pending))
+			for id := range pending {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			slog.Warn("drain timed out, stopping agents", "agents", ids)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(wait, drainPollInterval)):
+		}
+	}
+}
+
+// updateDrained removes agents from pending once they have acknowledged the
+// drain or their container is no longer running.
+func (d *Daemon) updateDrained(ctx context.Context, pending map[int]bool) {
+	for id := range pending {
+		if _, err := os.Stat(filepath.Join(d.agentLogDir(id), constants.DrainedFile)); err == nil {
+			delete(pending, id)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	agents, err := d.docker.ListAgents(ctx)
+	if err != nil {
+		return
+	}
+	running := make(map[int]bool)
+	for _, a := range agents {
+		if status := agentStatus(a); status == "running" || status == "unhealthy" {
+			running[a.ID] = true
+		}
+	}
+	for id := range pending {
+		if !running[id] {
+			delete(pending, id)
+		}
+	}
+}
+
+// clearDrainFiles removes the drain control files so restarted agents don't
+// go idle straight away.
+func (d *Daemon) clearDrainFiles() {
+	for _, a := range d.state.Agents {
+		dir := d.agentLogDir(a.ID)
+		_ = os.Remove(filepath.Join(dir, constants.DrainFile))
+		_ = os.Remove(filepath.Join(dir, constants.DrainedFile))
+	}
+}
+
+// drainDeadline returns when the daemon's drain ends, or the zero time if it
+// isn't draining.
+func drainDeadline(projectDir string) time.Time {
+	data, err := os.ReadFile(filepath.Join(projectDir, constants.StateFile))
+	if err != nil {
+		return time.Time{}
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil || state.DrainDeadline == nil {
+		return time.Time{}
+	}
+	return *state.DrainDeadline
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+func TestShutdown_Drain(t *testing.T) {
+	newDaemon := func(t *testing.T, timeout time.Duration, mock *mockDockerClient) *Daemon {
+		t.Helper()
+		return &Daemon{
+			projectDir: t.TempDir(),
+			cfg:        &config.Config{Daemon: config.DaemonConfig{DrainTimeout: timeout}},
+			docker:     mock,
+			startedAt:  time.Now(),
+			state: &State{
+				Status: "running",
+				Agents: []AgentState{{ID: 1, Status: "running"}, {ID: 2, Status: "running"}},
+			},
+		}
+	}
+	running := []docker.AgentInfo{
+		{ID: 1, Status: "Up 5 minutes"},
+		{ID: 2, Status: "Up 5 minutes"},
+	}
+
+	t.Run("waits out the timeout before stopping busy agents", func(t *testing.T) {
+		mock := &mockDockerClient{listResult: running}
+		d := newDaemon(t, 300*time.Millisecond, mock)
+
+		start := time.Now()
+		if err := d.shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+
+		if !mock.stopAllCall {
+			t.Fatal("expected StopAllAgents to be called after the drain timeout")
+		}
+		if waited := mock.stopAllAt.Sub(start); waited < 300*time.Millisecond {
+			t.Errorf("StopAllAgents called after %v, want at least the 300ms drain timeout", waited)
+		}
+		for _, id := range []int{1, 2} {
+			if _, err := os.Stat(filepath.Join(d.agentLogDir(id), constants.DrainFile)); !os.IsNotExist(err) {
+				t.Errorf("agent-%d drain file should be removed after shutdown", id)
+			}
+		}
+		if d.state.DrainDeadline != nil {
+			t.Error("DrainDeadline should be cleared once stopped")
+		}
+	})
+
+	t.Run("stops as soon as every agent has drained", func(t *testing.T) {
+		mock := &mockDockerClient{
+			// Agent 2 already exited; agent 1 acknowledges the drain.
+			listResult: []docker.AgentInfo{{ID: 1, Status: "Up 5 minutes"}, {ID: 2, Status: "Exited (0) 1 minute ago"}},
+		}
+		d := newDaemon(t, time.Minute, mock)
+		dir := d.agentLogDir(1)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, constants.DrainedFile), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if err := d.shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		if waited := time.Since(start); waited > 10*time.Second {
+			t.Errorf("shutdown took %v, want it to end once agents drained", waited)
+		}
+		if !mock.stopAllCall {
+			t.Error("expected StopAllAgents to be called")
+		}
+		if _, err := os.Stat(filepath.Join(dir, constants.DrainedFile)); !os.IsNotExist(err) {
+			t.Error("drained file should be removed after shutdown")
+		}
+	})
+
+	t.Run("custom command stops at once", func(t *testing.T) {
+		mock := &mockDockerClient{listResult: running}
+		d := newDaemon(t, time.Minute, mock)
+		d.cfg.Docker.Command = []string{"bash", "scripts/agent-loop.sh"}
+
+		start := time.Now()
+		if err := d.shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		if waited := time.Since(start); waited > 10*time.Second {
+			t.Errorf("shutdown took %v, want no drain for a custom command", waited)
+		}
+		if !mock.stopAllCall {
+			t.Error("expected StopAllAgents to be called")
+		}
+		if _, err := os.Stat(filepath.Join(d.agentLogDir(1), constants.DrainFile)); !os.IsNotExist(err) {
+			t.Error("no drain should be requested for a custom command")
+		}
+	})
+
+	t.Run("zero timeout stops at once", func(t *testing.T) {
+		mock := &mockDockerClient{listResult: running}
+		d := newDaemon(t, 0, mock)
+
+		if err := d.shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		if !mock.stopAllCall {
+			t.Error("expected StopAllAgents to be called")
+		}
+		if _, err := os.Stat(filepath.Join(d.agentLogDir(1), constants.DrainFile)); !os.IsNotExist(err) {
+			t.Error("no drain should be requested with a zero timeout")
+		}
+	})
+}
+
+func TestDrainDeadline(t *testing.T) {
+	dir := t.TempDir()
+	if got := drainDeadline(dir); !got.IsZero() {
+		t.Errorf("drainDeadline without state = %v, want zero", got)
+	}
+
+	deadline := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+	if err := WriteState(dir, &State{Status: "draining", DrainDeadline: &deadline}); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainDeadline(dir); !got.Equal(deadline) {
+		t.Errorf("drainDeadline = %v, want %v", got, deadline)
+	}
+}
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+const (
+	// eventBufferSize is how many events a slow subscriber may fall behind
+	// before further events are dropped for it.
+	eventBufferSize = 64
+
+	// eventKeepalive is how often an idle event stream sends a comment so
+	// proxies don't time the connection out.
+	eventKeepalive = 30 * time.Second
+)
+
+// eventBroker fans out daemon events to any number of subscribers. The zero
+// value is ready to use.
+type eventBroker struct {
+	mu     sync.Mutex
+	subs   map[chan notify.Event]struct{}
+	closed bool
+}
+
+// subscribe registers a new subscriber. The returned channel is closed when
+// unsubscribe is called or the broker is closed.
+func (b *eventBroker) subscribe() (ch <-chan notify.Event, unsubscribe func()) {
+	c := make(chan notify.Event, eventBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return c, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[chan notify.Event]struct{})
+	}
+	b.subs[c] = struct{}{}
+
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// publish delivers event to every subscriber without blocking; subscribers
+// whose buffer is full miss the event.
+func (b *eventBroker) publish(event notify.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.subs {
+		select {
+		case c <- event:
+		default:
+		}
+	}
+}
+
+// close ends every subscription and rejects new ones.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.subs {
+		close(c)
+	}
+	b.subs = nil
+	b.closed = true
+}
+
+// subscribers returns the number of active subscriptions.
+func (b *eventBroker) subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// handleEvents streams daemon events as Server-Sent Events until the client
+// disconnects. Each event is sent with its type as the SSE event name and
+// the notify.Event JSON as data.
+func (d *Daemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := d.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			_, _ = fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
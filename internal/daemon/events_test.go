@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// waitForSubscribers polls until the broker has n subscribers.
+func waitForSubscribers(t *testing.T, b *eventBroker, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers = %d, want %d", b.subscribers(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	d := &Daemon{cfg: &config.Config{Project: config.ProjectConfig{Name: "proj"}}}
+	srv := httptest.NewServer(d.httpHandler())
+	defer srv.Close()
+
+	// Two dashboards subscribe at once.
+	var readers []*bufio.Reader
+	for range 2 {
+		resp, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			t.Fatalf("GET /events: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+		readers = append(readers, bufio.NewReader(resp.Body))
+	}
+	waitForSubscribers(t, &d.events, 2)
+
+	// No webhook is configured; events still reach the stream.
+	d.sendEvent(notify.Event{Type: notify.EventAgentCrashed, AgentID: 2, Project: "proj", Message: "agent-2 crashed"})
+
+	for i, r := range readers {
+		eventLine, _ := r.ReadString('\n')
+		dataLine, _ := r.ReadString('\n')
+		if eventLine != "event: agent_crashed\n" {
+			t.Errorf("subscriber %d: event line = %q", i, eventLine)
+		}
+		var ev notify.Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(dataLine), "data: ")), &ev); err != nil {
+			t.Fatalf("subscriber %d: bad data line %q: %v", i, dataLine, err)
+		}
+		if ev.AgentID != 2 || ev.Message != "agent-2 crashed" {
+			t.Errorf("subscriber %d: event = %+v", i, ev)
+		}
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	t.Run("unsubscribe removes the subscriber", func(t *testing.T) {
+		var b eventBroker
+		ch, unsubscribe := b.subscribe()
+		unsubscribe()
+		unsubscribe() // safe to call twice
+
+		if b.subscribers() != 0 {
+			t.Errorf("subscribers = %d, want 0", b.subscribers())
+		}
+		if _, ok := <-ch; ok {
+			t.Error("channel should be closed after unsubscribe")
+		}
+		b.publish(notify.Event{Type: notify.EventStaleLock}) // must not panic
+	})
+
+	t.Run("slow subscribers drop events instead of blocking", func(t *testing.T) {
+		var b eventBroker
+		_, unsubscribe := b.subscribe()
+		defer unsubscribe()
+
+		done := make(chan struct{})
+		go func() {
+			for range eventBufferSize + 10 {
+				b.publish(notify.Event{Type: notify.EventCommitsPushed})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("publish blocked on a full subscriber")
+		}
+	})
+
+	t.Run("close ends streams", func(t *testing.T) {
+		var b eventBroker
+		ch, unsubscribe := b.subscribe()
+		b.close()
+		unsubscribe()
+
+		if _, ok := <-ch; ok {
+			t.Error("channel should be closed")
+		}
+		ch2, _ := b.subscribe()
+		if _, ok := <-ch2; ok {
+			t.Error("subscribing after close should return a closed channel")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+// maybeGC starts a `git gc --auto` of the upstream repo once
+// daemon.gc_interval has elapsed since the last one. The gc runs in its own
+// goroutine so a slow repack never delays agent supervision, and a new one
+// is not started while the previous is still running. It runs under the
+// daemon's shutdown context rather than the monitor iteration's, which is
+// cancelled as soon as the iteration returns.
+func (d *Daemon) maybeGC(now time.Time) {
+	interval := d.cfg.Daemon.GCInterval
+	if interval <= 0 || d.gc == nil || now.Sub(d.lastGC) < interval {
+		return
+	}
+	if !d.gcRunning.CompareAndSwap(false, true) {
+		return
+	}
+	d.lastGC = now
+
+	ctx := d.shutdownCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	upstreamPath := filepath.Join(d.projectDir, constants.UpstreamDir)
+	go func() {
+		defer d.gcRunning.Store(false)
+		start := time.Now()
+		if err := d.gc(ctx, upstreamPath); err != nil {
+			slog.Warn("upstream gc failed", "error", err)
+			return
+		}
+		slog.Info("upstream gc finished", "duration", time.Since(start).Round(time.Millisecond))
+	}()
+}
@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+func TestMaybeGC(t *testing.T) {
+	newDaemon := func(interval time.Duration, calls chan string) *Daemon {
+		return &Daemon{
+			projectDir: "/project",
+			cfg:        &config.Config{Daemon: config.DaemonConfig{GCInterval: interval}},
+			lastGC:     time.Now().UTC(),
+			gc: func(ctx context.Context, path string) error {
+				calls <- path
+				return nil
+			},
+		}
+	}
+
+	t.Run("runs once the interval has elapsed", func(t *testing.T) {
+		calls := make(chan string, 1)
+		d := newDaemon(time.Hour, calls)
+
+		d.maybeGC(d.lastGC.Add(30 * time.Minute))
+		select {
+		case <-calls:
+			t.Fatal("gc ran before the interval elapsed")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		now := d.lastGC.Add(time.Hour)
+		d.maybeGC(now)
+		select {
+		case path := <-calls:
+			if want := filepath.Join("/project", constants.UpstreamDir); path != want {
+				t.Errorf("gc path = %q, want %q", path, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("gc was not invoked after the interval elapsed")
+		}
+		if !d.lastGC.Equal(now) {
+			t.Errorf("lastGC = %v, want %v", d.lastGC, now)
+		}
+	})
+
+	t.Run("disabled when interval is zero", func(t *testing.T) {
+		calls := make(chan string, 1)
+		d := newDaemon(0, calls)
+
+		d.maybeGC(d.lastGC.Add(24 * time.Hour))
+		select {
+		case <-calls:
+			t.Fatal("gc ran with gc_interval = 0")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("skips while a gc is still running", func(t *testing.T) {
+		calls := make(chan string, 1)
+		d := newDaemon(time.Hour, calls)
+		d.gcRunning.Store(true)
+
+		d.maybeGC(d.lastGC.Add(2 * time.Hour))
+		select {
+		case <-calls:
+			t.Fatal("gc started while another was running")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	t.Run("outlives the monitor iteration that started it", func(t *testing.T) {
+		release := make(chan struct{})
+		finished := make(chan error, 1)
+		d := &Daemon{
+			projectDir:  "/project",
+			cfg:         &config.Config{Daemon: config.DaemonConfig{GCInterval: time.Hour}},
+			shutdownCtx: t.Context(),
+			gc: func(ctx context.Context, path string) error {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+				finished <- ctx.Err()
+				return ctx.Err()
+			},
+		}
+		d.monitorStep = func(ctx context.Context) { d.maybeGC(time.Now().UTC()) }
+
+		// The iteration's context is cancelled as soon as it returns.
+		d.runMonitor(t.Context())
+		d.waitForMonitor(5 * time.Second)
+		close(release)
+
+		select {
+		case err := <-finished:
+			if err != nil {
+				t.Errorf("gc context = %v after the iteration returned, want it still live", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("gc did not finish")
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+// Task history events.
+const (
+	TaskCompleted = "completed" // the owning agent released the lock
+	TaskCleared   = "cleared"   // the lock went stale and the daemon removed it
+)
+
+// TaskHistoryEntry is one line of the task history file.
+type TaskHistoryEntry struct {
+	Task      string    `json:"task"`
+	AgentID   int       `json:"agent_id,omitempty"`
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// appendTaskHistory appends entries to the task history file, creating it
+// if needed. Each entry is written as a single line in one append and
+// synced, so a crash can at worst leave a truncated final line, which
+// ReadTaskHistory skips. The next append starts on a fresh line so it isn't
+// joined onto the truncated one.
+func appendTaskHistory(projectDir string, entries ...TaskHistoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("daemon: failed to marshal task history: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	path := filepath.Join(projectDir, constants.TaskHistoryFile)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("daemon: failed to open task history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("daemon: failed to stat task history: %w", err)
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+			return fmt.Errorf("daemon: failed to read task history: %w", err)
+		}
+		if last[0] != '\n' {
+			buf = append([]byte{'\n'}, buf...)
+		}
+	}
+
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("daemon: failed to write task history: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("daemon: failed to sync task history: %w", err)
+	}
+	return nil
+}
+
+// ReadTaskHistory returns the last limit entries of the task history, oldest
+// first (all entries if limit <= 0). Malformed lines are skipped. A missing
+// history file yields no entries.
+func ReadTaskHistory(projectDir string, limit int) ([]TaskHistoryEntry, error) {
+	f, err := os.Open(filepath.Join(projectDir, constants.TaskHistoryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("daemon: failed to open task history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []TaskHistoryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e TaskHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("daemon: failed to read task history: %w", err)
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
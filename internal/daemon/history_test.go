@@ -0,0 +1,228 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/gitops"
+	"github.com/robmorgan/metamorph/internal/notify"
+	"github.com/robmorgan/metamorph/internal/tasks"
+)
+
+func TestTaskHistory(t *testing.T) {
+	t.Run("missing file yields no entries", func(t *testing.T) {
+		entries, err := ReadTaskHistory(t.TempDir(), 0)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("ReadTaskHistory = %v, %v; want empty", entries, err)
+		}
+	})
+
+	t.Run("appends and reads back the most recent entries", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.MkdirAll(filepath.Join(dir, ".metamorph"), 0755)
+		now := time.Date(2025, 6, 15, 10, 30, 0, 0, time.UTC)
+
+		if err := appendTaskHistory(dir,
+			TaskHistoryEntry{Task: "a", AgentID: 1, Event: TaskCompleted, Timestamp: now},
+			TaskHistoryEntry{Task: "b", AgentID: 2, Event: TaskCleared, Timestamp: now},
+		); err != nil {
+			t.Fatalf("appendTaskHistory: %v", err)
+		}
+		if err := appendTaskHistory(dir, TaskHistoryEntry{Task: "c", AgentID: 1, Event: TaskCompleted, Timestamp: now}); err != nil {
+			t.Fatalf("appendTaskHistory: %v", err)
+		}
+
+		// Simulate a crash mid-write leaving a truncated final line.
+		f, _ := os.OpenFile(filepath.Join(dir, constants.TaskHistoryFile), os.O_APPEND|os.O_WRONLY, 0644)
+		_, _ = f.WriteString(`{"task":"d","ev`)
+		_ = f.Close()
+
+		entries, err := ReadTaskHistory(dir, 2)
+		if err != nil {
+			t.Fatalf("ReadTaskHistory: %v", err)
+		}
+		if len(entries) != 2 || entries[0].Task != "b" || entries[1].Task != "c" {
+			t.Fatalf("entries = %+v, want b, c", entries)
+		}
+		if entries[0].Event != TaskCleared || entries[0].AgentID != 2 || !entries[0].Timestamp.Equal(now) {
+			t.Errorf("entries[0] = %+v", entries[0])
+		}
+
+		// The next append starts a new line rather than joining the
+		// truncated one.
+		if err := appendTaskHistory(dir, TaskHistoryEntry{Task: "e", AgentID: 3, Event: TaskCompleted, Timestamp: now}); err != nil {
+			t.Fatalf("appendTaskHistory: %v", err)
+		}
+		entries, err = ReadTaskHistory(dir, 0)
+		if err != nil {
+			t.Fatalf("ReadTaskHistory: %v", err)
+		}
+		if len(entries) != 4 || entries[3].Task != "e" || entries[3].AgentID != 3 {
+			t.Errorf("entries = %+v, want a, b, c, e", entries)
+		}
+	})
+}
+
+// taskUpstream creates a project with an upstream and returns its directory
+// and an agent clone to claim and release tasks in. claimStale commits a lock
+// claimed long ago, as tasks.ClaimTask always stamps the current time.
+func taskUpstream(t *testing.T) (dir, agentRepo string, claimStale func(name string, agentID int)) {
+	t.Helper()
+	runGit := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	dir = t.TempDir()
+	runGit(dir, "init")
+	runGit(dir, "config", "user.name", "test")
+	runGit(dir, "config", "user.email", "test@test")
+	_ = os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\n"), 0644)
+	runGit(dir, "add", ".")
+	runGit(dir, "commit", "-m", "initial commit")
+	if err := gitops.InitUpstream(t.Context(), dir, "", constants.TaskLockDir); err != nil {
+		t.Fatalf("InitUpstream: %v", err)
+	}
+
+	agentRepo = filepath.Join(t.TempDir(), "agent")
+	if err := gitops.CloneForAgent(t.Context(), filepath.Join(dir, constants.UpstreamDir), 1, agentRepo, gitops.CloneOpts{}); err != nil {
+		t.Fatalf("CloneForAgent: %v", err)
+	}
+
+	claimStale = func(name string, agentID int) {
+		t.Helper()
+		lock := filepath.Join(constants.TaskLockDir, name+".lock")
+		_ = os.WriteFile(filepath.Join(agentRepo, lock), []byte(fmt.Sprintf("agent-%d 2020-01-01T00:00:00Z", agentID)), 0644)
+		runGit(agentRepo, "add", lock)
+		runGit(agentRepo, "commit", "-m", "claim "+name)
+		runGit(agentRepo, "push", "origin", "HEAD")
+	}
+	return dir, agentRepo, claimStale
+}
+
+func TestUpdateTasksRecordsHistory(t *testing.T) {
+	dir, repo, claimStale := taskUpstream(t)
+	if claimed, err := tasks.ClaimTask(repo, constants.TaskLockDir, "done", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+		t.Fatalf("ClaimTask: claimed=%v, err=%v", claimed, err)
+	}
+	claimStale("stale", 2)
+
+	d := &Daemon{
+		projectDir: dir,
+		cfg:        &config.Config{Project: config.ProjectConfig{Name: "test"}},
+		state:      &State{Agents: []AgentState{{ID: 1}, {ID: 2}}},
+		metrics:    newMetrics(),
+	}
+
+	now := time.Now().UTC()
+	d.updateTasks(now)
+	if a := d.state.Agents[0]; a.CurrentTask == nil || *a.CurrentTask != "done" {
+		t.Fatalf("agent-1 task = %v, want done from the committed lock", a.CurrentTask)
+	}
+	d.clearStaleTasksAndNotify(t.Context(), now)
+
+	// Agent 1 releases its lock.
+	pullRebase(t, repo)
+	if err := tasks.ReleaseTask(repo, constants.TaskLockDir, "done", 1); err != nil {
+		t.Fatalf("ReleaseTask: %v", err)
+	}
+	d.updateTasks(now)
+	d.updateTasks(now)
+
+	entries, err := ReadTaskHistory(dir, 0)
+	if err != nil {
+		t.Fatalf("ReadTaskHistory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", entries)
+	}
+	if entries[0].Task != "stale" || entries[0].Event != TaskCleared || entries[0].AgentID != 2 {
+		t.Errorf("entries[0] = %+v, want stale cleared by agent-2", entries[0])
+	}
+	if entries[1].Task != "done" || entries[1].Event != TaskCompleted || entries[1].AgentID != 1 {
+		t.Errorf("entries[1] = %+v, want done completed by agent-1", entries[1])
+	}
+
+	// Stats and metrics count the same tasks as the history.
+	if got := d.state.Stats.TasksCompleted; got != 2 {
+		t.Errorf("Stats.TasksCompleted = %d, want 2", got)
+	}
+	if body := scrapeMetrics(t, d); !strings.Contains(body, "metamorph_tasks_completed_total 2") {
+		t.Errorf("metrics missing metamorph_tasks_completed_total 2:\n%s", body)
+	}
+
+	// The stale lock was removed from the upstream, not just forgotten.
+	locks, err := tasks.ListCommittedTasks(filepath.Join(dir, constants.UpstreamDir), constants.TaskLockDir)
+	if err != nil || len(locks) != 0 {
+		t.Errorf("committed locks = %+v, %v; want none", locks, err)
+	}
+}
+
+func TestUpdateTasksNotifiesCompletion(t *testing.T) {
+	dir, repo, claimStale := taskUpstream(t)
+	for _, name := range []string{"done", "busy"} {
+		if claimed, err := tasks.ClaimTask(repo, constants.TaskLockDir, name, 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("ClaimTask(%s): claimed=%v, err=%v", name, claimed, err)
+		}
+	}
+	claimStale("stale", 3)
+
+	notifier := &recordingNotifier{}
+	d := &Daemon{
+		projectDir: dir,
+		cfg: &config.Config{
+			Project: config.ProjectConfig{Name: "test"},
+			Agents:  config.AgentsConfig{Roles: []string{"developer", "tester"}},
+		},
+		state:    &State{Agents: []AgentState{{ID: 1}, {ID: 2}, {ID: 3}}},
+		notifier: notifier,
+	}
+
+	now := time.Now().UTC()
+	d.updateTasks(now)
+	d.clearStaleTasksAndNotify(t.Context(), now)
+	if len(notifier.events) != 1 || notifier.events[0].Type != notify.EventStaleLock {
+		t.Fatalf("events after first tick = %+v, want only stale_lock", notifier.events)
+	}
+
+	// Agent 1 releases one task and keeps working on the other.
+	pullRebase(t, repo)
+	if err := tasks.ReleaseTask(repo, constants.TaskLockDir, "done", 1); err != nil {
+		t.Fatalf("ReleaseTask: %v", err)
+	}
+	d.updateTasks(now)
+	d.updateTasks(now)
+
+	if len(notifier.events) != 2 {
+		t.Fatalf("events = %+v, want stale_lock then task_completed", notifier.events)
+	}
+	event := notifier.events[1]
+	if event.Type != notify.EventTaskCompleted {
+		t.Fatalf("event type = %q, want %q", event.Type, notify.EventTaskCompleted)
+	}
+	if event.AgentID != 1 || event.AgentRole != "developer" || event.Details["task"] != "done" {
+		t.Errorf("event = %+v, want done completed by agent-1 (developer)", event)
+	}
+}
+
+// pullRebase brings an agent clone up to date with the upstream, as agents
+// do between sessions.
+func pullRebase(t *testing.T, repo string) {
+	t.Helper()
+	cmd := exec.Command("git", "pull", "--rebase", "origin", "HEAD")
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git pull --rebase: %v\n%s", err, out)
+	}
+}
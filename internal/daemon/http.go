@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	httpReadHeaderTimeout = 5 * time.Second
+	httpShutdownTimeout   = 5 * time.Second
+)
+
+// startHTTPServer binds addr and serves the status API in the background.
+// An address without a host (e.g. ":8080") binds to localhost only.
+func (d *Daemon) startHTTPServer(addr string) error {
+	ln, err := net.Listen("tcp", listenAddr(addr))
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           d.httpHandler(),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	// Shutdown waits for connections to go idle, which an open /events
+	// stream never does, so end event streams explicitly.
+	srv.RegisterOnShutdown(d.events.close)
+	d.httpServer = srv
+
+	slog.Info("serving HTTP status API", "addr", ln.Addr().String())
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server failed", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// stopHTTPServer gracefully shuts down the HTTP server if it is running.
+func (d *Daemon) stopHTTPServer() {
+	if d.httpServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := d.httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server shutdown failed", "error", err)
+	}
+	d.httpServer = nil
+}
+
+// httpHandler returns the router for the status API.
+func (d *Daemon) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", d.handleStatus)
+	mux.HandleFunc("GET /healthz", d.handleHealthz)
+	mux.HandleFunc("GET /agents/{id}/logs", d.handleAgentLogs)
+	mux.HandleFunc("GET /events", d.handleEvents)
+	if d.metrics != nil {
+		mux.Handle("GET /metrics", d.metrics.handler())
+	}
+	return mux
+}
+
+// handleStatus returns the latest published State as JSON.
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	state := d.published
+	d.mu.RUnlock()
+
+	if state == nil {
+		http.Error(w, "state not available yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// handleHealthz reports that the daemon is up and serving requests.
+func (d *Daemon) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleAgentLogs returns the tail of an agent's latest session log as plain
+// text. The number of lines defaults to logTailLines and can be set with ?tail=N.
+func (d *Daemon) handleAgentLogs(w http.ResponseWriter, r *http.Request) {
+	agentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid agent ID %q", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+
+	tail := logTailLines
+	if v := r.URL.Query().Get("tail"); v != "" {
+		tail, err = strconv.Atoi(v)
+		if err != nil || tail <= 0 {
+			http.Error(w, fmt.Sprintf("invalid tail %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	logPath := latestSessionLog(d.agentLogDir(agentID))
+	if logPath == "" {
+		http.Error(w, fmt.Sprintf("no logs found for agent-%d", agentID), http.StatusNotFound)
+		return
+	}
+
+	lines, err := tailLines(logPath, tail)
+	if err != nil {
+		http.Error(w, "failed to read log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(strings.Join(lines, "\n")))
+}
+
+// publishState stores a copy of the current state for the HTTP handlers,
+// so they never read d.state while the monitor loop is mutating it.
+func (d *Daemon) publishState() {
+	if d.state == nil {
+		return
+	}
+	snapshot := *d.state
+	snapshot.Agents = append([]AgentState(nil), d.state.Agents...)
+
+	d.mu.Lock()
+	d.published = &snapshot
+	d.mu.Unlock()
+}
+
+// writeJSON writes v as an indented JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// listenAddr defaults a host-less address like ":8080" to localhost so the
+// API is not exposed on all interfaces unless explicitly requested.
+func listenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+)
+
+func TestHandleStatus(t *testing.T) {
+	t.Run("returns published state as JSON", func(t *testing.T) {
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			state: &State{
+				Status:      "running",
+				ProjectName: "proj",
+				Agents: []AgentState{
+					{ID: 1, Role: "developer", Status: "running"},
+				},
+			},
+		}
+		d.publishState()
+
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+
+		var got State
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if got.ProjectName != "proj" || len(got.Agents) != 1 {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("snapshot is isolated from later mutations", func(t *testing.T) {
+		d := &Daemon{
+			state: &State{
+				Status: "running",
+				Agents: []AgentState{{ID: 1, Status: "running"}},
+			},
+		}
+		d.publishState()
+		d.state.Agents[0].Status = "exited"
+
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		var got State
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		if got.Agents[0].Status != "running" {
+			t.Errorf("Agent Status = %q, want running (from snapshot)", got.Agents[0].Status)
+		}
+	})
+
+	t.Run("returns 503 before state is published", func(t *testing.T) {
+		d := &Daemon{}
+
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", rec.Code)
+		}
+	})
+
+	t.Run("rejects non-GET methods", func(t *testing.T) {
+		d := &Daemon{}
+
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", rec.Code)
+		}
+	})
+}
+
+func TestHandleHealthz(t *testing.T) {
+	d := &Daemon{}
+
+	rec := httptest.NewRecorder()
+	d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestHandleAgentLogs(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "agent_logs", "agent-1")
+	_ = os.MkdirAll(logDir, 0755)
+	_ = os.WriteFile(filepath.Join(logDir, "session-1.log"), []byte("old session\n"), 0644)
+	_ = os.WriteFile(filepath.Join(logDir, "session-2.log"), []byte("line1\nline2\nline3"), 0644)
+
+	d := &Daemon{projectDir: dir}
+
+	t.Run("returns latest session log", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents/1/logs", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if rec.Body.String() != "line1\nline2\nline3" {
+			t.Errorf("body = %q", rec.Body.String())
+		}
+	})
+
+	t.Run("honours tail parameter", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents/1/logs?tail=1", nil))
+
+		if rec.Body.String() != "line3" {
+			t.Errorf("body = %q, want line3", rec.Body.String())
+		}
+	})
+
+	t.Run("returns 404 for unknown agent", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents/9/logs", nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+
+	t.Run("returns 400 for invalid agent ID", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents/abc/logs", nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8080", "127.0.0.1:8080"},
+		{"127.0.0.1:9000", "127.0.0.1:9000"},
+		{"0.0.0.0:8080", "0.0.0.0:8080"},
+		{"localhost:8080", "localhost:8080"},
+	}
+
+	for _, tt := range tests {
+		if got := listenAddr(tt.addr); got != tt.want {
+			t.Errorf("listenAddr(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPServerLifecycle(t *testing.T) {
+	d := &Daemon{
+		projectDir: t.TempDir(),
+		docker:     &mockDockerClient{},
+		startedAt:  time.Now(),
+		cfg:        &config.Config{},
+		state:      &State{Status: "running"},
+	}
+	d.publishState()
+
+	if err := d.startHTTPServer("127.0.0.1:0"); err != nil {
+		t.Fatalf("startHTTPServer: %v", err)
+	}
+	if d.httpServer == nil {
+		t.Fatal("expected httpServer to be set")
+	}
+
+	if err := d.shutdown(t.Context()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if d.httpServer != nil {
+		t.Error("expected httpServer to be cleared after shutdown")
+	}
+}
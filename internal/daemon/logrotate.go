@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotatedSuffix is appended to a session log when it is rotated for size.
+// It keeps the file out of the session-N.log pattern so readers ignore it.
+const rotatedSuffix = ".1"
+
+// rotateAgentLogs enforces agents.max_log_files and agents.max_log_size_mb
+// for every agent: the oldest session logs beyond the limit are deleted, and
+// a session log larger than the size limit is rotated.
+func (d *Daemon) rotateAgentLogs() {
+	maxFiles := d.cfg.Agents.MaxLogFiles
+	maxBytes := int64(d.cfg.Agents.MaxLogSizeMB) * 1024 * 1024
+	if maxFiles <= 0 && maxBytes <= 0 {
+		return
+	}
+
+	for _, a := range d.state.Agents {
+		logDir := d.agentLogDir(a.ID)
+		if maxFiles > 0 {
+			if err := pruneSessionLogs(logDir, maxFiles); err != nil {
+				slog.Warn("failed to prune session logs", "agent", a.ID, "error", err)
+			}
+		}
+		if maxBytes > 0 {
+			if path := latestSessionLog(logDir); path != "" {
+				if err := rotateIfLarger(path, maxBytes); err != nil {
+					slog.Warn("failed to rotate session log", "agent", a.ID, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// sessionLogs returns the session-N.log files in logDir ordered from oldest
+// to newest by session number.
+func sessionLogs(logDir string) ([]string, error) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	nums := make(map[string]int)
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "session-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "session-"), ".log"))
+		if err != nil {
+			continue
+		}
+		nums[name] = num
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool { return nums[names[i]] < nums[names[j]] })
+	for i, name := range names {
+		names[i] = filepath.Join(logDir, name)
+	}
+	return names, nil
+}
+
+// pruneSessionLogs deletes the oldest session logs (and their rotated
+// copies) so that at most keep remain.
+func pruneSessionLogs(logDir string, keep int) error {
+	logs, err := sessionLogs(logDir)
+	if err != nil {
+		return err
+	}
+	if len(logs) <= keep {
+		return nil
+	}
+
+	for _, path := range logs[:len(logs)-keep] {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		_ = os.Remove(path + rotatedSuffix)
+	}
+	return nil
+}
+
+// rotateCopyPasses bounds how many times rotateIfLarger re-copies a log that
+// is still growing before truncating it.
+const rotateCopyPasses = 5
+
+// rotateIfLarger copies the log at path to path+".1" and truncates it once it
+// exceeds maxBytes. The agent's tee keeps the file open in append mode for
+// the whole session, so a rename would leave it writing to the rotated copy;
+// the file is truncated in place instead. Lines appended during the copy are
+// picked up by copying again until the file stops growing, which leaves only
+// a write landing between the last copy and the truncate to be lost.
+func rotateIfLarger(path string, maxBytes int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() <= maxBytes {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.Create(path + rotatedSuffix)
+	if err != nil {
+		return err
+	}
+	for pass := 0; pass < rotateCopyPasses; pass++ {
+		n, err := io.Copy(dst, src)
+		if err != nil {
+			_ = dst.Close()
+			return fmt.Errorf("failed to copy log: %w", err)
+		}
+		if n == 0 && pass > 0 {
+			break
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Truncate(path, 0)
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robmorgan/metamorph/internal/config"
+)
+
+func TestPruneSessionLogs(t *testing.T) {
+	dir := t.TempDir()
+	for i := 1; i <= 12; i++ {
+		_ = os.WriteFile(filepath.Join(dir, fmt.Sprintf("session-%d.log", i)), []byte("log\n"), 0644)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "session-2.log"+rotatedSuffix), []byte("old\n"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep me\n"), 0644)
+
+	if err := pruneSessionLogs(dir, 3); err != nil {
+		t.Fatalf("pruneSessionLogs: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := "notes.txt session-10.log session-11.log session-12.log"
+	if strings.Join(got, " ") != want {
+		t.Errorf("remaining files = %v, want %s", got, want)
+	}
+}
+
+func TestRotateIfLarger(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session-1.log")
+	content := strings.Repeat("x", 100)
+	_ = os.WriteFile(path, []byte(content), 0644)
+
+	t.Run("leaves small files alone", func(t *testing.T) {
+		if err := rotateIfLarger(path, 200); err != nil {
+			t.Fatalf("rotateIfLarger: %v", err)
+		}
+		if _, err := os.Stat(path + rotatedSuffix); !os.IsNotExist(err) {
+			t.Error("expected no rotated file")
+		}
+	})
+
+	t.Run("rotates files over the limit", func(t *testing.T) {
+		if err := rotateIfLarger(path, 50); err != nil {
+			t.Fatalf("rotateIfLarger: %v", err)
+		}
+		rotated, err := os.ReadFile(path + rotatedSuffix)
+		if err != nil || string(rotated) != content {
+			t.Errorf("rotated content = %q, err = %v", rotated, err)
+		}
+		info, _ := os.Stat(path)
+		if info.Size() != 0 {
+			t.Errorf("log size after rotation = %d, want 0", info.Size())
+		}
+	})
+}
+
+func TestRotateAgentLogs(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{
+		projectDir: dir,
+		cfg: &config.Config{
+			Agents: config.AgentsConfig{MaxLogFiles: 2},
+		},
+		state: &State{Agents: []AgentState{{ID: 1}, {ID: 2}}},
+	}
+
+	for _, id := range []int{1, 2} {
+		logDir := d.agentLogDir(id)
+		_ = os.MkdirAll(logDir, 0755)
+		for i := 1; i <= 5; i++ {
+			_ = os.WriteFile(filepath.Join(logDir, fmt.Sprintf("session-%d.log", i)), []byte("log\n"), 0644)
+		}
+	}
+
+	d.rotateAgentLogs()
+
+	for _, id := range []int{1, 2} {
+		logs, _ := sessionLogs(d.agentLogDir(id))
+		if len(logs) != 2 || filepath.Base(logs[0]) != "session-4.log" {
+			t.Errorf("agent-%d logs = %v, want session-4.log and session-5.log", id, logs)
+		}
+	}
+}
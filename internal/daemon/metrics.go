@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors exported on /metrics. All methods
+// are no-ops on a nil receiver so monitor hooks work when metrics are unset.
+type metrics struct {
+	registry       *prometheus.Registry
+	commitsTotal   prometheus.Counter
+	agentRestarts  *prometheus.CounterVec
+	tasksCompleted prometheus.Counter
+	agentsRunning  prometheus.Gauge
+	uptimeSeconds  prometheus.Gauge
+}
+
+// newMetrics creates the daemon's collectors and registers them on a
+// dedicated registry.
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		commitsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "metamorph_commits_total",
+			Help: "Number of new commits pushed to the upstream repo since the daemon started.",
+		}),
+		agentRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metamorph_agent_restarts_total",
+			Help: "Number of times an agent container was restarted after crashing.",
+		}, []string{"agent", "role"}),
+		tasksCompleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "metamorph_tasks_completed_total",
+			Help: "Number of task locks cleared since the daemon started.",
+		}),
+		agentsRunning: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "metamorph_agents_running",
+			Help: "Number of agent containers currently running.",
+		}),
+		uptimeSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "metamorph_uptime_seconds",
+			Help: "Seconds since the daemon started.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.commitsTotal,
+		m.agentRestarts,
+		m.tasksCompleted,
+		m.agentsRunning,
+		m.uptimeSeconds,
+	)
+
+	return m
+}
+
+// handler returns an http.Handler serving the registry in the Prometheus
+// exposition format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *metrics) addCommits(n int) {
+	if m == nil {
+		return
+	}
+	m.commitsTotal.Add(float64(n))
+}
+
+func (m *metrics) incAgentRestarts(agentID int, role string) {
+	if m == nil {
+		return
+	}
+	m.agentRestarts.WithLabelValues(strconv.Itoa(agentID), role).Inc()
+}
+
+func (m *metrics) addTasksCompleted(n int) {
+	if m == nil {
+		return
+	}
+	m.tasksCompleted.Add(float64(n))
+}
+
+func (m *metrics) setAgentsRunning(n int) {
+	if m == nil {
+		return
+	}
+	m.agentsRunning.Set(float64(n))
+}
+
+func (m *metrics) setUptime(secs int) {
+	if m == nil {
+		return
+	}
+	m.uptimeSeconds.Set(float64(secs))
+}
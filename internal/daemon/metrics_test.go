@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+// scrapeMetrics fetches /metrics from the daemon's HTTP handler.
+func scrapeMetrics(t *testing.T, d *Daemon) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Run("exposes counters updated by monitor hooks", func(t *testing.T) {
+		mock := &mockDockerClient{
+			startAgents: make(map[int]string),
+		}
+
+		d := &Daemon{
+			projectDir: t.TempDir(),
+			docker:     mock,
+			metrics:    newMetrics(),
+			cfg: &config.Config{
+				Project: config.ProjectConfig{Name: "test"},
+				Agents:  config.AgentsConfig{Model: "claude-sonnet"},
+			},
+			state: &State{
+				Agents: []AgentState{
+					{ID: 1, Role: "developer", Status: "running"},
+					{ID: 2, Role: "tester", Status: "running"},
+				},
+			},
+		}
+
+		infos := []docker.AgentInfo{{ID: 1, Status: "Up 1 hour"}}
+		d.updateAgentStates(infos)
+		d.restartCrashedAgents(context.Background(), infos, time.Now().UTC())
+		d.metrics.addCommits(3)
+		d.metrics.addTasksCompleted(2)
+
+		body := scrapeMetrics(t, d)
+
+		for _, want := range []string{
+			`metamorph_agent_restarts_total{agent="2",role="tester"} 1`,
+			`metamorph_agents_running 1`,
+			`metamorph_commits_total 3`,
+			`metamorph_tasks_completed_total 2`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("metrics output missing %q\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("not served when metrics are disabled", func(t *testing.T) {
+		d := &Daemon{}
+
+		rec := httptest.NewRecorder()
+		d.httpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+}
+
+func TestMetricsNilSafe(t *testing.T) {
+	var m *metrics
+	// None of these should panic.
+	m.addCommits(1)
+	m.incAgentRestarts(1, "developer")
+	m.addTasksCompleted(1)
+	m.setAgentsRunning(1)
+	m.setUptime(1)
+}
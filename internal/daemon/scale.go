@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// RequestScale asks a running daemon to scale to n agents. The request is
+// written to a control file that the daemon applies on its next monitor tick.
+func RequestScale(projectDir string, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("daemon: agent count must be greater than 0")
+	}
+
+	path := filepath.Join(projectDir, constants.ScaleFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.Itoa(n)), 0644); err != nil {
+		return fmt.Errorf("daemon: failed to write scale request: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("daemon: failed to write scale request: %w", err)
+	}
+	return nil
+}
+
+// reconcileScale applies a pending scale request, if any. New agents get the
+// next sequential IDs and round-robin roles; scaling down stops the
+// highest-numbered agents first.
+func (d *Daemon) reconcileScale(ctx context.Context, now time.Time) {
+	path := filepath.Join(d.projectDir, constants.ScaleFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_ = os.Remove(path)
+
+	desired, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || desired <= 0 {
+		slog.Warn("ignoring invalid scale request", "value", strings.TrimSpace(string(data)))
+		return
+	}
+
+	current := len(d.state.Agents)
+	if desired == current {
+		return
+	}
+
+	sort.Slice(d.state.Agents, func(i, j int) bool {
+		return d.state.Agents[i].ID < d.state.Agents[j].ID
+	})
+
+	if desired > current {
+		d.scaleUp(ctx, desired, now)
+	} else {
+		d.scaleDown(ctx, desired)
+	}
+	d.cfg.Agents.Count = len(d.state.Agents)
+
+	direction := "up"
+	if desired < current {
+		direction = "down"
+	}
+	d.sendEvent(notify.Event{
+		Type:      notify.EventAgentsScaled,
+		Project:   d.cfg.Project.Name,
+		Message:   fmt.Sprintf("scaled %s from %d to %d agents", direction, current, len(d.state.Agents)),
+		Timestamp: now,
+		Details: map[string]interface{}{
+			"from": current,
+			"to":   len(d.state.Agents),
+		},
+	})
+}
+
+// scaleUp starts agents until there are desired agents in total.
+func (d *Daemon) scaleUp(ctx context.Context, desired int, now time.Time) {
+	nextID := 1
+	if n := len(d.state.Agents); n > 0 {
+		nextID = d.state.Agents[n-1].ID + 1
+	}
+
+	for len(d.state.Agents) < desired {
+		id := nextID
+		nextID++
+		role := d.roleFor(id)
+
+		slog.Info("scaling up: starting agent", "agent", id, "role", role)
+		containerID, err := d.docker.StartAgent(ctx, d.agentOpts(id, role))
+		if err != nil {
+			slog.Error("failed to start agent", "agent", id, "error", err)
+			return
+		}
+
+		d.state.Agents = append(d.state.Agents, AgentState{
+			ID:           id,
+			Role:         role,
+			ContainerID:  containerID,
+			Status:       "running",
+			LastActivity: now,
+			StartedAt:    now,
+		})
+	}
+}
+
+// scaleDown stops the highest-numbered agents until desired remain.
+func (d *Daemon) scaleDown(ctx context.Context, desired int) {
+	for len(d.state.Agents) > desired {
+		a := d.state.Agents[len(d.state.Agents)-1]
+
+		slog.Info("scaling down: stopping agent", "agent", a.ID, "role", a.Role)
+		if err := d.docker.StopAgent(ctx, a.ID); err != nil {
+			slog.Error("failed to stop agent", "agent", a.ID, "error", err)
+			return
+		}
+
+		d.state.Agents = d.state.Agents[:len(d.state.Agents)-1]
+		delete(d.crashes, a.ID)
+		delete(d.lastErrorNotified, a.ID)
+	}
+}
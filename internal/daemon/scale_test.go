@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/constants"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+func newScaleTestDaemon(t *testing.T, mock *mockDockerClient, webhookURL string, agents []AgentState) *Daemon {
+	t.Helper()
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, ".metamorph"), 0755)
+
+	return &Daemon{
+		projectDir:        dir,
+		docker:            mock,
+		crashes:           make(map[int]*crashRecord),
+		lastErrorNotified: make(map[int]time.Time),
+		cfg: &config.Config{
+			Project:       config.ProjectConfig{Name: "test"},
+			Agents:        config.AgentsConfig{Count: len(agents), Model: "claude-sonnet", Roles: []string{"developer", "tester"}},
+			Notifications: config.NotificationsConfig{WebhookURL: webhookURL},
+		},
+		state: &State{Agents: agents},
+	}
+}
+
+func TestRequestScale(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, ".metamorph"), 0755)
+
+	if err := RequestScale(dir, 4); err != nil {
+		t.Fatalf("RequestScale: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, constants.ScaleFile))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "4" {
+		t.Errorf("scale file = %q, want 4", data)
+	}
+
+	if err := RequestScale(dir, 0); err == nil {
+		t.Error("expected error for zero agents")
+	}
+}
+
+func TestReconcileScale(t *testing.T) {
+	t.Run("scales up with sequential IDs and round-robin roles", func(t *testing.T) {
+		var received []notify.Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var e notify.Event
+			_ = json.NewDecoder(r.Body).Decode(&e)
+			received = append(received, e)
+		}))
+		defer srv.Close()
+
+		mock := &mockDockerClient{startAgents: make(map[int]string)}
+		d := newScaleTestDaemon(t, mock, srv.URL, []AgentState{
+			{ID: 1, Role: "developer", Status: "running"},
+			{ID: 2, Role: "tester", Status: "running"},
+		})
+
+		_ = RequestScale(d.projectDir, 5)
+		d.reconcileScale(context.Background(), time.Now().UTC())
+
+		if len(d.state.Agents) != 5 {
+			t.Fatalf("len(Agents) = %d, want 5", len(d.state.Agents))
+		}
+		wantRoles := []string{"developer", "tester", "developer", "tester", "developer"}
+		for i, a := range d.state.Agents {
+			if a.ID != i+1 {
+				t.Errorf("Agents[%d].ID = %d, want %d", i, a.ID, i+1)
+			}
+			if a.Role != wantRoles[i] {
+				t.Errorf("agent-%d role = %q, want %q", a.ID, a.Role, wantRoles[i])
+			}
+		}
+		if len(mock.startAgents) != 3 {
+			t.Errorf("started %d agents, want 3", len(mock.startAgents))
+		}
+		if d.cfg.Agents.Count != 5 {
+			t.Errorf("cfg.Agents.Count = %d, want 5", d.cfg.Agents.Count)
+		}
+		if _, err := os.Stat(filepath.Join(d.projectDir, constants.ScaleFile)); !os.IsNotExist(err) {
+			t.Error("expected scale file to be removed after reconcile")
+		}
+
+		if len(received) != 1 || received[0].Type != notify.EventAgentsScaled {
+			t.Fatalf("expected one %s event, got %+v", notify.EventAgentsScaled, received)
+		}
+		if received[0].Details["to"] != float64(5) {
+			t.Errorf("Details[to] = %v, want 5", received[0].Details["to"])
+		}
+	})
+
+	t.Run("scales down by stopping highest-numbered agents", func(t *testing.T) {
+		mock := &mockDockerClient{}
+		d := newScaleTestDaemon(t, mock, "", []AgentState{
+			{ID: 3, Role: "developer", Status: "running"},
+			{ID: 1, Role: "developer", Status: "running"},
+			{ID: 2, Role: "tester", Status: "running"},
+		})
+		d.crashes[3] = &crashRecord{count: 2}
+
+		_ = RequestScale(d.projectDir, 1)
+		d.reconcileScale(context.Background(), time.Now().UTC())
+
+		if len(d.state.Agents) != 1 || d.state.Agents[0].ID != 1 {
+			t.Fatalf("Agents = %+v, want only agent-1", d.state.Agents)
+		}
+		if len(mock.stopCalls) != 2 || mock.stopCalls[0] != 3 || mock.stopCalls[1] != 2 {
+			t.Errorf("stopCalls = %v, want [3 2]", mock.stopCalls)
+		}
+		if _, ok := d.crashes[3]; ok {
+			t.Error("expected crash record for agent-3 to be cleared")
+		}
+	})
+
+	t.Run("no-op without a request", func(t *testing.T) {
+		mock := &mockDockerClient{}
+		d := newScaleTestDaemon(t, mock, "", []AgentState{{ID: 1, Role: "developer", Status: "running"}})
+
+		d.reconcileScale(context.Background(), time.Now().UTC())
+
+		if len(d.state.Agents) != 1 || len(mock.stopCalls) != 0 {
+			t.Errorf("expected no changes, got agents=%+v stops=%v", d.state.Agents, mock.stopCalls)
+		}
+	})
+
+	t.Run("ignores invalid request", func(t *testing.T) {
+		mock := &mockDockerClient{}
+		d := newScaleTestDaemon(t, mock, "", []AgentState{{ID: 1, Role: "developer", Status: "running"}})
+		path := filepath.Join(d.projectDir, constants.ScaleFile)
+		_ = os.WriteFile(path, []byte("lots"), 0644)
+
+		d.reconcileScale(context.Background(), time.Now().UTC())
+
+		if len(d.state.Agents) != 1 {
+			t.Errorf("len(Agents) = %d, want 1", len(d.state.Agents))
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("expected invalid scale file to be removed")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package daemon
+
+// countSessions updates SessionsCompleted and Stats.TotalSessions from the
+// agents' session logs. The entrypoint creates session-N.log when session N
+// starts, so a new highest N means every session before it has finished.
+//
+// The highest number seen per agent is remembered so that a session is never
+// counted twice. Logs already present the first time an agent is looked at,
+// e.g. from a previous run, only set the baseline.
+func (d *Daemon) countSessions() {
+	if d.sessionsSeen == nil {
+		d.sessionsSeen = make(map[int]int)
+	}
+
+	for i := range d.state.Agents {
+		a := &d.state.Agents[i]
+		_, num := latestSession(d.agentLogDir(a.ID))
+
+		prev, ok := d.sessionsSeen[a.ID]
+		if !ok {
+			d.sessionsSeen[a.ID] = num
+			continue
+		}
+		if num <= prev {
+			continue
+		}
+		d.sessionsSeen[a.ID] = num
+
+		finished := completedBefore(num) - completedBefore(prev)
+		a.SessionsCompleted += finished
+		d.state.Stats.TotalSessions += finished
+	}
+}
+
+// completedBefore returns how many sessions have finished once session n has
+// started.
+func completedBefore(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return n - 1
+}
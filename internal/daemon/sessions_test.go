@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountSessions(t *testing.T) {
+	dir := t.TempDir()
+	d := &Daemon{
+		projectDir: dir,
+		state: &State{
+			Agents: []AgentState{{ID: 1}, {ID: 2}},
+			Stats:  Stats{TotalSessions: 10}, // carried over from a previous run
+		},
+	}
+
+	writeSession := func(agentID, n int) {
+		t.Helper()
+		logDir := d.agentLogDir(agentID)
+		if err := os.MkdirAll(logDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(logDir, fmt.Sprintf("session-%d.log", n)), []byte("log\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Agent 1 has logs left over from a previous run; agent 2 has none yet.
+	writeSession(1, 1)
+	writeSession(1, 2)
+	d.countSessions()
+	if got := d.state.Stats.TotalSessions; got != 10 {
+		t.Fatalf("TotalSessions after baseline = %d, want 10", got)
+	}
+
+	// Agent 2 starts its first session: nothing has finished yet.
+	writeSession(2, 1)
+	d.countSessions()
+	if got := d.state.Agents[1].SessionsCompleted; got != 0 {
+		t.Errorf("agent-2 SessionsCompleted = %d, want 0", got)
+	}
+
+	// Agent 1 starts session 3 and agent 2 jumps to session 3 between ticks.
+	writeSession(1, 3)
+	writeSession(2, 2)
+	writeSession(2, 3)
+	d.countSessions()
+	if got := d.state.Agents[0].SessionsCompleted; got != 1 {
+		t.Errorf("agent-1 SessionsCompleted = %d, want 1", got)
+	}
+	if got := d.state.Agents[1].SessionsCompleted; got != 2 {
+		t.Errorf("agent-2 SessionsCompleted = %d, want 2", got)
+	}
+	if got := d.state.Stats.TotalSessions; got != 13 {
+		t.Errorf("TotalSessions = %d, want 13", got)
+	}
+
+	// Nothing new: a second tick must not count the same sessions again.
+	d.countSessions()
+	if got := d.state.Stats.TotalSessions; got != 13 {
+		t.Errorf("TotalSessions after idle tick = %d, want 13", got)
+	}
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+// startupGrace is added to the build phase deadline to cover the daemon's
+// setup before the build starts (orphan cleanup, upstream init, clones).
+const startupGrace = time.Minute
+
+// Startup phases reported by Start while it waits for the daemon.
+const (
+	phaseBuild  = "build"
+	phaseAgents = "agents"
+)
+
+// startupTracker follows the daemon through its startup phases, using the
+// progress messages it logs, and tracks the deadline for the current one.
+type startupTracker struct {
+	phase         string
+	deadline      time.Time
+	buildTimeout  time.Duration
+	agentsTimeout time.Duration
+}
+
+func newStartupTracker(now time.Time, buildTimeout, agentsTimeout time.Duration) *startupTracker {
+	return &startupTracker{
+		phase:         phaseBuild,
+		deadline:      now.Add(buildTimeout + startupGrace),
+		buildTimeout:  buildTimeout,
+		agentsTimeout: agentsTimeout,
+	}
+}
+
+// observe advances to the agents phase, restarting the clock, once the
+// daemon logs that the image is built and agents are starting.
+func (t *startupTracker) observe(msg string, now time.Time) {
+	if t.phase == phaseBuild && msg == "starting agents" {
+		t.phase = phaseAgents
+		t.deadline = now.Add(t.agentsTimeout)
+	}
+}
+
+// expired reports whether the current phase has run past its deadline.
+func (t *startupTracker) expired(now time.Time) bool {
+	return !now.Before(t.deadline)
+}
+
+// timeoutError describes which phase timed out and which setting to raise.
+func (t *startupTracker) timeoutError() error {
+	if t.phase == phaseAgents {
+		return fmt.Errorf("daemon: agents did not all reach running within %s (raise daemon.agents_ready_timeout)", t.agentsTimeout)
+	}
+	return fmt.Errorf("daemon: image build did not finish within %s (raise docker.build_timeout)", t.buildTimeout)
+}
+
+// agentsReady reports whether state lists want agents and Docker reports
+// each one's container as running. state.json alone isn't enough: the daemon
+// marks agents running as soon as their containers are started, so one that
+// exits straight away still shows as running there until the next tick.
+func agentsReady(ctx context.Context, dc docker.DockerClient, state *State, want int) bool {
+	if state == nil || len(state.Agents) < want || len(state.Agents) == 0 {
+		return false
+	}
+	infos, err := dc.ListAgents(ctx)
+	if err != nil {
+		return false
+	}
+	containers := make(map[int]docker.AgentInfo, len(infos))
+	for _, info := range infos {
+		containers[info.ID] = info
+	}
+	for _, a := range state.Agents {
+		info, ok := containers[a.ID]
+		if !ok || agentStatus(info) != "running" {
+			return false
+		}
+	}
+	return true
+}
+
+// readStateFile parses state.json without the liveness checks GetStatus
+// applies. It returns nil while the file is missing or unreadable.
+func readStateFile(path string) *State {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return &state
+}
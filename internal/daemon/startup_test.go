@@ -0,0 +1,141 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+func TestStartupTracker(t *testing.T) {
+	start := time.Now()
+
+	t.Run("build phase allows the build timeout plus grace", func(t *testing.T) {
+		tr := newStartupTracker(start, 5*time.Minute, 2*time.Minute)
+		if tr.phase != phaseBuild {
+			t.Fatalf("phase = %q, want %q", tr.phase, phaseBuild)
+		}
+		if tr.expired(start.Add(5 * time.Minute)) {
+			t.Error("expired before the grace period ran out")
+		}
+		if !tr.expired(start.Add(5*time.Minute + startupGrace)) {
+			t.Error("not expired after build timeout plus grace")
+		}
+		if err := tr.timeoutError(); !strings.Contains(err.Error(), "image build") || !strings.Contains(err.Error(), "docker.build_timeout") {
+			t.Errorf("timeoutError = %q, want a build phase message", err)
+		}
+	})
+
+	t.Run("starting agents switches phase and restarts the clock", func(t *testing.T) {
+		tr := newStartupTracker(start, 5*time.Minute, 2*time.Minute)
+		tr.observe("building docker image", start.Add(time.Minute))
+		if tr.phase != phaseBuild {
+			t.Fatalf("phase = %q after unrelated message, want %q", tr.phase, phaseBuild)
+		}
+
+		built := start.Add(4 * time.Minute)
+		tr.observe("starting agents", built)
+		if tr.phase != phaseAgents {
+			t.Fatalf("phase = %q, want %q", tr.phase, phaseAgents)
+		}
+		if tr.expired(built.Add(time.Minute)) {
+			t.Error("expired within the agents ready timeout")
+		}
+		if !tr.expired(built.Add(2 * time.Minute)) {
+			t.Error("not expired after the agents ready timeout")
+		}
+		if err := tr.timeoutError(); !strings.Contains(err.Error(), "running") || !strings.Contains(err.Error(), "daemon.agents_ready_timeout") {
+			t.Errorf("timeoutError = %q, want an agents phase message", err)
+		}
+
+		// A repeated message doesn't push the deadline back.
+		tr.observe("starting agents", built.Add(time.Minute))
+		if !tr.expired(built.Add(2 * time.Minute)) {
+			t.Error("deadline moved on a repeated message")
+		}
+	})
+}
+
+func TestAgentsReady(t *testing.T) {
+	up := func(id int) docker.AgentInfo { return docker.AgentInfo{ID: id, Status: "Up 5 seconds"} }
+	running := func(ids ...int) *State {
+		state := &State{Status: "running"}
+		for _, id := range ids {
+			state.Agents = append(state.Agents, AgentState{ID: id, Status: "running"})
+		}
+		return state
+	}
+
+	tests := []struct {
+		name       string
+		state      *State
+		containers []docker.AgentInfo
+		listErr    error
+		want       int
+		ready      bool
+	}{
+		{name: "no state", state: nil, containers: []docker.AgentInfo{up(1)}, want: 1, ready: false},
+		{name: "no agents yet", state: running(), want: 2, ready: false},
+		{name: "fewer agents than configured", state: running(1), containers: []docker.AgentInfo{up(1)}, want: 2, ready: false},
+		{
+			name:  "one agent not running",
+			state: &State{Agents: []AgentState{{ID: 1, Status: "running"}, {ID: 2, Status: "exited"}}},
+			containers: []docker.AgentInfo{
+				up(1),
+				{ID: 2, Status: "Exited (1) 2 seconds ago"},
+			},
+			want:  2,
+			ready: false,
+		},
+		{
+			name:  "container exited although state says running",
+			state: running(1, 2),
+			containers: []docker.AgentInfo{
+				up(1),
+				{ID: 2, Status: "Exited (1) 1 second ago"},
+			},
+			want:  2,
+			ready: false,
+		},
+		{name: "container missing", state: running(1, 2), containers: []docker.AgentInfo{up(1)}, want: 2, ready: false},
+		{name: "docker unreachable", state: running(1), listErr: errors.New("connection refused"), want: 1, ready: false},
+		{name: "all running", state: running(1, 2), containers: []docker.AgentInfo{up(1), up(2)}, want: 2, ready: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := &mockDockerClient{listResult: tt.containers, listErr: tt.listErr}
+			if got := agentsReady(t.Context(), dc, tt.state, tt.want); got != tt.ready {
+				t.Errorf("agentsReady = %v, want %v", got, tt.ready)
+			}
+		})
+	}
+}
+
+func TestReadStateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	if state := readStateFile(path); state != nil {
+		t.Errorf("readStateFile on a missing file = %+v, want nil", state)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if state := readStateFile(path); state != nil {
+		t.Errorf("readStateFile on invalid JSON = %+v, want nil", state)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"status":"running","agents":[{"id":1,"status":"running"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := readStateFile(path)
+	if state == nil || len(state.Agents) != 1 || state.Agents[0].Status != "running" {
+		t.Errorf("readStateFile = %+v, want one running agent", state)
+	}
+}
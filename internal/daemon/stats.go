@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+// saveLifetimeStats copies the counters from a cleanly stopped previous run's
+// state.json into the lifetime stats file so the next run can continue them.
+// It is a no-op when there is no prior state or the daemon did not stop
+// cleanly.
+func saveLifetimeStats(projectDir string) error {
+	data, err := os.ReadFile(filepath.Join(projectDir, constants.StateFile))
+	if err != nil {
+		return nil
+	}
+
+	var prev State
+	if err := json.Unmarshal(data, &prev); err != nil || prev.Status != "stopped" {
+		return nil
+	}
+
+	stats := Stats{
+		TotalCommits:   prev.Stats.TotalCommits,
+		TotalSessions:  prev.Stats.TotalSessions,
+		TasksCompleted: prev.Stats.TasksCompleted,
+	}
+	out, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, constants.StatsFile), out, 0644); err != nil {
+		return fmt.Errorf("failed to write stats file: %w", err)
+	}
+	return nil
+}
+
+// loadLifetimeStats returns the counters carried over from previous runs, or
+// zero Stats if there are none. Uptime is per-run and always starts at zero.
+func loadLifetimeStats(projectDir string) Stats {
+	var stats Stats
+	data, err := os.ReadFile(filepath.Join(projectDir, constants.StatsFile))
+	if err != nil {
+		return stats
+	}
+	_ = json.Unmarshal(data, &stats)
+	stats.UptimeSeconds = 0
+	return stats
+}
+
+// ResetStats discards the stats carried over from previous runs so the next
+// start begins counting from zero. It must not be called while the daemon
+// is running.
+func ResetStats(projectDir string) error {
+	for _, name := range []string{constants.StatsFile, constants.StateFile} {
+		if err := os.Remove(filepath.Join(projectDir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("daemon: failed to reset stats: %w", err)
+		}
+	}
+	return nil
+}
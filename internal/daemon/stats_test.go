@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/constants"
+)
+
+func TestLifetimeStats(t *testing.T) {
+	t.Run("carries forward stats from a stopped run", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = WriteState(dir, &State{
+			Status:    "stopped",
+			StartedAt: time.Now().UTC(),
+			Stats: Stats{
+				TotalCommits:   42,
+				TotalSessions:  7,
+				TasksCompleted: 5,
+				UptimeSeconds:  3600,
+			},
+		})
+
+		if err := saveLifetimeStats(dir); err != nil {
+			t.Fatalf("saveLifetimeStats: %v", err)
+		}
+		got := loadLifetimeStats(dir)
+
+		want := Stats{TotalCommits: 42, TotalSessions: 7, TasksCompleted: 5}
+		if got != want {
+			t.Errorf("loadLifetimeStats = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("accumulates across runs", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = WriteState(dir, &State{Status: "stopped", Stats: Stats{TasksCompleted: 3}})
+		_ = saveLifetimeStats(dir)
+
+		// Second run starts from the carried-over stats and clears 2 more tasks.
+		d := &Daemon{projectDir: dir, state: &State{Stats: loadLifetimeStats(dir)}}
+		d.state.Stats.TasksCompleted += 2
+		d.state.Status = "stopped"
+		_ = d.writeState()
+
+		_ = saveLifetimeStats(dir)
+		if got := loadLifetimeStats(dir).TasksCompleted; got != 5 {
+			t.Errorf("TasksCompleted = %d, want 5", got)
+		}
+	})
+
+	t.Run("ignores state from a run that did not stop cleanly", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = WriteState(dir, &State{Status: "running", Stats: Stats{TasksCompleted: 9}})
+
+		if err := saveLifetimeStats(dir); err != nil {
+			t.Fatalf("saveLifetimeStats: %v", err)
+		}
+		if got := loadLifetimeStats(dir); got != (Stats{}) {
+			t.Errorf("loadLifetimeStats = %+v, want zero", got)
+		}
+	})
+
+	t.Run("no prior state", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := saveLifetimeStats(dir); err != nil {
+			t.Fatalf("saveLifetimeStats: %v", err)
+		}
+		if got := loadLifetimeStats(dir); got != (Stats{}) {
+			t.Errorf("loadLifetimeStats = %+v, want zero", got)
+		}
+	})
+}
+
+func TestResetStats(t *testing.T) {
+	dir := t.TempDir()
+	_ = WriteState(dir, &State{Status: "stopped", Stats: Stats{TasksCompleted: 3}})
+	_ = saveLifetimeStats(dir)
+
+	if err := ResetStats(dir); err != nil {
+		t.Fatalf("ResetStats: %v", err)
+	}
+	for _, name := range []string{constants.StatsFile, constants.StateFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+
+	// Safe to call again when nothing is left.
+	if err := ResetStats(dir); err != nil {
+		t.Errorf("ResetStats on clean dir: %v", err)
+	}
+}
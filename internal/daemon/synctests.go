@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// maxSyncTestOutput caps how much test output is included in a
+// sync_test_failed event.
+const maxSyncTestOutput = 4000
+
+// syncTestsTimeout bounds a testing.command run after a sync. The command
+// and everything it started are killed once it passes.
+const syncTestsTimeout = 30 * time.Minute
+
+// startSyncTests runs testing.command in the background after agent commits
+// have been merged into the project directory. A run is skipped if the
+// previous one has not finished yet.
+func (d *Daemon) startSyncTests() {
+	if d.cfg.Testing.Command == "" {
+		return
+	}
+	if !d.syncTestsRunning.CompareAndSwap(false, true) {
+		return
+	}
+	ctx := d.shutdownCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go func() {
+		defer d.syncTestsRunning.Store(false)
+		d.runSyncTests(ctx)
+	}()
+}
+
+// runSyncTests runs testing.command in the project directory and sends a
+// sync_test_failed event, with the tail of the output, if it fails or times
+// out. Cancelling ctx (on shutdown) kills the command without an event.
+func (d *Daemon) runSyncTests(ctx context.Context) {
+	command := d.cfg.Testing.Command
+	start := time.Now()
+
+	timeout := d.syncTestsTimeout
+	if timeout == 0 {
+		timeout = syncTestsTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Run the command in its own process group so a timeout also kills the
+	// test binaries and servers it started.
+	cmd := exec.CommandContext(runCtx, "sh", "-c", command)
+	cmd.Dir = d.projectDir
+	cmd.SysProcAttr = processGroupAttr()
+	cmd.Cancel = func() error { return killProcessGroup(cmd.Process) }
+	cmd.WaitDelay = 5 * time.Second
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		slog.Info("tests passed after sync", "command", command, "duration", time.Since(start).Round(time.Millisecond))
+		return
+	}
+	if ctx.Err() != nil {
+		slog.Info("tests cancelled by shutdown", "command", command)
+		return
+	}
+
+	message := fmt.Sprintf("Tests failed after syncing agent commits: %v", err)
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		message = fmt.Sprintf("Tests timed out after %s after syncing agent commits", timeout)
+	}
+	slog.Warn("tests failed after sync", "command", command, "error", err)
+	d.sendEvent(notify.Event{
+		Type:      notify.EventSyncTestFailed,
+		Project:   d.cfg.Project.Name,
+		Message:   message,
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"command": command,
+			"output":  truncateOutput(string(out), maxSyncTestOutput),
+		},
+	})
+}
+
+// truncateOutput keeps the last n bytes of s, where test failures are
+// usually reported.
+func truncateOutput(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "...\n" + s[len(s)-n:]
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+func TestRunSyncTests(t *testing.T) {
+	newDaemon := func(t *testing.T, command string) (*Daemon, *[]notify.Event) {
+		var received []notify.Event
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ev notify.Event
+			_ = json.NewDecoder(r.Body).Decode(&ev)
+			received = append(received, ev)
+		}))
+		t.Cleanup(srv.Close)
+
+		return &Daemon{
+			projectDir: t.TempDir(),
+			cfg: &config.Config{
+				Project:       config.ProjectConfig{Name: "test"},
+				Testing:       config.TestingConfig{Command: command, RunOnSync: true},
+				Notifications: config.NotificationsConfig{WebhookURL: srv.URL, Format: "json"},
+			},
+		}, &received
+	}
+
+	t.Run("passing command sends nothing", func(t *testing.T) {
+		d, received := newDaemon(t, "true")
+		d.runSyncTests(context.Background())
+		if len(*received) != 0 {
+			t.Errorf("expected no events, got %d", len(*received))
+		}
+	})
+
+	t.Run("failing command sends sync_test_failed", func(t *testing.T) {
+		d, received := newDaemon(t, "echo 'FAIL: TestParse'; exit 1")
+		d.runSyncTests(context.Background())
+		if len(*received) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(*received))
+		}
+		ev := (*received)[0]
+		if ev.Type != notify.EventSyncTestFailed {
+			t.Errorf("event type = %q, want %q", ev.Type, notify.EventSyncTestFailed)
+		}
+		if out, _ := ev.Details["output"].(string); !strings.Contains(out, "FAIL: TestParse") {
+			t.Errorf("output detail = %q, want test output", out)
+		}
+	})
+
+	t.Run("timeout kills the command and its children", func(t *testing.T) {
+		// The background sleep holds the output pipe open, so only killing
+		// the whole process group lets the run finish.
+		d, received := newDaemon(t, "sleep 60 & sleep 60")
+		d.syncTestsTimeout = 200 * time.Millisecond
+
+		start := time.Now()
+		d.runSyncTests(context.Background())
+		if elapsed := time.Since(start); elapsed > 4*time.Second {
+			t.Errorf("runSyncTests took %s, want it stopped at the timeout", elapsed)
+		}
+		if len(*received) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(*received))
+		}
+		if msg := (*received)[0].Message; !strings.Contains(msg, "timed out") {
+			t.Errorf("message = %q, want a timeout", msg)
+		}
+	})
+
+	t.Run("shutdown cancels without an event", func(t *testing.T) {
+		d, received := newDaemon(t, "sleep 60")
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		d.runSyncTests(ctx)
+		if elapsed := time.Since(start); elapsed > 4*time.Second {
+			t.Errorf("runSyncTests took %s, want it stopped on cancel", elapsed)
+		}
+		if len(*received) != 0 {
+			t.Errorf("expected no events on shutdown, got %d", len(*received))
+		}
+	})
+}
+
+func TestTruncateOutput(t *testing.T) {
+	if got := truncateOutput("short", 10); got != "short" {
+		t.Errorf("truncateOutput(short) = %q", got)
+	}
+	if got := truncateOutput("0123456789", 4); got != "...\n6789" {
+		t.Errorf("truncateOutput = %q, want the last 4 bytes", got)
+	}
+}
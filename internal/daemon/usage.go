@@ -0,0 +1,39 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+// collectAgentStats samples CPU and memory usage of every running agent.
+// Collection is best-effort: an agent whose stats can't be read simply
+// shows no usage. Samples are taken concurrently because Docker needs about
+// a second per container to measure CPU.
+func (d *Daemon) collectAgentStats(ctx context.Context) {
+	results := make([]docker.AgentStats, len(d.state.Agents))
+	var wg sync.WaitGroup
+	for i, a := range d.state.Agents {
+		if a.Status != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func(i, agentID int) {
+			defer wg.Done()
+			stats, err := d.docker.Stats(ctx, agentID)
+			if err != nil {
+				slog.Debug("failed to collect agent stats", "agent", agentID, "error", err)
+				return
+			}
+			results[i] = stats
+		}(i, a.ID)
+	}
+	wg.Wait()
+
+	for i := range d.state.Agents {
+		d.state.Agents[i].CPUPercent = results[i].CPUPercent
+		d.state.Agents[i].MemoryBytes = results[i].MemoryBytes
+	}
+}
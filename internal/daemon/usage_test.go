@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/robmorgan/metamorph/internal/docker"
+)
+
+func TestCollectAgentStats(t *testing.T) {
+	t.Run("records usage for running agents", func(t *testing.T) {
+		mock := &mockDockerClient{stats: map[int]docker.AgentStats{
+			1: {CPUPercent: 85.5, MemoryBytes: 512 << 20},
+			2: {CPUPercent: 10, MemoryBytes: 64 << 20},
+		}}
+		d := &Daemon{
+			docker: mock,
+			state: &State{Agents: []AgentState{
+				{ID: 1, Status: "running"},
+				{ID: 2, Status: "stopped", CPUPercent: 50, MemoryBytes: 1 << 20},
+			}},
+		}
+
+		d.collectAgentStats(context.Background())
+
+		if a := d.state.Agents[0]; a.CPUPercent != 85.5 || a.MemoryBytes != 512<<20 {
+			t.Errorf("agent-1 = %v%% / %d bytes", a.CPUPercent, a.MemoryBytes)
+		}
+		if a := d.state.Agents[1]; a.CPUPercent != 0 || a.MemoryBytes != 0 {
+			t.Errorf("stopped agent-2 should have its usage cleared, got %v%% / %d bytes", a.CPUPercent, a.MemoryBytes)
+		}
+	})
+
+	t.Run("errors leave usage empty", func(t *testing.T) {
+		mock := &mockDockerClient{statsErr: fmt.Errorf("docker unavailable")}
+		d := &Daemon{
+			docker: mock,
+			state:  &State{Agents: []AgentState{{ID: 1, Status: "running", CPUPercent: 20}}},
+		}
+
+		d.collectAgentStats(context.Background())
+
+		if a := d.state.Agents[0]; a.CPUPercent != 0 || a.MemoryBytes != 0 {
+			t.Errorf("agent-1 = %v%% / %d bytes, want zero", a.CPUPercent, a.MemoryBytes)
+		}
+	})
+}
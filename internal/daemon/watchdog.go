@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// runMonitor starts a monitor iteration in its own goroutine under a
+// watchdog, so a hung git or Docker call can't stall the tick loop. An
+// iteration running longer than daemon.monitor_timeout is cancelled,
+// reported and abandoned. A tick that arrives while the previous iteration
+// is still within its timeout is skipped rather than run alongside it, but
+// once an iteration is abandoned the next tick runs on schedule even if the
+// stuck call hasn't returned yet; its cancelled context makes any further
+// calls it makes fail fast.
+func (d *Daemon) runMonitor(ctx context.Context) {
+	d.monitorGen++
+	gen := d.monitorGen
+	if !d.monitorActive.CompareAndSwap(0, gen) {
+		slog.Warn("previous monitor iteration still running, skipping tick")
+		return
+	}
+
+	step := d.monitorStep
+	if step == nil {
+		step = d.monitor
+	}
+
+	iterCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	d.monitorDone = done
+	go func() {
+		defer close(done)
+		defer d.monitorActive.CompareAndSwap(gen, 0)
+		defer cancel()
+		step(iterCtx)
+	}()
+	if timeout := d.cfg.Daemon.MonitorTimeout; timeout > 0 {
+		go d.watchMonitor(gen, done, cancel, timeout)
+	}
+}
+
+// watchMonitor cancels a monitor iteration that hasn't finished within
+// timeout, releases the tick loop from it and sends a monitor_stall event.
+func (d *Daemon) watchMonitor(gen uint64, done <-chan struct{}, cancel context.CancelFunc, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	cancel()
+	d.monitorActive.CompareAndSwap(gen, 0)
+	slog.Error("monitor iteration stalled, cancelling it", "timeout", timeout)
+	d.sendEvent(notify.Event{
+		Type:      notify.EventMonitorStall,
+		Project:   d.cfg.Project.Name,
+		Message:   fmt.Sprintf("monitor loop stalled for over %s", timeout),
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"timeout_seconds": int(timeout.Seconds()),
+		},
+	})
+}
+
+// waitForMonitor waits up to timeout for an in-flight monitor iteration to
+// finish, so shutdown doesn't race it for the daemon's state.
+func (d *Daemon) waitForMonitor(timeout time.Duration) {
+	if d.monitorDone == nil {
+		return
+	}
+	select {
+	case <-d.monitorDone:
+	case <-time.After(timeout):
+		slog.Warn("monitor iteration still running at shutdown", "waited", timeout)
+	}
+}
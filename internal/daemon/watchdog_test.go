@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
+	"github.com/robmorgan/metamorph/internal/notify"
+)
+
+// chanNotifier is a notify.Notifier that forwards events to a channel, for
+// events sent from background goroutines.
+type chanNotifier chan notify.Event
+
+func (n chanNotifier) Send(event notify.Event) error {
+	n <- event
+	return nil
+}
+
+func TestRunMonitor_Stall(t *testing.T) {
+	events := make(chanNotifier, 1)
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	var runs atomic.Int32
+	d := &Daemon{
+		cfg: &config.Config{
+			Project: config.ProjectConfig{Name: "proj"},
+			Daemon:  config.DaemonConfig{MonitorTimeout: 50 * time.Millisecond},
+		},
+		notifier: events,
+		monitorStep: func(ctx context.Context) {
+			if runs.Add(1) > 1 {
+				return
+			}
+			<-ctx.Done()
+			close(cancelled)
+			<-release // stay wedged after cancellation, like a call that ignores ctx
+		},
+	}
+
+	d.runMonitor(context.Background())
+
+	select {
+	case event := <-events:
+		if event.Type != notify.EventMonitorStall {
+			t.Errorf("event type = %q, want %q", event.Type, notify.EventMonitorStall)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no monitor_stall event after the watchdog timeout")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled iteration's context was not cancelled")
+	}
+
+	// Once the watchdog abandons the wedged iteration, the next tick runs
+	// without waiting for it to return.
+	d.runMonitor(context.Background())
+	d.waitForMonitor(5 * time.Second)
+	if got := runs.Load(); got != 2 {
+		t.Errorf("runs = %d after the stall, want 2", got)
+	}
+
+	close(release)
+}
+
+func TestRunMonitor_SkipsTickWithinTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var runs atomic.Int32
+	d := &Daemon{
+		cfg: &config.Config{Daemon: config.DaemonConfig{MonitorTimeout: time.Minute}},
+		monitorStep: func(ctx context.Context) {
+			runs.Add(1)
+			<-release
+		},
+	}
+
+	d.runMonitor(context.Background())
+
+	// A tick while the iteration is still within its timeout is skipped,
+	// not run alongside it.
+	d.runMonitor(context.Background())
+	if got := runs.Load(); got > 1 {
+		t.Errorf("runs = %d while the first iteration was running, want 1", got)
+	}
+
+	close(release)
+	d.waitForMonitor(5 * time.Second)
+
+	d.runMonitor(context.Background())
+	d.waitForMonitor(5 * time.Second)
+	if got := runs.Load(); got != 2 {
+		t.Errorf("runs = %d after the first iteration finished, want 2", got)
+	}
+}
+
+func TestRunMonitor_NoStall(t *testing.T) {
+	events := make(chanNotifier, 1)
+	d := &Daemon{
+		cfg:         &config.Config{Daemon: config.DaemonConfig{MonitorTimeout: 50 * time.Millisecond}},
+		notifier:    events,
+		monitorStep: func(ctx context.Context) {},
+	}
+
+	d.runMonitor(context.Background())
+	d.waitForMonitor(5 * time.Second)
+	time.Sleep(100 * time.Millisecond) // past the watchdog timeout
+
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %q for an iteration that finished in time", event.Type)
+	default:
+	}
+}
+
+func TestRunMonitor_WatchdogDisabled(t *testing.T) {
+	events := make(chanNotifier, 1)
+	release := make(chan struct{})
+	d := &Daemon{
+		cfg:         &config.Config{},
+		notifier:    events,
+		monitorStep: func(ctx context.Context) { <-release },
+	}
+
+	d.runMonitor(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	d.waitForMonitor(5 * time.Second)
+
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %q with monitor_timeout = 0", event.Type)
+	default:
+	}
+}
@@ -5,10 +5,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -18,24 +23,32 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/robmorgan/metamorph/assets"
+	"github.com/robmorgan/metamorph/internal/config"
 	"github.com/robmorgan/metamorph/internal/constants"
 )
 
 const (
-	defaultImageTag  = "metamorph-agent:latest"
 	labelProject     = "metamorph.project"
 	labelAgentID     = "metamorph.agent-id"
-	stopTimeout      = 30 // seconds
+	labelRole        = "metamorph.role"
+	labelModel       = "metamorph.model"
+	labelBuildHash   = "metamorph.build-hash" // on the image; buildHash of its inputs
+	stopTimeout      = 30                     // seconds
 	buildTimeout     = 5 * time.Minute
 	startStopTimeout = 30 * time.Second
 	listTimeout      = 10 * time.Second
+	buildHashFile    = ".build-hash" // in the build dir; hash of the last successful build's inputs
+	cacheDir         = "/workspace/.cache"
+	gpgHostDir       = "/home/agent/.gnupg-host" // read-only; the entrypoint copies it to ~/.gnupg
 )
 
 // AgentOpts configures a new agent container.
@@ -44,10 +57,31 @@ type AgentOpts struct {
 	AgentID        int
 	Role           string
 	Model          string
-	APIKey         string // Anthropic API key (if set)
-	OAuthToken     string // Claude Code OAuth token (if set, preferred over APIKey)
-	GitAuthorName  string // Git author name for commits (optional)
-	GitAuthorEmail string // Git author email for commits (optional)
+	APIKey         string   // Anthropic API key (if set)
+	OAuthToken     string   // Claude Code OAuth token (if set, preferred over APIKey)
+	GitAuthorName  string   // Git author name for commits (optional)
+	GitAuthorEmail string   // Git author email for commits (optional)
+	Branch         string   // upstream branch to work on (default branch when empty)
+	RestartPolicy  string   // "no", "on-failure" or "unless-stopped" (default)
+	GPUs           string   // "all" or a device count to pass through (none when empty)
+	CacheVolume    string   // named volume or host path mounted at cacheDir (none when empty)
+	SignCommits    bool     // GPG-sign agent commits
+	SigningKey     string   // GPG key ID to sign with (git's default when empty)
+	GPGHome        string   // host GnuPG home copied into the container when signing
+	CloneDepth     int      // shallow-clone upstream with this much history (full clone when 0)
+	Image          string   // image to run (the locally built image when empty)
+	PromptFile     string   // prompt mounted as AGENT_PROMPT.md (AgentPromptPath when empty)
+	Command        []string // run instead of the entrypoint's session loop (none when empty)
+	TaskLockDir    string   // repo dir agents claim tasks in (the entrypoint's default when empty)
+}
+
+// ExecOpts configures an interactive command run inside an agent container.
+type ExecOpts struct {
+	Cmd    []string
+	Tty    bool // allocate a pseudo-TTY (stdout and stderr are merged)
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // AgentInfo describes a running agent container.
@@ -55,32 +89,54 @@ type AgentInfo struct {
 	ID          int
 	ContainerID string
 	Role        string
+	Model       string
 	Status      string
-	StartedAt   time.Time
+	Health      string    // "healthy", "unhealthy" or "starting"; empty without a health check
+	StartedAt   time.Time // container creation time, or its last start when inspected after a restart
+}
+
+// AgentStats is a point-in-time resource usage sample for an agent container.
+type AgentStats struct {
+	CPUPercent  float64 // share of one CPU, so 250 means two and a half cores
+	MemoryBytes uint64  // memory in use, excluding reclaimable page cache
+	MemoryLimit uint64  // container memory limit (the host's memory when unlimited)
 }
 
 // DockerClient is the interface for Docker operations so the daemon and CLI
 // can be tested without a real Docker daemon.
 type DockerClient interface {
-	BuildImage(projectDir string, extraPackages []string) error
+	BuildImage(projectDir string, extraPackages []string, systemPrompt string, timeout time.Duration) error
+	PullImage(ref string, auth RegistryAuth, timeout time.Duration) error
 	StartAgent(ctx context.Context, opts AgentOpts) (string, error)
 	StopAgent(ctx context.Context, agentID int) error
 	StopAllAgents(ctx context.Context) error
+	PauseAgent(ctx context.Context, agentID int) error
+	UnpauseAgent(ctx context.Context, agentID int) error
 	ListAgents(ctx context.Context) ([]AgentInfo, error)
+	Stats(ctx context.Context, agentID int) (AgentStats, error)
 	GetLogs(ctx context.Context, agentID int, tail int, follow bool) (io.ReadCloser, error)
+	ExecInteractive(ctx context.Context, agentID int, opts ExecOpts) (int, error)
 }
 
 // dockerAPI is the subset of the Docker SDK client we use, enabling test mocks.
 type dockerAPI interface {
 	Ping(ctx context.Context) (types.Ping, error)
 	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	ImageInspect(ctx context.Context, imageID string, inspectOpts ...dockerclient.ImageInspectOption) (image.InspectResponse, error)
+	ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error)
 	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
 	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerPause(ctx context.Context, containerID string) error
+	ContainerUnpause(ctx context.Context, containerID string) error
 	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
 	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
 	ContainerLogs(ctx context.Context, container string, options container.LogsOptions) (io.ReadCloser, error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+	ContainerExecCreate(ctx context.Context, container string, options container.ExecOptions) (container.ExecCreateResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
 }
 
 // Client manages Docker containers for metamorph agents.
@@ -92,9 +148,11 @@ type Client struct {
 // Verify Client implements DockerClient at compile time.
 var _ DockerClient = (*Client)(nil)
 
-// NewClient creates a Docker API client and verifies connectivity.
-func NewClient(projectName string) (*Client, error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+// NewClient creates a Docker API client and verifies connectivity. host is
+// the docker.host config value, e.g. "tcp://build-box:2375"; when empty the
+// client is configured from DOCKER_HOST and related environment variables.
+func NewClient(projectName, host string) (*Client, error) {
+	cli, err := dockerclient.NewClientWithOpts(clientOpts(host)...)
 	if err != nil {
 		return nil, fmt.Errorf("docker: failed to create client: %w", err)
 	}
@@ -106,24 +164,59 @@ func NewClient(projectName string) (*Client, error) {
 	return &Client{cli: cli, projectName: projectName}, nil
 }
 
+// clientOpts returns the Docker client options for the given host. The
+// environment is always applied first so TLS settings such as
+// DOCKER_CERT_PATH still work with an explicit host.
+func clientOpts(host string) []dockerclient.Opt {
+	opts := []dockerclient.Opt{dockerclient.FromEnv}
+	if host != "" {
+		opts = append(opts, dockerclient.WithHost(host))
+	}
+	return append(opts, dockerclient.WithAPIVersionNegotiation())
+}
+
 // newClientWithAPI creates a Client with a provided dockerAPI (for testing).
 func newClientWithAPI(projectName string, api dockerAPI) *Client {
 	return &Client{cli: api, projectName: projectName}
 }
 
 // BuildImage writes the embedded Dockerfile and entrypoint into .metamorph/docker/,
-// creates a tar build context, and builds the image.
-func (c *Client) BuildImage(projectDir string, extraPackages []string) error {
+// creates a tar build context, and builds the image. systemPrompt replaces
+// the embedded system prompt when non-empty. The build is cancelled after
+// timeout (5 minutes when zero).
+func (c *Client) BuildImage(projectDir string, extraPackages []string, systemPrompt string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = buildTimeout
+	}
+
+	if systemPrompt == "" {
+		systemPrompt = assets.SystemPrompt
+	}
+
 	buildDir := filepath.Join(projectDir, constants.DockerDir)
 	if err := os.MkdirAll(buildDir, 0755); err != nil {
 		return fmt.Errorf("docker: failed to create build dir: %w", err)
 	}
 
+	// Skip the build if the inputs haven't changed since the last successful
+	// build and the image still carries their hash. The tag is shared by
+	// every project on the host, so the label catches another project having
+	// rebuilt it with different inputs.
+	hash := buildHash(extraPackages, systemPrompt)
+	hashPath := filepath.Join(buildDir, buildHashFile)
+	if prev, err := os.ReadFile(hashPath); err == nil && string(prev) == hash {
+		img, err := c.cli.ImageInspect(context.Background(), config.DefaultImage)
+		if err == nil && img.Config != nil && img.Config.Labels[labelBuildHash] == hash {
+			slog.Info("docker image is up to date, skipping build")
+			return nil
+		}
+	}
+
 	// Write embedded assets to the build directory.
 	embeddedFiles := map[string]string{
 		"Dockerfile":       assets.DefaultDockerfile,
 		"entrypoint.sh":    assets.DefaultEntrypoint,
-		"SYSTEM_PROMPT.md": assets.SystemPrompt,
+		"SYSTEM_PROMPT.md": systemPrompt,
 	}
 	for name, content := range embeddedFiles {
 		dst := filepath.Join(buildDir, name)
@@ -143,38 +236,227 @@ func (c *Client) BuildImage(projectDir string, extraPackages []string) error {
 		buildArgs["EXTRA_PACKAGES"] = &pkgs
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	resp, err := c.cli.ImageBuild(ctx, buildCtx, types.ImageBuildOptions{
-		Tags:       []string{defaultImageTag},
+		Tags:       []string{config.DefaultImage},
 		Dockerfile: "Dockerfile",
 		Remove:     true,
 		BuildArgs:  buildArgs,
+		Labels:     map[string]string{labelBuildHash: hash},
 	})
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("docker: image build timed out after %s (raise docker.build_timeout): %w", timeout, err)
+		}
 		return fmt.Errorf("docker: failed to build image: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Read the build output stream and check for errors.
+	// Read the build output stream, logging progress and checking for errors.
+	// Each step is logged so the foreground 'metamorph start' (which tails the
+	// daemon log) shows progress during a slow first build.
 	scanner := bufio.NewScanner(resp.Body)
 	var buildErr string
 	for scanner.Scan() {
 		var msg struct {
-			Error string `json:"error"`
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if line := strings.TrimSpace(msg.Stream); line != "" {
+			slog.Info("docker build: " + line)
 		}
-		if err := json.Unmarshal(scanner.Bytes(), &msg); err == nil && msg.Error != "" {
+		if msg.Error != "" {
 			buildErr = msg.Error
 		}
 	}
 	if err := scanner.Err(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("docker: image build timed out after %s (raise docker.build_timeout): %w", timeout, err)
+		}
 		return fmt.Errorf("docker: failed to read build output: %w", err)
 	}
 	if buildErr != "" {
 		return fmt.Errorf("docker: image build failed: %s", buildErr)
 	}
 
+	if err := os.WriteFile(hashPath, []byte(hash), 0644); err != nil {
+		return fmt.Errorf("docker: failed to write build hash: %w", err)
+	}
+
+	return nil
+}
+
+// RegistryAuth holds the credentials for pulling a private image: a
+// username and password, or the name of a Docker credential helper. The
+// zero value pulls anonymously.
+type RegistryAuth struct {
+	Username         string
+	Password         string
+	CredentialHelper string // asks docker-credential-<name> for the image's registry
+}
+
+// dockerHubServer is the address credential helpers store Docker Hub
+// credentials under.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// encode returns the X-Registry-Auth value for pulling ref, or "" for an
+// anonymous pull. Cancelling ctx stops a running credential helper.
+func (a RegistryAuth) encode(ctx context.Context, ref string) (string, error) {
+	server := registryServer(ref)
+	username, password := a.Username, a.Password
+	if a.CredentialHelper != "" {
+		var err error
+		if username, password, err = credentialHelperGet(ctx, a.CredentialHelper, server); err != nil {
+			return "", err
+		}
+	}
+	if username == "" && password == "" {
+		return "", nil
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: server,
+	})
+}
+
+// registryServer returns the registry ref is pulled from: its first path
+// component when that names a host, otherwise Docker Hub.
+func registryServer(ref string) string {
+	host, _, ok := strings.Cut(ref, "/")
+	if ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return host
+	}
+	return dockerHubServer
+}
+
+// credentialHelperGet asks docker-credential-<helper> for server's
+// credentials, using the credential helper protocol's "get" command. The
+// helper's output is only included in errors when it fails, since it then
+// holds an error message rather than a secret. Cancelling ctx kills the
+// helper, e.g. one stuck waiting for a login prompt.
+func credentialHelperGet(ctx context.Context, helper, server string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", fmt.Errorf("docker: credential helper %s for %s: %w", helper, server, ctxErr)
+		}
+		msg := strings.TrimSpace(string(out))
+		var exitErr *exec.ExitError
+		if msg == "" && errors.As(err, &exitErr) {
+			msg = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		if msg != "" {
+			return "", "", fmt.Errorf("docker: credential helper %s failed for %s: %s", helper, server, msg)
+		}
+		return "", "", fmt.Errorf("docker: credential helper %s failed for %s: %w", helper, server, err)
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("docker: credential helper %s returned invalid output for %s", helper, server)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// PullImage pulls ref from its registry, authenticating with auth, and logs
+// each layer's progress. Credentials are never logged. The pull, including
+// any credential helper, is cancelled after timeout (5 minutes when zero).
+func (c *Client) PullImage(ref string, auth RegistryAuth, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = buildTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	encodedAuth, err := auth.encode(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.cli.ImagePull(ctx, ref, image.PullOptions{RegistryAuth: encodedAuth})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("docker: image pull timed out after %s (raise docker.build_timeout): %w", timeout, err)
+		}
+		return fmt.Errorf("docker: failed to pull image %s: %w", ref, err)
+	}
+	defer func() { _ = body.Close() }()
+
+	// Each layer reports "Downloading" and "Extracting" many times as its
+	// progress bar advances; log only when a layer's status changes.
+	scanner := bufio.NewScanner(body)
+	lastStatus := make(map[string]string)
+	var pullErr string
+	for scanner.Scan() {
+		var msg struct {
+			Status string `json:"status"`
+			ID     string `json:"id"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Error != "" {
+			pullErr = msg.Error
+			continue
+		}
+		if msg.Status == "" || lastStatus[msg.ID] == msg.Status {
+			continue
+		}
+		lastStatus[msg.ID] = msg.Status
+		if msg.ID != "" {
+			slog.Info("docker pull: " + msg.ID + ": " + msg.Status)
+		} else {
+			slog.Info("docker pull: " + msg.Status)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("docker: image pull timed out after %s (raise docker.build_timeout): %w", timeout, err)
+		}
+		return fmt.Errorf("docker: failed to read pull output: %w", err)
+	}
+	if pullErr != "" {
+		return fmt.Errorf("docker: image pull failed: %s", pullErr)
+	}
+	return nil
+}
+
+// buildHash identifies the inputs of an image build: the embedded build
+// assets, the system prompt and the extra packages.
+func buildHash(extraPackages []string, systemPrompt string) string {
+	h := sha256.New()
+	for _, part := range []string{
+		assets.DefaultDockerfile,
+		assets.DefaultEntrypoint,
+		systemPrompt,
+		strings.Join(extraPackages, " "),
+	} {
+		_, _ = io.WriteString(h, part)
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// InvalidateBuildCache removes the stored build hash so the next BuildImage
+// rebuilds the image even if its inputs are unchanged.
+func InvalidateBuildCache(projectDir string) error {
+	path := filepath.Join(projectDir, constants.DockerDir, buildHashFile)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("docker: failed to remove build hash: %w", err)
+	}
 	return nil
 }
 
@@ -195,12 +477,16 @@ func (c *Client) StartAgent(ctx context.Context, opts AgentOpts) (string, error)
 		return "", fmt.Errorf("docker: failed to resolve upstream path: %w", err)
 	}
 
-	agentPromptAbs, err := filepath.Abs(filepath.Join(opts.ProjectDir, constants.AgentPromptFile))
+	promptFile := opts.PromptFile
+	if promptFile == "" {
+		promptFile = AgentPromptPath(opts.ProjectDir, opts.Role)
+	}
+	agentPromptAbs, err := filepath.Abs(promptFile)
 	if err != nil {
 		return "", fmt.Errorf("docker: failed to resolve agent prompt path: %w", err)
 	}
 	if _, err := os.Stat(agentPromptAbs); os.IsNotExist(err) {
-		return "", fmt.Errorf("docker: %s not found in project directory (run 'metamorph init' first)", constants.AgentPromptFile)
+		return "", fmt.Errorf("docker: %s not found in project directory (run 'metamorph init' first)", filepath.Base(promptFile))
 	}
 
 	logDir := filepath.Join(opts.ProjectDir, constants.AgentLogDir, fmt.Sprintf("agent-%d", opts.AgentID))
@@ -228,15 +514,52 @@ func (c *Client) StartAgent(ctx context.Context, opts AgentOpts) (string, error)
 	if opts.GitAuthorEmail != "" {
 		env = append(env, "GIT_AUTHOR_EMAIL="+opts.GitAuthorEmail)
 	}
+	if opts.Branch != "" {
+		env = append(env, "AGENT_BRANCH="+opts.Branch)
+	}
+	if opts.CloneDepth > 0 {
+		env = append(env, "CLONE_DEPTH="+strconv.Itoa(opts.CloneDepth))
+	}
+	if opts.TaskLockDir != "" {
+		env = append(env, "TASK_LOCK_DIR="+opts.TaskLockDir)
+	}
+	if opts.SignCommits {
+		env = append(env, "GIT_SIGN_COMMITS=true")
+		if opts.SigningKey != "" {
+			env = append(env, "GIT_SIGNING_KEY="+opts.SigningKey)
+		}
+	}
+	var cacheMount *mount.Mount
+	if opts.CacheVolume != "" {
+		m, err := cacheVolumeMount(opts.ProjectDir, opts.CacheVolume)
+		if err != nil {
+			return "", err
+		}
+		cacheMount = &m
+		env = append(env, cacheEnv...)
+	}
 
+	imageRef := opts.Image
+	if imageRef == "" {
+		imageRef = config.DefaultImage
+	}
 	config := &container.Config{
-		Image: defaultImageTag,
+		Image: imageRef,
 		Env:   env,
+		Cmd:   opts.Command,
 		Labels: map[string]string{
 			labelProject: c.projectName,
 			labelAgentID: agentIDStr,
+			labelRole:    opts.Role,
+			labelModel:   opts.Model,
 		},
 	}
+	if len(opts.Command) > 0 {
+		// The image's HEALTHCHECK watches the session logs the built-in loop
+		// writes; a custom command may never write them and would be
+		// restarted as unhealthy.
+		config.Healthcheck = &container.HealthConfig{Test: []string{"NONE"}}
+	}
 
 	hostConfig := &container.HostConfig{
 		Mounts: []mount.Mount{
@@ -257,10 +580,22 @@ func (c *Client) StartAgent(ctx context.Context, opts AgentOpts) (string, error)
 				ReadOnly: true,
 			},
 		},
-		RestartPolicy: container.RestartPolicy{
-			Name: container.RestartPolicyUnlessStopped,
+		RestartPolicy: restartPolicy(opts.RestartPolicy),
+		Resources: container.Resources{
+			DeviceRequests: gpuRequests(opts.GPUs),
 		},
 	}
+	if cacheMount != nil {
+		hostConfig.Mounts = append(hostConfig.Mounts, *cacheMount)
+	}
+	if opts.SignCommits && opts.GPGHome != "" {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   opts.GPGHome,
+			Target:   gpgHostDir,
+			ReadOnly: true,
+		})
+	}
 
 	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, containerName)
 	if err != nil {
@@ -274,6 +609,85 @@ func (c *Client) StartAgent(ctx context.Context, opts AgentOpts) (string, error)
 	return resp.ID, nil
 }
 
+// AgentPromptPath returns the prompt for agents with the given role:
+// AGENT_PROMPT.<role>.md if it exists in projectDir, otherwise the shared
+// AGENT_PROMPT.md.
+func AgentPromptPath(projectDir, role string) string {
+	if role != "" {
+		rolePrompt := filepath.Join(projectDir, fmt.Sprintf(constants.RolePromptFile, role))
+		if _, err := os.Stat(rolePrompt); err == nil {
+			return rolePrompt
+		}
+	}
+	return filepath.Join(projectDir, constants.AgentPromptFile)
+}
+
+// restartPolicy maps a docker.restart_policy config value to a container
+// restart policy. Anything unrecognised falls back to unless-stopped.
+func restartPolicy(name string) container.RestartPolicy {
+	switch name {
+	case "no":
+		return container.RestartPolicy{Name: container.RestartPolicyDisabled}
+	case "on-failure":
+		return container.RestartPolicy{Name: container.RestartPolicyOnFailure}
+	default:
+		return container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}
+	}
+}
+
+// cacheEnv points the common package managers at cacheDir. Their caches are
+// safe to share between concurrently running agents: Go and pip lock cache
+// entries, and npm's cache is content-addressed with atomic writes.
+var cacheEnv = []string{
+	"XDG_CACHE_HOME=" + cacheDir, // Go build cache, pip, and most other tools
+	"GOMODCACHE=" + cacheDir + "/go-mod",
+	"npm_config_cache=" + cacheDir + "/npm",
+}
+
+// cacheVolumeMount returns the mount for a docker.cache_volume value. Values
+// that look like paths are bind-mounted (relative to projectDir); anything
+// else is a named volume, which Docker creates on first use.
+func cacheVolumeMount(projectDir, volume string) (mount.Mount, error) {
+	if !strings.ContainsAny(volume, `/\`) && !strings.HasPrefix(volume, ".") {
+		return mount.Mount{Type: mount.TypeVolume, Source: volume, Target: cacheDir}, nil
+	}
+
+	path := volume
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return mount.Mount{}, fmt.Errorf("docker: failed to resolve cache volume path: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return mount.Mount{}, fmt.Errorf("docker: failed to create cache dir: %w", err)
+	}
+	return mount.Mount{Type: mount.TypeBind, Source: abs, Target: cacheDir}, nil
+}
+
+// gpuRequests maps a docker.gpus config value to the device requests that
+// `docker run --gpus` would send for the NVIDIA runtime. Empty or invalid
+// values request no GPUs.
+func gpuRequests(gpus string) []container.DeviceRequest {
+	count := -1 // all GPUs
+	if gpus == "" {
+		return nil
+	}
+	if gpus != "all" {
+		n, err := strconv.Atoi(gpus)
+		if err != nil || n <= 0 {
+			return nil
+		}
+		count = n
+	}
+	return []container.DeviceRequest{{
+		Driver:       "nvidia",
+		Count:        count,
+		Capabilities: [][]string{{"gpu"}},
+	}}
+}
+
 // StopAgent stops and removes the container for the given agent.
 func (c *Client) StopAgent(ctx context.Context, agentID int) error {
 	ctx, cancel := context.WithTimeout(ctx, startStopTimeout)
@@ -342,6 +756,39 @@ func (c *Client) StopAllAgents(ctx context.Context) error {
 	return nil
 }
 
+// PauseAgent freezes all processes in the agent's container without
+// stopping it.
+func (c *Client) PauseAgent(ctx context.Context, agentID int) error {
+	ctx, cancel := context.WithTimeout(ctx, startStopTimeout)
+	defer cancel()
+
+	containerID, err := c.findContainer(ctx, agentID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.cli.ContainerPause(ctx, containerID); err != nil {
+		return fmt.Errorf("docker: failed to pause agent-%d: %w", agentID, err)
+	}
+	return nil
+}
+
+// UnpauseAgent resumes a container previously paused with PauseAgent.
+func (c *Client) UnpauseAgent(ctx context.Context, agentID int) error {
+	ctx, cancel := context.WithTimeout(ctx, startStopTimeout)
+	defer cancel()
+
+	containerID, err := c.findContainer(ctx, agentID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.cli.ContainerUnpause(ctx, containerID); err != nil {
+		return fmt.Errorf("docker: failed to unpause agent-%d: %w", agentID, err)
+	}
+	return nil
+}
+
 // ListAgents returns info about all running agent containers for this project.
 func (c *Client) ListAgents(ctx context.Context) ([]AgentInfo, error) {
 	ctx, cancel := context.WithTimeout(ctx, listTimeout)
@@ -355,27 +802,176 @@ func (c *Client) ListAgents(ctx context.Context) ([]AgentInfo, error) {
 	var agents []AgentInfo
 	for _, ctr := range containers {
 		agentID, _ := strconv.Atoi(ctr.Labels[labelAgentID])
-
-		info, err := c.cli.ContainerInspect(ctx, ctr.ID)
-		if err != nil {
-			return nil, fmt.Errorf("docker: failed to inspect container %s: %w", ctr.ID[:12], err)
-		}
-
-		role := envValue(info.Config.Env, "AGENT_ROLE")
-		startedAt, _ := time.Parse(time.RFC3339Nano, info.State.StartedAt)
-
-		agents = append(agents, AgentInfo{
+		agent := AgentInfo{
 			ID:          agentID,
 			ContainerID: ctr.ID,
-			Role:        role,
+			Role:        ctr.Labels[labelRole],
+			Model:       ctr.Labels[labelModel],
 			Status:      ctr.Status,
-			StartedAt:   startedAt,
-		})
+			Health:      statusHealth(ctr.Status),
+		}
+		if ctr.Created > 0 {
+			agent.StartedAt = time.Unix(ctr.Created, 0).UTC()
+		}
+
+		// Containers started before the role and model labels existed only
+		// carry them in the environment, so inspect those. The creation time
+		// is stale once a container is restarted in place, so also inspect
+		// containers whose uptime is shorter than their age.
+		if agent.Role == "" || agent.Model == "" || restartedInPlace(ctr.Status, agent.StartedAt, time.Now()) {
+			info, err := c.cli.ContainerInspect(ctx, ctr.ID)
+			if err != nil {
+				return nil, fmt.Errorf("docker: failed to inspect container %s: %w", ctr.ID[:12], err)
+			}
+			if info.Config != nil {
+				if agent.Role == "" {
+					agent.Role = envValue(info.Config.Env, "AGENT_ROLE")
+				}
+				if agent.Model == "" {
+					agent.Model = envValue(info.Config.Env, "AGENT_MODEL")
+				}
+			}
+			if info.ContainerJSONBase != nil && info.State != nil {
+				if startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil {
+					agent.StartedAt = startedAt
+				}
+				if info.State.Health != nil {
+					agent.Health = info.State.Health.Status
+				}
+			}
+		}
+
+		agents = append(agents, agent)
 	}
 
 	return agents, nil
 }
 
+// restartSlack absorbs clock differences between the host and the Docker
+// daemon when comparing a container's uptime with its age.
+const restartSlack = time.Minute
+
+// restartedInPlace reports whether a running container's list status, such
+// as "Up 2 minutes (healthy)", shows less uptime than the time since it was
+// created, meaning it has been restarted since.
+func restartedInPlace(status string, created, now time.Time) bool {
+	uptime, ok := statusUptime(status)
+	if !ok || created.IsZero() {
+		return false
+	}
+	return now.Sub(created) > uptime+restartSlack
+}
+
+// statusUptime returns an upper bound on the uptime in a running container's
+// list status. Docker rounds the uptime down to a whole unit ("3 hours"), so
+// the bound is one unit more.
+func statusUptime(status string) (time.Duration, bool) {
+	rest, ok := strings.CutPrefix(status, "Up ")
+	if !ok {
+		return 0, false
+	}
+	if i := strings.Index(rest, " ("); i >= 0 {
+		rest = rest[:i]
+	}
+	switch rest {
+	case "Less than a second":
+		return time.Second, true
+	case "About a minute":
+		return 2 * time.Minute, true
+	case "About an hour":
+		return 2 * time.Hour, true
+	}
+
+	count, unit, ok := strings.Cut(rest, " ")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil {
+		return 0, false
+	}
+	units := map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+		"month":  30 * 24 * time.Hour,
+		"year":   365 * 24 * time.Hour,
+	}
+	d, ok := units[strings.TrimSuffix(unit, "s")]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n+1) * d, true
+}
+
+// statusHealth extracts the health check state from a container list status
+// such as "Up 2 hours (unhealthy)" or "Up 5 seconds (health: starting)".
+func statusHealth(status string) string {
+	switch {
+	case strings.HasSuffix(status, "(healthy)"):
+		return "healthy"
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.HasSuffix(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
+
+// Stats samples CPU and memory usage of the agent's container. Docker takes
+// two readings about a second apart to compute the CPU percentage.
+func (c *Client) Stats(ctx context.Context, agentID int) (AgentStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	containerID, err := c.findContainer(ctx, agentID)
+	if err != nil {
+		return AgentStats{}, err
+	}
+
+	resp, err := c.cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return AgentStats{}, fmt.Errorf("docker: failed to get stats for agent-%d: %w", agentID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var raw container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return AgentStats{}, fmt.Errorf("docker: failed to decode stats for agent-%d: %w", agentID, err)
+	}
+	return parseStats(raw), nil
+}
+
+// parseStats converts a Docker stats sample into AgentStats, using the same
+// formulas as `docker stats`.
+func parseStats(raw container.StatsResponse) AgentStats {
+	var stats AgentStats
+
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// Page cache is reclaimable, so it is not counted as usage: cgroup v1
+	// reports it as total_inactive_file, cgroup v2 as inactive_file.
+	mem := raw.MemoryStats.Usage
+	cache, ok := raw.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		cache = raw.MemoryStats.Stats["inactive_file"]
+	}
+	if cache < mem {
+		mem -= cache
+	}
+	stats.MemoryBytes = mem
+	stats.MemoryLimit = raw.MemoryStats.Limit
+
+	return stats
+}
+
 // GetLogs returns a log stream from the agent's container.
 func (c *Client) GetLogs(ctx context.Context, agentID int, tail int, follow bool) (io.ReadCloser, error) {
 	containerID, err := c.findContainer(ctx, agentID)
@@ -410,6 +1006,65 @@ func (c *Client) GetLogs(ctx context.Context, agentID int, tail int, follow bool
 	return pr, nil
 }
 
+// ExecInteractive runs a command inside the agent's container with stdin,
+// stdout and stderr attached, and returns the command's exit code.
+func (c *Client) ExecInteractive(ctx context.Context, agentID int, opts ExecOpts) (int, error) {
+	containerID, err := c.findContainer(ctx, agentID)
+	if err != nil {
+		return 0, err
+	}
+
+	execResp, err := c.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          opts.Cmd,
+		Tty:          opts.Tty,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   "/workspace",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("docker: failed to create exec for agent-%d: %w", agentID, err)
+	}
+
+	hijacked, err := c.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{Tty: opts.Tty})
+	if err != nil {
+		return 0, fmt.Errorf("docker: failed to attach to exec for agent-%d: %w", agentID, err)
+	}
+	defer hijacked.Close()
+
+	if opts.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(hijacked.Conn, opts.Stdin)
+			_ = hijacked.CloseWrite()
+		}()
+	}
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = stdout
+	}
+
+	// Without a TTY, Docker multiplexes stdout/stderr with frame headers.
+	if opts.Tty {
+		_, err = io.Copy(stdout, hijacked.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+	}
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("docker: failed to read exec output for agent-%d: %w", agentID, err)
+	}
+
+	inspect, err := c.cli.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return 0, fmt.Errorf("docker: failed to inspect exec for agent-%d: %w", agentID, err)
+	}
+
+	return inspect.ExitCode, nil
+}
+
 // findContainer locates a single container by agent ID within this project.
 func (c *Client) findContainer(ctx context.Context, agentID int) (string, error) {
 	f := filters.NewArgs()
@@ -456,6 +1111,10 @@ func createTarContext(dir string) (io.Reader, error) {
 		if err != nil {
 			return err
 		}
+		// The build hash is bookkeeping, not a build input.
+		if rel == buildHashFile {
+			return nil
+		}
 
 		header, err := tar.FileInfoHeader(info, "")
 		if err != nil {
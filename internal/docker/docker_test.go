@@ -1,13 +1,19 @@
 package docker
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -15,8 +21,14 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	dockerclient "github.com/docker/docker/client"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/robmorgan/metamorph/internal/config"
 )
 
 // dockerFrame creates a Docker multiplexed log frame (stdout stream type).
@@ -35,27 +47,45 @@ func dockerFrame(payload string) []byte {
 type mockDocker struct {
 	mu sync.Mutex // protects tracked call slices for concurrent use
 
-	pingErr     error
-	buildErr    error
-	buildBody   string
-	createResp  container.CreateResponse
-	createErr   error
-	startErr    error
-	stopErr     error
-	removeErr   error
-	listResult  []types.Container
-	listErr     error
-	inspectResp types.ContainerJSON
-	inspectErr  error
-	logsBody    string
-	logsErr     error
+	pingErr       error
+	buildErr      error
+	buildBody     string
+	buildBlock    bool              // ImageBuild blocks until its context is done
+	imageErr      error             // returned by ImageInspect; nil means the image exists
+	imageLabels   map[string]string // ImageInspect labels; the last build's labels when nil
+	pullBody      string
+	pullErr       error
+	createResp    container.CreateResponse
+	createErr     error
+	startErr      error
+	stopErr       error
+	removeErr     error
+	listResult    []types.Container
+	listErr       error
+	inspectResp   types.ContainerJSON
+	inspectErr    error
+	logsBody      string
+	logsErr       error
+	statsBody     string
+	statsErr      error
+	pauseErr      error
+	execCreateErr error
+	execOutput    string
+	execExitCode  int
 
 	// Track calls for assertions.
 	buildOptions types.ImageBuildOptions
+	builds       int
+	pulled       []string
+	pullOptions  image.PullOptions
 	created      []mockCreateCall
 	started      []string
 	stopped      []string
 	removed      []string
+	paused       []string
+	unpaused     []string
+	inspected    []string
+	execOptions  container.ExecOptions
 }
 
 type mockCreateCall struct {
@@ -70,6 +100,11 @@ func (m *mockDocker) Ping(ctx context.Context) (types.Ping, error) {
 
 func (m *mockDocker) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
 	m.buildOptions = options
+	m.builds++
+	if m.buildBlock {
+		<-ctx.Done()
+		return types.ImageBuildResponse{}, ctx.Err()
+	}
 	if m.buildErr != nil {
 		return types.ImageBuildResponse{}, m.buildErr
 	}
@@ -77,6 +112,23 @@ func (m *mockDocker) ImageBuild(ctx context.Context, buildContext io.Reader, opt
 	return types.ImageBuildResponse{Body: body}, nil
 }
 
+func (m *mockDocker) ImageInspect(ctx context.Context, imageID string, inspectOpts ...dockerclient.ImageInspectOption) (image.InspectResponse, error) {
+	labels := m.imageLabels
+	if labels == nil {
+		labels = m.buildOptions.Labels
+	}
+	return image.InspectResponse{Config: &container.Config{Labels: labels}}, m.imageErr
+}
+
+func (m *mockDocker) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error) {
+	m.pulled = append(m.pulled, refStr)
+	m.pullOptions = options
+	if m.pullErr != nil {
+		return nil, m.pullErr
+	}
+	return io.NopCloser(strings.NewReader(m.pullBody)), nil
+}
+
 func (m *mockDocker) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
 	m.created = append(m.created, mockCreateCall{Name: containerName, Config: config, Host: hostConfig})
 	return m.createResp, m.createErr
@@ -101,11 +153,22 @@ func (m *mockDocker) ContainerRemove(ctx context.Context, containerID string, op
 	return m.removeErr
 }
 
+func (m *mockDocker) ContainerPause(ctx context.Context, containerID string) error {
+	m.paused = append(m.paused, containerID)
+	return m.pauseErr
+}
+
+func (m *mockDocker) ContainerUnpause(ctx context.Context, containerID string) error {
+	m.unpaused = append(m.unpaused, containerID)
+	return m.pauseErr
+}
+
 func (m *mockDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
 	return m.listResult, m.listErr
 }
 
 func (m *mockDocker) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	m.inspected = append(m.inspected, containerID)
 	return m.inspectResp, m.inspectErr
 }
 
@@ -116,6 +179,59 @@ func (m *mockDocker) ContainerLogs(ctx context.Context, ctr string, options cont
 	return io.NopCloser(strings.NewReader(m.logsBody)), nil
 }
 
+func (m *mockDocker) ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	if m.statsErr != nil {
+		return container.StatsResponseReader{}, m.statsErr
+	}
+	return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader(m.statsBody))}, nil
+}
+
+func (m *mockDocker) ContainerExecCreate(ctx context.Context, ctr string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	m.execOptions = options
+	if m.execCreateErr != nil {
+		return container.ExecCreateResponse{}, m.execCreateErr
+	}
+	return container.ExecCreateResponse{ID: "exec-1"}, nil
+}
+
+func (m *mockDocker) ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error) {
+	client, server := net.Pipe()
+	go func() {
+		// Drain stdin written by the caller until the client side closes.
+		_, _ = io.Copy(io.Discard, server)
+	}()
+	return types.HijackedResponse{Conn: client, Reader: bufio.NewReader(strings.NewReader(m.execOutput))}, nil
+}
+
+func (m *mockDocker) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	return container.ExecInspect{ExecID: execID, ExitCode: m.execExitCode}, nil
+}
+
+func TestClientOpts(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://from-env:2375")
+
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"falls back to DOCKER_HOST", "", "tcp://from-env:2375"},
+		{"configured host wins", "tcp://remote-box:2376", "tcp://remote-box:2376"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, err := dockerclient.NewClientWithOpts(clientOpts(tt.host)...)
+			if err != nil {
+				t.Fatalf("NewClientWithOpts: %v", err)
+			}
+			defer func() { _ = cli.Close() }()
+			if got := cli.DaemonHost(); got != tt.want {
+				t.Errorf("DaemonHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestBuildImage(t *testing.T) {
 	t.Run("writes embedded assets and calls build", func(t *testing.T) {
 		projectDir := t.TempDir()
@@ -123,7 +239,7 @@ func TestBuildImage(t *testing.T) {
 		mock := &mockDocker{buildBody: `{"stream":"Successfully built abc123"}`}
 		c := newClientWithAPI("test-project", mock)
 
-		if err := c.BuildImage(projectDir, nil); err != nil {
+		if err := c.BuildImage(projectDir, nil, "", 0); err != nil {
 			t.Fatalf("BuildImage: %v", err)
 		}
 
@@ -141,13 +257,38 @@ func TestBuildImage(t *testing.T) {
 		}
 	})
 
+	t.Run("uses system prompt override", func(t *testing.T) {
+		projectDir := t.TempDir()
+		mock := &mockDocker{buildBody: `{"stream":"Successfully built abc123"}`}
+		c := newClientWithAPI("test-project", mock)
+
+		if err := c.BuildImage(projectDir, nil, "Custom instructions.\n", 0); err != nil {
+			t.Fatalf("BuildImage: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(projectDir, ".metamorph", "docker", "SYSTEM_PROMPT.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "Custom instructions.\n" {
+			t.Errorf("SYSTEM_PROMPT.md = %q, want the override", data)
+		}
+
+		// Switching back to the built-in prompt invalidates the build hash.
+		if err := c.BuildImage(projectDir, nil, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		if mock.builds != 2 {
+			t.Errorf("builds = %d, want rebuild after system prompt change", mock.builds)
+		}
+	})
+
 	t.Run("returns error when build fails", func(t *testing.T) {
 		projectDir := t.TempDir()
 
 		mock := &mockDocker{buildErr: fmt.Errorf("build failed")}
 		c := newClientWithAPI("test-project", mock)
 
-		err := c.BuildImage(projectDir, nil)
+		err := c.BuildImage(projectDir, nil, "", 0)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -156,13 +297,109 @@ func TestBuildImage(t *testing.T) {
 		}
 	})
 
+	t.Run("times out after the build timeout", func(t *testing.T) {
+		mock := &mockDocker{buildBlock: true}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.BuildImage(t.TempDir(), nil, "", 10*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "timed out after 10ms (raise docker.build_timeout)") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("logs build steps and keeps error detection", func(t *testing.T) {
+		var logs bytes.Buffer
+		oldLogger := slog.Default()
+		slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+		defer slog.SetDefault(oldLogger)
+
+		mock := &mockDocker{buildBody: `{"stream":"Step 1/2 : FROM ubuntu:24.04\n"}
+{"stream":"\n"}
+{"stream":" ---> abc123\n"}
+{"errorDetail":{"message":"apt failed"},"error":"apt failed"}`}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.BuildImage(t.TempDir(), nil, "", 0)
+		if err == nil || !strings.Contains(err.Error(), "image build failed: apt failed") {
+			t.Errorf("expected build failure, got %v", err)
+		}
+
+		out := logs.String()
+		for _, want := range []string{`msg="docker build: Step 1/2 : FROM ubuntu:24.04"`, `msg="docker build: ---> abc123"`} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %s in log output, got:\n%s", want, out)
+			}
+		}
+		if strings.Count(out, "docker build:") != 2 {
+			t.Errorf("expected blank stream lines to be skipped, got:\n%s", out)
+		}
+	})
+
+	t.Run("skips rebuild when inputs are unchanged", func(t *testing.T) {
+		projectDir := t.TempDir()
+		mock := &mockDocker{buildBody: `{"stream":"Successfully built abc123"}`}
+		c := newClientWithAPI("test-project", mock)
+
+		for i := 0; i < 2; i++ {
+			if err := c.BuildImage(projectDir, []string{"vim"}, "", 0); err != nil {
+				t.Fatalf("BuildImage #%d: %v", i+1, err)
+			}
+		}
+		if mock.builds != 1 {
+			t.Fatalf("builds = %d, want second call skipped", mock.builds)
+		}
+
+		// Changed extra packages invalidate the hash.
+		if err := c.BuildImage(projectDir, []string{"vim", "htop"}, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		if mock.builds != 2 {
+			t.Errorf("builds = %d, want rebuild after extra_packages change", mock.builds)
+		}
+
+		// A missing image forces a rebuild.
+		mock.imageErr = fmt.Errorf("no such image")
+		if err := c.BuildImage(projectDir, []string{"vim", "htop"}, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		if mock.builds != 3 {
+			t.Errorf("builds = %d, want rebuild when image is missing", mock.builds)
+		}
+
+		// Another project rebuilding the shared tag with other inputs forces
+		// a rebuild.
+		mock.imageErr = nil
+		mock.imageLabels = map[string]string{labelBuildHash: "other-project"}
+		if err := c.BuildImage(projectDir, []string{"vim", "htop"}, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		if mock.builds != 4 {
+			t.Errorf("builds = %d, want rebuild when the image has another build hash", mock.builds)
+		}
+		mock.imageLabels = nil
+
+		// InvalidateBuildCache forces a rebuild.
+		if err := InvalidateBuildCache(projectDir); err != nil {
+			t.Fatalf("InvalidateBuildCache: %v", err)
+		}
+		if err := c.BuildImage(projectDir, []string{"vim", "htop"}, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		if mock.builds != 5 {
+			t.Errorf("builds = %d, want rebuild after InvalidateBuildCache", mock.builds)
+		}
+	})
+
 	t.Run("passes extra packages as build arg", func(t *testing.T) {
 		projectDir := t.TempDir()
 
 		mock := &mockDocker{buildBody: `{"stream":"Successfully built abc123"}`}
 		c := newClientWithAPI("test-project", mock)
 
-		if err := c.BuildImage(projectDir, []string{"vim", "htop"}); err != nil {
+		if err := c.BuildImage(projectDir, []string{"vim", "htop"}, "", 0); err != nil {
 			t.Fatalf("BuildImage: %v", err)
 		}
 
@@ -181,7 +418,7 @@ func TestBuildImage(t *testing.T) {
 		mock := &mockDocker{buildBody: `{"stream":"Successfully built abc123"}`}
 		c := newClientWithAPI("test-project", mock)
 
-		if err := c.BuildImage(projectDir, nil); err != nil {
+		if err := c.BuildImage(projectDir, nil, "", 0); err != nil {
 			t.Fatalf("BuildImage: %v", err)
 		}
 
@@ -191,6 +428,188 @@ func TestBuildImage(t *testing.T) {
 	})
 }
 
+func TestPullImage(t *testing.T) {
+	t.Run("pulls the image and reads progress", func(t *testing.T) {
+		mock := &mockDocker{pullBody: `{"status":"Pulling from acme/agent","id":"1.2"}
+{"status":"Downloading","progressDetail":{"current":1,"total":2},"id":"abc"}
+{"status":"Downloading","progressDetail":{"current":2,"total":2},"id":"abc"}
+{"status":"Pull complete","id":"abc"}
+{"status":"Status: Downloaded newer image for ghcr.io/acme/agent:1.2"}`}
+		c := newClientWithAPI("test-project", mock)
+
+		if err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{}, 0); err != nil {
+			t.Fatalf("PullImage: %v", err)
+		}
+		if len(mock.pulled) != 1 || mock.pulled[0] != "ghcr.io/acme/agent:1.2" {
+			t.Errorf("pulled = %q, want the requested ref", mock.pulled)
+		}
+		if mock.builds != 0 {
+			t.Errorf("builds = %d, want 0", mock.builds)
+		}
+	})
+
+	t.Run("request error", func(t *testing.T) {
+		mock := &mockDocker{pullErr: errors.New("unauthorized")}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{}, 0)
+		if err == nil || !strings.Contains(err.Error(), "failed to pull image ghcr.io/acme/agent:1.2") {
+			t.Errorf("PullImage = %v, want a pull error naming the image", err)
+		}
+	})
+
+	t.Run("error in the progress stream", func(t *testing.T) {
+		mock := &mockDocker{pullBody: `{"status":"Pulling from acme/agent","id":"1.2"}
+{"error":"manifest for ghcr.io/acme/agent:1.2 not found"}`}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{}, 0)
+		if err == nil || !strings.Contains(err.Error(), "manifest for ghcr.io/acme/agent:1.2 not found") {
+			t.Errorf("PullImage = %v, want the stream error", err)
+		}
+	})
+
+	t.Run("anonymous pull sends no auth", func(t *testing.T) {
+		mock := &mockDocker{}
+		c := newClientWithAPI("test-project", mock)
+
+		if err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{}, 0); err != nil {
+			t.Fatalf("PullImage: %v", err)
+		}
+		if mock.pullOptions.RegistryAuth != "" {
+			t.Errorf("RegistryAuth = %q, want empty", mock.pullOptions.RegistryAuth)
+		}
+	})
+
+	t.Run("passes username and password", func(t *testing.T) {
+		mock := &mockDocker{pullErr: errors.New("denied")}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{Username: "bot", Password: "s3cret"}, 0)
+		if err == nil {
+			t.Fatal("expected the mock's pull error")
+		}
+		if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("error %q leaks the password", err)
+		}
+
+		auth, decodeErr := registry.DecodeAuthConfig(mock.pullOptions.RegistryAuth)
+		if decodeErr != nil {
+			t.Fatalf("DecodeAuthConfig: %v", decodeErr)
+		}
+		if auth.Username != "bot" || auth.Password != "s3cret" || auth.ServerAddress != "ghcr.io" {
+			t.Errorf("auth = %+v, want bot/s3cret for ghcr.io", auth)
+		}
+	})
+
+	t.Run("asks the credential helper", func(t *testing.T) {
+		bin := t.TempDir()
+		// The helper echoes the server it was asked about as the username.
+		helper := `#!/bin/sh
+[ "$1" = get ] || exit 1
+server=$(cat)
+printf '{"ServerURL":"%s","Username":"%s","Secret":"tok"}' "$server" "$server"
+`
+		if err := os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		mock := &mockDocker{}
+		c := newClientWithAPI("test-project", mock)
+
+		if err := c.PullImage("registry.example.com:5000/agent:1.2", RegistryAuth{CredentialHelper: "fake"}, 0); err != nil {
+			t.Fatalf("PullImage: %v", err)
+		}
+		auth, err := registry.DecodeAuthConfig(mock.pullOptions.RegistryAuth)
+		if err != nil {
+			t.Fatalf("DecodeAuthConfig: %v", err)
+		}
+		if auth.Username != "registry.example.com:5000" || auth.Password != "tok" || auth.ServerAddress != "registry.example.com:5000" {
+			t.Errorf("auth = %+v, want the helper's credentials for registry.example.com:5000", auth)
+		}
+	})
+
+	t.Run("credential helper failure stops the pull", func(t *testing.T) {
+		bin := t.TempDir()
+		helper := "#!/bin/sh\necho 'credentials not found in native keychain'\nexit 1\n"
+		if err := os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		mock := &mockDocker{}
+		c := newClientWithAPI("test-project", mock)
+
+		err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{CredentialHelper: "fake"}, 0)
+		if err == nil || !strings.Contains(err.Error(), "credentials not found in native keychain") {
+			t.Errorf("PullImage = %v, want the helper's message", err)
+		}
+		if len(mock.pulled) != 0 {
+			t.Errorf("pulled = %q after a helper failure", mock.pulled)
+		}
+	})
+
+	t.Run("credential helper is killed at the timeout", func(t *testing.T) {
+		bin := t.TempDir()
+		helper := "#!/bin/sh\nexec sleep 60\n"
+		if err := os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		mock := &mockDocker{}
+		c := newClientWithAPI("test-project", mock)
+
+		start := time.Now()
+		err := c.PullImage("ghcr.io/acme/agent:1.2", RegistryAuth{CredentialHelper: "fake"}, 200*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("PullImage = %v, want a deadline error", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("PullImage took %s, want the helper stopped at the timeout", elapsed)
+		}
+		if len(mock.pulled) != 0 {
+			t.Errorf("pulled = %q after a helper timeout", mock.pulled)
+		}
+	})
+
+	t.Run("containers run the pulled image", func(t *testing.T) {
+		projectDir := t.TempDir()
+		_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+		_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+
+		mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+		c := newClientWithAPI("test-project", mock)
+
+		opts := AgentOpts{ProjectDir: projectDir, AgentID: 1, Image: "ghcr.io/acme/agent:1.2"}
+		if _, err := c.StartAgent(context.Background(), opts); err != nil {
+			t.Fatalf("StartAgent: %v", err)
+		}
+		if got := mock.created[0].Config.Image; got != "ghcr.io/acme/agent:1.2" {
+			t.Errorf("image = %q, want the pulled image", got)
+		}
+	})
+}
+
+func TestRegistryServer(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "ghcr.io/acme/agent:1.2", want: "ghcr.io"},
+		{ref: "registry.example.com:5000/agent", want: "registry.example.com:5000"},
+		{ref: "localhost/agent:dev", want: "localhost"},
+		{ref: "acme/agent:1.2", want: dockerHubServer},
+		{ref: "agent", want: dockerHubServer},
+	}
+	for _, tt := range tests {
+		if got := registryServer(tt.ref); got != tt.want {
+			t.Errorf("registryServer(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
 func TestStartAgent(t *testing.T) {
 	t.Run("creates and starts container with correct config", func(t *testing.T) {
 		projectDir := t.TempDir()
@@ -235,6 +654,12 @@ func TestStartAgent(t *testing.T) {
 		if call.Config.Labels[labelAgentID] != "1" {
 			t.Errorf("agent-id label = %q", call.Config.Labels[labelAgentID])
 		}
+		if call.Config.Labels[labelRole] != "developer" {
+			t.Errorf("role label = %q", call.Config.Labels[labelRole])
+		}
+		if call.Config.Labels[labelModel] != "claude-sonnet" {
+			t.Errorf("model label = %q", call.Config.Labels[labelModel])
+		}
 
 		// Verify environment.
 		envMap := map[string]string{}
@@ -286,6 +711,173 @@ func TestStartAgent(t *testing.T) {
 		}
 	})
 
+	t.Run("applies configured restart policy", func(t *testing.T) {
+		tests := []struct {
+			policy string
+			want   container.RestartPolicyMode
+		}{
+			{"no", container.RestartPolicyDisabled},
+			{"on-failure", container.RestartPolicyOnFailure},
+			{"unless-stopped", container.RestartPolicyUnlessStopped},
+			{"", container.RestartPolicyUnlessStopped},
+		}
+		for _, tt := range tests {
+			projectDir := t.TempDir()
+			_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+			_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+
+			mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+			c := newClientWithAPI("proj", mock)
+
+			if _, err := c.StartAgent(context.Background(), AgentOpts{ProjectDir: projectDir, AgentID: 1, RestartPolicy: tt.policy}); err != nil {
+				t.Fatalf("StartAgent(%q): %v", tt.policy, err)
+			}
+			if got := mock.created[0].Host.RestartPolicy.Name; got != tt.want {
+				t.Errorf("restart_policy %q: HostConfig restart policy = %q, want %q", tt.policy, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("requests GPUs when configured", func(t *testing.T) {
+		tests := []struct {
+			gpus      string
+			wantCount int // -1 = all; 0 = no device request
+		}{
+			{"", 0},
+			{"all", -1},
+			{"2", 2},
+		}
+		for _, tt := range tests {
+			projectDir := t.TempDir()
+			_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+			_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+
+			mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+			c := newClientWithAPI("proj", mock)
+
+			if _, err := c.StartAgent(context.Background(), AgentOpts{ProjectDir: projectDir, AgentID: 1, GPUs: tt.gpus}); err != nil {
+				t.Fatalf("StartAgent(gpus=%q): %v", tt.gpus, err)
+			}
+			reqs := mock.created[0].Host.DeviceRequests
+			if tt.wantCount == 0 {
+				if len(reqs) != 0 {
+					t.Errorf("gpus %q: DeviceRequests = %+v, want none", tt.gpus, reqs)
+				}
+				continue
+			}
+			if len(reqs) != 1 {
+				t.Fatalf("gpus %q: DeviceRequests = %+v, want one", tt.gpus, reqs)
+			}
+			req := reqs[0]
+			if req.Driver != "nvidia" || req.Count != tt.wantCount {
+				t.Errorf("gpus %q: driver=%q count=%d, want nvidia/%d", tt.gpus, req.Driver, req.Count, tt.wantCount)
+			}
+			if len(req.Capabilities) != 1 || len(req.Capabilities[0]) != 1 || req.Capabilities[0][0] != "gpu" {
+				t.Errorf("gpus %q: Capabilities = %v, want [[gpu]]", tt.gpus, req.Capabilities)
+			}
+		}
+	})
+
+	t.Run("sets Cmd from the command override", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			command []string
+		}{
+			{"default entrypoint loop", nil},
+			{"override", []string{"bash", "scripts/agent-loop.sh", "--fast"}},
+		}
+		for _, tt := range tests {
+			projectDir := t.TempDir()
+			_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+			_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+
+			mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+			c := newClientWithAPI("proj", mock)
+
+			if _, err := c.StartAgent(context.Background(), AgentOpts{ProjectDir: projectDir, AgentID: 1, Command: tt.command}); err != nil {
+				t.Fatalf("%s: StartAgent: %v", tt.name, err)
+			}
+			cfg := mock.created[0].Config
+			if !slices.Equal(cfg.Cmd, tt.command) {
+				t.Errorf("%s: Cmd = %q, want %q", tt.name, cfg.Cmd, tt.command)
+			}
+			if len(cfg.Entrypoint) != 0 {
+				t.Errorf("%s: Entrypoint = %q, want the image's entrypoint", tt.name, cfg.Entrypoint)
+			}
+			if disabled := cfg.Healthcheck != nil && slices.Equal(cfg.Healthcheck.Test, []string{"NONE"}); disabled != (tt.command != nil) {
+				t.Errorf("%s: Healthcheck = %+v, want it disabled only for an override", tt.name, cfg.Healthcheck)
+			}
+		}
+	})
+
+	t.Run("mounts shared cache volume when configured", func(t *testing.T) {
+		hostCache := t.TempDir()
+		tests := []struct {
+			volume   string
+			wantType mount.Type
+			wantSrc  string
+		}{
+			{"metamorph-cache", mount.TypeVolume, "metamorph-cache"},
+			{hostCache, mount.TypeBind, hostCache},
+		}
+		for _, tt := range tests {
+			projectDir := t.TempDir()
+			_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+			_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+
+			mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+			c := newClientWithAPI("proj", mock)
+
+			if _, err := c.StartAgent(context.Background(), AgentOpts{ProjectDir: projectDir, AgentID: 1, CacheVolume: tt.volume}); err != nil {
+				t.Fatalf("StartAgent(cache_volume=%q): %v", tt.volume, err)
+			}
+			call := mock.created[0]
+
+			var found *mount.Mount
+			for i, m := range call.Host.Mounts {
+				if m.Target == "/workspace/.cache" {
+					found = &call.Host.Mounts[i]
+				}
+			}
+			if found == nil {
+				t.Fatalf("cache_volume %q: no mount at /workspace/.cache in %+v", tt.volume, call.Host.Mounts)
+			}
+			if found.Type != tt.wantType || found.Source != tt.wantSrc {
+				t.Errorf("cache_volume %q: mount = %s %q, want %s %q", tt.volume, found.Type, found.Source, tt.wantType, tt.wantSrc)
+			}
+			if !slices.Contains(call.Config.Env, "GOMODCACHE=/workspace/.cache/go-mod") {
+				t.Errorf("cache_volume %q: expected GOMODCACHE in env %v", tt.volume, call.Config.Env)
+			}
+		}
+	})
+
+	t.Run("passes signing config and GnuPG home when signing", func(t *testing.T) {
+		projectDir := t.TempDir()
+		_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+		_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Prompt\n"), 0644)
+		gpgHome := t.TempDir()
+
+		mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+		c := newClientWithAPI("proj", mock)
+
+		opts := AgentOpts{ProjectDir: projectDir, AgentID: 1, SignCommits: true, SigningKey: "ABCDEF", GPGHome: gpgHome}
+		if _, err := c.StartAgent(context.Background(), opts); err != nil {
+			t.Fatalf("StartAgent: %v", err)
+		}
+		call := mock.created[0]
+
+		for _, want := range []string{"GIT_SIGN_COMMITS=true", "GIT_SIGNING_KEY=ABCDEF"} {
+			if !slices.Contains(call.Config.Env, want) {
+				t.Errorf("expected %s in env %v", want, call.Config.Env)
+			}
+		}
+		if !slices.ContainsFunc(call.Host.Mounts, func(m mount.Mount) bool {
+			return m.Source == gpgHome && m.Target == "/home/agent/.gnupg-host" && m.ReadOnly
+		}) {
+			t.Errorf("expected read-only GnuPG home mount, got %+v", call.Host.Mounts)
+		}
+	})
+
 	t.Run("returns error on create failure", func(t *testing.T) {
 		projectDir := t.TempDir()
 		_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
@@ -358,6 +950,55 @@ func TestStopAgent(t *testing.T) {
 	})
 }
 
+func TestPauseAgent(t *testing.T) {
+	t.Run("pauses and unpauses container", func(t *testing.T) {
+		mock := &mockDocker{
+			listResult: []types.Container{
+				{ID: "cid-123", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+			},
+		}
+		c := newClientWithAPI("proj", mock)
+
+		if err := c.PauseAgent(context.Background(), 1); err != nil {
+			t.Fatalf("PauseAgent: %v", err)
+		}
+		if len(mock.paused) != 1 || mock.paused[0] != "cid-123" {
+			t.Errorf("paused = %v", mock.paused)
+		}
+
+		if err := c.UnpauseAgent(context.Background(), 1); err != nil {
+			t.Fatalf("UnpauseAgent: %v", err)
+		}
+		if len(mock.unpaused) != 1 || mock.unpaused[0] != "cid-123" {
+			t.Errorf("unpaused = %v", mock.unpaused)
+		}
+	})
+
+	t.Run("returns error when not found", func(t *testing.T) {
+		mock := &mockDocker{listResult: []types.Container{}}
+		c := newClientWithAPI("proj", mock)
+
+		if err := c.PauseAgent(context.Background(), 99); err == nil || !strings.Contains(err.Error(), "no container found") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("wraps docker error", func(t *testing.T) {
+		mock := &mockDocker{
+			listResult: []types.Container{
+				{ID: "cid-123", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+			},
+			pauseErr: fmt.Errorf("already paused"),
+		}
+		c := newClientWithAPI("proj", mock)
+
+		err := c.PauseAgent(context.Background(), 1)
+		if err == nil || !strings.Contains(err.Error(), "failed to pause agent-1") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestStopAllAgents(t *testing.T) {
 	t.Run("stops all project containers", func(t *testing.T) {
 		mock := &mockDocker{
@@ -428,6 +1069,9 @@ func TestListAgents(t *testing.T) {
 		if a.Role != "developer" {
 			t.Errorf("Role = %q", a.Role)
 		}
+		if a.Model != "claude-sonnet" {
+			t.Errorf("Model = %q", a.Model)
+		}
 		if a.Status != "Up 2 hours" {
 			t.Errorf("Status = %q", a.Status)
 		}
@@ -436,6 +1080,37 @@ func TestListAgents(t *testing.T) {
 		}
 	})
 
+	t.Run("prefers role and model labels over env", func(t *testing.T) {
+		mock := &mockDocker{
+			listResult: []types.Container{
+				{ID: "cid-111", Labels: map[string]string{
+					labelProject: "proj",
+					labelAgentID: "1",
+					labelRole:    "tester",
+					labelModel:   "claude-opus",
+				}},
+			},
+			inspectResp: types.ContainerJSON{
+				Config: &container.Config{
+					Env: []string{"AGENT_ROLE=developer", "AGENT_MODEL=claude-sonnet"},
+				},
+				ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{}},
+			},
+		}
+		c := newClientWithAPI("proj", mock)
+
+		agents, err := c.ListAgents(context.Background())
+		if err != nil {
+			t.Fatalf("ListAgents: %v", err)
+		}
+		if len(agents) != 1 {
+			t.Fatalf("expected 1 agent, got %d", len(agents))
+		}
+		if agents[0].Role != "tester" || agents[0].Model != "claude-opus" {
+			t.Errorf("Role, Model = %q, %q, want tester, claude-opus", agents[0].Role, agents[0].Model)
+		}
+	})
+
 	t.Run("empty list", func(t *testing.T) {
 		mock := &mockDocker{listResult: []types.Container{}}
 		c := newClientWithAPI("proj", mock)
@@ -450,6 +1125,60 @@ func TestListAgents(t *testing.T) {
 	})
 }
 
+func TestStats(t *testing.T) {
+	agentContainer := []types.Container{
+		{ID: "cid-123", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+	}
+
+	t.Run("parses cpu and memory", func(t *testing.T) {
+		// 200ms of CPU over 1s of system time on 4 CPUs = 80%.
+		body := `{
+			"cpu_stats": {"cpu_usage": {"total_usage": 1200000000}, "system_cpu_usage": 11000000000, "online_cpus": 4},
+			"precpu_stats": {"cpu_usage": {"total_usage": 1000000000}, "system_cpu_usage": 10000000000},
+			"memory_stats": {"usage": 314572800, "limit": 2147483648, "stats": {"inactive_file": 104857600}}
+		}`
+		mock := &mockDocker{listResult: agentContainer, statsBody: body}
+		c := newClientWithAPI("proj", mock)
+
+		stats, err := c.Stats(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Stats: %v", err)
+		}
+		if stats.CPUPercent < 79.9 || stats.CPUPercent > 80.1 {
+			t.Errorf("CPUPercent = %v, want 80", stats.CPUPercent)
+		}
+		if stats.MemoryBytes != 200*1024*1024 {
+			t.Errorf("MemoryBytes = %d, want usage minus page cache (200MiB)", stats.MemoryBytes)
+		}
+		if stats.MemoryLimit != 2*1024*1024*1024 {
+			t.Errorf("MemoryLimit = %d", stats.MemoryLimit)
+		}
+	})
+
+	t.Run("zero cpu without a previous sample", func(t *testing.T) {
+		body := `{"cpu_stats": {"cpu_usage": {"total_usage": 5}, "system_cpu_usage": 10}, "memory_stats": {"usage": 1024}}`
+		mock := &mockDocker{listResult: agentContainer, statsBody: body}
+		c := newClientWithAPI("proj", mock)
+
+		stats, err := c.Stats(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Stats: %v", err)
+		}
+		if stats.CPUPercent != 0 || stats.MemoryBytes != 1024 {
+			t.Errorf("stats = %+v", stats)
+		}
+	})
+
+	t.Run("returns API errors", func(t *testing.T) {
+		mock := &mockDocker{listResult: agentContainer, statsErr: fmt.Errorf("daemon gone")}
+		c := newClientWithAPI("proj", mock)
+
+		if _, err := c.Stats(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "daemon gone") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestGetLogs(t *testing.T) {
 	t.Run("returns log stream", func(t *testing.T) {
 		// Build properly framed Docker log output.
@@ -490,6 +1219,76 @@ func TestGetLogs(t *testing.T) {
 	})
 }
 
+func TestExecInteractive(t *testing.T) {
+	t.Run("runs command and returns exit code", func(t *testing.T) {
+		mock := &mockDocker{
+			listResult: []types.Container{
+				{ID: "cid-111", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+			},
+			execOutput:   "hello from agent\n",
+			execExitCode: 3,
+		}
+		c := newClientWithAPI("proj", mock)
+
+		var out bytes.Buffer
+		code, err := c.ExecInteractive(context.Background(), 1, ExecOpts{
+			Cmd:    []string{"echo", "hello"},
+			Tty:    true,
+			Stdin:  strings.NewReader(""),
+			Stdout: &out,
+		})
+		if err != nil {
+			t.Fatalf("ExecInteractive: %v", err)
+		}
+		if code != 3 {
+			t.Errorf("exit code = %d, want 3", code)
+		}
+		if out.String() != "hello from agent\n" {
+			t.Errorf("output = %q", out.String())
+		}
+		if len(mock.execOptions.Cmd) != 2 || mock.execOptions.Cmd[0] != "echo" {
+			t.Errorf("exec Cmd = %v", mock.execOptions.Cmd)
+		}
+		if !mock.execOptions.Tty || !mock.execOptions.AttachStdin {
+			t.Errorf("expected Tty and AttachStdin, got %+v", mock.execOptions)
+		}
+	})
+
+	t.Run("demuxes output without a TTY", func(t *testing.T) {
+		mock := &mockDocker{
+			listResult: []types.Container{
+				{ID: "cid-111", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+			},
+			execOutput: string(dockerFrame("git status output\n")),
+		}
+		c := newClientWithAPI("proj", mock)
+
+		var out bytes.Buffer
+		if _, err := c.ExecInteractive(context.Background(), 1, ExecOpts{
+			Cmd:    []string{"git", "status"},
+			Stdout: &out,
+		}); err != nil {
+			t.Fatalf("ExecInteractive: %v", err)
+		}
+		if out.String() != "git status output\n" {
+			t.Errorf("output = %q", out.String())
+		}
+	})
+
+	t.Run("returns error when container not found", func(t *testing.T) {
+		mock := &mockDocker{listResult: []types.Container{}}
+		c := newClientWithAPI("proj", mock)
+
+		_, err := c.ExecInteractive(context.Background(), 99, ExecOpts{Cmd: []string{"/bin/bash"}})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "no container found") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestContainerNamingConvention(t *testing.T) {
 	tests := []struct {
 		project string
@@ -549,6 +1348,36 @@ func TestStopAllAgents_CallsStopForEach(t *testing.T) {
 	}
 }
 
+func TestStartAgent_RolePrompt(t *testing.T) {
+	projectDir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
+	_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.md"), []byte("# Shared\n"), 0644)
+	_ = os.WriteFile(filepath.Join(projectDir, "AGENT_PROMPT.tester.md"), []byte("# Tester\n"), 0644)
+
+	promptSource := func(role string) string {
+		t.Helper()
+		mock := &mockDocker{createResp: container.CreateResponse{ID: "cid"}}
+		c := newClientWithAPI("proj", mock)
+		if _, err := c.StartAgent(context.Background(), AgentOpts{ProjectDir: projectDir, AgentID: 1, Role: role, Model: "m"}); err != nil {
+			t.Fatalf("StartAgent(%s): %v", role, err)
+		}
+		for _, m := range mock.created[0].Host.Mounts {
+			if m.Target == "/workspace/AGENT_PROMPT.md" {
+				return filepath.Base(m.Source)
+			}
+		}
+		t.Fatalf("no prompt mount for %s", role)
+		return ""
+	}
+
+	if got := promptSource("tester"); got != "AGENT_PROMPT.tester.md" {
+		t.Errorf("tester prompt = %q, want the tester-specific prompt", got)
+	}
+	if got := promptSource("developer"); got != "AGENT_PROMPT.md" {
+		t.Errorf("developer prompt = %q, want the shared prompt", got)
+	}
+}
+
 func TestStartAgent_PassesCorrectConfig(t *testing.T) {
 	projectDir := t.TempDir()
 	_ = os.MkdirAll(filepath.Join(projectDir, ".metamorph", "upstream.git"), 0755)
@@ -573,8 +1402,8 @@ func TestStartAgent_PassesCorrectConfig(t *testing.T) {
 	}
 
 	call := mock.created[0]
-	if call.Config.Image != defaultImageTag {
-		t.Errorf("image = %q, want %q", call.Config.Image, defaultImageTag)
+	if call.Config.Image != config.DefaultImage {
+		t.Errorf("image = %q, want %q", call.Config.Image, config.DefaultImage)
 	}
 
 	envMap := map[string]string{}
@@ -752,7 +1581,12 @@ func TestDockerClientInterface(t *testing.T) {
 // mockDockerClient is a full mock of the DockerClient interface for consumers.
 type mockDockerClient struct{}
 
-func (m *mockDockerClient) BuildImage(projectDir string, extraPackages []string) error { return nil }
+func (m *mockDockerClient) BuildImage(projectDir string, extraPackages []string, systemPrompt string, timeout time.Duration) error {
+	return nil
+}
+func (m *mockDockerClient) PullImage(ref string, auth RegistryAuth, timeout time.Duration) error {
+	return nil
+}
 func (m *mockDockerClient) StartAgent(ctx context.Context, opts AgentOpts) (string, error) {
 	return "mock-id", nil
 }
@@ -761,9 +1595,21 @@ func (m *mockDockerClient) StopAllAgents(ctx context.Context) error          { r
 func (m *mockDockerClient) ListAgents(ctx context.Context) ([]AgentInfo, error) {
 	return nil, nil
 }
+func (m *mockDockerClient) Stats(ctx context.Context, agentID int) (AgentStats, error) {
+	return AgentStats{}, nil
+}
 func (m *mockDockerClient) GetLogs(ctx context.Context, agentID int, tail int, follow bool) (io.ReadCloser, error) {
 	return io.NopCloser(strings.NewReader("")), nil
 }
+func (m *mockDockerClient) PauseAgent(ctx context.Context, agentID int) error {
+	return nil
+}
+func (m *mockDockerClient) UnpauseAgent(ctx context.Context, agentID int) error {
+	return nil
+}
+func (m *mockDockerClient) ExecInteractive(ctx context.Context, agentID int, opts ExecOpts) (int, error) {
+	return 0, nil
+}
 
 func TestEnvValue(t *testing.T) {
 	tests := []struct {
@@ -790,19 +1636,28 @@ func TestCreateTarContext(t *testing.T) {
 	dir := t.TempDir()
 	_ = os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM ubuntu\n"), 0644)
 	_ = os.WriteFile(filepath.Join(dir, "entrypoint.sh"), []byte("#!/bin/bash\n"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, buildHashFile), []byte("abc"), 0644)
 
 	reader, err := createTarContext(dir)
 	if err != nil {
 		t.Fatalf("createTarContext: %v", err)
 	}
 
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, reader); err != nil {
-		t.Fatalf("reading tar: %v", err)
+	var names []string
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		names = append(names, hdr.Name)
 	}
-
-	if buf.Len() == 0 {
-		t.Error("expected non-empty tar archive")
+	slices.Sort(names)
+	if got := strings.Join(names, " "); got != "Dockerfile entrypoint.sh" {
+		t.Errorf("tar entries = %q, want the build files without %s", got, buildHashFile)
 	}
 }
 
@@ -842,6 +1697,149 @@ func TestStopAllAgents_RemoveError(t *testing.T) {
 	}
 }
 
+func TestListAgents_Health(t *testing.T) {
+	mock := &mockDocker{
+		listResult: []types.Container{
+			{ID: "cid-111", Status: "Up 2 hours (unhealthy)", Labels: map[string]string{labelProject: "proj", labelAgentID: "1"}},
+		},
+		inspectResp: types.ContainerJSON{
+			Config: &container.Config{Env: []string{"AGENT_ROLE=developer"}},
+			ContainerJSONBase: &types.ContainerJSONBase{
+				State: &types.ContainerState{
+					Health: &types.Health{Status: types.Unhealthy, FailingStreak: 3},
+				},
+			},
+		},
+	}
+	c := newClientWithAPI("proj", mock)
+
+	agents, err := c.ListAgents(context.Background())
+	if err != nil {
+		t.Fatalf("ListAgents: %v", err)
+	}
+	if len(agents) != 1 || agents[0].Health != "unhealthy" {
+		t.Errorf("agents = %+v, want agent-1 reported unhealthy", agents)
+	}
+}
+
+func TestListAgents_SkipsInspectWithLabels(t *testing.T) {
+	created := time.Now().Add(-2 * time.Hour).Truncate(time.Second).UTC()
+	mock := &mockDocker{
+		listResult: []types.Container{
+			{ID: "cid-111", Status: "Up 2 hours (unhealthy)", Created: created.Unix(), Labels: map[string]string{
+				labelProject: "proj", labelAgentID: "1", labelRole: "developer", labelModel: "claude-sonnet",
+			}},
+			{ID: "cid-222", Status: "Up 1 hour", Labels: map[string]string{
+				labelProject: "proj", labelAgentID: "2",
+			}},
+		},
+		inspectResp: types.ContainerJSON{
+			Config:            &container.Config{Env: []string{"AGENT_ROLE=tester", "AGENT_MODEL=claude-opus"}},
+			ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{}},
+		},
+	}
+	c := newClientWithAPI("proj", mock)
+
+	agents, err := c.ListAgents(context.Background())
+	if err != nil {
+		t.Fatalf("ListAgents: %v", err)
+	}
+	if len(agents) != 2 {
+		t.Fatalf("expected 2 agents, got %d", len(agents))
+	}
+
+	// Only the unlabelled container is inspected.
+	if len(mock.inspected) != 1 || mock.inspected[0] != "cid-222" {
+		t.Errorf("inspected = %v, want [cid-222]", mock.inspected)
+	}
+
+	a := agents[0]
+	if a.Role != "developer" || a.Model != "claude-sonnet" {
+		t.Errorf("agent-1 Role, Model = %q, %q", a.Role, a.Model)
+	}
+	if a.Health != "unhealthy" {
+		t.Errorf("agent-1 Health = %q, want unhealthy from the list status", a.Health)
+	}
+	if !a.StartedAt.Equal(created) {
+		t.Errorf("agent-1 StartedAt = %v, want %v", a.StartedAt, created)
+	}
+	if agents[1].Role != "tester" || agents[1].Model != "claude-opus" {
+		t.Errorf("agent-2 Role, Model = %q, %q, want tester, claude-opus from env", agents[1].Role, agents[1].Model)
+	}
+}
+
+func TestListAgents_InspectsRestartedContainers(t *testing.T) {
+	created := time.Now().Add(-3 * time.Hour).Truncate(time.Second).UTC()
+	restarted := time.Now().Add(-2 * time.Minute).Truncate(time.Second).UTC()
+	mock := &mockDocker{
+		listResult: []types.Container{
+			{ID: "cid-111", Status: "Up 2 minutes", Created: created.Unix(), Labels: map[string]string{
+				labelProject: "proj", labelAgentID: "1", labelRole: "developer", labelModel: "claude-sonnet",
+			}},
+		},
+		inspectResp: types.ContainerJSON{
+			Config: &container.Config{Env: []string{"AGENT_ROLE=tester"}},
+			ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{
+				StartedAt: restarted.Format(time.RFC3339Nano),
+			}},
+		},
+	}
+	c := newClientWithAPI("proj", mock)
+
+	agents, err := c.ListAgents(context.Background())
+	if err != nil {
+		t.Fatalf("ListAgents: %v", err)
+	}
+	if len(mock.inspected) != 1 {
+		t.Errorf("inspected = %v, want the restarted container", mock.inspected)
+	}
+	if len(agents) != 1 || !agents[0].StartedAt.Equal(restarted) {
+		t.Fatalf("agents = %+v, want StartedAt %v from inspect", agents, restarted)
+	}
+	if agents[0].Role != "developer" {
+		t.Errorf("Role = %q, want the label over env", agents[0].Role)
+	}
+}
+
+func TestRestartedInPlace(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status  string
+		created time.Time
+		want    bool
+	}{
+		{"Up 2 hours", now.Add(-2*time.Hour - 20*time.Minute), false},
+		{"Up About an hour (healthy)", now.Add(-80 * time.Minute), false},
+		{"Up 45 seconds", now.Add(-45 * time.Second), false},
+		{"Up 3 days", now.Add(-3*24*time.Hour - 5*time.Hour), false},
+		{"Up 2 minutes", now.Add(-3 * time.Hour), true},
+		{"Up Less than a second", now.Add(-10 * time.Minute), true},
+		{"Up 5 seconds (health: starting)", now.Add(-24 * time.Hour), true},
+		{"Exited (1) 3 minutes ago", now.Add(-3 * time.Hour), false},
+		{"Up 2 minutes", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := restartedInPlace(tt.status, tt.created, now); got != tt.want {
+			t.Errorf("restartedInPlace(%q, %s ago) = %v, want %v", tt.status, now.Sub(tt.created), got, tt.want)
+		}
+	}
+}
+
+func TestStatusHealth(t *testing.T) {
+	tests := map[string]string{
+		"Up 2 hours (healthy)":            "healthy",
+		"Up 2 hours (unhealthy)":          "unhealthy",
+		"Up 5 seconds (health: starting)": "starting",
+		"Up 2 hours":                      "",
+		"Exited (1) 3 minutes ago":        "",
+	}
+	for status, want := range tests {
+		if got := statusHealth(status); got != want {
+			t.Errorf("statusHealth(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
 func TestListAgents_Error(t *testing.T) {
 	mock := &mockDocker{
 		listErr: fmt.Errorf("docker daemon not running"),
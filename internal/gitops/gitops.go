@@ -2,25 +2,42 @@ package gitops
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/robmorgan/metamorph/internal/constants"
 )
 
+// waitDelay bounds how long git has to exit after a cancelled context
+// interrupts it, and how long its output pipes may stay open afterwards,
+// before it is killed.
+const waitDelay = 5 * time.Second
+
 // git runs a git command in the given directory, capturing stdout and stderr.
-func git(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+// Cancelling ctx interrupts the command, so git can remove its lock files
+// (e.g. index.lock) before exiting, and kills it if it doesn't exit in time.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
 	cmd.Dir = dir
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	// Don't wait on helpers (e.g. ssh) that inherited the output pipes once
+	// git itself has exited.
+	cmd.WaitDelay = waitDelay
 	err := cmd.Run()
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("%w: %w", ctxErr, err)
+		}
 		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
 	}
 	return strings.TrimSpace(stdout.String()), nil
@@ -29,8 +46,13 @@ func git(dir string, args ...string) (string, error) {
 // InitUpstream creates a bare git repo at <projectDir>/.metamorph/upstream.git
 // by cloning the user's project repo. This gives shared history so that
 // fetch/merge can sync agent commits back to the project.
-// Scaffold files (PROGRESS.md, current_tasks/.gitkeep) are added if missing.
-func InitUpstream(projectDir string) error {
+// Scaffold files (PROGRESS.md, <lockDir>/.gitkeep) are added if missing.
+//
+// defaultBranch is the branch agents work on. It is created from the
+// project's current commit if the project has no such branch, so agents get
+// a predictable name whether git defaulted to main or master. An empty
+// defaultBranch keeps the project's current branch.
+func InitUpstream(ctx context.Context, projectDir, defaultBranch, lockDir string) error {
 	upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 
 	if err := os.MkdirAll(filepath.Dir(upstreamPath), 0755); err != nil {
@@ -38,10 +60,16 @@ func InitUpstream(projectDir string) error {
 	}
 
 	// Clone from user's repo — shared history enables fetch/merge on sync.
-	if _, err := git(projectDir, "clone", "--bare", ".", upstreamPath); err != nil {
+	if _, err := git(ctx, projectDir, "clone", "--bare", ".", upstreamPath); err != nil {
 		return fmt.Errorf("gitops: failed to clone bare repo: %w", err)
 	}
 
+	if defaultBranch != "" {
+		if err := setDefaultBranch(ctx, upstreamPath, defaultBranch); err != nil {
+			return err
+		}
+	}
+
 	// Clone the bare repo to a temp dir to add scaffold files.
 	tmpDir, err := os.MkdirTemp("", "metamorph-init-*")
 	if err != nil {
@@ -50,23 +78,23 @@ func InitUpstream(projectDir string) error {
 	defer func() { _ = os.RemoveAll(tmpDir) }()
 
 	seedDir := filepath.Join(tmpDir, "seed")
-	if _, err := git(tmpDir, "clone", upstreamPath, "seed"); err != nil {
+	if _, err := git(ctx, tmpDir, "clone", upstreamPath, "seed"); err != nil {
 		return fmt.Errorf("gitops: failed to clone for seeding: %w", err)
 	}
 
 	// Set identity for the seed commit so it works in environments without
 	// a global git config (e.g. CI runners).
-	if _, err := git(seedDir, "config", "user.name", "metamorph"); err != nil {
+	if _, err := git(ctx, seedDir, "config", "user.name", "metamorph"); err != nil {
 		return fmt.Errorf("gitops: failed to set user.name in seed clone: %w", err)
 	}
-	if _, err := git(seedDir, "config", "user.email", "metamorph@localhost"); err != nil {
+	if _, err := git(ctx, seedDir, "config", "user.email", "metamorph@localhost"); err != nil {
 		return fmt.Errorf("gitops: failed to set user.email in seed clone: %w", err)
 	}
 
 	// Only create scaffold files that don't already exist.
 	files := map[string]string{
-		constants.ProgressFile:                            "# Progress\n",
-		filepath.Join(constants.TaskLockDir, ".gitkeep"): "",
+		constants.ProgressFile:             "# Progress\n",
+		filepath.Join(lockDir, ".gitkeep"): "",
 	}
 	added := false
 	for relPath, content := range files {
@@ -84,19 +112,19 @@ func InitUpstream(projectDir string) error {
 	}
 
 	if added {
-		if _, err := git(seedDir, "add", "."); err != nil {
+		if _, err := git(ctx, seedDir, "add", "."); err != nil {
 			return fmt.Errorf("gitops: failed to stage seed files: %w", err)
 		}
-		if _, err := git(seedDir, "commit", "-m", "metamorph: add scaffold files"); err != nil {
+		if _, err := git(ctx, seedDir, "commit", "-m", "metamorph: add scaffold files"); err != nil {
 			return fmt.Errorf("gitops: failed to commit seed files: %w", err)
 		}
 
 		// Detect branch name and push.
-		branch, err := git(seedDir, "rev-parse", "--abbrev-ref", "HEAD")
+		branch, err := git(ctx, seedDir, "rev-parse", "--abbrev-ref", "HEAD")
 		if err != nil {
 			return fmt.Errorf("gitops: failed to detect branch name: %w", err)
 		}
-		if _, err := git(seedDir, "push", "origin", branch); err != nil {
+		if _, err := git(ctx, seedDir, "push", "origin", branch); err != nil {
 			return fmt.Errorf("gitops: failed to push seed commit: %w", err)
 		}
 	}
@@ -104,29 +132,129 @@ func InitUpstream(projectDir string) error {
 	return nil
 }
 
-// CloneForAgent clones the upstream repo and configures git identity for the agent.
-func CloneForAgent(upstreamPath string, agentID int, destDir string) error {
+// setDefaultBranch points the bare repo's HEAD at branch, creating the
+// branch from the current HEAD if it doesn't exist.
+func setDefaultBranch(ctx context.Context, upstreamPath, branch string) error {
+	ref := "refs/heads/" + branch
+	if _, err := git(ctx, upstreamPath, "rev-parse", "--verify", "-q", ref); err != nil {
+		if _, err := git(ctx, upstreamPath, "branch", branch, "HEAD"); err != nil {
+			return fmt.Errorf("gitops: failed to create default branch %s: %w", branch, err)
+		}
+	}
+	if _, err := git(ctx, upstreamPath, "symbolic-ref", "HEAD", ref); err != nil {
+		return fmt.Errorf("gitops: failed to set default branch to %s: %w", branch, err)
+	}
+	return nil
+}
+
+// GC runs `git gc --auto` in the repo at path, packing loose objects only
+// when git's own thresholds say it is worthwhile. It is safe to run while
+// agents are pushing.
+func GC(ctx context.Context, path string) error {
+	if _, err := git(ctx, path, "gc", "--auto", "--quiet"); err != nil {
+		return fmt.Errorf("gitops: gc failed: %w", err)
+	}
+	return nil
+}
+
+// AgentBranch returns the upstream branch an agent works on when
+// git.branch_per_agent is enabled.
+func AgentBranch(agentID int) string {
+	return fmt.Sprintf("agent-%d", agentID)
+}
+
+// CloneOpts configures an agent clone.
+type CloneOpts struct {
+	// BranchPerAgent switches the clone to the agent's own branch (see
+	// AgentBranch), continuing it if it already exists upstream.
+	BranchPerAgent bool
+	SignCommits    bool   // set commit.gpgsign so every commit is signed
+	SigningKey     string // user.signingkey (git's default key when empty)
+
+	// Depth limits the clone to this many commits of history (full clone
+	// when 0). Pushes and pull --rebase still work because upstream has the
+	// full history; commands that walk past the boundary, like git blame on
+	// old lines, see a truncated history.
+	Depth int
+
+	// AuthorName and AuthorEmail, when set, make commits authored by this
+	// identity. The committer stays agent-N so agent work remains
+	// distinguishable in the log.
+	AuthorName  string
+	AuthorEmail string
+}
+
+// CloneForAgent clones the upstream repo and configures git identity, and
+// optionally branch and commit signing, for the agent.
+func CloneForAgent(ctx context.Context, upstreamPath string, agentID int, destDir string, opts CloneOpts) error {
 	parent := filepath.Dir(destDir)
-	if _, err := git(parent, "clone", upstreamPath, destDir); err != nil {
+	args := []string{"clone", upstreamPath, destDir}
+	if opts.Depth > 0 {
+		// --depth is ignored for plain local paths, and implies
+		// --single-branch, which would hide existing agent branches.
+		abs, err := filepath.Abs(upstreamPath)
+		if err != nil {
+			return fmt.Errorf("gitops: failed to resolve upstream path: %w", err)
+		}
+		url := filepath.ToSlash(abs)
+		if !strings.HasPrefix(url, "/") {
+			url = "/" + url // Windows drive path, e.g. file:///C:/...
+		}
+		args = []string{"clone", "--depth", strconv.Itoa(opts.Depth), "--no-single-branch", "file://" + url, destDir}
+	}
+	if _, err := git(ctx, parent, args...); err != nil {
 		return fmt.Errorf("gitops: failed to clone for agent-%d: %w", agentID, err)
 	}
 
+	if opts.BranchPerAgent {
+		branch := AgentBranch(agentID)
+		start := "HEAD"
+		if _, err := git(ctx, destDir, "rev-parse", "--verify", "-q", "origin/"+branch); err == nil {
+			start = "origin/" + branch
+		}
+		if _, err := git(ctx, destDir, "checkout", "-B", branch, start); err != nil {
+			return fmt.Errorf("gitops: failed to check out %s: %w", branch, err)
+		}
+	}
+
 	name := fmt.Sprintf("agent-%d", agentID)
 	email := fmt.Sprintf("agent-%d@metamorph.local", agentID)
 
-	if _, err := git(destDir, "config", "user.name", name); err != nil {
+	if _, err := git(ctx, destDir, "config", "user.name", name); err != nil {
 		return fmt.Errorf("gitops: failed to set user.name for agent-%d: %w", agentID, err)
 	}
-	if _, err := git(destDir, "config", "user.email", email); err != nil {
+	if _, err := git(ctx, destDir, "config", "user.email", email); err != nil {
 		return fmt.Errorf("gitops: failed to set user.email for agent-%d: %w", agentID, err)
 	}
 
+	if opts.AuthorName != "" {
+		if _, err := git(ctx, destDir, "config", "author.name", opts.AuthorName); err != nil {
+			return fmt.Errorf("gitops: failed to set author.name for agent-%d: %w", agentID, err)
+		}
+	}
+	if opts.AuthorEmail != "" {
+		if _, err := git(ctx, destDir, "config", "author.email", opts.AuthorEmail); err != nil {
+			return fmt.Errorf("gitops: failed to set author.email for agent-%d: %w", agentID, err)
+		}
+	}
+
+	if opts.SignCommits {
+		if _, err := git(ctx, destDir, "config", "commit.gpgsign", "true"); err != nil {
+			return fmt.Errorf("gitops: failed to enable commit signing for agent-%d: %w", agentID, err)
+		}
+		if opts.SigningKey != "" {
+			if _, err := git(ctx, destDir, "config", "user.signingkey", opts.SigningKey); err != nil {
+				return fmt.Errorf("gitops: failed to set user.signingkey for agent-%d: %w", agentID, err)
+			}
+		}
+	}
+
 	return nil
 }
 
 // SyncToWorkingCopy clones or pulls latest changes into workingCopyPath.
 // Returns a summary of new commits.
-func SyncToWorkingCopy(upstreamPath string, workingCopyPath string) (string, error) {
+func SyncToWorkingCopy(ctx context.Context, upstreamPath string, workingCopyPath string) (string, error) {
 	gitDir := filepath.Join(workingCopyPath, ".git")
 
 	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
@@ -135,11 +263,19 @@ func SyncToWorkingCopy(upstreamPath string, workingCopyPath string) (string, err
 		if err := os.MkdirAll(parent, 0755); err != nil {
 			return "", fmt.Errorf("gitops: failed to create parent for working copy: %w", err)
 		}
-		if _, err := git(parent, "clone", upstreamPath, workingCopyPath); err != nil {
+		if _, err := git(ctx, parent, "clone", upstreamPath, workingCopyPath); err != nil {
 			return "", fmt.Errorf("gitops: failed to clone into working copy: %w", err)
 		}
+		// The daemon commits here (e.g. clearing stale task locks), so it
+		// must not depend on a global git identity.
+		if _, err := git(ctx, workingCopyPath, "config", "user.name", "metamorph"); err != nil {
+			return "", fmt.Errorf("gitops: failed to set user.name in working copy: %w", err)
+		}
+		if _, err := git(ctx, workingCopyPath, "config", "user.email", "metamorph@localhost"); err != nil {
+			return "", fmt.Errorf("gitops: failed to set user.email in working copy: %w", err)
+		}
 		// Return all commits as the summary.
-		summary, err := git(workingCopyPath, "log", "--oneline")
+		summary, err := git(ctx, workingCopyPath, "log", "--oneline")
 		if err != nil {
 			return "", fmt.Errorf("gitops: failed to read log after clone: %w", err)
 		}
@@ -147,21 +283,25 @@ func SyncToWorkingCopy(upstreamPath string, workingCopyPath string) (string, err
 	}
 
 	// Record HEAD before pull.
-	oldHead, err := git(workingCopyPath, "rev-parse", "HEAD")
+	oldHead, err := git(ctx, workingCopyPath, "rev-parse", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to get HEAD before sync: %w", err)
 	}
 
-	branch, err := git(workingCopyPath, "rev-parse", "--abbrev-ref", "HEAD")
+	branch, err := git(ctx, workingCopyPath, "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to detect branch: %w", err)
 	}
 
-	if _, err := git(workingCopyPath, "pull", "--rebase", "origin", branch); err != nil {
+	if _, err := git(ctx, workingCopyPath, "pull", "--rebase", "origin", branch); err != nil {
+		if ctx.Err() != nil {
+			// Don't leave a half-finished rebase behind for the next sync.
+			_, _ = git(context.WithoutCancel(ctx), workingCopyPath, "rebase", "--abort")
+		}
 		return "", fmt.Errorf("gitops: failed to pull --rebase: %w", err)
 	}
 
-	newHead, err := git(workingCopyPath, "rev-parse", "HEAD")
+	newHead, err := git(ctx, workingCopyPath, "rev-parse", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to get HEAD after sync: %w", err)
 	}
@@ -170,52 +310,83 @@ func SyncToWorkingCopy(upstreamPath string, workingCopyPath string) (string, err
 		return "", nil
 	}
 
-	summary, err := git(workingCopyPath, "log", "--oneline", oldHead+".."+newHead)
+	summary, err := git(ctx, workingCopyPath, "log", "--oneline", oldHead+".."+newHead)
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to read new commits: %w", err)
 	}
 	return summary, nil
 }
 
+// Project sync strategies for SyncToProjectDirWithStrategy.
+const (
+	SyncMerge  = "merge"  // merge upstream into the project, preferring agent changes on conflict
+	SyncRebase = "rebase" // rebase local project commits onto upstream
+	SyncReset  = "reset"  // hard-reset the project to upstream, discarding local commits and changes
+)
+
 // SyncToProjectDir fetches agent commits from upstream and merges them
 // into the user's project directory.
-func SyncToProjectDir(upstreamPath, projectDir string) (string, error) {
+func SyncToProjectDir(ctx context.Context, upstreamPath, projectDir string) (string, error) {
+	return SyncToProjectDirWithStrategy(ctx, upstreamPath, projectDir, SyncMerge)
+}
+
+// SyncToProjectDirWithStrategy fetches agent commits from upstream and
+// brings them into the user's project directory using strategy (SyncMerge
+// when empty). It returns a one-line-per-commit summary of the upstream
+// commits brought in, or "" if there were none. A merge or rebase that
+// conflicts is aborted, leaving the project as it was, and reported as a
+// *ConflictError.
+func SyncToProjectDirWithStrategy(ctx context.Context, upstreamPath, projectDir, strategy string) (string, error) {
 	// Verify project is a git repo.
 	if _, err := os.Stat(filepath.Join(projectDir, ".git")); os.IsNotExist(err) {
 		return "", fmt.Errorf("gitops: project is not a git repo: %s", projectDir)
 	}
 
 	// Record HEAD before merge.
-	oldHead, err := git(projectDir, "rev-parse", "HEAD")
+	oldHead, err := git(ctx, projectDir, "rev-parse", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to get HEAD before sync: %w", err)
 	}
 
-	// Detect the default branch in upstream.
-	branch, err := git(upstreamPath, "symbolic-ref", "--short", "HEAD")
-	if err != nil {
-		// Fallback: detect from project dir.
-		branch, err = git(projectDir, "rev-parse", "--abbrev-ref", "HEAD")
-		if err != nil {
-			return "", fmt.Errorf("gitops: failed to detect branch name: %w", err)
-		}
+	if err := fetchUpstream(ctx, upstreamPath, projectDir); err != nil {
+		return "", err
 	}
 
-	// Fetch from upstream.
-	if _, err := git(projectDir, "fetch", upstreamPath, branch); err != nil {
-		return "", fmt.Errorf("gitops: fetch failed: %w", err)
+	switch strategy {
+	case SyncRebase, SyncReset:
+		// Summarize before rewriting HEAD, since afterwards oldHead..HEAD
+		// would also list rebased local commits.
+		summary, err := fetchedCommits(ctx, projectDir, oldHead)
+		if err != nil {
+			return "", err
+		}
+		if strategy == SyncReset {
+			if _, err := git(ctx, projectDir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+				return "", fmt.Errorf("gitops: reset failed: %w", err)
+			}
+			return summary, nil
+		}
+		if _, err := git(ctx, projectDir, "rebase", "--autostash", "FETCH_HEAD"); err != nil {
+			conflictErr := syncFailure(ctx, projectDir, SyncRebase, err)
+			if _, abortErr := git(context.WithoutCancel(ctx), projectDir, "rebase", "--abort"); abortErr != nil {
+				slog.Warn("gitops: failed to abort rebase", "error", abortErr)
+			}
+			return "", conflictErr
+		}
+		return summary, nil
 	}
 
 	// Merge FETCH_HEAD, auto-resolving conflicts in favor of upstream (agent work).
-	if _, err := git(projectDir, "merge", "-X", "theirs", "FETCH_HEAD", "--no-edit"); err != nil {
-		if _, abortErr := git(projectDir, "merge", "--abort"); abortErr != nil {
+	if _, err := git(ctx, projectDir, "merge", "-X", "theirs", "FETCH_HEAD", "--no-edit"); err != nil {
+		conflictErr := syncFailure(ctx, projectDir, SyncMerge, err)
+		if _, abortErr := git(context.WithoutCancel(ctx), projectDir, "merge", "--abort"); abortErr != nil {
 			slog.Warn("gitops: failed to abort merge", "error", abortErr)
 		}
-		return "", fmt.Errorf("gitops: merge failed (will retry on next sync): %w", err)
+		return "", conflictErr
 	}
 
 	// Get new HEAD.
-	newHead, err := git(projectDir, "rev-parse", "HEAD")
+	newHead, err := git(ctx, projectDir, "rev-parse", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to get HEAD after sync: %w", err)
 	}
@@ -225,9 +396,160 @@ func SyncToProjectDir(upstreamPath, projectDir string) (string, error) {
 	}
 
 	// Return summary of new commits.
-	summary, err := git(projectDir, "log", "--oneline", oldHead+".."+newHead)
+	summary, err := git(ctx, projectDir, "log", "--oneline", oldHead+".."+newHead)
 	if err != nil {
 		return "", fmt.Errorf("gitops: failed to read new commits: %w", err)
 	}
 	return summary, nil
 }
+
+// ConflictError is returned by SyncToProjectDirWithStrategy when agent
+// commits conflict with the project's local commits or changes. The merge
+// or rebase has already been aborted.
+type ConflictError struct {
+	Strategy string   // SyncMerge or SyncRebase
+	Commit   string   // upstream commit that could not be synced
+	Files    []string // paths that conflicted
+	Err      error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("gitops: %s failed (will retry on next sync): conflicts in %s: %v",
+		e.Strategy, strings.Join(e.Files, ", "), e.Err)
+}
+
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// syncFailure builds the error for a failed merge or rebase of FETCH_HEAD,
+// before it is aborted: a *ConflictError naming the unmerged paths, or a
+// plain error if the failure wasn't a conflict.
+func syncFailure(ctx context.Context, projectDir, strategy string, err error) error {
+	files, _ := git(ctx, projectDir, "diff", "--name-only", "--diff-filter=U")
+	if files == "" {
+		return fmt.Errorf("gitops: %s failed (will retry on next sync): %w", strategy, err)
+	}
+	commit, _ := git(ctx, projectDir, "rev-parse", "FETCH_HEAD")
+	return &ConflictError{
+		Strategy: strategy,
+		Commit:   commit,
+		Files:    strings.Split(files, "\n"),
+		Err:      err,
+	}
+}
+
+// PendingCommits returns a one-line-per-commit summary of the upstream
+// commits that SyncToProjectDir would bring into projectDir, without
+// changing its branch or working tree. Returns "" when there are none.
+func PendingCommits(ctx context.Context, upstreamPath, projectDir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(projectDir, ".git")); os.IsNotExist(err) {
+		return "", fmt.Errorf("gitops: project is not a git repo: %s", projectDir)
+	}
+
+	if err := fetchUpstream(ctx, upstreamPath, projectDir); err != nil {
+		return "", err
+	}
+
+	return fetchedCommits(ctx, projectDir, "HEAD")
+}
+
+// fetchedCommits summarizes, one line per commit, the commits in FETCH_HEAD
+// that aren't reachable from rev: what a sync starting at rev brings in.
+func fetchedCommits(ctx context.Context, projectDir, rev string) (string, error) {
+	summary, err := git(ctx, projectDir, "log", "--oneline", rev+"..FETCH_HEAD")
+	if err != nil {
+		return "", fmt.Errorf("gitops: failed to read new commits: %w", err)
+	}
+	return summary, nil
+}
+
+// fetchUpstream fetches upstream's default branch into projectDir's
+// FETCH_HEAD.
+func fetchUpstream(ctx context.Context, upstreamPath, projectDir string) error {
+	// Detect the default branch in upstream.
+	branch, err := git(ctx, upstreamPath, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		// Fallback: detect from project dir.
+		branch, err = git(ctx, projectDir, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return fmt.Errorf("gitops: failed to detect branch name: %w", err)
+		}
+	}
+
+	if _, err := git(ctx, projectDir, "fetch", upstreamPath, branch); err != nil {
+		return fmt.Errorf("gitops: fetch failed: %w", err)
+	}
+	return nil
+}
+
+// BranchMergeResult reports the outcome of MergeAgentBranches.
+type BranchMergeResult struct {
+	Merged     []string          // branches merged into the default branch
+	Conflicted map[string]string // branch → tip commit, for branches left unmerged due to conflicts
+}
+
+// MergeAgentBranches merges the given agent branches into the upstream's
+// default branch. Each branch is fast-forwarded when possible, otherwise
+// merged with a merge commit. A branch that conflicts is left unmerged and
+// reported in Conflicted so the caller can notify. Branches that don't exist
+// yet or are already merged are skipped.
+func MergeAgentBranches(ctx context.Context, upstreamPath string, branches []string) (*BranchMergeResult, error) {
+	result := &BranchMergeResult{Conflicted: make(map[string]string)}
+
+	base, err := git(ctx, upstreamPath, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("gitops: failed to detect default branch: %w", err)
+	}
+
+	// Check the bare repo first so we only clone when there is work to do.
+	var pending []string
+	for _, branch := range branches {
+		if _, err := git(ctx, upstreamPath, "rev-parse", "--verify", "-q", "refs/heads/"+branch); err != nil {
+			continue // agent hasn't pushed its branch yet
+		}
+		if _, err := git(ctx, upstreamPath, "merge-base", "--is-ancestor", branch, base); err == nil {
+			continue // already merged
+		}
+		pending = append(pending, branch)
+	}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "metamorph-merge-*")
+	if err != nil {
+		return nil, fmt.Errorf("gitops: failed to create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mergeDir := filepath.Join(tmpDir, "merge")
+	if _, err := git(ctx, tmpDir, "clone", "--branch", base, upstreamPath, "merge"); err != nil {
+		return nil, fmt.Errorf("gitops: failed to clone for merge: %w", err)
+	}
+	if _, err := git(ctx, mergeDir, "config", "user.name", "metamorph"); err != nil {
+		return nil, fmt.Errorf("gitops: failed to set user.name in merge clone: %w", err)
+	}
+	if _, err := git(ctx, mergeDir, "config", "user.email", "metamorph@localhost"); err != nil {
+		return nil, fmt.Errorf("gitops: failed to set user.email in merge clone: %w", err)
+	}
+
+	for _, branch := range pending {
+		msg := fmt.Sprintf("metamorph: merge %s", branch)
+		if _, err := git(ctx, mergeDir, "merge", "--no-edit", "-m", msg, "origin/"+branch); err != nil {
+			if _, abortErr := git(context.WithoutCancel(ctx), mergeDir, "merge", "--abort"); abortErr != nil {
+				slog.Warn("gitops: failed to abort merge", "branch", branch, "error", abortErr)
+			}
+			tip, _ := git(ctx, mergeDir, "rev-parse", "origin/"+branch)
+			result.Conflicted[branch] = tip
+			continue
+		}
+		result.Merged = append(result.Merged, branch)
+	}
+
+	if len(result.Merged) > 0 {
+		if _, err := git(ctx, mergeDir, "push", "origin", "HEAD:"+base); err != nil {
+			return nil, fmt.Errorf("gitops: failed to push merged branches: %w", err)
+		}
+	}
+
+	return result, nil
+}
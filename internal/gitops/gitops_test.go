@@ -1,11 +1,15 @@
 package gitops
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/robmorgan/metamorph/internal/constants"
 )
@@ -14,22 +18,22 @@ import (
 // a dummy file. This is needed because InitUpstream now clones the user's repo.
 func initGitRepo(t *testing.T, dir string) {
 	t.Helper()
-	if _, err := git(dir, "init"); err != nil {
+	if _, err := git(t.Context(), dir, "init"); err != nil {
 		t.Fatalf("git init: %v", err)
 	}
-	if _, err := git(dir, "config", "user.name", "test"); err != nil {
+	if _, err := git(t.Context(), dir, "config", "user.name", "test"); err != nil {
 		t.Fatalf("git config user.name: %v", err)
 	}
-	if _, err := git(dir, "config", "user.email", "test@test"); err != nil {
+	if _, err := git(t.Context(), dir, "config", "user.email", "test@test"); err != nil {
 		t.Fatalf("git config user.email: %v", err)
 	}
 	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\n"), 0644); err != nil {
 		t.Fatalf("write README: %v", err)
 	}
-	if _, err := git(dir, "add", "."); err != nil {
+	if _, err := git(t.Context(), dir, "add", "."); err != nil {
 		t.Fatalf("git add: %v", err)
 	}
-	if _, err := git(dir, "commit", "-m", "initial commit"); err != nil {
+	if _, err := git(t.Context(), dir, "commit", "-m", "initial commit"); err != nil {
 		t.Fatalf("git commit: %v", err)
 	}
 }
@@ -39,7 +43,7 @@ func setupUpstream(t *testing.T) (projectDir, upstreamPath string) {
 	t.Helper()
 	projectDir = t.TempDir()
 	initGitRepo(t, projectDir)
-	if err := InitUpstream(projectDir); err != nil {
+	if err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir); err != nil {
 		t.Fatalf("InitUpstream: %v", err)
 	}
 	upstreamPath = filepath.Join(projectDir, constants.UpstreamDir)
@@ -47,11 +51,31 @@ func setupUpstream(t *testing.T) (projectDir, upstreamPath string) {
 }
 
 func TestInitUpstream(t *testing.T) {
+	t.Run("seeds a custom lock dir", func(t *testing.T) {
+		projectDir := t.TempDir()
+		initGitRepo(t, projectDir)
+
+		if err := InitUpstream(t.Context(), projectDir, "", "work/locks"); err != nil {
+			t.Fatalf("InitUpstream: %v", err)
+		}
+
+		cloneDir := filepath.Join(t.TempDir(), "verify")
+		if _, err := git(t.Context(), t.TempDir(), "clone", filepath.Join(projectDir, constants.UpstreamDir), cloneDir); err != nil {
+			t.Fatalf("clone for verification: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(cloneDir, "work", "locks", ".gitkeep")); err != nil {
+			t.Errorf("custom lock dir not seeded: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(cloneDir, constants.TaskLockDir)); !os.IsNotExist(err) {
+			t.Errorf("default lock dir seeded alongside the custom one: %v", err)
+		}
+	})
+
 	t.Run("creates bare repo with seed files", func(t *testing.T) {
 		projectDir := t.TempDir()
 		initGitRepo(t, projectDir)
 
-		if err := InitUpstream(projectDir); err != nil {
+		if err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir); err != nil {
 			t.Fatalf("InitUpstream: %v", err)
 		}
 
@@ -64,7 +88,7 @@ func TestInitUpstream(t *testing.T) {
 
 		// Clone and verify seed files exist.
 		cloneDir := filepath.Join(t.TempDir(), "verify")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
 			t.Fatalf("clone for verification: %v", err)
 		}
 
@@ -78,7 +102,7 @@ func TestInitUpstream(t *testing.T) {
 		}
 
 		// Verify commit messages include both original and scaffold.
-		log, err := git(cloneDir, "log", "--oneline")
+		log, err := git(t.Context(), cloneDir, "log", "--oneline")
 		if err != nil {
 			t.Fatalf("git log: %v", err)
 		}
@@ -94,13 +118,13 @@ func TestInitUpstream(t *testing.T) {
 		projectDir := t.TempDir()
 
 		// Init git repo with scaffold files already present.
-		if _, err := git(projectDir, "init"); err != nil {
+		if _, err := git(t.Context(), projectDir, "init"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "config", "user.name", "test"); err != nil {
+		if _, err := git(t.Context(), projectDir, "config", "user.name", "test"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "config", "user.email", "test@test"); err != nil {
+		if _, err := git(t.Context(), projectDir, "config", "user.email", "test@test"); err != nil {
 			t.Fatal(err)
 		}
 		if err := os.WriteFile(filepath.Join(projectDir, constants.ProgressFile), []byte("# Progress\n"), 0644); err != nil {
@@ -112,25 +136,25 @@ func TestInitUpstream(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(projectDir, constants.TaskLockDir, ".gitkeep"), []byte(""), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), projectDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "commit", "-m", "initial commit with scaffold"); err != nil {
+		if _, err := git(t.Context(), projectDir, "commit", "-m", "initial commit with scaffold"); err != nil {
 			t.Fatal(err)
 		}
 
-		if err := InitUpstream(projectDir); err != nil {
+		if err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir); err != nil {
 			t.Fatalf("InitUpstream: %v", err)
 		}
 
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 		cloneDir := filepath.Join(t.TempDir(), "verify")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
 			t.Fatalf("clone for verification: %v", err)
 		}
 
 		// Should NOT have a scaffold commit since files already existed.
-		log, err := git(cloneDir, "log", "--oneline")
+		log, err := git(t.Context(), cloneDir, "log", "--oneline")
 		if err != nil {
 			t.Fatalf("git log: %v", err)
 		}
@@ -143,14 +167,14 @@ func TestInitUpstream(t *testing.T) {
 		projectDir := t.TempDir()
 		initGitRepo(t, projectDir)
 
-		if err := InitUpstream(projectDir); err != nil {
+		if err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir); err != nil {
 			t.Fatalf("InitUpstream: %v", err)
 		}
 
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 
 		// Verify refs exist (bare repo should have at least one ref).
-		refs, err := git(upstreamPath, "show-ref")
+		refs, err := git(t.Context(), upstreamPath, "show-ref")
 		if err != nil {
 			t.Fatalf("show-ref: %v", err)
 		}
@@ -167,25 +191,25 @@ func TestInitUpstream(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(projectDir, "extra.txt"), []byte("data"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), projectDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "commit", "-m", "add extra file"); err != nil {
+		if _, err := git(t.Context(), projectDir, "commit", "-m", "add extra file"); err != nil {
 			t.Fatal(err)
 		}
 
-		if err := InitUpstream(projectDir); err != nil {
+		if err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir); err != nil {
 			t.Fatalf("InitUpstream: %v", err)
 		}
 
 		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
 		cloneDir := filepath.Join(t.TempDir(), "verify")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, cloneDir); err != nil {
 			t.Fatal(err)
 		}
 
 		// Verify user's commits are present.
-		log, err := git(cloneDir, "log", "--oneline")
+		log, err := git(t.Context(), cloneDir, "log", "--oneline")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -203,14 +227,14 @@ func TestInitUpstream(t *testing.T) {
 	})
 
 	t.Run("fails on invalid project dir", func(t *testing.T) {
-		err := InitUpstream("/nonexistent/path/that/does/not/exist")
+		err := InitUpstream(t.Context(), "/nonexistent/path/that/does/not/exist", "", constants.TaskLockDir)
 		if err == nil {
 			t.Fatal("expected error for invalid path")
 		}
 	})
 
 	t.Run("error includes context", func(t *testing.T) {
-		err := InitUpstream("/nonexistent/path")
+		err := InitUpstream(t.Context(), "/nonexistent/path", "", constants.TaskLockDir)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -220,12 +244,72 @@ func TestInitUpstream(t *testing.T) {
 	})
 }
 
+func TestInitUpstream_DefaultBranch(t *testing.T) {
+	// A project whose branch is "master", as older git versions create.
+	newMasterProject := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		initGitRepo(t, dir)
+		if _, err := git(t.Context(), dir, "branch", "-M", "master"); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	t.Run("creates the configured branch", func(t *testing.T) {
+		projectDir := newMasterProject(t)
+		if err := InitUpstream(t.Context(), projectDir, "main", constants.TaskLockDir); err != nil {
+			t.Fatalf("InitUpstream: %v", err)
+		}
+		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+
+		if head, _ := git(t.Context(), upstreamPath, "symbolic-ref", "--short", "HEAD"); head != "main" {
+			t.Fatalf("upstream HEAD = %q, want main", head)
+		}
+
+		// Agents clone onto main, and their work syncs back to the project's master.
+		agentDir := filepath.Join(t.TempDir(), "agent-1")
+		if err := CloneForAgent(t.Context(), upstreamPath, 1, agentDir, CloneOpts{}); err != nil {
+			t.Fatalf("CloneForAgent: %v", err)
+		}
+		if branch, _ := git(t.Context(), agentDir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "main" {
+			t.Errorf("agent branch = %q, want main", branch)
+		}
+		commitAndPush(t, agentDir, "agent.txt", "agent work")
+
+		if _, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir); err != nil {
+			t.Fatalf("SyncToProjectDir: %v", err)
+		}
+		if branch, _ := git(t.Context(), projectDir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "master" {
+			t.Errorf("project branch = %q, want master", branch)
+		}
+		if _, err := os.Stat(filepath.Join(projectDir, "agent.txt")); err != nil {
+			t.Errorf("agent commit not synced to project: %v", err)
+		}
+	})
+
+	t.Run("keeps an existing branch", func(t *testing.T) {
+		projectDir := newMasterProject(t)
+		if err := InitUpstream(t.Context(), projectDir, "master", constants.TaskLockDir); err != nil {
+			t.Fatalf("InitUpstream: %v", err)
+		}
+		upstreamPath := filepath.Join(projectDir, constants.UpstreamDir)
+
+		if head, _ := git(t.Context(), upstreamPath, "symbolic-ref", "--short", "HEAD"); head != "master" {
+			t.Errorf("upstream HEAD = %q, want master", head)
+		}
+		if _, err := git(t.Context(), upstreamPath, "rev-parse", "--verify", "-q", "refs/heads/main"); err == nil {
+			t.Error("expected no main branch to be created")
+		}
+	})
+}
+
 func TestCloneForAgent(t *testing.T) {
 	t.Run("clones and sets git identity", func(t *testing.T) {
 		_, upstreamPath := setupUpstream(t)
 
 		destDir := filepath.Join(t.TempDir(), "agent-1")
-		if err := CloneForAgent(upstreamPath, 1, destDir); err != nil {
+		if err := CloneForAgent(t.Context(), upstreamPath, 1, destDir, CloneOpts{}); err != nil {
 			t.Fatalf("CloneForAgent: %v", err)
 		}
 
@@ -235,7 +319,7 @@ func TestCloneForAgent(t *testing.T) {
 		}
 
 		// Verify git config.
-		name, err := git(destDir, "config", "user.name")
+		name, err := git(t.Context(), destDir, "config", "user.name")
 		if err != nil {
 			t.Fatalf("get user.name: %v", err)
 		}
@@ -243,7 +327,7 @@ func TestCloneForAgent(t *testing.T) {
 			t.Errorf("user.name = %q, want %q", name, "agent-1")
 		}
 
-		email, err := git(destDir, "config", "user.email")
+		email, err := git(t.Context(), destDir, "config", "user.email")
 		if err != nil {
 			t.Fatalf("get user.email: %v", err)
 		}
@@ -261,12 +345,12 @@ func TestCloneForAgent(t *testing.T) {
 		_, upstreamPath := setupUpstream(t)
 
 		destDir := filepath.Join(t.TempDir(), "agent-5")
-		if err := CloneForAgent(upstreamPath, 5, destDir); err != nil {
+		if err := CloneForAgent(t.Context(), upstreamPath, 5, destDir, CloneOpts{}); err != nil {
 			t.Fatalf("CloneForAgent: %v", err)
 		}
 
 		// Verify remote points to upstream.
-		remote, err := git(destDir, "remote", "get-url", "origin")
+		remote, err := git(t.Context(), destDir, "remote", "get-url", "origin")
 		if err != nil {
 			t.Fatalf("get remote url: %v", err)
 		}
@@ -281,11 +365,11 @@ func TestCloneForAgent(t *testing.T) {
 
 		for i := 1; i <= 3; i++ {
 			dest := filepath.Join(base, "agent")
-			if err := CloneForAgent(upstreamPath, i, dest); err != nil {
-				t.Fatalf("CloneForAgent(%d): %v", i, err)
+			if err := CloneForAgent(t.Context(), upstreamPath, i, dest, CloneOpts{}); err != nil {
+				t.Fatalf("CloneForAgent(t.Context(), %d): %v", i, err)
 			}
 			// Verify identity is independent.
-			name, _ := git(dest, "config", "user.name")
+			name, _ := git(t.Context(), dest, "config", "user.name")
 			if expected := "agent-" + strings.TrimPrefix(name, "agent-"); name != expected {
 				t.Errorf("agent %d: unexpected name %q", i, name)
 			}
@@ -295,7 +379,7 @@ func TestCloneForAgent(t *testing.T) {
 	})
 
 	t.Run("error includes agent ID context", func(t *testing.T) {
-		err := CloneForAgent("/nonexistent/upstream", 42, filepath.Join(t.TempDir(), "dest"))
+		err := CloneForAgent(t.Context(), "/nonexistent/upstream", 42, filepath.Join(t.TempDir(), "dest"), CloneOpts{})
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -306,6 +390,32 @@ func TestCloneForAgent(t *testing.T) {
 			t.Errorf("error should have gitops prefix: %v", err)
 		}
 	})
+
+	t.Run("configures commit signing", func(t *testing.T) {
+		_, upstreamPath := setupUpstream(t)
+
+		destDir := filepath.Join(t.TempDir(), "agent-2")
+		opts := CloneOpts{SignCommits: true, SigningKey: "ABCDEF0123456789"}
+		if err := CloneForAgent(t.Context(), upstreamPath, 2, destDir, opts); err != nil {
+			t.Fatalf("CloneForAgent: %v", err)
+		}
+
+		if got, _ := git(t.Context(), destDir, "config", "--local", "commit.gpgsign"); got != "true" {
+			t.Errorf("commit.gpgsign = %q, want %q", got, "true")
+		}
+		if got, _ := git(t.Context(), destDir, "config", "--local", "user.signingkey"); got != "ABCDEF0123456789" {
+			t.Errorf("user.signingkey = %q, want %q", got, "ABCDEF0123456789")
+		}
+
+		// Without signing, nothing is set locally.
+		plainDir := filepath.Join(t.TempDir(), "agent-3")
+		if err := CloneForAgent(t.Context(), upstreamPath, 3, plainDir, CloneOpts{}); err != nil {
+			t.Fatalf("CloneForAgent: %v", err)
+		}
+		if got, err := git(t.Context(), plainDir, "config", "--local", "commit.gpgsign"); err == nil {
+			t.Errorf("commit.gpgsign = %q, want unset", got)
+		}
+	})
 }
 
 func TestSyncToWorkingCopy(t *testing.T) {
@@ -313,7 +423,7 @@ func TestSyncToWorkingCopy(t *testing.T) {
 		_, upstreamPath := setupUpstream(t)
 		wcPath := filepath.Join(t.TempDir(), "wc")
 
-		summary, err := SyncToWorkingCopy(upstreamPath, wcPath)
+		summary, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath)
 		if err != nil {
 			t.Fatalf("SyncToWorkingCopy (initial): %v", err)
 		}
@@ -333,12 +443,12 @@ func TestSyncToWorkingCopy(t *testing.T) {
 		wcPath := filepath.Join(t.TempDir(), "wc")
 
 		// Initial sync.
-		if _, err := SyncToWorkingCopy(upstreamPath, wcPath); err != nil {
+		if _, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath); err != nil {
 			t.Fatalf("initial sync: %v", err)
 		}
 
 		// Second sync — no changes.
-		summary, err := SyncToWorkingCopy(upstreamPath, wcPath)
+		summary, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath)
 		if err != nil {
 			t.Fatalf("second sync: %v", err)
 		}
@@ -352,26 +462,26 @@ func TestSyncToWorkingCopy(t *testing.T) {
 		wcPath := filepath.Join(t.TempDir(), "wc")
 
 		// Initial sync.
-		if _, err := SyncToWorkingCopy(upstreamPath, wcPath); err != nil {
+		if _, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath); err != nil {
 			t.Fatalf("initial sync: %v", err)
 		}
 
 		// Push a new commit from a separate clone.
 		pusherDir := filepath.Join(t.TempDir(), "pusher")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
 			t.Fatalf("clone pusher: %v", err)
 		}
-		_, _ = git(pusherDir, "config", "user.name", "test")
-		_, _ = git(pusherDir, "config", "user.email", "test@test")
+		_, _ = git(t.Context(), pusherDir, "config", "user.name", "test")
+		_, _ = git(t.Context(), pusherDir, "config", "user.email", "test@test")
 		_ = os.WriteFile(filepath.Join(pusherDir, "newfile.txt"), []byte("hello"), 0644)
-		_, _ = git(pusherDir, "add", ".")
-		_, _ = git(pusherDir, "commit", "-m", "add newfile")
-		if _, err := git(pusherDir, "push"); err != nil {
+		_, _ = git(t.Context(), pusherDir, "add", ".")
+		_, _ = git(t.Context(), pusherDir, "commit", "-m", "add newfile")
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatalf("push from pusher: %v", err)
 		}
 
 		// Sync should pick up the new commit.
-		summary, err := SyncToWorkingCopy(upstreamPath, wcPath)
+		summary, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath)
 		if err != nil {
 			t.Fatalf("sync after push: %v", err)
 		}
@@ -390,28 +500,28 @@ func TestSyncToWorkingCopy(t *testing.T) {
 		wcPath := filepath.Join(t.TempDir(), "wc")
 
 		// Initial sync.
-		if _, err := SyncToWorkingCopy(upstreamPath, wcPath); err != nil {
+		if _, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath); err != nil {
 			t.Fatalf("initial sync: %v", err)
 		}
 
 		// Push multiple commits.
 		pusherDir := filepath.Join(t.TempDir(), "pusher")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
 			t.Fatalf("clone pusher: %v", err)
 		}
-		_, _ = git(pusherDir, "config", "user.name", "test")
-		_, _ = git(pusherDir, "config", "user.email", "test@test")
+		_, _ = git(t.Context(), pusherDir, "config", "user.name", "test")
+		_, _ = git(t.Context(), pusherDir, "config", "user.email", "test@test")
 
 		for i := 1; i <= 3; i++ {
 			_ = os.WriteFile(filepath.Join(pusherDir, "file"+strings.Repeat("x", i)+".txt"), []byte("data"), 0644)
-			_, _ = git(pusherDir, "add", ".")
-			_, _ = git(pusherDir, "commit", "-m", "commit "+strings.Repeat("x", i))
+			_, _ = git(t.Context(), pusherDir, "add", ".")
+			_, _ = git(t.Context(), pusherDir, "commit", "-m", "commit "+strings.Repeat("x", i))
 		}
-		if _, err := git(pusherDir, "push"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatalf("push: %v", err)
 		}
 
-		summary, err := SyncToWorkingCopy(upstreamPath, wcPath)
+		summary, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath)
 		if err != nil {
 			t.Fatalf("sync: %v", err)
 		}
@@ -422,7 +532,7 @@ func TestSyncToWorkingCopy(t *testing.T) {
 	})
 
 	t.Run("error wrapping includes context", func(t *testing.T) {
-		_, err := SyncToWorkingCopy("/nonexistent/upstream.git", filepath.Join(t.TempDir(), "wc"))
+		_, err := SyncToWorkingCopy(t.Context(), "/nonexistent/upstream.git", filepath.Join(t.TempDir(), "wc"))
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -436,7 +546,7 @@ func TestSyncToWorkingCopy(t *testing.T) {
 		// Use a path with nested non-existent parents.
 		wcPath := filepath.Join(t.TempDir(), "a", "b", "wc")
 
-		summary, err := SyncToWorkingCopy(upstreamPath, wcPath)
+		summary, err := SyncToWorkingCopy(t.Context(), upstreamPath, wcPath)
 		if err != nil {
 			t.Fatalf("SyncToWorkingCopy: %v", err)
 		}
@@ -455,10 +565,10 @@ func TestCloneForAgent_ConfigErrors(t *testing.T) {
 
 		for _, id := range []int{1, 10, 100} {
 			destDir := filepath.Join(t.TempDir(), "agent")
-			if err := CloneForAgent(upstreamPath, id, destDir); err != nil {
-				t.Fatalf("CloneForAgent(%d): %v", id, err)
+			if err := CloneForAgent(t.Context(), upstreamPath, id, destDir, CloneOpts{}); err != nil {
+				t.Fatalf("CloneForAgent(t.Context(), %d): %v", id, err)
 			}
-			name, err := git(destDir, "config", "user.name")
+			name, err := git(t.Context(), destDir, "config", "user.name")
 			if err != nil {
 				t.Fatalf("get user.name: %v", err)
 			}
@@ -486,7 +596,7 @@ func TestInitUpstream_GitCloneFailure(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := InitUpstream(projectDir)
+	err := InitUpstream(t.Context(), projectDir, "", constants.TaskLockDir)
 	if err == nil {
 		t.Fatal("expected error when upstream.git is a file")
 	}
@@ -504,7 +614,7 @@ func TestSyncToWorkingCopy_CorruptedRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err := SyncToWorkingCopy("/some/upstream", wcPath)
+	_, err := SyncToWorkingCopy(t.Context(), "/some/upstream", wcPath)
 	if err == nil {
 		t.Fatal("expected error for corrupted .git")
 	}
@@ -529,7 +639,7 @@ func TestSyncToWorkingCopy_MkdirAllFailure(t *testing.T) {
 	// wcPath = readonly/sub/wc → parent = readonly/sub → MkdirAll fails.
 	wcPath := filepath.Join(readonlyDir, "sub", "wc")
 
-	_, err := SyncToWorkingCopy("/some/upstream", wcPath)
+	_, err := SyncToWorkingCopy(t.Context(), "/some/upstream", wcPath)
 	if err == nil {
 		t.Fatal("expected error when parent can't be created")
 	}
@@ -544,30 +654,30 @@ func TestSyncToProjectDir(t *testing.T) {
 
 		// Push a commit to upstream (simulating an agent).
 		pusherDir := filepath.Join(t.TempDir(), "agent")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
 			t.Fatalf("clone for agent: %v", err)
 		}
-		if _, err := git(pusherDir, "config", "user.name", "agent-1"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.name", "agent-1"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "config", "user.email", "agent-1@metamorph.local"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.email", "agent-1@metamorph.local"); err != nil {
 			t.Fatal(err)
 		}
 		if err := os.WriteFile(filepath.Join(pusherDir, "feature.go"), []byte("package main\n"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), pusherDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "commit", "-m", "feat: add feature"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "commit", "-m", "feat: add feature"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "push"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatal(err)
 		}
 
 		// Sync to project.
-		summary, err := SyncToProjectDir(upstreamPath, projectDir)
+		summary, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir)
 		if err != nil {
 			t.Fatalf("SyncToProjectDir: %v", err)
 		}
@@ -587,30 +697,30 @@ func TestSyncToProjectDir(t *testing.T) {
 
 		// Push first commit.
 		pusherDir := filepath.Join(t.TempDir(), "agent")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "config", "user.name", "agent-1"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.name", "agent-1"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "config", "user.email", "agent-1@test"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.email", "agent-1@test"); err != nil {
 			t.Fatal(err)
 		}
 		if err := os.WriteFile(filepath.Join(pusherDir, "first.txt"), []byte("first"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), pusherDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "commit", "-m", "first commit"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "commit", "-m", "first commit"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "push"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatal(err)
 		}
 
 		// First sync.
-		summary1, err := SyncToProjectDir(upstreamPath, projectDir)
+		summary1, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir)
 		if err != nil {
 			t.Fatalf("first sync: %v", err)
 		}
@@ -622,18 +732,18 @@ func TestSyncToProjectDir(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(pusherDir, "second.txt"), []byte("second"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), pusherDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "commit", "-m", "second commit"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "commit", "-m", "second commit"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "push"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatal(err)
 		}
 
 		// Second sync — should only include the new commit.
-		summary2, err := SyncToProjectDir(upstreamPath, projectDir)
+		summary2, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir)
 		if err != nil {
 			t.Fatalf("second sync: %v", err)
 		}
@@ -649,12 +759,12 @@ func TestSyncToProjectDir(t *testing.T) {
 		projectDir, upstreamPath := setupUpstream(t)
 
 		// First sync to bring in any scaffold commits.
-		if _, err := SyncToProjectDir(upstreamPath, projectDir); err != nil {
+		if _, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir); err != nil {
 			t.Fatalf("initial SyncToProjectDir: %v", err)
 		}
 
 		// Second sync — should be a no-op.
-		summary, err := SyncToProjectDir(upstreamPath, projectDir)
+		summary, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir)
 		if err != nil {
 			t.Fatalf("SyncToProjectDir: %v", err)
 		}
@@ -665,7 +775,7 @@ func TestSyncToProjectDir(t *testing.T) {
 
 	t.Run("errors when not a git repo", func(t *testing.T) {
 		notARepo := t.TempDir()
-		_, err := SyncToProjectDir("/some/upstream", notARepo)
+		_, err := SyncToProjectDir(t.Context(), "/some/upstream", notARepo)
 		if err == nil {
 			t.Fatal("expected error for non-git-repo project dir")
 		}
@@ -679,26 +789,26 @@ func TestSyncToProjectDir(t *testing.T) {
 
 		// Push a conflicting change via upstream (simulating an agent).
 		pusherDir := filepath.Join(t.TempDir(), "agent")
-		if _, err := git(t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
+		if _, err := git(t.Context(), t.TempDir(), "clone", upstreamPath, pusherDir); err != nil {
 			t.Fatalf("clone for agent: %v", err)
 		}
-		if _, err := git(pusherDir, "config", "user.name", "agent-1"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.name", "agent-1"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "config", "user.email", "agent-1@test"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "config", "user.email", "agent-1@test"); err != nil {
 			t.Fatal(err)
 		}
 		// Write a file that will conflict.
 		if err := os.WriteFile(filepath.Join(pusherDir, "conflict.txt"), []byte("agent version\n"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), pusherDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "commit", "-m", "agent: add conflict.txt"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "commit", "-m", "agent: add conflict.txt"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(pusherDir, "push"); err != nil {
+		if _, err := git(t.Context(), pusherDir, "push"); err != nil {
 			t.Fatal(err)
 		}
 
@@ -706,15 +816,15 @@ func TestSyncToProjectDir(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(projectDir, "conflict.txt"), []byte("project version\n"), 0644); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "add", "."); err != nil {
+		if _, err := git(t.Context(), projectDir, "add", "."); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := git(projectDir, "commit", "-m", "project: add conflict.txt"); err != nil {
+		if _, err := git(t.Context(), projectDir, "commit", "-m", "project: add conflict.txt"); err != nil {
 			t.Fatal(err)
 		}
 
 		// Sync should auto-resolve the conflict in favor of upstream (theirs).
-		_, err := SyncToProjectDir(upstreamPath, projectDir)
+		_, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir)
 		if err != nil {
 			t.Fatalf("expected auto-resolved merge, got error: %v", err)
 		}
@@ -729,3 +839,410 @@ func TestSyncToProjectDir(t *testing.T) {
 		}
 	})
 }
+
+// commitAndPush writes content to name in dir, commits it and pushes HEAD to
+// origin (forced, as agents do in branch-per-agent mode).
+func commitAndPush(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(t.Context(), dir, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(t.Context(), dir, "commit", "-m", "update "+name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(t.Context(), dir, "push", "--force", "origin", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncToProjectDirWithStrategy(t *testing.T) {
+	// setup returns an up-to-date project and an agent clone that has
+	// pushed shared.txt, so both sides can go on to change it.
+	setup := func(t *testing.T) (projectDir, upstreamPath, agentDir string) {
+		t.Helper()
+		projectDir, upstreamPath = setupUpstream(t)
+		agentDir = filepath.Join(t.TempDir(), "agent-1")
+		if err := CloneForAgent(t.Context(), upstreamPath, 1, agentDir, CloneOpts{}); err != nil {
+			t.Fatal(err)
+		}
+		commitAndPush(t, agentDir, "shared.txt", "base\n")
+		if _, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir); err != nil {
+			t.Fatal(err)
+		}
+		return projectDir, upstreamPath, agentDir
+	}
+	commitLocal := func(t *testing.T, dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := git(t.Context(), dir, "add", name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := git(t.Context(), dir, "commit", "-m", "local "+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(t *testing.T, path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("rebase replays local commits onto agent work", func(t *testing.T) {
+		projectDir, upstreamPath, agentDir := setup(t)
+		commitLocal(t, projectDir, "local.txt", "mine\n")
+		commitAndPush(t, agentDir, "agent.txt", "theirs\n")
+		// Uncommitted edits are stashed and restored around the rebase.
+		if err := os.WriteFile(filepath.Join(projectDir, "README.md"), []byte("# Edited\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		summary, err := SyncToProjectDirWithStrategy(t.Context(), upstreamPath, projectDir, SyncRebase)
+		if err != nil {
+			t.Fatalf("SyncToProjectDirWithStrategy: %v", err)
+		}
+		if !strings.Contains(summary, "update agent.txt") || strings.Contains(summary, "local local.txt") {
+			t.Errorf("summary should list only agent commits, got %q", summary)
+		}
+
+		if subject, _ := git(t.Context(), projectDir, "log", "-1", "--format=%s"); subject != "local local.txt" {
+			t.Errorf("HEAD = %q, want the local commit on top", subject)
+		}
+		if subject, _ := git(t.Context(), projectDir, "log", "-1", "--format=%s", "HEAD~1"); subject != "update agent.txt" {
+			t.Errorf("HEAD~1 = %q, want the agent commit", subject)
+		}
+		if merges, _ := git(t.Context(), projectDir, "rev-list", "--merges", "--count", "HEAD"); merges != "0" {
+			t.Errorf("rebase should not create merge commits, found %s", merges)
+		}
+		if got := readFile(t, filepath.Join(projectDir, "README.md")); got != "# Edited\n" {
+			t.Errorf("uncommitted edit lost: README.md = %q", got)
+		}
+	})
+
+	t.Run("rebase conflict is aborted", func(t *testing.T) {
+		projectDir, upstreamPath, agentDir := setup(t)
+		commitLocal(t, projectDir, "shared.txt", "mine\n")
+		commitAndPush(t, agentDir, "shared.txt", "theirs\n")
+		headBefore, _ := git(t.Context(), projectDir, "rev-parse", "HEAD")
+
+		_, err := SyncToProjectDirWithStrategy(t.Context(), upstreamPath, projectDir, SyncRebase)
+		if err == nil || !strings.Contains(err.Error(), "rebase failed") {
+			t.Fatalf("expected rebase failure, got %v", err)
+		}
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("expected a *ConflictError, got %T", err)
+		}
+		if !reflect.DeepEqual(conflict.Files, []string{"shared.txt"}) {
+			t.Errorf("conflict files = %v, want [shared.txt]", conflict.Files)
+		}
+		if upstreamHead, _ := git(t.Context(), upstreamPath, "rev-parse", "HEAD"); conflict.Commit != upstreamHead {
+			t.Errorf("conflict commit = %s, want upstream %s", conflict.Commit, upstreamHead)
+		}
+
+		if headAfter, _ := git(t.Context(), projectDir, "rev-parse", "HEAD"); headAfter != headBefore {
+			t.Errorf("HEAD moved from %s to %s after aborted rebase", headBefore, headAfter)
+		}
+		if _, err := os.Stat(filepath.Join(projectDir, ".git", "rebase-merge")); !os.IsNotExist(err) {
+			t.Error("rebase should not be left in progress")
+		}
+		if got := readFile(t, filepath.Join(projectDir, "shared.txt")); got != "mine\n" {
+			t.Errorf("shared.txt = %q, want local content", got)
+		}
+	})
+
+	t.Run("reset discards conflicting local work", func(t *testing.T) {
+		projectDir, upstreamPath, agentDir := setup(t)
+		commitLocal(t, projectDir, "shared.txt", "mine\n")
+		commitAndPush(t, agentDir, "shared.txt", "theirs\n")
+
+		summary, err := SyncToProjectDirWithStrategy(t.Context(), upstreamPath, projectDir, SyncReset)
+		if err != nil {
+			t.Fatalf("SyncToProjectDirWithStrategy: %v", err)
+		}
+		if !strings.Contains(summary, "update shared.txt") {
+			t.Errorf("summary should list the agent commit, got %q", summary)
+		}
+
+		upstreamHead, _ := git(t.Context(), upstreamPath, "rev-parse", "HEAD")
+		if head, _ := git(t.Context(), projectDir, "rev-parse", "HEAD"); head != upstreamHead {
+			t.Errorf("HEAD = %s, want upstream %s", head, upstreamHead)
+		}
+		if got := readFile(t, filepath.Join(projectDir, "shared.txt")); got != "theirs\n" {
+			t.Errorf("shared.txt = %q, want agent content", got)
+		}
+	})
+}
+
+func TestPendingCommits(t *testing.T) {
+	projectDir, upstreamPath := setupUpstream(t)
+
+	// Bring in the scaffold commit so the project starts up to date.
+	if _, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := PendingCommits(t.Context(), upstreamPath, projectDir)
+	if err != nil {
+		t.Fatalf("PendingCommits: %v", err)
+	}
+	if pending != "" {
+		t.Errorf("expected no pending commits before agents push, got %q", pending)
+	}
+
+	agentDir := filepath.Join(t.TempDir(), "agent-1")
+	if err := CloneForAgent(t.Context(), upstreamPath, 1, agentDir, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	commitAndPush(t, agentDir, "feature.go", "package main\n")
+
+	headBefore, _ := git(t.Context(), projectDir, "rev-parse", "HEAD")
+	pending, err = PendingCommits(t.Context(), upstreamPath, projectDir)
+	if err != nil {
+		t.Fatalf("PendingCommits: %v", err)
+	}
+	if !strings.Contains(pending, "update feature.go") {
+		t.Errorf("expected pushed commit in pending summary, got %q", pending)
+	}
+
+	// Previewing must not touch the project.
+	if headAfter, _ := git(t.Context(), projectDir, "rev-parse", "HEAD"); headAfter != headBefore {
+		t.Errorf("HEAD moved from %s to %s", headBefore, headAfter)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "feature.go")); !os.IsNotExist(err) {
+		t.Error("feature.go should not be in the project dir after a preview")
+	}
+
+	// Once synced, nothing is pending.
+	if _, err := SyncToProjectDir(t.Context(), upstreamPath, projectDir); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err = PendingCommits(t.Context(), upstreamPath, projectDir); err != nil || pending != "" {
+		t.Errorf("PendingCommits after sync = %q, %v; want none", pending, err)
+	}
+}
+
+func TestCloneForAgent_Depth(t *testing.T) {
+	_, upstreamPath := setupUpstream(t)
+
+	// Give upstream some history, including an agent branch.
+	writer := filepath.Join(t.TempDir(), "writer")
+	if err := CloneForAgent(t.Context(), upstreamPath, 9, writer, CloneOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		commitAndPush(t, writer, "history.txt", fmt.Sprintf("commit %d", i))
+	}
+	if _, err := git(t.Context(), writer, "push", "origin", "HEAD:refs/heads/agent-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	destDir := filepath.Join(t.TempDir(), "agent-2")
+	if err := CloneForAgent(t.Context(), upstreamPath, 2, destDir, CloneOpts{Depth: 1, BranchPerAgent: true}); err != nil {
+		t.Fatalf("CloneForAgent: %v", err)
+	}
+
+	if count, _ := git(t.Context(), destDir, "rev-list", "--count", "HEAD"); count != "1" {
+		t.Errorf("commits in clone = %s, want 1", count)
+	}
+	if shallow, _ := git(t.Context(), destDir, "rev-parse", "--is-shallow-repository"); shallow != "true" {
+		t.Errorf("is-shallow-repository = %q, want true", shallow)
+	}
+	if branch, _ := git(t.Context(), destDir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "agent-2" {
+		t.Errorf("branch = %q, want agent-2", branch)
+	}
+
+	// Pushing from a shallow clone still works.
+	commitAndPush(t, destDir, "shallow.txt", "from a shallow clone")
+	if _, err := git(t.Context(), upstreamPath, "cat-file", "-e", "agent-2:shallow.txt"); err != nil {
+		t.Errorf("push from shallow clone did not reach upstream: %v", err)
+	}
+}
+
+func TestCloneForAgent_AuthorIdentity(t *testing.T) {
+	_, upstreamPath := setupUpstream(t)
+
+	destDir := filepath.Join(t.TempDir(), "agent-4")
+	opts := CloneOpts{AuthorName: "Jane Doe", AuthorEmail: "jane@example.com"}
+	if err := CloneForAgent(t.Context(), upstreamPath, 4, destDir, opts); err != nil {
+		t.Fatalf("CloneForAgent: %v", err)
+	}
+
+	commitAndPush(t, destDir, "authored.txt", "authored by the user")
+
+	if got, _ := git(t.Context(), destDir, "log", "-1", "--format=%an <%ae>"); got != "Jane Doe <jane@example.com>" {
+		t.Errorf("author = %q, want configured identity", got)
+	}
+	if got, _ := git(t.Context(), destDir, "log", "-1", "--format=%cn <%ce>"); got != "agent-4 <agent-4@metamorph.local>" {
+		t.Errorf("committer = %q, want synthetic agent identity", got)
+	}
+}
+
+func TestCloneForAgent_BranchPerAgent(t *testing.T) {
+	_, upstreamPath := setupUpstream(t)
+
+	destDir := filepath.Join(t.TempDir(), "agent-3")
+	if err := CloneForAgent(t.Context(), upstreamPath, 3, destDir, CloneOpts{BranchPerAgent: true}); err != nil {
+		t.Fatalf("CloneForAgent: %v", err)
+	}
+	branch, err := git(t.Context(), destDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch != "agent-3" {
+		t.Fatalf("branch = %q, want %q", branch, "agent-3")
+	}
+	commitAndPush(t, destDir, "work.txt", "agent work")
+
+	// A fresh clone continues the existing branch.
+	againDir := filepath.Join(t.TempDir(), "agent-3-again")
+	if err := CloneForAgent(t.Context(), upstreamPath, 3, againDir, CloneOpts{BranchPerAgent: true}); err != nil {
+		t.Fatalf("CloneForAgent (existing branch): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(againDir, "work.txt")); err != nil {
+		t.Error("expected work.txt from the existing agent branch")
+	}
+}
+
+func TestMergeAgentBranches(t *testing.T) {
+	headFiles := func(t *testing.T, upstreamPath string) string {
+		t.Helper()
+		out, err := git(t.Context(), upstreamPath, "ls-tree", "--name-only", "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("fast-forwards a single branch", func(t *testing.T) {
+		_, upstreamPath := setupUpstream(t)
+		agentDir := filepath.Join(t.TempDir(), "agent-1")
+		if err := CloneForAgent(t.Context(), upstreamPath, 1, agentDir, CloneOpts{BranchPerAgent: true}); err != nil {
+			t.Fatal(err)
+		}
+		commitAndPush(t, agentDir, "one.txt", "one")
+
+		result, err := MergeAgentBranches(t.Context(), upstreamPath, []string{"agent-1", "agent-2"})
+		if err != nil {
+			t.Fatalf("MergeAgentBranches: %v", err)
+		}
+		if len(result.Merged) != 1 || result.Merged[0] != "agent-1" {
+			t.Errorf("Merged = %v, want [agent-1]", result.Merged)
+		}
+		head, _ := git(t.Context(), upstreamPath, "rev-parse", "HEAD")
+		tip, _ := git(t.Context(), upstreamPath, "rev-parse", "agent-1")
+		if head != tip {
+			t.Errorf("expected fast-forward to %s, HEAD is %s", tip, head)
+		}
+
+		// Nothing left to merge on the next call.
+		result, err = MergeAgentBranches(t.Context(), upstreamPath, []string{"agent-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Merged) != 0 {
+			t.Errorf("expected no merges on second call, got %v", result.Merged)
+		}
+	})
+
+	t.Run("creates merge commit for diverged branches", func(t *testing.T) {
+		_, upstreamPath := setupUpstream(t)
+		for i, name := range []string{"one.txt", "two.txt"} {
+			dir := filepath.Join(t.TempDir(), fmt.Sprintf("agent-%d", i))
+			if err := CloneForAgent(t.Context(), upstreamPath, i, dir, CloneOpts{BranchPerAgent: true}); err != nil {
+				t.Fatal(err)
+			}
+			commitAndPush(t, dir, name, name)
+		}
+
+		result, err := MergeAgentBranches(t.Context(), upstreamPath, []string{"agent-0", "agent-1"})
+		if err != nil {
+			t.Fatalf("MergeAgentBranches: %v", err)
+		}
+		if len(result.Merged) != 2 {
+			t.Errorf("Merged = %v, want both branches", result.Merged)
+		}
+		files := headFiles(t, upstreamPath)
+		if !strings.Contains(files, "one.txt") || !strings.Contains(files, "two.txt") {
+			t.Errorf("expected both files on default branch, got %q", files)
+		}
+		subject, _ := git(t.Context(), upstreamPath, "log", "-1", "--format=%s")
+		if subject != "metamorph: merge agent-1" {
+			t.Errorf("HEAD subject = %q, want merge commit", subject)
+		}
+	})
+
+	t.Run("leaves conflicting branch unmerged", func(t *testing.T) {
+		_, upstreamPath := setupUpstream(t)
+		for i := 0; i < 2; i++ {
+			dir := filepath.Join(t.TempDir(), fmt.Sprintf("agent-%d", i))
+			if err := CloneForAgent(t.Context(), upstreamPath, i, dir, CloneOpts{BranchPerAgent: true}); err != nil {
+				t.Fatal(err)
+			}
+			commitAndPush(t, dir, "README.md", fmt.Sprintf("agent %d\n", i))
+		}
+
+		result, err := MergeAgentBranches(t.Context(), upstreamPath, []string{"agent-0", "agent-1"})
+		if err != nil {
+			t.Fatalf("MergeAgentBranches: %v", err)
+		}
+		if len(result.Merged) != 1 || result.Merged[0] != "agent-0" {
+			t.Errorf("Merged = %v, want [agent-0]", result.Merged)
+		}
+		tip, _ := git(t.Context(), upstreamPath, "rev-parse", "agent-1")
+		if result.Conflicted["agent-1"] != tip {
+			t.Errorf("Conflicted = %v, want agent-1 at %s", result.Conflicted, tip)
+		}
+		if _, err := git(t.Context(), upstreamPath, "merge-base", "--is-ancestor", "agent-1", "HEAD"); err == nil {
+			t.Error("conflicting branch should not be merged")
+		}
+	})
+}
+
+func TestGC(t *testing.T) {
+	_, upstreamPath := setupUpstream(t)
+
+	if err := GC(t.Context(), upstreamPath); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if err := GC(t.Context(), filepath.Join(t.TempDir(), "missing.git")); err == nil {
+		t.Error("GC on a missing repo should fail")
+	}
+}
+
+func TestGit_ContextCancelsLongRunningCommand(t *testing.T) {
+	dir := t.TempDir()
+	initGitRepo(t, dir)
+
+	// A pre-commit hook that never finishes keeps `git commit -a` running,
+	// holding index.lock, until it is stopped. The hook drops its output so
+	// git's pipes close with it.
+	hook := "#!/bin/sh\nexec sleep 60 >/dev/null 2>&1\n"
+	if err := os.WriteFile(filepath.Join(dir, ".git", "hooks", "pre-commit"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := git(ctx, dir, "commit", "-a", "-m", "never lands")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("git returned after %v, want it interrupted promptly", elapsed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "index.lock")); !os.IsNotExist(err) {
+		t.Error("index.lock left behind; git should be interrupted, not killed")
+	}
+}
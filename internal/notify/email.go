@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSMTPPort is the submission port used when EmailOptions.Port is 0.
+const DefaultSMTPPort = 587
+
+// emailTimeout bounds a whole SMTP exchange, from dialling to QUIT, so a
+// slow or silent server can't stall the daemon's monitor loop.
+const emailTimeout = 15 * time.Second
+
+// EmailOptions configures email delivery over SMTP.
+type EmailOptions struct {
+	Host     string   // SMTP server host
+	Port     int      // SMTP server port (default DefaultSMTPPort)
+	From     string   // envelope and header sender
+	To       []string // recipients
+	Username string   // PLAIN auth user; no auth when empty
+	Password string
+}
+
+// EmailNotifier is a Notifier that emails events via SMTP. The server must
+// offer STARTTLS before credentials are sent, except on localhost.
+type EmailNotifier struct {
+	opts     EmailOptions
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error // sendMailWithTimeout, replaceable in tests
+}
+
+// NewEmailNotifier returns a Notifier that emails events to opts.To.
+func NewEmailNotifier(opts EmailOptions) *EmailNotifier {
+	if opts.Port == 0 {
+		opts.Port = DefaultSMTPPort
+	}
+	return &EmailNotifier{opts: opts, sendMail: sendMailWithTimeout(emailTimeout)}
+}
+
+// sendMailWithTimeout returns a function that works like smtp.SendMail but
+// gives up once timeout has passed since it started dialling.
+func sendMailWithTimeout(timeout time.Duration) func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	return func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+
+		host, _, _ := net.SplitHostPort(addr)
+		c, err := smtp.NewClient(conn, host)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = c.Close() }()
+
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+		if a != nil {
+			if ok, _ := c.Extension("AUTH"); !ok {
+				return errors.New("smtp: server doesn't support AUTH")
+			}
+			if err := c.Auth(a); err != nil {
+				return err
+			}
+		}
+		if err := c.Mail(from); err != nil {
+			return err
+		}
+		for _, rcpt := range to {
+			if err := c.Rcpt(rcpt); err != nil {
+				return err
+			}
+		}
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return c.Quit()
+	}
+}
+
+// Send implements Notifier.
+func (n *EmailNotifier) Send(event Event) error {
+	var auth smtp.Auth
+	if n.opts.Username != "" {
+		auth = smtp.PlainAuth("", n.opts.Username, n.opts.Password, n.opts.Host)
+	}
+	addr := net.JoinHostPort(n.opts.Host, strconv.Itoa(n.opts.Port))
+	msg := emailMessage(n.opts.From, n.opts.To, event)
+	if err := n.sendMail(addr, auth, n.opts.From, n.opts.To, msg); err != nil {
+		return fmt.Errorf("notify: failed to send email via %s: %w", addr, err)
+	}
+	return nil
+}
+
+// emailSubject returns the subject line for an event email.
+func emailSubject(event Event) string {
+	return fmt.Sprintf("[metamorph] %s: %s", event.Project, event.Message)
+}
+
+// emailMessage renders an event as a plain-text RFC 5322 message.
+func emailMessage(from string, to []string, event Event) []byte {
+	date := event.Timestamp
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", headerValue(emailSubject(event))))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", event.Message)
+	fmt.Fprintf(&b, "Project: %s\r\n", event.Project)
+	for _, f := range summaryFields(event) {
+		if f.Items != nil {
+			fmt.Fprintf(&b, "%s:\r\n", f.Name)
+			for _, item := range f.Items {
+				fmt.Fprintf(&b, "    %s\r\n", item)
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", f.Name, strings.Trim(f.Value, "`"))
+	}
+	if !event.Timestamp.IsZero() {
+		fmt.Fprintf(&b, "Time: %s\r\n", event.Timestamp.Format(time.RFC3339))
+	}
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so event text can't inject extra headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
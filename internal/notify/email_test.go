@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"errors"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifier(t *testing.T) {
+	var (
+		gotAddr string
+		gotAuth smtp.Auth
+		gotFrom string
+		gotTo   []string
+		gotMsg  string
+	)
+	n := NewEmailNotifier(EmailOptions{
+		Host: "smtp.example.com",
+		From: "metamorph@example.com",
+		To:   []string{"dev@example.com", "ops@example.com"},
+	})
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, a, from, to, string(msg)
+		return nil
+	}
+
+	event := Event{
+		Type:      EventAgentCrashed,
+		AgentID:   2,
+		AgentRole: "tester",
+		Project:   "my-app",
+		Message:   "agent-2 crashed\nand restarted",
+		Timestamp: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Details:   map[string]interface{}{"exit_code": 137, "files": []string{"a.go", "b.go"}},
+	}
+	if err := n.Send(event); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if gotAddr != "smtp.example.com:587" {
+		t.Errorf("addr = %q, want the default submission port", gotAddr)
+	}
+	if gotAuth != nil {
+		t.Error("expected no auth without a username")
+	}
+	if gotFrom != "metamorph@example.com" || len(gotTo) != 2 {
+		t.Errorf("from, to = %q, %v", gotFrom, gotTo)
+	}
+	for _, want := range []string{
+		"To: dev@example.com, ops@example.com\r\n",
+		"Subject: [metamorph] my-app: agent-2 crashed and restarted\r\n",
+		"Date: Wed, 15 Jan 2025 10:30:00 +0000\r\n",
+		"\r\n\r\nagent-2 crashed\nand restarted\r\n",
+		"Project: my-app\r\n",
+		"Event: agent_crashed\r\n",
+		"Agent: agent-2 (tester)\r\n",
+		"exit_code: 137\r\n",
+		"files:\r\n    a.go\r\n    b.go\r\n",
+		"Time: 2025-01-15T10:30:00Z\r\n",
+	} {
+		if !strings.Contains(gotMsg, want) {
+			t.Errorf("message missing %q:\n%s", want, gotMsg)
+		}
+	}
+}
+
+func TestEmailNotifier_AuthAndErrors(t *testing.T) {
+	n := NewEmailNotifier(EmailOptions{
+		Host:     "smtp.example.com",
+		Port:     2525,
+		From:     "metamorph@example.com",
+		To:       []string{"dev@example.com"},
+		Username: "user",
+		Password: "secret",
+	})
+	var gotAuth smtp.Auth
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAuth = a
+		return errors.New("connection refused")
+	}
+
+	err := n.Send(Event{Type: EventDaemonStarted, Project: "my-app"})
+	if err == nil || !strings.Contains(err.Error(), "failed to send email via smtp.example.com:2525: connection refused") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if gotAuth == nil {
+		t.Error("expected PLAIN auth when a username is set")
+	}
+}
+
+func TestEmailSubjectEncoding(t *testing.T) {
+	msg := string(emailMessage("a@example.com", []string{"b@example.com"}, Event{Project: "café", Message: "build ✓"}))
+	want := "Subject: " + mime.QEncoding.Encode("UTF-8", "[metamorph] café: build ✓") + "\r\n"
+	if !strings.Contains(msg, want) {
+		t.Errorf("message missing %q:\n%s", want, msg)
+	}
+	if strings.Contains(msg, "Subject: [metamorph] café") {
+		t.Error("non-ASCII subject was not encoded")
+	}
+}
+
+func TestSendMailWithTimeout(t *testing.T) {
+	// A server that accepts the connection but never sends its greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	start := time.Now()
+	err = sendMailWithTimeout(100*time.Millisecond)(ln.Addr().String(), nil, "a@example.com", []string{"b@example.com"}, []byte("hi"))
+	if err == nil {
+		t.Fatal("expected a timeout from a silent server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send took %s, want it bounded by the timeout", elapsed)
+	}
+}
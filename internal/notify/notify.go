@@ -2,21 +2,57 @@ package notify
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Event types.
 const (
-	EventAgentCrashed  = "agent_crashed"
-	EventCommitsPushed = "commits_pushed"
-	EventStaleLock     = "stale_lock"
-	EventTestFailure   = "test_failure"
+	EventAgentCrashed   = "agent_crashed"
+	EventAgentFailed    = "agent_failed"
+	EventAgentsScaled   = "agents_scaled"
+	EventCommitsPushed  = "commits_pushed"
+	EventDaemonDown     = "daemon_down"
+	EventDaemonStarted  = "daemon_started"
+	EventDiskFull       = "disk_full"
+	EventMergeConflict  = "merge_conflict"
+	EventMonitorStall   = "monitor_stall"
+	EventStaleLock      = "stale_lock"
+	EventSyncConflict   = "sync_conflict"
+	EventSyncTestFailed = "sync_test_failed"
+	EventTaskCompleted  = "task_completed"
+	EventTestFailure    = "test_failure"
 )
 
+// EventTypes lists every event type the daemon sends, for validating
+// notifications.enabled_events.
+var EventTypes = []string{
+	EventAgentCrashed,
+	EventAgentFailed,
+	EventAgentsScaled,
+	EventCommitsPushed,
+	EventDaemonDown,
+	EventDaemonStarted,
+	EventDiskFull,
+	EventMergeConflict,
+	EventMonitorStall,
+	EventStaleLock,
+	EventSyncConflict,
+	EventSyncTestFailed,
+	EventTaskCompleted,
+	EventTestFailure,
+}
+
 // Event represents a notification to be sent to a webhook.
 type Event struct {
 	Type      string                 `json:"event"`
@@ -28,30 +64,292 @@ type Event struct {
 	Details   map[string]interface{} `json:"details,omitempty"`
 }
 
-// Send POSTs the event as JSON to webhookURL with a 5s timeout.
-// Returns nil if webhookURL is empty (notifications disabled).
+// Payload formats.
+const (
+	FormatJSON    = "json"    // the raw Event struct
+	FormatSlack   = "slack"   // a Slack incoming-webhook message
+	FormatDiscord = "discord" // a Discord webhook message with an embed
+)
+
+// Default delivery settings used by Send.
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = time.Second
+	requestTimeout     = 5 * time.Second
+)
+
+// Options configures webhook delivery.
+type Options struct {
+	MaxAttempts int           // total attempts including the first (default DefaultMaxAttempts)
+	BaseDelay   time.Duration // delay before the first retry, doubled for each subsequent retry (default DefaultBaseDelay)
+	Format      string        // payload format: FormatJSON (default), FormatSlack or FormatDiscord
+	// SigningSecret, when set, signs each request body; see Sign.
+	SigningSecret string
+	// Headers are added to every request, e.g. Authorization for an auth
+	// proxy. Content-Type defaults to application/json and is only replaced
+	// if Headers sets it explicitly.
+	Headers map[string]string
+}
+
+// SignatureHeader carries the HMAC signature of a signed webhook request.
+const SignatureHeader = "X-Metamorph-Signature"
+
+// Notifier delivers events to an external service.
+type Notifier interface {
+	Send(event Event) error
+}
+
+// HTTPNotifier is a Notifier that POSTs events to a webhook; see
+// SendWithOptions.
+type HTTPNotifier struct {
+	URL     string
+	Options Options
+}
+
+// NewHTTPNotifier returns a Notifier that POSTs events to webhookURL.
+func NewHTTPNotifier(webhookURL string, opts Options) *HTTPNotifier {
+	return &HTTPNotifier{URL: webhookURL, Options: opts}
+}
+
+// Send implements Notifier.
+func (n *HTTPNotifier) Send(event Event) error {
+	return SendWithOptions(n.URL, event, n.Options)
+}
+
+// MultiNotifier sends each event to every Notifier in turn, returning the
+// joined errors of those that failed.
+type MultiNotifier []Notifier
+
+// Send implements Notifier.
+func (m MultiNotifier) Send(event Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Send(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Send POSTs the event as JSON to webhookURL using the default retry
+// settings. Returns nil if webhookURL is empty (notifications disabled).
 func Send(webhookURL string, event Event) error {
+	return SendWithOptions(webhookURL, event, Options{})
+}
+
+// SendWithOptions POSTs the event as JSON to webhookURL with a 5s timeout per
+// attempt. Connection errors and 5xx responses are retried with exponential
+// backoff; 4xx responses are returned immediately. Returns nil if webhookURL
+// is empty (notifications disabled).
+func SendWithOptions(webhookURL string, event Event, opts Options) error {
 	if webhookURL == "" {
 		return nil
 	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultBaseDelay
+	}
 
-	body, err := json.Marshal(event)
+	body, err := buildPayload(event, opts.Format)
 	if err != nil {
 		return fmt.Errorf("notify: failed to marshal event: %w", err)
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	client := &http.Client{Timeout: requestTimeout}
+	delay := opts.BaseDelay
+	for attempt := 1; ; attempt++ {
+		retryable, err := post(client, webhookURL, body, opts)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= opts.MaxAttempts {
+			return err
+		}
+
+		slog.Warn("notify: retrying webhook", "url", webhookURL, "attempt", attempt, "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes a single webhook request. It reports whether a failure is worth
+// retrying (connection errors and 5xx responses).
+func post(client *http.Client, webhookURL string, body []byte, opts Options) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("notify: invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	if opts.SigningSecret != "" {
+		req.Header.Set(SignatureHeader, Sign(opts.SigningSecret, body))
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		slog.Error("notify: webhook request failed", "url", webhookURL, "error", err)
-		return fmt.Errorf("notify: webhook request failed: %w", err)
+		return true, fmt.Errorf("notify: webhook request failed: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode >= 400 {
 		slog.Error("notify: webhook returned error", "url", webhookURL, "status", resp.StatusCode)
-		return fmt.Errorf("notify: webhook returned status %d", resp.StatusCode)
+		return resp.StatusCode >= 500, fmt.Errorf("notify: webhook returned status %d", resp.StatusCode)
 	}
 
-	return nil
+	return false, nil
+}
+
+// Sign returns the X-Metamorph-Signature header value for body: the string
+// "sha256=" followed by the lowercase hex HMAC-SHA256 of the exact request
+// body bytes, keyed with secret. Receivers should recompute it over the raw
+// body and compare with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildPayload encodes the event in the requested format.
+func buildPayload(event Event, format string) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(slackMessage{Text: slackText(event)})
+	case FormatDiscord:
+		return json.Marshal(discordPayload(event))
+	}
+	return json.Marshal(event)
+}
+
+// summaryField is one line of the human-readable event summary shared by the
+// chat formats. List details keep their items separate so each format can
+// lay them out.
+type summaryField struct {
+	Name  string
+	Value string
+	Items []string
+}
+
+// summaryFields returns the event type, agent (if any) and details, sorted
+// by key, as displayed by the chat formats.
+func summaryFields(event Event) []summaryField {
+	fields := []summaryField{{Name: "Event", Value: "`" + event.Type + "`"}}
+	if event.AgentID > 0 {
+		agent := fmt.Sprintf("agent-%d", event.AgentID)
+		if event.AgentRole != "" {
+			agent += fmt.Sprintf(" (%s)", event.AgentRole)
+		}
+		fields = append(fields, summaryField{Name: "Agent", Value: agent})
+	}
+
+	keys := make([]string, 0, len(event.Details))
+	for k := range event.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch v := event.Details[k].(type) {
+		case []string:
+			fields = append(fields, summaryField{Name: k, Items: v})
+		case map[string]int:
+			fields = append(fields, summaryField{Name: k, Value: formatCounts(v)})
+		default:
+			fields = append(fields, summaryField{Name: k, Value: fmt.Sprint(v)})
+		}
+	}
+	return fields
+}
+
+// formatCounts renders counts as "a: 1, b: 2", sorted by key.
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s: %d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// slackMessage is the minimal Slack incoming-webhook payload.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// slackText renders an event as a human-readable Slack message.
+func slackText(event Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*[%s]* %s", event.Project, event.Message)
+	for _, f := range summaryFields(event) {
+		if f.Items != nil {
+			fmt.Fprintf(&b, "\n• %s:", f.Name)
+			for _, item := range f.Items {
+				fmt.Fprintf(&b, "\n    %s", item)
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "\n• %s: %s", f.Name, f.Value)
+	}
+	return b.String()
+}
+
+// discordFieldLimit is the longest value, in characters, Discord accepts in
+// an embed field.
+const discordFieldLimit = 1024
+
+// discordMessage is a Discord webhook payload: the summary as content and
+// an embed with the project, agent and details.
+type discordMessage struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Timestamp string         `json:"timestamp,omitempty"`
+	Fields    []discordField `json:"fields"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// discordPayload renders an event as a Discord webhook message.
+func discordPayload(event Event) discordMessage {
+	embed := discordEmbed{Title: event.Type}
+	if !event.Timestamp.IsZero() {
+		embed.Timestamp = event.Timestamp.Format(time.RFC3339)
+	}
+	fields := append([]summaryField{{Name: "Project", Value: event.Project}}, summaryFields(event)...)
+	for _, f := range fields {
+		value := f.Value
+		if f.Items != nil {
+			value = strings.Join(f.Items, "\n")
+		}
+		if value == "" {
+			value = "-" // Discord rejects empty field values
+		}
+		if utf8.RuneCountInString(value) > discordFieldLimit {
+			value = string([]rune(value)[:discordFieldLimit-3]) + "..."
+		}
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   f.Name,
+			Value:  value,
+			Inline: f.Name == "Project" || f.Name == "Event" || f.Name == "Agent",
+		})
+	}
+
+	return discordMessage{
+		Content: fmt.Sprintf("**[%s]** %s", event.Project, event.Message),
+		Embeds:  []discordEmbed{embed},
+	}
 }
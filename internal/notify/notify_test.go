@@ -1,12 +1,20 @@
 package notify
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestEventSerialization(t *testing.T) {
@@ -188,3 +196,295 @@ func TestSend(t *testing.T) {
 		}
 	})
 }
+
+func TestSendWithOptions(t *testing.T) {
+	opts := Options{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	t.Run("retries server errors until success", func(t *testing.T) {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		if err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed}, opts); err != nil {
+			t.Fatalf("SendWithOptions: %v", err)
+		}
+		if got := atomic.LoadInt32(&attempts); got != 3 {
+			t.Errorf("attempts = %d, want 3", got)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed}, opts)
+		if err == nil || err.Error() != "notify: webhook returned status 502" {
+			t.Fatalf("error = %v", err)
+		}
+		if got := atomic.LoadInt32(&attempts); got != 3 {
+			t.Errorf("attempts = %d, want 3", got)
+		}
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+
+		if err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed}, opts); err == nil {
+			t.Fatal("expected error for 404 response")
+		}
+		if got := atomic.LoadInt32(&attempts); got != 1 {
+			t.Errorf("attempts = %d, want 1", got)
+		}
+	})
+}
+
+func TestSendWithOptions_SlackFormat(t *testing.T) {
+	var payload map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+	}))
+	defer srv.Close()
+
+	event := Event{
+		Type:      EventCommitsPushed,
+		Project:   "my-project",
+		Message:   "2 new commits pushed",
+		Timestamp: time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC),
+		Details: map[string]interface{}{
+			"count":   2,
+			"commits": []string{"abc123 Add parser", "def456 Fix tests"},
+		},
+	}
+
+	if err := SendWithOptions(srv.URL, event, Options{Format: FormatSlack}); err != nil {
+		t.Fatalf("SendWithOptions: %v", err)
+	}
+
+	if len(payload) != 1 {
+		t.Errorf("payload keys = %v, want only text", payload)
+	}
+	text, _ := payload["text"].(string)
+	for _, want := range []string{"my-project", "2 new commits pushed", "commits_pushed", "abc123 Add parser", "count: 2"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Slack text missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestSlackText(t *testing.T) {
+	text := slackText(Event{
+		Type:      EventAgentCrashed,
+		AgentID:   2,
+		AgentRole: "tester",
+		Project:   "proj",
+		Message:   "agent-2 (tester) crashed and was restarted",
+		Details:   map[string]interface{}{"restart_count": 3},
+	})
+
+	want := "*[proj]* agent-2 (tester) crashed and was restarted\n" +
+		"• Event: `agent_crashed`\n" +
+		"• Agent: agent-2 (tester)\n" +
+		"• restart_count: 3"
+	if text != want {
+		t.Errorf("slackText =\n%s\nwant\n%s", text, want)
+	}
+}
+
+func TestSlackText_Counts(t *testing.T) {
+	text := slackText(Event{
+		Type:    EventCommitsPushed,
+		Project: "proj",
+		Message: "3 new commit(s) pushed",
+		Details: map[string]interface{}{"by_type": map[string]int{"fix": 1, "feat": 2}},
+	})
+	if !strings.Contains(text, "• by_type: feat: 2, fix: 1") {
+		t.Errorf("expected counts sorted by type, got:\n%s", text)
+	}
+}
+
+func TestDiscordPayload(t *testing.T) {
+	body, err := buildPayload(Event{
+		Type:      EventCommitsPushed,
+		AgentID:   2,
+		AgentRole: "tester",
+		Project:   "proj",
+		Message:   "2 new commits pushed",
+		Timestamp: time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC),
+		Details: map[string]interface{}{
+			"count":   2,
+			"commits": []string{"abc123 Add parser", "def456 Fix tests"},
+		},
+	}, FormatDiscord)
+	if err != nil {
+		t.Fatalf("buildPayload: %v", err)
+	}
+
+	var got discordMessage
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	want := discordMessage{
+		Content: "**[proj]** 2 new commits pushed",
+		Embeds: []discordEmbed{{
+			Title:     "commits_pushed",
+			Timestamp: "2025-06-15T10:00:00Z",
+			Fields: []discordField{
+				{Name: "Project", Value: "proj", Inline: true},
+				{Name: "Event", Value: "`commits_pushed`", Inline: true},
+				{Name: "Agent", Value: "agent-2 (tester)", Inline: true},
+				{Name: "commits", Value: "abc123 Add parser\ndef456 Fix tests"},
+				{Name: "count", Value: "2"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discord payload =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDiscordPayload_Truncation(t *testing.T) {
+	long := strings.Repeat("é", discordFieldLimit+10)
+	msg := discordPayload(Event{Type: EventTestFailure, Project: "proj", Details: map[string]interface{}{"output": long}})
+
+	var value string
+	for _, f := range msg.Embeds[0].Fields {
+		if f.Name == "output" {
+			value = f.Value
+		}
+	}
+	if !utf8.ValidString(value) {
+		t.Errorf("truncated value is not valid UTF-8: %q", value)
+	}
+	if n := utf8.RuneCountInString(value); n != discordFieldLimit {
+		t.Errorf("truncated value has %d characters, want %d", n, discordFieldLimit)
+	}
+	if !strings.HasSuffix(value, "...") {
+		t.Errorf("truncated value = %q, want a trailing ellipsis", value)
+	}
+}
+
+func TestSendWithOptions_Signature(t *testing.T) {
+	const secret = "s3cret"
+
+	t.Run("signs body when secret is set", func(t *testing.T) {
+		var body []byte
+		var signature string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+		}))
+		defer srv.Close()
+
+		err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed, Project: "proj"}, Options{SigningSecret: secret})
+		if err != nil {
+			t.Fatalf("SendWithOptions: %v", err)
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if signature != want {
+			t.Errorf("%s = %q, want %q", SignatureHeader, signature, want)
+		}
+	})
+
+	t.Run("omits header without secret", func(t *testing.T) {
+		signature := "unset"
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signature = r.Header.Get(SignatureHeader)
+		}))
+		defer srv.Close()
+
+		if err := Send(srv.URL, Event{Type: EventAgentCrashed}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if signature != "" {
+			t.Errorf("%s = %q, want empty", SignatureHeader, signature)
+		}
+	})
+}
+
+func TestSendWithOptions_Headers(t *testing.T) {
+	t.Run("sends custom headers and keeps JSON content type", func(t *testing.T) {
+		var got http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+		}))
+		defer srv.Close()
+
+		opts := Options{Headers: map[string]string{
+			"Authorization": "Bearer token123",
+			"X-Team":        "platform",
+		}}
+		if err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed}, opts); err != nil {
+			t.Fatalf("SendWithOptions: %v", err)
+		}
+
+		if got.Get("Authorization") != "Bearer token123" {
+			t.Errorf("Authorization = %q", got.Get("Authorization"))
+		}
+		if got.Get("X-Team") != "platform" {
+			t.Errorf("X-Team = %q", got.Get("X-Team"))
+		}
+		if got.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got.Get("Content-Type"))
+		}
+	})
+
+	t.Run("explicit Content-Type overrides the default", func(t *testing.T) {
+		var contentType string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+		}))
+		defer srv.Close()
+
+		opts := Options{Headers: map[string]string{"content-type": "application/vnd.custom+json"}}
+		if err := SendWithOptions(srv.URL, Event{Type: EventAgentCrashed}, opts); err != nil {
+			t.Fatalf("SendWithOptions: %v", err)
+		}
+		if contentType != "application/vnd.custom+json" {
+			t.Errorf("Content-Type = %q", contentType)
+		}
+	})
+}
+
+// recordingNotifier records the events it is sent and fails with err.
+type recordingNotifier struct {
+	events []Event
+	err    error
+}
+
+func (n *recordingNotifier) Send(event Event) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func TestMultiNotifier(t *testing.T) {
+	failing := &recordingNotifier{err: io.ErrClosedPipe}
+	ok := &recordingNotifier{}
+	m := MultiNotifier{failing, ok}
+
+	err := m.Send(Event{Type: EventAgentCrashed})
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("err = %v, want the failing notifier's error", err)
+	}
+	if len(failing.events) != 1 || len(ok.events) != 1 {
+		t.Errorf("got %d and %d events, want every notifier to be sent the event despite a failure", len(failing.events), len(ok.events))
+	}
+}
@@ -3,21 +3,41 @@ package tasks
 import (
 	"bytes"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const lockDir = "current_tasks"
-
 // TaskLock represents a claimed task.
 type TaskLock struct {
 	Name      string
 	AgentID   int
 	ClaimedAt time.Time
+	Priority  int // copied from the task's .task file when claimed (0 if none)
+
+	// Description is what the agent is doing, from the lock's optional
+	// second line.
+	Description string
+}
+
+// ValidateTaskName reports whether name can be used as a task name. The name
+// becomes a file name under the lock dir, so it must not be empty or contain
+// path separators or "..".
+func ValidateTaskName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("tasks: task name must not be empty")
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("tasks: task name %q must not contain path separators", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("tasks: task name %q must not contain \"..\"", name)
+	}
+	return nil
 }
 
 // git runs a git command in the given directory, capturing stdout and stderr.
@@ -31,12 +51,62 @@ func git(dir string, args ...string) (string, string, error) {
 	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
 }
 
-// ClaimTask attempts to claim a task by creating a lock file and pushing.
-// Returns true if the claim succeeded, false if another agent got it first.
-func ClaimTask(repoDir string, taskName string, agentID int) (bool, error) {
+// claimRetryBase scales the randomized delay between claim retries.
+const claimRetryBase = 100 * time.Millisecond
+
+// ClaimTask attempts to claim a task by creating a lock file and pushing it
+// to the remote's default branch. Returns true if the claim succeeded, false
+// if another agent got it first. If the task has a .task file, its priority
+// is recorded in the lock. A non-empty description is written on the lock's
+// second line.
+//
+// A rejected push only means someone else pushed first; if the task is still
+// unlocked after pulling their commits, the claim is retried up to retries
+// times (tasks.claim_retries) after a short randomized backoff. It gives up
+// as soon as another agent's lock for the task appears.
+func ClaimTask(repoDir, lockDir, taskName string, agentID int, description string, retries int) (bool, error) {
+	if err := ValidateTaskName(taskName); err != nil {
+		return false, err
+	}
+	lockFile := filepath.Join(repoDir, lockDir, taskName+".lock")
+	for attempt := 0; ; attempt++ {
+		claimed, err := claimOnce(repoDir, lockDir, taskName, agentID, description)
+		if err != nil || claimed {
+			return claimed, err
+		}
+		if _, err := os.Stat(lockFile); err == nil {
+			return false, nil // taken by another agent
+		}
+		if attempt >= retries {
+			return false, nil
+		}
+		time.Sleep(claimRetryDelay(attempt))
+	}
+}
+
+// claimRetryDelay returns a randomized delay before retry attempt+1, so
+// agents that lost the same race don't push in lockstep again.
+func claimRetryDelay(attempt int) time.Duration {
+	return time.Duration(attempt+1)*claimRetryBase/2 + rand.N(claimRetryBase)
+}
+
+// claimOnce makes a single claim attempt. On a rejected push it rolls back
+// and syncs with the remote, then returns false.
+func claimOnce(repoDir, lockDir, taskName string, agentID int, description string) (bool, error) {
 	lockFile := filepath.Join(repoDir, lockDir, taskName+".lock")
 	content := fmt.Sprintf("agent-%d %s", agentID, time.Now().UTC().Format(time.RFC3339))
 
+	priority, err := taskPriority(repoDir, lockDir, taskName)
+	if err != nil {
+		return false, err
+	}
+	if priority != 0 {
+		content += " " + strconv.Itoa(priority)
+	}
+	if description = strings.Join(strings.Fields(description), " "); description != "" {
+		content += "\n" + description + "\n"
+	}
+
 	if err := os.MkdirAll(filepath.Dir(lockFile), 0755); err != nil {
 		return false, fmt.Errorf("tasks: failed to create lock dir: %w", err)
 	}
@@ -54,7 +124,11 @@ func ClaimTask(repoDir string, taskName string, agentID int) (bool, error) {
 		return false, fmt.Errorf("tasks: failed to commit lock file: %w", err)
 	}
 
-	_, stderr, err := git(repoDir, "push")
+	branch, err := defaultBranch(repoDir)
+	if err != nil {
+		return false, err
+	}
+	_, stderr, err := git(repoDir, "push", "origin", "HEAD:"+branch)
 	if err != nil {
 		// Check if this is a push rejection (another agent won the race).
 		if strings.Contains(stderr, "rejected") || strings.Contains(stderr, "conflict") {
@@ -62,7 +136,15 @@ func ClaimTask(repoDir string, taskName string, agentID int) (bool, error) {
 			_ = os.Remove(lockFile)
 			_, _, _ = git(repoDir, "checkout", "--", lockDir+"/")
 			_, _, _ = git(repoDir, "reset", "--hard", "HEAD~1")
-			_, _, _ = git(repoDir, "pull", "--rebase", "origin", "HEAD")
+
+			// Sync with the branch the locks live on, which need not be
+			// the one we're on (e.g. an agent-N branch).
+			if _, stderr, err := git(repoDir, "pull", "--rebase", "origin", branch); err != nil {
+				return false, fmt.Errorf("tasks: failed to pull %s after losing claim: %w: %s", branch, err, stderr)
+			}
+			if status, _, err := git(repoDir, "status", "--porcelain"); err != nil || status != "" {
+				return false, fmt.Errorf("tasks: working tree not clean after losing claim for %q", taskName)
+			}
 			return false, nil
 		}
 		return false, fmt.Errorf("tasks: failed to push lock file: %w", err)
@@ -72,7 +154,7 @@ func ClaimTask(repoDir string, taskName string, agentID int) (bool, error) {
 }
 
 // ReleaseTask removes a task lock, verifying this agent owns it.
-func ReleaseTask(repoDir string, taskName string, agentID int) error {
+func ReleaseTask(repoDir, lockDir, taskName string, agentID int) error {
 	lockFile := filepath.Join(repoDir, lockDir, taskName+".lock")
 
 	data, err := os.ReadFile(lockFile)
@@ -85,6 +167,35 @@ func ReleaseTask(repoDir string, taskName string, agentID int) error {
 		return fmt.Errorf("tasks: lock for %q is not owned by agent-%d", taskName, agentID)
 	}
 
+	msg := fmt.Sprintf("release task %s from agent-%d", taskName, agentID)
+	return removeLock(repoDir, lockDir, taskName, msg)
+}
+
+// ForceReleaseTask removes a task lock regardless of which agent holds it,
+// for operators freeing a stuck lock. Returns the lock that was released.
+func ForceReleaseTask(repoDir, lockDir, taskName string) (TaskLock, error) {
+	lockName := taskName + ".lock"
+	data, err := os.ReadFile(filepath.Join(repoDir, lockDir, lockName))
+	if err != nil {
+		return TaskLock{}, fmt.Errorf("tasks: failed to read lock file: %w", err)
+	}
+
+	lock, err := parseLock(lockName, string(data))
+	if err != nil {
+		return TaskLock{}, err
+	}
+
+	msg := fmt.Sprintf("force release task %s from agent-%d", taskName, lock.AgentID)
+	if err := removeLock(repoDir, lockDir, taskName, msg); err != nil {
+		return TaskLock{}, err
+	}
+	return lock, nil
+}
+
+// removeLock deletes a task's lock file, commits the removal with msg and pushes.
+func removeLock(repoDir, lockDir, taskName, msg string) error {
+	lockFile := filepath.Join(repoDir, lockDir, taskName+".lock")
+
 	if err := os.Remove(lockFile); err != nil {
 		return fmt.Errorf("tasks: failed to remove lock file: %w", err)
 	}
@@ -93,20 +204,39 @@ func ReleaseTask(repoDir string, taskName string, agentID int) error {
 		return fmt.Errorf("tasks: failed to stage lock removal: %w", err)
 	}
 
-	msg := fmt.Sprintf("release task %s from agent-%d", taskName, agentID)
 	if _, _, err := git(repoDir, "commit", "-m", msg); err != nil {
 		return fmt.Errorf("tasks: failed to commit lock removal: %w", err)
 	}
 
-	if _, _, err := git(repoDir, "push"); err != nil {
+	branch, err := defaultBranch(repoDir)
+	if err != nil {
+		return err
+	}
+	if _, _, err := git(repoDir, "push", "origin", "HEAD:"+branch); err != nil {
 		return fmt.Errorf("tasks: failed to push lock removal: %w", err)
 	}
 
 	return nil
 }
 
-// ListTasks reads all .lock files in current_tasks/ and returns parsed TaskLocks.
-func ListTasks(projectDir string) ([]TaskLock, error) {
+// defaultBranch returns the branch the remote's HEAD points at. Lock commits
+// are always pushed there, whatever branch repoDir has checked out, so that
+// with git.branch_per_agent every agent still sees every lock.
+func defaultBranch(repoDir string) (string, error) {
+	out, stderr, err := git(repoDir, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("tasks: failed to detect the default branch: %w: %s", err, stderr)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if ref, ok := strings.CutPrefix(line, "ref: refs/heads/"); ok {
+			return strings.TrimSuffix(ref, "\tHEAD"), nil
+		}
+	}
+	return "", fmt.Errorf("tasks: failed to detect the default branch: origin has no HEAD")
+}
+
+// ListTasks reads all .lock files in lockDir and returns parsed TaskLocks.
+func ListTasks(projectDir, lockDir string) ([]TaskLock, error) {
 	dir := filepath.Join(projectDir, lockDir)
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -136,9 +266,149 @@ func ListTasks(projectDir string) ([]TaskLock, error) {
 	return locks, nil
 }
 
+// ListCommittedTasks returns the task locks committed at HEAD in repoPath.
+// Unlike ListTasks it needs no checkout, so it works on the bare upstream
+// the daemon watches. A repository without commits has no locks.
+func ListCommittedTasks(repoPath, lockDir string) ([]TaskLock, error) {
+	if _, _, err := git(repoPath, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		return nil, nil
+	}
+
+	out, stderr, err := git(repoPath, "ls-tree", "-z", "HEAD", "--", lockDir+"/")
+	if err != nil {
+		return nil, fmt.Errorf("tasks: failed to list %s: %w: %s", lockDir, err, stderr)
+	}
+
+	var locks []TaskLock
+	for _, entry := range strings.Split(out, "\x00") {
+		// Each entry is "<mode> <type> <object>\t<path>".
+		meta, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || !strings.HasSuffix(path, ".lock") {
+			continue
+		}
+		data, stderr, err := git(repoPath, "cat-file", "blob", fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("tasks: failed to read %s: %w: %s", path, err, stderr)
+		}
+
+		lock, err := parseLock(filepath.Base(path), data)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, nil
+}
+
+// ListAvailableTasks returns the names of queued tasks that are not claimed,
+// highest priority first (ties broken by name). A task is queued by a
+// <lockDir>/<name>.task file whose content is its integer priority; an
+// empty file means priority 0. Delete the .task file once the task is done.
+func ListAvailableTasks(projectDir, lockDir string) ([]string, error) {
+	dir := filepath.Join(projectDir, lockDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tasks: failed to read lock dir: %w", err)
+	}
+
+	claimed := make(map[string]bool)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".lock") {
+			claimed[strings.TrimSuffix(e.Name(), ".lock")] = true
+		}
+	}
+
+	priorities := make(map[string]int)
+	var names []string
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".task") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".task")
+		if claimed[name] {
+			continue
+		}
+		priority, err := taskPriority(projectDir, lockDir, name)
+		if err != nil {
+			return nil, err
+		}
+		priorities[name] = priority
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if priorities[names[i]] != priorities[names[j]] {
+			return priorities[names[i]] > priorities[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names, nil
+}
+
+// ClaimNextTask claims the highest-priority available task for the agent,
+// falling back to the next one whenever another agent wins the race.
+// Returns the claimed task name, or "" if there was nothing left to claim.
+// Each claim is retried as in ClaimTask.
+func ClaimNextTask(repoDir, lockDir string, agentID, retries int) (string, error) {
+	tried := make(map[string]bool)
+	for {
+		available, err := ListAvailableTasks(repoDir, lockDir)
+		if err != nil {
+			return "", err
+		}
+
+		next := ""
+		for _, name := range available {
+			if !tried[name] {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			return "", nil
+		}
+		tried[next] = true
+
+		claimed, err := ClaimTask(repoDir, lockDir, next, agentID, "", retries)
+		if err != nil {
+			return "", err
+		}
+		if claimed {
+			return next, nil
+		}
+	}
+}
+
+// taskPriority reads the priority from a task's .task file. Missing or
+// empty files have priority 0.
+func taskPriority(projectDir, lockDir, taskName string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, lockDir, taskName+".task"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("tasks: failed to read %s.task: %w", taskName, err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return 0, nil
+	}
+	priority, err := strconv.Atoi(content)
+	if err != nil {
+		return 0, fmt.Errorf("tasks: invalid priority in %s.task: %w", taskName, err)
+	}
+	return priority, nil
+}
+
 // ClearStaleTasks removes lock files older than maxAge. Does not git commit —
 // the caller decides whether to commit. Returns names of cleared tasks.
-func ClearStaleTasks(projectDir string, maxAge time.Duration) ([]string, error) {
+func ClearStaleTasks(projectDir, lockDir string, maxAge time.Duration) ([]string, error) {
 	dir := filepath.Join(projectDir, lockDir)
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -177,11 +447,14 @@ func ClearStaleTasks(projectDir string, maxAge time.Duration) ([]string, error)
 }
 
 // parseLock parses a lock filename and its content into a TaskLock.
+// Content is "agent-{id} {timestamp}" with an optional trailing priority,
+// optionally followed by a description on the next line.
 func parseLock(filename, content string) (TaskLock, error) {
 	name := strings.TrimSuffix(filename, ".lock")
 
-	parts := strings.SplitN(strings.TrimSpace(content), " ", 2)
-	if len(parts) != 2 {
+	header, rest, _ := strings.Cut(content, "\n")
+	parts := strings.Fields(header)
+	if len(parts) != 2 && len(parts) != 3 {
 		return TaskLock{}, fmt.Errorf("tasks: malformed lock file %s", filename)
 	}
 
@@ -196,9 +469,19 @@ func parseLock(filename, content string) (TaskLock, error) {
 		return TaskLock{}, fmt.Errorf("tasks: invalid timestamp in %s: %w", filename, err)
 	}
 
+	priority := 0
+	if len(parts) == 3 {
+		priority, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return TaskLock{}, fmt.Errorf("tasks: invalid priority in %s: %w", filename, err)
+		}
+	}
+
 	return TaskLock{
-		Name:      name,
-		AgentID:   agentID,
-		ClaimedAt: claimedAt,
+		Name:        name,
+		AgentID:     agentID,
+		ClaimedAt:   claimedAt,
+		Priority:    priority,
+		Description: strings.Join(strings.Fields(rest), " "),
 	}, nil
 }
@@ -9,11 +9,22 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/robmorgan/metamorph/internal/config"
 )
 
+// lockDir is the default tasks.lock_dir.
+const lockDir = "current_tasks"
+
 // setupRepo creates a bare upstream repo seeded with current_tasks/.gitkeep,
 // and returns the upstream path plus a helper to clone agent worktrees.
 func setupRepo(t *testing.T) (upstreamPath string, cloneAgent func(agentID int) string) {
+	t.Helper()
+	return setupRepoWithLockDir(t, lockDir)
+}
+
+// setupRepoWithLockDir is setupRepo with the lock dir seeded at dir.
+func setupRepoWithLockDir(t *testing.T, dir string) (upstreamPath string, cloneAgent func(agentID int) string) {
 	t.Helper()
 	base := t.TempDir()
 	upstreamPath = filepath.Join(base, "upstream.git")
@@ -31,7 +42,7 @@ func setupRepo(t *testing.T) (upstreamPath string, cloneAgent func(agentID int)
 	_, _, _ = git(seedDir, "config", "user.name", "setup")
 	_, _, _ = git(seedDir, "config", "user.email", "setup@test")
 
-	taskDir := filepath.Join(seedDir, lockDir)
+	taskDir := filepath.Join(seedDir, dir)
 	_ = os.MkdirAll(taskDir, 0755)
 	_ = os.WriteFile(filepath.Join(taskDir, ".gitkeep"), []byte(""), 0644)
 	_, _, _ = git(seedDir, "add", ".")
@@ -60,7 +71,7 @@ func TestClaimTask(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		claimed, err := ClaimTask(repo, "fix-bug", 1)
+		claimed, err := ClaimTask(repo, lockDir, "fix-bug", 1, "", config.DefaultClaimRetries)
 		if err != nil {
 			t.Fatalf("ClaimTask: %v", err)
 		}
@@ -85,6 +96,27 @@ func TestClaimTask(t *testing.T) {
 		}
 	})
 
+	t.Run("with a description", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+		repo := cloneAgent(1)
+
+		if _, err := ClaimTask(repo, lockDir, "fix-bug", 1, "  chasing the\nflaky parser test ", config.DefaultClaimRetries); err != nil {
+			t.Fatalf("ClaimTask: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(repo, lockDir, "fix-bug.lock"))
+		if err != nil {
+			t.Fatalf("read lock file: %v", err)
+		}
+		lock, err := parseLock("fix-bug.lock", string(data))
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.AgentID != 1 || lock.Description != "chasing the flaky parser test" {
+			t.Errorf("lock = %+v, want agent 1 with the description on one line", lock)
+		}
+	})
+
 	t.Run("race condition: exactly one winner", func(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 
@@ -92,13 +124,13 @@ func TestClaimTask(t *testing.T) {
 		repo2 := cloneAgent(2)
 
 		// Agent 1 claims first.
-		claimed1, err1 := ClaimTask(repo1, "shared-task", 1)
+		claimed1, err1 := ClaimTask(repo1, lockDir, "shared-task", 1, "", config.DefaultClaimRetries)
 		if err1 != nil {
 			t.Fatalf("agent-1 ClaimTask: %v", err1)
 		}
 
 		// Agent 2 tries to claim the same task — push should be rejected.
-		claimed2, err2 := ClaimTask(repo2, "shared-task", 2)
+		claimed2, err2 := ClaimTask(repo2, lockDir, "shared-task", 2, "", config.DefaultClaimRetries)
 		if err2 != nil {
 			t.Fatalf("agent-2 ClaimTask: %v", err2)
 		}
@@ -114,6 +146,153 @@ func TestClaimTask(t *testing.T) {
 		}
 	})
 
+	t.Run("losing claimant on a non-default branch ends up clean and synced", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+
+		// Agents work on "develop", which is not the upstream's HEAD.
+		seed := cloneAgent(0)
+		if _, _, err := git(seed, "push", "origin", "HEAD:refs/heads/develop"); err != nil {
+			t.Fatalf("push develop: %v", err)
+		}
+		repo1 := cloneAgent(1)
+		repo2 := cloneAgent(2)
+		for _, repo := range []string{repo1, repo2} {
+			if _, stderr, err := git(repo, "checkout", "develop"); err != nil {
+				t.Fatalf("checkout develop: %v: %s", err, stderr)
+			}
+		}
+
+		if claimed, err := ClaimTask(repo1, lockDir, "shared-task", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+		claimed, err := ClaimTask(repo2, lockDir, "shared-task", 2, "", config.DefaultClaimRetries)
+		if err != nil {
+			t.Fatalf("agent-2 ClaimTask: %v", err)
+		}
+		if claimed {
+			t.Fatal("expected agent-2 to lose the claim")
+		}
+
+		if branch, _, _ := git(repo2, "rev-parse", "--abbrev-ref", "HEAD"); branch != "develop" {
+			t.Errorf("agent-2 branch = %q, want develop", branch)
+		}
+		if status, _, _ := git(repo2, "status", "--porcelain"); status != "" {
+			t.Errorf("agent-2 working tree not clean:\n%s", status)
+		}
+		data, err := os.ReadFile(filepath.Join(repo2, lockDir, "shared-task.lock"))
+		if err != nil {
+			t.Fatalf("expected agent-1's lock after sync: %v", err)
+		}
+		if !strings.HasPrefix(string(data), "agent-1 ") {
+			t.Errorf("lock content = %q, want agent-1's lock", data)
+		}
+	})
+
+	t.Run("losing claimant on an agent branch missing upstream ends up clean", func(t *testing.T) {
+		upstreamPath, cloneAgent := setupRepo(t)
+		repo1 := cloneAgent(1)
+		repo2 := cloneAgent(2)
+
+		// agent-2 has never pushed its branch, so origin has no agent-2 to
+		// pull from when it rolls back.
+		if _, stderr, err := git(repo2, "checkout", "-b", "agent-2"); err != nil {
+			t.Fatalf("checkout agent branch: %v: %s", err, stderr)
+		}
+
+		if claimed, err := ClaimTask(repo1, lockDir, "shared-task", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+		claimed, err := ClaimTask(repo2, lockDir, "shared-task", 2, "", 0)
+		if err != nil {
+			t.Fatalf("agent-2 ClaimTask: %v", err)
+		}
+		if claimed {
+			t.Fatal("expected agent-2 to lose the claim")
+		}
+
+		if _, _, err := git(upstreamPath, "rev-parse", "--verify", "-q", "agent-2"); err == nil {
+			t.Error("rollback pushed an agent-2 branch upstream")
+		}
+		if branch, _, _ := git(repo2, "rev-parse", "--abbrev-ref", "HEAD"); branch != "agent-2" {
+			t.Errorf("agent-2 branch = %q, want agent-2", branch)
+		}
+		if status, _, _ := git(repo2, "status", "--porcelain"); status != "" {
+			t.Errorf("agent-2 working tree not clean:\n%s", status)
+		}
+		data, err := os.ReadFile(filepath.Join(repo2, lockDir, "shared-task.lock"))
+		if err != nil || !strings.HasPrefix(string(data), "agent-1 ") {
+			t.Errorf("lock = %q, %v; want agent-1's lock synced from the default branch", data, err)
+		}
+	})
+
+	t.Run("agent branches push locks to the default branch", func(t *testing.T) {
+		upstreamPath, cloneAgent := setupRepo(t)
+		repo1 := cloneAgent(1)
+		repo2 := cloneAgent(2)
+		for i, repo := range []string{repo1, repo2} {
+			if _, stderr, err := git(repo, "checkout", "-b", fmt.Sprintf("agent-%d", i+1)); err != nil {
+				t.Fatalf("checkout agent branch: %v: %s", err, stderr)
+			}
+		}
+
+		if claimed, err := ClaimTask(repo1, lockDir, "shared-task", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+		if _, stderr, err := git(upstreamPath, "cat-file", "-e", "HEAD:"+lockDir+"/shared-task.lock"); err != nil {
+			t.Fatalf("lock not on the upstream's default branch: %v: %s", err, stderr)
+		}
+		if _, _, err := git(upstreamPath, "rev-parse", "--verify", "-q", "agent-1"); err == nil {
+			t.Error("claim pushed an agent-1 branch upstream, want only the default branch")
+		}
+
+		claimed, err := ClaimTask(repo2, lockDir, "shared-task", 2, "", config.DefaultClaimRetries)
+		if err != nil {
+			t.Fatalf("agent-2 ClaimTask: %v", err)
+		}
+		if claimed {
+			t.Fatal("expected agent-2 to see agent-1's lock and lose")
+		}
+		if branch, _, _ := git(repo2, "rev-parse", "--abbrev-ref", "HEAD"); branch != "agent-2" {
+			t.Errorf("agent-2 branch = %q, want agent-2", branch)
+		}
+
+		if err := ReleaseTask(repo1, lockDir, "shared-task", 1); err != nil {
+			t.Fatalf("ReleaseTask: %v", err)
+		}
+		if _, _, err := git(upstreamPath, "cat-file", "-e", "HEAD:"+lockDir+"/shared-task.lock"); err == nil {
+			t.Error("lock still on the upstream's default branch after release")
+		}
+	})
+
+	t.Run("claims and rollbacks work in shallow clones", func(t *testing.T) {
+		upstreamPath, _ := setupRepo(t)
+
+		shallowClone := func(agentID int) string {
+			dir := filepath.Join(t.TempDir(), fmt.Sprintf("agent-%d", agentID))
+			if _, stderr, err := git(filepath.Dir(dir), "clone", "--depth", "1", "file://"+upstreamPath, dir); err != nil {
+				t.Fatalf("shallow clone: %v: %s", err, stderr)
+			}
+			_, _, _ = git(dir, "config", "user.name", fmt.Sprintf("agent-%d", agentID))
+			_, _, _ = git(dir, "config", "user.email", fmt.Sprintf("agent-%d@test", agentID))
+			return dir
+		}
+		repo1, repo2 := shallowClone(1), shallowClone(2)
+
+		if claimed, err := ClaimTask(repo1, lockDir, "shallow-task", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+		claimed, err := ClaimTask(repo2, lockDir, "shallow-task", 2, "", config.DefaultClaimRetries)
+		if err != nil {
+			t.Fatalf("agent-2 ClaimTask: %v", err)
+		}
+		if claimed {
+			t.Fatal("expected agent-2 to lose the claim")
+		}
+		if _, err := os.Stat(filepath.Join(repo2, lockDir, "shallow-task.lock")); err != nil {
+			t.Errorf("expected agent-1's lock in agent-2's clone after rollback: %v", err)
+		}
+	})
+
 	t.Run("concurrent claim: exactly one winner among 5 agents", func(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 
@@ -133,7 +312,7 @@ func TestClaimTask(t *testing.T) {
 		for i := 0; i < numAgents; i++ {
 			go func(agentID int, repo string) {
 				defer wg.Done()
-				claimed, err := ClaimTask(repo, "contested-task", agentID)
+				claimed, err := ClaimTask(repo, lockDir, "contested-task", agentID, "", config.DefaultClaimRetries)
 				if err != nil {
 					atomic.AddInt32(&errCount, 1)
 					return
@@ -151,17 +330,112 @@ func TestClaimTask(t *testing.T) {
 	})
 }
 
+func TestValidateTaskName(t *testing.T) {
+	for _, name := range []string{"add-login", "fix_bug.v2", "task-1"} {
+		if err := ValidateTaskName(name); err != nil {
+			t.Errorf("ValidateTaskName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", "  ", "../escape", "a/b", `a\b`, "..", "a..b"} {
+		if err := ValidateTaskName(name); err == nil {
+			t.Errorf("ValidateTaskName(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestClaimTask_InvalidName(t *testing.T) {
+	_, cloneAgent := setupRepo(t)
+	repo := cloneAgent(1)
+
+	claimed, err := ClaimTask(repo, lockDir, "../outside", 1, "", config.DefaultClaimRetries)
+	if err == nil || claimed {
+		t.Fatalf("ClaimTask = %v, %v; want an invalid name error", claimed, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "outside.lock")); !os.IsNotExist(err) {
+		t.Error("no lock file should be written outside the lock dir")
+	}
+}
+
+func TestClaimTaskRetries(t *testing.T) {
+	t.Run("retries a lost race while the task is still free", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+		repo1 := cloneAgent(1)
+		repo2 := cloneAgent(2)
+
+		// Agent 1's claim of another task makes agent 2's first push stale.
+		if claimed, err := ClaimTask(repo1, lockDir, "task-a", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+
+		claimed, err := ClaimTask(repo2, lockDir, "task-b", 2, "", 1)
+		if err != nil {
+			t.Fatalf("agent-2 ClaimTask: %v", err)
+		}
+		if !claimed {
+			t.Fatal("expected agent-2 to claim task-b on retry")
+		}
+		data, err := os.ReadFile(filepath.Join(repo2, lockDir, "task-b.lock"))
+		if err != nil || !strings.HasPrefix(string(data), "agent-2 ") {
+			t.Errorf("task-b lock = %q, %v; want agent-2's lock", data, err)
+		}
+	})
+
+	t.Run("no retries gives up on the first lost race", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+		repo1 := cloneAgent(1)
+		repo2 := cloneAgent(2)
+
+		if claimed, err := ClaimTask(repo1, lockDir, "task-a", 1, "", config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("agent-1 ClaimTask = %v, %v; want a successful claim", claimed, err)
+		}
+		claimed, err := ClaimTask(repo2, lockDir, "task-b", 2, "", 0)
+		if err != nil || claimed {
+			t.Errorf("agent-2 ClaimTask = %v, %v; want a lost claim without retries", claimed, err)
+		}
+	})
+
+	t.Run("concurrent claims of different tasks all succeed", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+
+		const numAgents = 5
+		repos := make([]string, numAgents)
+		for i := 0; i < numAgents; i++ {
+			repos[i] = cloneAgent(i + 1)
+		}
+
+		// Every rejected push means another agent's claim landed, so each
+		// agent loses at most numAgents-1 races.
+		var wg sync.WaitGroup
+		results := make([]bool, numAgents)
+		errs := make([]error, numAgents)
+		wg.Add(numAgents)
+		for i := 0; i < numAgents; i++ {
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = ClaimTask(repos[i], lockDir, fmt.Sprintf("task-%d", i+1), i+1, "", numAgents-1)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range numAgents {
+			if errs[i] != nil || !results[i] {
+				t.Errorf("agent-%d claim = %v, %v; want success", i+1, results[i], errs[i])
+			}
+		}
+	})
+}
+
 func TestReleaseTask(t *testing.T) {
 	t.Run("owner can release", func(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		claimed, err := ClaimTask(repo, "my-task", 1)
+		claimed, err := ClaimTask(repo, lockDir, "my-task", 1, "", config.DefaultClaimRetries)
 		if err != nil || !claimed {
 			t.Fatalf("ClaimTask: claimed=%v, err=%v", claimed, err)
 		}
 
-		if err := ReleaseTask(repo, "my-task", 1); err != nil {
+		if err := ReleaseTask(repo, lockDir, "my-task", 1); err != nil {
 			t.Fatalf("ReleaseTask: %v", err)
 		}
 
@@ -176,13 +450,13 @@ func TestReleaseTask(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		claimed, err := ClaimTask(repo, "guarded-task", 1)
+		claimed, err := ClaimTask(repo, lockDir, "guarded-task", 1, "", config.DefaultClaimRetries)
 		if err != nil || !claimed {
 			t.Fatalf("ClaimTask: claimed=%v, err=%v", claimed, err)
 		}
 
 		// Agent 2 tries to release agent 1's lock.
-		err = ReleaseTask(repo, "guarded-task", 2)
+		err = ReleaseTask(repo, lockDir, "guarded-task", 2)
 		if err == nil {
 			t.Fatal("expected error when non-owner tries to release")
 		}
@@ -195,19 +469,61 @@ func TestReleaseTask(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		err := ReleaseTask(repo, "no-such-task", 1)
+		err := ReleaseTask(repo, lockDir, "no-such-task", 1)
 		if err == nil {
 			t.Fatal("expected error for nonexistent task")
 		}
 	})
 }
 
+func TestForceReleaseTask(t *testing.T) {
+	t.Run("releases another agent's lock", func(t *testing.T) {
+		upstreamPath, cloneAgent := setupRepo(t)
+		owner := cloneAgent(1)
+
+		claimed, err := ClaimTask(owner, lockDir, "stuck-task", 1, "", config.DefaultClaimRetries)
+		if err != nil || !claimed {
+			t.Fatalf("ClaimTask: claimed=%v, err=%v", claimed, err)
+		}
+
+		// An operator with a separate clone frees the lock.
+		admin := cloneAgent(99)
+		lock, err := ForceReleaseTask(admin, lockDir, "stuck-task")
+		if err != nil {
+			t.Fatalf("ForceReleaseTask: %v", err)
+		}
+		if lock.AgentID != 1 {
+			t.Errorf("released lock AgentID = %d, want 1", lock.AgentID)
+		}
+
+		// The removal was pushed upstream.
+		verify := filepath.Join(t.TempDir(), "verify")
+		if _, _, err := git(filepath.Dir(verify), "clone", upstreamPath, verify); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(verify, lockDir, "stuck-task.lock")); !os.IsNotExist(err) {
+			t.Error("lock file should be removed upstream after forced release")
+		}
+		log, _, _ := git(verify, "log", "--oneline", "-1")
+		if !strings.Contains(log, "force release task stuck-task from agent-1") {
+			t.Errorf("commit message = %q", log)
+		}
+	})
+
+	t.Run("nonexistent task", func(t *testing.T) {
+		_, cloneAgent := setupRepo(t)
+		if _, err := ForceReleaseTask(cloneAgent(1), lockDir, "no-such-task"); err == nil {
+			t.Fatal("expected error for nonexistent task")
+		}
+	})
+}
+
 func TestListTasks(t *testing.T) {
 	t.Run("empty list", func(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		locks, err := ListTasks(repo)
+		locks, err := ListTasks(repo, lockDir)
 		if err != nil {
 			t.Fatalf("ListTasks: %v", err)
 		}
@@ -220,10 +536,10 @@ func TestListTasks(t *testing.T) {
 		_, cloneAgent := setupRepo(t)
 		repo := cloneAgent(1)
 
-		_, _ = ClaimTask(repo, "task-a", 1)
-		_, _ = ClaimTask(repo, "task-b", 1)
+		_, _ = ClaimTask(repo, lockDir, "task-a", 1, "", config.DefaultClaimRetries)
+		_, _ = ClaimTask(repo, lockDir, "task-b", 1, "", config.DefaultClaimRetries)
 
-		locks, err := ListTasks(repo)
+		locks, err := ListTasks(repo, lockDir)
 		if err != nil {
 			t.Fatalf("ListTasks: %v", err)
 		}
@@ -251,7 +567,7 @@ func TestListTasks(t *testing.T) {
 		repo := cloneAgent(1)
 
 		// .gitkeep already exists — should be ignored.
-		locks, err := ListTasks(repo)
+		locks, err := ListTasks(repo, lockDir)
 		if err != nil {
 			t.Fatalf("ListTasks: %v", err)
 		}
@@ -261,7 +577,7 @@ func TestListTasks(t *testing.T) {
 	})
 
 	t.Run("missing dir returns nil", func(t *testing.T) {
-		locks, err := ListTasks("/nonexistent/dir")
+		locks, err := ListTasks("/nonexistent/dir", lockDir)
 		if err != nil {
 			t.Fatalf("ListTasks: %v", err)
 		}
@@ -287,7 +603,7 @@ func TestListTasks(t *testing.T) {
 			0644,
 		)
 
-		locks, err := ListTasks(dir)
+		locks, err := ListTasks(dir, lockDir)
 		if err != nil {
 			t.Fatalf("ListTasks: %v", err)
 		}
@@ -315,6 +631,44 @@ func TestListTasks(t *testing.T) {
 	})
 }
 
+func TestListCommittedTasks(t *testing.T) {
+	upstreamPath, cloneAgent := setupRepo(t)
+	repo := cloneAgent(1)
+
+	locks, err := ListCommittedTasks(upstreamPath, lockDir)
+	if err != nil || len(locks) != 0 {
+		t.Fatalf("ListCommittedTasks before any claim = %+v, %v; want none", locks, err)
+	}
+
+	for _, name := range []string{"alpha", "beta"} {
+		if claimed, err := ClaimTask(repo, lockDir, name, 1, "working on "+name, config.DefaultClaimRetries); err != nil || !claimed {
+			t.Fatalf("ClaimTask(%s): claimed=%v, err=%v", name, claimed, err)
+		}
+	}
+	if err := ReleaseTask(repo, lockDir, "alpha", 1); err != nil {
+		t.Fatalf("ReleaseTask: %v", err)
+	}
+
+	locks, err = ListCommittedTasks(upstreamPath, lockDir)
+	if err != nil {
+		t.Fatalf("ListCommittedTasks: %v", err)
+	}
+	if len(locks) != 1 || locks[0].Name != "beta" || locks[0].AgentID != 1 || locks[0].Description != "working on beta" {
+		t.Errorf("locks = %+v, want beta held by agent-1", locks)
+	}
+
+	t.Run("repository without commits", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.git")
+		if _, _, err := git(filepath.Dir(empty), "init", "--bare", empty); err != nil {
+			t.Fatal(err)
+		}
+		locks, err := ListCommittedTasks(empty, lockDir)
+		if err != nil || len(locks) != 0 {
+			t.Errorf("ListCommittedTasks = %+v, %v; want none", locks, err)
+		}
+	})
+}
+
 func TestClearStaleTasks(t *testing.T) {
 	t.Run("clears old locks", func(t *testing.T) {
 		dir := t.TempDir()
@@ -337,7 +691,7 @@ func TestClearStaleTasks(t *testing.T) {
 			0644,
 		)
 
-		cleared, err := ClearStaleTasks(dir, 1*time.Hour)
+		cleared, err := ClearStaleTasks(dir, lockDir, 1*time.Hour)
 		if err != nil {
 			t.Fatalf("ClearStaleTasks: %v", err)
 		}
@@ -369,7 +723,7 @@ func TestClearStaleTasks(t *testing.T) {
 			0644,
 		)
 
-		cleared, err := ClearStaleTasks(dir, 1*time.Hour)
+		cleared, err := ClearStaleTasks(dir, lockDir, 1*time.Hour)
 		if err != nil {
 			t.Fatalf("ClearStaleTasks: %v", err)
 		}
@@ -379,7 +733,7 @@ func TestClearStaleTasks(t *testing.T) {
 	})
 
 	t.Run("missing dir returns nil", func(t *testing.T) {
-		cleared, err := ClearStaleTasks("/nonexistent/dir", time.Hour)
+		cleared, err := ClearStaleTasks("/nonexistent/dir", lockDir, time.Hour)
 		if err != nil {
 			t.Fatalf("ClearStaleTasks: %v", err)
 		}
@@ -411,7 +765,7 @@ func TestClearStaleTasks(t *testing.T) {
 			)
 		}
 
-		cleared, err := ClearStaleTasks(dir, 1*time.Hour)
+		cleared, err := ClearStaleTasks(dir, lockDir, 1*time.Hour)
 		if err != nil {
 			t.Fatalf("ClearStaleTasks: %v", err)
 		}
@@ -420,7 +774,7 @@ func TestClearStaleTasks(t *testing.T) {
 		}
 
 		// Verify new locks still exist.
-		remaining, _ := ListTasks(dir)
+		remaining, _ := ListTasks(dir, lockDir)
 		if len(remaining) != 2 {
 			t.Errorf("expected 2 remaining, got %d", len(remaining))
 		}
@@ -445,6 +799,63 @@ func TestParseLock(t *testing.T) {
 		}
 	})
 
+	t.Run("with priority", func(t *testing.T) {
+		lock, err := parseLock("urgent.lock", "agent-2 2025-06-15T10:30:00Z 5\n")
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.AgentID != 2 || lock.Priority != 5 {
+			t.Errorf("lock = %+v, want agent 2 priority 5", lock)
+		}
+	})
+
+	t.Run("missing priority defaults to zero", func(t *testing.T) {
+		lock, err := parseLock("fix-bug.lock", "agent-3 2025-06-15T10:30:00Z")
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.Priority != 0 {
+			t.Errorf("Priority = %d, want 0", lock.Priority)
+		}
+	})
+
+	t.Run("two-field lock has no description", func(t *testing.T) {
+		lock, err := parseLock("fix-bug.lock", "agent-3 2025-06-15T10:30:00Z\n")
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.Description != "" {
+			t.Errorf("Description = %q, want empty", lock.Description)
+		}
+	})
+
+	t.Run("with description", func(t *testing.T) {
+		lock, err := parseLock("fix-bug.lock", "agent-3 2025-06-15T10:30:00Z\nrewriting the tokenizer\n")
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.AgentID != 3 || lock.Priority != 0 || lock.Description != "rewriting the tokenizer" {
+			t.Errorf("lock = %+v, want agent 3 with description", lock)
+		}
+	})
+
+	t.Run("with priority and description", func(t *testing.T) {
+		lock, err := parseLock("urgent.lock", "agent-2 2025-06-15T10:30:00Z 5\nhotfix for login\n")
+		if err != nil {
+			t.Fatalf("parseLock: %v", err)
+		}
+		if lock.Priority != 5 || lock.Description != "hotfix for login" {
+			t.Errorf("lock = %+v, want priority 5 with description", lock)
+		}
+	})
+
+	t.Run("invalid priority", func(t *testing.T) {
+		_, err := parseLock("bad.lock", "agent-1 2025-06-15T10:30:00Z high")
+		if err == nil || !strings.Contains(err.Error(), "invalid priority") {
+			t.Errorf("expected invalid priority error, got %v", err)
+		}
+	})
+
 	t.Run("malformed content", func(t *testing.T) {
 		_, err := parseLock("bad.lock", "no-space-here")
 		if err == nil {
@@ -475,3 +886,141 @@ func TestParseLock(t *testing.T) {
 		}
 	})
 }
+
+func TestListAvailableTasks(t *testing.T) {
+	dir := t.TempDir()
+	taskDir := filepath.Join(dir, lockDir)
+	_ = os.MkdirAll(taskDir, 0755)
+
+	for name, content := range map[string]string{
+		"docs.task":    "",
+		"bugfix.task":  "10\n",
+		"feature.task": "5",
+		"alpha.task":   "5",
+		"claimed.task": "100",
+		"claimed.lock": "agent-1 2025-06-15T10:30:00Z 100",
+		".gitkeep":     "",
+	} {
+		if err := os.WriteFile(filepath.Join(taskDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ListAvailableTasks(dir, lockDir)
+	if err != nil {
+		t.Fatalf("ListAvailableTasks: %v", err)
+	}
+	want := []string{"bugfix", "alpha", "feature", "docs"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListAvailableTasks = %v, want %v", got, want)
+	}
+
+	t.Run("invalid priority", func(t *testing.T) {
+		_ = os.WriteFile(filepath.Join(taskDir, "bad.task"), []byte("soon"), 0644)
+		if _, err := ListAvailableTasks(dir, lockDir); err == nil {
+			t.Error("expected error for non-integer priority")
+		}
+	})
+
+	t.Run("missing dir", func(t *testing.T) {
+		got, err := ListAvailableTasks(t.TempDir(), lockDir)
+		if err != nil || len(got) != 0 {
+			t.Errorf("ListAvailableTasks = %v, %v; want empty", got, err)
+		}
+	})
+}
+
+func TestClaimNextTask(t *testing.T) {
+	_, cloneAgent := setupRepo(t)
+
+	// Queue two tasks via one agent and push them upstream.
+	seed := cloneAgent(9)
+	_ = os.WriteFile(filepath.Join(seed, lockDir, "low.task"), []byte("1"), 0644)
+	_ = os.WriteFile(filepath.Join(seed, lockDir, "high.task"), []byte("9"), 0644)
+	_, _, _ = git(seed, "add", ".")
+	_, _, _ = git(seed, "commit", "-m", "queue tasks")
+	if _, _, err := git(seed, "push"); err != nil {
+		t.Fatalf("push tasks: %v", err)
+	}
+
+	repo1 := cloneAgent(1)
+	repo2 := cloneAgent(2)
+
+	name, err := ClaimNextTask(repo1, lockDir, 1, config.DefaultClaimRetries)
+	if err != nil {
+		t.Fatalf("agent-1 ClaimNextTask: %v", err)
+	}
+	if name != "high" {
+		t.Errorf("agent-1 claimed %q, want high", name)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(repo1, lockDir, "high.lock"))
+	lock, err := parseLock("high.lock", string(data))
+	if err != nil || lock.Priority != 9 {
+		t.Errorf("lock = %+v (%v), want priority 9", lock, err)
+	}
+
+	// Agent 2's clone is stale: it loses the race for "high" and falls back.
+	name, err = ClaimNextTask(repo2, lockDir, 2, config.DefaultClaimRetries)
+	if err != nil {
+		t.Fatalf("agent-2 ClaimNextTask: %v", err)
+	}
+	if name != "low" {
+		t.Errorf("agent-2 claimed %q, want low", name)
+	}
+
+	name, err = ClaimNextTask(repo1, lockDir, 1, config.DefaultClaimRetries)
+	if err != nil {
+		t.Fatalf("ClaimNextTask with nothing left: %v", err)
+	}
+	if name != "" {
+		t.Errorf("claimed %q, want nothing", name)
+	}
+}
+
+func TestCustomLockDir(t *testing.T) {
+	const customDir = "work/locks"
+	_, cloneAgent := setupRepoWithLockDir(t, customDir)
+	repo1 := cloneAgent(1)
+	repo2 := cloneAgent(2)
+
+	// Queue a task in the custom dir and claim it.
+	_ = os.WriteFile(filepath.Join(repo1, customDir, "parser.task"), []byte("5"), 0644)
+	if _, _, err := git(repo1, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	_, _, _ = git(repo1, "commit", "-m", "queue parser")
+	_, _, _ = git(repo1, "push")
+
+	name, err := ClaimNextTask(repo1, customDir, 1, config.DefaultClaimRetries)
+	if err != nil || name != "parser" {
+		t.Fatalf("ClaimNextTask = %q, %v; want parser", name, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo1, customDir, "parser.lock")); err != nil {
+		t.Fatalf("lock not written to the custom dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo1, lockDir)); !os.IsNotExist(err) {
+		t.Errorf("default lock dir was created: %v", err)
+	}
+
+	// Another agent sees the claim in the custom dir only.
+	_, _, _ = git(repo2, "pull")
+	locks, err := ListTasks(repo2, customDir)
+	if err != nil || len(locks) != 1 || locks[0].Name != "parser" || locks[0].Priority != 5 {
+		t.Fatalf("ListTasks = %+v, %v; want the parser lock with priority 5", locks, err)
+	}
+	if locks, _ := ListTasks(repo2, lockDir); len(locks) != 0 {
+		t.Errorf("ListTasks(default dir) = %+v, want none", locks)
+	}
+
+	// Stale locks are cleared from the custom dir.
+	old := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339)
+	_ = os.WriteFile(filepath.Join(repo1, customDir, "parser.lock"), []byte("agent-1 "+old), 0644)
+	cleared, err := ClearStaleTasks(repo1, customDir, time.Hour)
+	if err != nil || len(cleared) != 1 || cleared[0] != "parser" {
+		t.Fatalf("ClearStaleTasks = %v, %v; want [parser]", cleared, err)
+	}
+	if locks, _ := ListTasks(repo1, customDir); len(locks) != 0 {
+		t.Errorf("locks left after clearing: %+v", locks)
+	}
+}